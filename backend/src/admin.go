@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetMigrations reports the current schema version and the state of
+// every embedded migration.
+func (s *server) handleGetMigrations(c *gin.Context) {
+	version, err := s.db.CurrentVersion(c)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read schema version: %v", err))
+		return
+	}
+
+	migrations, err := s.db.MigrationStatus(c)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read migration status: %v", err))
+		return
+	}
+
+	c.JSON(200, gin.H{"current_version": version, "migrations": migrations})
+}
+
+// handleMigrateUp applies pending migrations. With dryRun=true it only reports
+// what would be applied.
+func (s *server) handleMigrateUp(c *gin.Context) {
+	if c.Query("dryRun") == "true" {
+		pending, err := s.db.PendingMigrations(c)
+		if err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to read pending migrations: %v", err))
+			return
+		}
+		c.JSON(200, gin.H{"dry_run": true, "pending": pending})
+		return
+	}
+
+	results, err := s.db.MigrateUp(c)
+	if err != nil {
+		respondErrorDetails(c, CodeInternal, fmt.Sprintf("Failed to apply migrations: %v", err), gin.H{"applied": results})
+		return
+	}
+
+	requestLog(c).Warn("Migrations applied", "applied", len(results))
+	c.JSON(200, gin.H{"applied": results})
+}
+
+// handleMigrateDown rolls back the latest migration. The caller must confirm
+// the version being rolled back to guard against accidental data loss.
+func (s *server) handleMigrateDown(c *gin.Context) {
+	version, err := s.db.CurrentVersion(c)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read schema version: %v", err))
+		return
+	}
+
+	confirm, err := strconv.ParseInt(c.Query("confirm"), 10, 64)
+	if err != nil || confirm != version {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Rolling back migration %d requires confirm=%d", version, version))
+		return
+	}
+
+	result, err := s.db.MigrateDown(c)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to roll back migration: %v", err))
+		return
+	}
+
+	requestLog(c).Warn("Migration rolled back", "version", result.Version)
+	c.JSON(200, gin.H{"rolled_back": result})
+}
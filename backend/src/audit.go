@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maestro/src/database/schema"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAuditEntries bounds the entries returned by one audit query.
+const maxAuditEntries = 1000
+
+// auditLog records every mutating request with its user and outcome once it
+// has been handled, including requests rejected by authentication.
+func (s *server) auditLog(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	switch c.Request.Method {
+	case "GET", "HEAD", "OPTIONS":
+		return
+	}
+
+	user := currentUser(c)
+	if user.Name == "" {
+		user.Name = anonymousUser
+	}
+
+	// the request may be gone by now, the entry must still be written
+	err := s.db.Query.InsertAuditLog(context.Background(), schema.InsertAuditLogParams{
+		CreatedAt:  start.UTC(),
+		UserName:   user.Name,
+		Role:       string(user.Role),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Route:      c.FullPath(),
+		Status:     int64(c.Writer.Status()),
+		ClientIp:   c.ClientIP(),
+		RequestID:  c.Writer.Header().Get(requestIDHeader),
+		DurationMs: time.Since(start).Milliseconds(),
+	})
+	if err != nil {
+		requestLog(c).Error("Failed to write audit log", "error", err)
+	}
+}
+
+// handleGetAuditLog queries the audit log, most recent first. Entries can be
+// filtered by `user`, `method`, `path` prefix and an RFC 3339 `from`/`to`
+// range; `limit` defaults to 100.
+func (s *server) handleGetAuditLog(c *gin.Context) {
+	until := time.Now()
+	since := time.Time{}
+
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid from time: %s", raw))
+			return
+		}
+		since = parsed
+	}
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid to time: %s", raw))
+			return
+		}
+		until = parsed
+	}
+
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxAuditEntries {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid limit: %s, expected 1 to %d", raw, maxAuditEntries))
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := s.db.Query.ListAuditLog(c, schema.ListAuditLogParams{
+		UserName:   c.Query("user"),
+		Method:     c.Query("method"),
+		PathPrefix: c.Query("path"),
+		Since:      since.UTC(),
+		Until:      until.UTC(),
+		RowLimit:   int64(limit),
+	})
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to query audit log: %v", err))
+		return
+	}
+
+	c.JSON(200, entries)
+}
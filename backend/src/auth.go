@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Role grants access to a set of endpoints. Each role includes the rights of
+// the roles below it.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"   // list and read workspaces, runs and logs
+	RoleOperator Role = "operator" // also edit files, build, run and stop
+	RoleAdmin    Role = "admin"    // also delete workspaces and manage servers
+)
+
+var roleRanks = map[Role]int{RoleViewer: 1, RoleOperator: 2, RoleAdmin: 3}
+
+// allows reports whether r includes the rights of required.
+func (r Role) allows(required Role) bool {
+	return roleRanks[r] >= roleRanks[required]
+}
+
+// AuthConfig lists the API users and the role of requests without a token.
+type AuthConfig struct {
+	Users []User `yaml:"users"`
+
+	// AnonymousRole applies to requests without a bearer token. When empty,
+	// every endpoint requires a token.
+	AnonymousRole Role `yaml:"anonymousRole"`
+
+	// SigningKey authenticates signed download URLs. When empty, a random key
+	// is used and signed URLs stop working on restart.
+	SigningKey string `yaml:"signingKey"`
+
+	// OIDC lets users log in through an identity provider in addition to the
+	// configured users.
+	OIDC OIDCConfig `yaml:"oidc"`
+}
+
+// User is an API identity authenticated by a bearer token. Name identifies
+// the user, for single sign-on users it is their subject at the issuer and
+// DisplayName their user name there. Grant names the workspace a signed URL
+// may access whoever its owner, the one it was signed for.
+type User struct {
+	Name        string `yaml:"name" json:"name"`
+	DisplayName string `yaml:"-" json:"display_name,omitempty"`
+	Token       string `yaml:"token" json:"-"`
+	Role        Role   `yaml:"role" json:"role"`
+	Grant       string `yaml:"-" json:"-"`
+}
+
+const anonymousUser = "anonymous"
+
+// validateAuth checks that every configured role exists and that tokens are
+// set and unique.
+func validateAuth(cfg AuthConfig) error {
+	if cfg.AnonymousRole != "" && roleRanks[cfg.AnonymousRole] == 0 {
+		return fmt.Errorf("unknown anonymous role %q", cfg.AnonymousRole)
+	}
+
+	tokens := map[string]bool{}
+	for _, user := range cfg.Users {
+		if roleRanks[user.Role] == 0 {
+			return fmt.Errorf("user %s: unknown role %q", user.Name, user.Role)
+		}
+		if user.Token == "" {
+			return fmt.Errorf("user %s: token is required", user.Name)
+		}
+		if tokens[user.Token] {
+			return fmt.Errorf("user %s: token is already used by another user", user.Name)
+		}
+		tokens[user.Token] = true
+	}
+	return validateOIDC(cfg.OIDC)
+}
+
+// bearerToken returns the bearer token of the request. Browsers cannot set
+// headers on WebSockets, they pass the token as the subprotocols bearer and
+// the token instead.
+func bearerToken(c *gin.Context) (string, bool) {
+	if token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); found {
+		return token, true
+	}
+	protocol, token, found := strings.Cut(c.GetHeader("Sec-WebSocket-Protocol"), ",")
+	if found && strings.TrimSpace(protocol) == websocketBearerProtocol {
+		return strings.TrimSpace(token), true
+	}
+	return "", false
+}
+
+// authFailures counts the requests with invalid credentials per IP, nil if
+// they are not limited.
+var authFailures *rateLimiter
+
+// authFailuresExceeded rejects the request with 429, before its credentials
+// are checked, once its IP sent invalid ones too often.
+func authFailuresExceeded(c *gin.Context) bool {
+	if authFailures == nil {
+		return false
+	}
+	if delay := authFailures.wait("ip:" + c.ClientIP()); delay > 0 {
+		rejectRateLimited(c, delay, "Too many failed authentication attempts")
+		return true
+	}
+	return false
+}
+
+// rejectAuthentication counts the invalid credentials of the request against
+// its IP and rejects it with 401.
+func rejectAuthentication(c *gin.Context, message string) {
+	if authFailures != nil {
+		authFailures.take("ip:" + c.ClientIP())
+	}
+	abortWithError(c, CodeUnauthenticated, message)
+}
+
+// authenticate resolves the bearer token of the request to a configured user
+// or a single sign-on session and stores it in the context. Signed URLs act as
+// their signer with the viewer role, granted the workspace they were signed
+// for. Other requests without a token get the
+// anonymous role. Requests with credentials are rejected while their IP is
+// over the failed authentication limit.
+func (s *server) authenticate(c *gin.Context) {
+	token, found := bearerToken(c)
+	if !found {
+		if user, signed, err := signedURLUser(c); signed {
+			if authFailuresExceeded(c) {
+				return
+			}
+			if err != nil {
+				rejectAuthentication(c, fmt.Sprintf("Invalid signed URL: %v", err))
+				return
+			}
+			c.Set("user", user)
+			c.Next()
+			return
+		}
+
+		c.Set("user", User{Name: anonymousUser, Role: config.Auth.AnonymousRole})
+		c.Next()
+		return
+	}
+
+	if authFailuresExceeded(c) {
+		return
+	}
+	for _, user := range config.Auth.Users {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(user.Token)) == 1 {
+			c.Set("user", user)
+			c.Next()
+			return
+		}
+	}
+
+	if user, ok := s.sessionUser(c, token); ok {
+		c.Set("user", user)
+		c.Next()
+		return
+	}
+
+	rejectAuthentication(c, "Invalid token")
+}
+
+// currentUser returns the user set by authenticate.
+func currentUser(c *gin.Context) User {
+	user, _ := c.Get("user")
+	u, _ := user.(User)
+	return u
+}
+
+// isAdmin reports whether the request was made by an admin.
+func isAdmin(c *gin.Context) bool {
+	return currentUser(c).Role.allows(RoleAdmin)
+}
+
+// requireRole rejects requests whose user lacks the given role.
+func requireRole(role Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := currentUser(c)
+		if user.Role.allows(role) {
+			c.Next()
+			return
+		}
+
+		if user.Name == anonymousUser {
+			abortWithError(c, CodeUnauthenticated, "Authentication required")
+			return
+		}
+		abortWithError(c, CodeForbidden, fmt.Sprintf("The %s role is required", role))
+	}
+}
+
+var (
+	requireViewer   = requireRole(RoleViewer)
+	requireOperator = requireRole(RoleOperator)
+	requireAdmin    = requireRole(RoleAdmin)
+)
@@ -0,0 +1,164 @@
+// Package broker publishes messages to a NATS or MQTT broker, for consumers on
+// an existing message bus that do not take HTTP callbacks.
+package broker
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/nats-io/nats.go"
+)
+
+// connectTimeout bounds a connection attempt and a publish. Failed
+// connections are retried in the background for as long as maestro runs.
+const connectTimeout = 10 * time.Second
+
+// Config selects the broker lifecycle events are published to.
+type Config struct {
+	// URL of the broker: nats:// or tls:// for NATS, mqtt://, mqtts://,
+	// tcp://, ssl://, ws:// or wss:// for MQTT. Empty disables publishing.
+	URL string `yaml:"url"`
+	// Topic prefixes the event type: maestro.events.exited on NATS,
+	// maestro/events/exited on MQTT. Defaults to maestro.events.
+	Topic          string `yaml:"topic"`
+	Username       string `yaml:"username"`
+	PasswordSecret string `yaml:"passwordSecret"` // name of the secret holding the password or token
+	ClientID       string `yaml:"clientID"`       // MQTT client ID, defaults to maestro
+	QoS            byte   `yaml:"qos"`            // MQTT quality of service, 0 to 2
+	Retain         bool   `yaml:"retain"`         // MQTT retains the last event of each type
+}
+
+// Validate checks the broker URL and options.
+func (cfg Config) Validate() error {
+	if cfg.URL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(cfg.URL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid broker URL %s", cfg.URL)
+	}
+	if protocol(parsed.Scheme) == "" {
+		return fmt.Errorf("unsupported broker scheme %s: expected nats, tls, mqtt, mqtts, tcp, ssl, ws or wss", parsed.Scheme)
+	}
+	if cfg.QoS > 2 {
+		return fmt.Errorf("invalid MQTT qos %d: expected 0 to 2", cfg.QoS)
+	}
+	return nil
+}
+
+// protocol returns nats or mqtt for the schemes of their URLs.
+func protocol(scheme string) string {
+	switch scheme {
+	case "nats", "tls":
+		return "nats"
+	case "mqtt", "mqtts", "tcp", "ssl", "ws", "wss":
+		return "mqtt"
+	}
+	return ""
+}
+
+// Publisher publishes messages under a topic of the configured prefix.
+type Publisher interface {
+	// Publish sends the payload to the topic prefix joined with name.
+	Publish(name string, payload []byte) error
+	Close()
+}
+
+// Connect connects to the configured broker with the password, if any. A
+// broker that cannot be reached yet is connected to in the background; only
+// invalid configurations fail.
+func Connect(cfg Config, password string) (Publisher, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	topic := cfg.Topic
+	if topic == "" {
+		topic = "maestro.events"
+	}
+	parsed, _ := url.Parse(cfg.URL)
+	if protocol(parsed.Scheme) == "nats" {
+		return connectNATS(cfg, topic, password)
+	}
+	return connectMQTT(cfg, strings.ReplaceAll(topic, ".", "/"), password)
+}
+
+type natsPublisher struct {
+	conn  *nats.Conn
+	topic string
+}
+
+func connectNATS(cfg Config, topic, password string) (Publisher, error) {
+	opts := []nats.Option{
+		nats.Name("maestro"),
+		nats.Timeout(connectTimeout),
+		nats.MaxReconnects(-1),
+		nats.RetryOnFailedConnect(true),
+	}
+	if cfg.Username != "" {
+		opts = append(opts, nats.UserInfo(cfg.Username, password))
+	} else if password != "" {
+		opts = append(opts, nats.Token(password))
+	}
+	conn, err := nats.Connect(cfg.URL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &natsPublisher{conn: conn, topic: topic}, nil
+}
+
+func (p *natsPublisher) Publish(name string, payload []byte) error {
+	return p.conn.Publish(p.topic+"."+name, payload)
+}
+
+func (p *natsPublisher) Close() {
+	p.conn.Drain()
+}
+
+type mqttPublisher struct {
+	client mqtt.Client
+	topic  string
+	qos    byte
+	retain bool
+}
+
+func connectMQTT(cfg Config, topic, password string) (Publisher, error) {
+	// paho names the plain and TLS schemes tcp and ssl
+	server := cfg.URL
+	if rest, ok := strings.CutPrefix(server, "mqtt://"); ok {
+		server = "tcp://" + rest
+	} else if rest, ok := strings.CutPrefix(server, "mqtts://"); ok {
+		server = "ssl://" + rest
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		clientID = "maestro"
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(server).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(password).
+		SetConnectTimeout(connectTimeout).
+		SetAutoReconnect(true).
+		SetConnectRetry(true)
+	client := mqtt.NewClient(opts)
+	// with retries, the token only completes once connected
+	client.Connect()
+	return &mqttPublisher{client: client, topic: topic, qos: cfg.QoS, retain: cfg.Retain}, nil
+}
+
+func (p *mqttPublisher) Publish(name string, payload []byte) error {
+	token := p.client.Publish(p.topic+"/"+name, p.qos, p.retain, payload)
+	if !token.WaitTimeout(connectTimeout) {
+		return fmt.Errorf("timed out publishing to %s", p.topic+"/"+name)
+	}
+	return token.Error()
+}
+
+func (p *mqttPublisher) Close() {
+	p.client.Disconnect(250)
+}
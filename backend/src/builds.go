@@ -0,0 +1,387 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maestro/src/manager"
+	"maestro/src/outbound"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// buildLogPollInterval is how often a followed build log is checked for new
+// output.
+const buildLogPollInterval = 500 * time.Millisecond
+
+// gitCloneTimeout bounds cloning a repository to build from.
+const gitCloneTimeout = 5 * time.Minute
+
+// handleGetBuildLog streams the output of the image's latest build, following
+// the log until the build finishes.
+func handleGetBuildLog(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	buildLog := imageManager.LastBuildLog()
+	if buildLog == nil {
+		respondError(c, CodeNotFound, fmt.Sprintf("No build log for image %s", name))
+		return
+	}
+
+	file, err := os.Open(buildLog.Path)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to open build log: %v", buildLog.Name))
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Header("X-Build-Log", buildLog.Name)
+
+	buf := make([]byte, 32*1024)
+	c.Stream(func(w io.Writer) bool {
+		n, err := file.Read(buf)
+		if n > 0 {
+			w.Write(buf[:n])
+			return true
+		}
+		if err != nil && err != io.EOF {
+			return false
+		}
+
+		// caught up with the writer: finish once the build is done
+		select {
+		case <-buildLog.Done():
+			io.Copy(w, file)
+			return false
+		case <-c.Request.Context().Done():
+			return false
+		case <-time.After(buildLogPollInterval):
+			return true
+		}
+	})
+}
+
+// errSecretReference rejects a secret named by a non-admin. Secrets are set by
+// admins and shared by every workspace, so only admins choose which one a
+// request uses.
+var errSecretReference = errors.New("only admins may name a secret")
+
+// checkSecretReference returns errSecretReference when a non-admin names a
+// secret, name being empty when none is named.
+func checkSecretReference(c *gin.Context, name string) error {
+	if name != "" && !isAdmin(c) {
+		return fmt.Errorf("%w: %s", errSecretReference, name)
+	}
+	return nil
+}
+
+// gitCredentials sets the deploy key from the secret keyName, if any, and the
+// outbound proxy of an https source.
+func gitCredentials(source *manager.GitSource, keyName string) error {
+	if keyName != "" {
+		key, err := secretStore.Reveal(keyName)
+		if err != nil {
+			return fmt.Errorf("deploy key %s: %v", keyName, err)
+		}
+		source.DeployKey = key
+	}
+	if target, err := url.Parse(source.URL); err == nil && target.Scheme == "https" {
+		if proxy, err := outbound.Proxy(target); err == nil && proxy != nil {
+			source.Proxy = proxy.String()
+		}
+	}
+	return nil
+}
+
+// gitBuildOptions clones the repository named by the `git` query parameter
+// into a temporary build context. `ref` selects a branch, tag or commit,
+// `subdir` the context within the repository and `containerfile` the
+// Containerfile within the context. `deploy_key` names a secret holding the
+// private key for an ssh repository, which only admins may do.
+func gitBuildOptions(c *gin.Context) (manager.BuildOptions, func(), error) {
+	noop := func() {}
+
+	source := manager.GitSource{
+		URL:    c.Query("git"),
+		Ref:    c.Query("ref"),
+		Subdir: c.Query("subdir"),
+	}
+	if err := source.Validate(); err != nil {
+		return manager.BuildOptions{}, noop, err
+	}
+	containerfile := c.Query("containerfile")
+	if containerfile != "" {
+		if _, err := manager.WorkspacePath(containerfile); err != nil {
+			return manager.BuildOptions{}, noop, fmt.Errorf("invalid Containerfile path %s", containerfile)
+		}
+	}
+
+	if err := checkSecretReference(c, c.Query("deploy_key")); err != nil {
+		return manager.BuildOptions{}, noop, err
+	}
+	if err := gitCredentials(&source, c.Query("deploy_key")); err != nil {
+		return manager.BuildOptions{}, noop, err
+	}
+
+	cloneDir, err := tempBuildContext("git-")
+	if err != nil {
+		return manager.BuildOptions{}, noop, err
+	}
+	cleanup := func() { os.RemoveAll(cloneDir) }
+
+	ctx, cancel := context.WithTimeout(c, gitCloneTimeout)
+	defer cancel()
+	contextDir, commit, err := manager.CloneGit(ctx, source, cloneDir)
+	if err != nil {
+		cleanup()
+		return manager.BuildOptions{}, noop, fmt.Errorf("failed to clone %s: %v", source.URL, err)
+	}
+	requestLog(c).Info("Cloned build context", "repository", source.URL, "ref", source.Ref, "commit", commit)
+
+	return manager.BuildOptions{ContextDir: contextDir, Git: source.URL + "@" + commit, Commit: commit, Containerfile: containerfile}, cleanup, nil
+}
+
+// handleGetBuild reports the progress and result of a build started through
+// workspaces/:name/build. The build log is streamed by workspaces/:name/build/log.
+func (s *server) handleGetBuild(c *gin.Context) {
+	op, _, ok := s.loadOwnedOperation(c)
+	if !ok {
+		return
+	}
+	if op.Kind != manager.OperationBuild {
+		respondError(c, CodeNotFound, fmt.Sprintf("Build %s not found", op.ID))
+		return
+	}
+
+	c.JSON(200, op.Copy())
+}
+
+// registryPush is where a build is pushed once it succeeds.
+type registryPush struct {
+	ref      string
+	password string
+}
+
+// pushFromRequest reads the optional `push` and `tag` query parameters. It
+// returns nil when the build is not to be pushed.
+func pushFromRequest(c *gin.Context, name string) (*registryPush, error) {
+	if c.Query("push") != "true" {
+		return nil, nil
+	}
+
+	ref, err := config.Registry.Reference(name, c.Query("tag"))
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := registryPassword()
+	if err != nil {
+		return nil, err
+	}
+	return &registryPush{ref: ref, password: password}, nil
+}
+
+// pushBuild pushes the build of the image on buildServer to the registry for
+// Kubernetes servers, and returns the reference they pull it by.
+func pushBuild(imageManager *manager.ImageManager, buildServer *manager.ConnectionManager) (string, error) {
+	ref, err := config.Registry.Reference(imageManager.Name, "")
+	if err != nil {
+		return "", err
+	}
+	password, err := registryPassword()
+	if err != nil {
+		return "", err
+	}
+	digest, err := imageManager.Push(buildServer, ref, config.Registry, password)
+	if err != nil {
+		return "", err
+	}
+	return manager.PushedReference(ref, digest)
+}
+
+// registryPassword reveals the password builds are pushed with, empty if the
+// registry takes none.
+func registryPassword() (string, error) {
+	if config.Registry.PasswordSecret == "" {
+		return "", nil
+	}
+	password, err := secretStore.Reveal(config.Registry.PasswordSecret)
+	if err != nil {
+		return "", fmt.Errorf("registry password %s: %v", config.Registry.PasswordSecret, err)
+	}
+	return string(password), nil
+}
+
+// handleCancelBuild stops a running build. Builds waiting for a run or another
+// build of the same image are canceled before they start.
+func (s *server) handleCancelBuild(c *gin.Context) {
+	op, _, ok := s.loadOwnedOperation(c)
+	if !ok {
+		return
+	}
+	if op.Kind != manager.OperationBuild {
+		respondError(c, CodeNotFound, fmt.Sprintf("Build %s not found", op.ID))
+		return
+	}
+
+	if err := op.Cancel(); err != nil {
+		respondError(c, CodeNotCancelable, fmt.Sprintf("Build %s cannot be canceled: %v", op.ID, err))
+		return
+	}
+
+	c.JSON(200, op.Copy())
+}
+
+// buildOnServers starts builds of the image on every server, or on those in
+// the `servers` query parameter, concurrently. Each server is a step of the
+// build's operation, so builds/:id reports the result per server.
+func (s *server) buildOnServers(c *gin.Context, imageManager *manager.ImageManager) {
+	name := imageManager.Name
+
+	var connections []*manager.ConnectionManager
+	if raw := c.Query("servers"); raw != "" {
+		for _, serverName := range strings.Split(raw, ",") {
+			connectionManager, exists := serviceManager.Connections.Load(serverName)
+			if !exists {
+				respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+				return
+			}
+			if !slices.Contains(connections, connectionManager) {
+				connections = append(connections, connectionManager)
+			}
+		}
+	} else {
+		serviceManager.Connections.Range(func(_ string, connectionManager *manager.ConnectionManager) bool {
+			connections = append(connections, connectionManager)
+			return true
+		})
+		slices.SortFunc(connections, func(a, b *manager.ConnectionManager) int {
+			return strings.Compare(a.Server.Name, b.Server.Name)
+		})
+	}
+	if len(connections) == 0 {
+		respondError(c, CodeNotFound, "No servers to build on")
+		return
+	}
+	if c.Query("push") == "true" {
+		respondError(c, CodeInvalidRequest, "Pushing is only supported for builds on one server")
+		return
+	}
+
+	buildOpts, cleanup, err := buildOptionsFromRequest(c, imageManager)
+	if err != nil {
+		respondError(c, errorCode(err, CodeInvalidRequest), err.Error())
+		return
+	}
+
+	// servers pass their own build args, so each checks the base images
+	serverNames := make([]string, len(connections))
+	for i, connectionManager := range connections {
+		if !checkBuildPolicy(c, imageManager, connectionManager, buildOpts) {
+			cleanup()
+			return
+		}
+		serverNames[i] = connectionManager.Server.Name
+	}
+
+	op := manager.NewOperation(manager.NewRunID(), manager.OperationBuild, name, currentUser(c).Name, serverNames, s.persistOperation)
+	serviceManager.Operations.Store(op.ID, op)
+	requestLog(c).Info("Build started", "image", name, "servers", serverNames, "build", op.ID)
+
+	ctx, cancel := config.Builds.BuildContext()
+	op.SetCancel(func() error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		defer cleanup()
+		defer cancel()
+
+		log := loggers.For("builds")
+		for _, serverName := range serverNames {
+			op.Begin(serverName)
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilding, Image: name, Server: serverName})
+		}
+		imageManager.BuildOnServers(ctx, connections, buildOpts, func(serverName string, err error) {
+			if err != nil {
+				op.Fail(serverName, err)
+				log.Error("Build failed", "image", name, "server", serverName, "build", op.ID, "error", err)
+				serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: name, Server: serverName, Message: err.Error()})
+				return
+			}
+			op.Succeed(serverName)
+			log.Info("Build finished", "image", name, "server", serverName, "build", op.ID)
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilt, Image: name, Server: serverName})
+		})
+		op.SetCancel(nil)
+	}()
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Build of image %s started on %d servers", name, len(serverNames)), "build": op.ID, "operation": op.ID, "servers": serverNames})
+}
+
+// handleTransferImage copies the image built on server `from`, by default the
+// server it last ran on, to server `to` so it runs there without a rebuild.
+// The copy runs in the background; the response names its operation.
+func (s *server) handleTransferImage(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	fromName := c.Query("from")
+	if fromName == "" {
+		imageManager.Mu.RLock()
+		if imageManager.Connection != nil {
+			fromName = imageManager.Connection.Server.Name
+		}
+		imageManager.Mu.RUnlock()
+	}
+	from, exists := serviceManager.Connections.Load(fromName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", fromName))
+		return
+	}
+	to, exists := serviceManager.Connections.Load(c.Query("to"))
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", c.Query("to")))
+		return
+	}
+	if from == to {
+		respondError(c, CodeInvalidRequest, "Source and target server are the same")
+		return
+	}
+
+	op := s.newOperation(manager.OperationTransfer, name, to.Server.Name, currentUser(c).Name)
+	op.SetServer(from.Server.Name)
+	requestLog(c).Info("Transfer started", "image", name, "from", from.Server.Name, "to", to.Server.Name, "operation", op.ID)
+
+	go func() {
+		size, err := imageManager.Transfer(from, to)
+		op.Logf("Copied %.1f MiB from %s to %s", float64(size)/1024/1024, from.Server.Name, to.Server.Name)
+		op.Finish(err)
+		if err != nil {
+			loggers.For("builds").Error("Transfer failed", "image", name, "from", from.Server.Name, "to", to.Server.Name, "error", err)
+			return
+		}
+		serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilt, Image: name, Server: to.Server.Name, Message: "copied from " + from.Server.Name})
+	}()
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Copying image %s from server %s to %s", name, from.Server.Name, to.Server.Name), "operation": op.ID})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maestro/src/manager"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listingCacheTTL bounds how stale a cached listing can be when no event
+// invalidates it.
+const listingCacheTTL = 2 * time.Second
+
+// CacheStats counts the lookups of one cache namespace.
+type CacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+type cacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// listingCache keeps rendered listings for a short time. Entries are keyed by
+// namespace (the listing) and scope (what the user may see and the page asked
+// for) and a namespace is dropped as soon as an event touches it.
+type listingCache struct {
+	ttl     time.Duration
+	entries map[string]map[string]cacheEntry
+	stats   map[string]*CacheStats
+
+	mu sync.Mutex
+}
+
+var listings = &listingCache{
+	ttl:     listingCacheTTL,
+	entries: map[string]map[string]cacheEntry{},
+	stats:   map[string]*CacheStats{},
+}
+
+func runsNamespace(image string) string {
+	return "runs/" + image
+}
+
+// serve responds with the cached listing of the namespace or renders, caches
+// and sends a fresh one. The variant tells apart renderings for the same user,
+// such as pages.
+func (lc *listingCache) serve(c *gin.Context, namespace, variant string, render func() any) {
+	// admins see everything, everyone else only what they can access
+	scope := "*"
+	if !isAdmin(c) {
+		scope = "user:" + currentUser(c).Name
+	}
+	scope += "?" + variant
+
+	lc.mu.Lock()
+	stats := lc.statsFor(namespace)
+	entry, exists := lc.entries[namespace][scope]
+	if exists && time.Now().Before(entry.expires) {
+		stats.Hits++
+		lc.mu.Unlock()
+		c.Data(200, "application/json; charset=utf-8", entry.body)
+		return
+	}
+	stats.Misses++
+	lc.mu.Unlock()
+
+	body, err := json.Marshal(render())
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to render listing: %v", err))
+		return
+	}
+
+	now := time.Now()
+	lc.mu.Lock()
+	if lc.entries[namespace] == nil {
+		lc.entries[namespace] = map[string]cacheEntry{}
+	}
+	// every page is cached, drop the stale ones so they do not pile up
+	for key, cached := range lc.entries[namespace] {
+		if !now.Before(cached.expires) {
+			delete(lc.entries[namespace], key)
+		}
+	}
+	lc.entries[namespace][scope] = cacheEntry{body: body, expires: now.Add(lc.ttl)}
+	lc.mu.Unlock()
+
+	c.Data(200, "application/json; charset=utf-8", body)
+}
+
+// invalidate drops every cached listing of the namespaces.
+func (lc *listingCache) invalidate(namespaces ...string) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	for _, namespace := range namespaces {
+		if len(lc.entries[namespace]) > 0 {
+			lc.statsFor(namespace).Invalidations++
+		}
+		delete(lc.entries, namespace)
+	}
+}
+
+// invalidateImage drops the listings showing the image.
+func (lc *listingCache) invalidateImage(image string) {
+	lc.invalidate("workspaces", runsNamespace(image))
+}
+
+// watch invalidates the listings touched by lifecycle events until the bus
+// closes the subscription.
+func (lc *listingCache) watch(bus *manager.EventBus) {
+	for event := range bus.Subscribe() {
+		lc.invalidateImage(event.Image)
+	}
+}
+
+// snapshot returns a copy of the hit metrics per listing.
+func (lc *listingCache) snapshot() map[string]CacheStats {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+
+	result := make(map[string]CacheStats, len(lc.stats))
+	for namespace, stats := range lc.stats {
+		result[namespace] = *stats
+	}
+	return result
+}
+
+// statsFor returns the metrics of a namespace. The runs of all images share
+// their metrics so they do not grow with the number of images. The caller
+// must hold lc.mu.
+func (lc *listingCache) statsFor(namespace string) *CacheStats {
+	listing, _, _ := strings.Cut(namespace, "/")
+	stats, exists := lc.stats[listing]
+	if !exists {
+		stats = &CacheStats{}
+		lc.stats[listing] = stats
+	}
+	return stats
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// GetImagePolicy returns the image policy.
+func (c *Client) GetImagePolicy(ctx context.Context) (*ImagePolicy, error) {
+	var policy ImagePolicy
+	return &policy, c.do(ctx, "GET", "admin/image-policy", nil, nil, &policy)
+}
+
+// PutImagePolicy replaces the image policy.
+func (c *Client) PutImagePolicy(ctx context.Context, policy ImagePolicy) (*ImagePolicy, error) {
+	var result ImagePolicy
+	return &result, c.do(ctx, "PUT", "admin/image-policy", nil, policy, &result)
+}
+
+// PolicyTest names the images to check against the image policy: the images
+// given, plus the base images of a workspace's Containerfile if container is
+// set.
+type PolicyTest struct {
+	Images        []string `json:"images,omitempty"`
+	Container     string   `json:"container,omitempty"`
+	Containerfile string   `json:"containerfile,omitempty"` // relative to the workspace, its Containerfile if empty
+}
+
+// TestImagePolicy checks images against the image policy without building.
+func (c *Client) TestImagePolicy(ctx context.Context, test PolicyTest) ([]PolicyDecision, error) {
+	var decisions []PolicyDecision
+	err := c.do(ctx, "POST", "image-policy/test", nil, test, &decisions)
+	return decisions, err
+}
+
+// ListSecrets returns the metadata of the secrets, never their values.
+func (c *Client) ListSecrets(ctx context.Context) ([]SecretInfo, error) {
+	var secrets []SecretInfo
+	err := c.do(ctx, "GET", "secrets", nil, nil, &secrets)
+	return secrets, err
+}
+
+// PutSecret creates or replaces a secret.
+func (c *Client) PutSecret(ctx context.Context, name, value string) (*SecretInfo, error) {
+	body := map[string]string{"value": value}
+	var info SecretInfo
+	return &info, c.do(ctx, "PUT", segments("secrets", name), nil, body, &info)
+}
+
+// DeleteSecret removes a secret.
+func (c *Client) DeleteSecret(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", segments("secrets", name), nil, nil, nil)
+}
+
+// RotateSecrets encrypts every secret with the current key and returns how
+// many were re-encrypted.
+func (c *Client) RotateSecrets(ctx context.Context) (int, error) {
+	var result struct {
+		Rotated int `json:"rotated"`
+	}
+	err := c.do(ctx, "POST", "admin/secrets/rotate", nil, nil, &result)
+	return result.Rotated, err
+}
+
+// AuditFilter selects the audit entries AuditLog returns. Zero fields do not
+// filter.
+type AuditFilter struct {
+	User   string
+	Method string
+	Path   string // prefix of the request paths
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// AuditLog returns the most recent audit entries matching the filter.
+func (c *Client) AuditLog(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := url.Values{}
+	setString(query, "user", filter.User)
+	setString(query, "method", filter.Method)
+	setString(query, "path", filter.Path)
+	if !filter.From.IsZero() {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	var entries []AuditEntry
+	err := c.do(ctx, "GET", "admin/audit", query, nil, &entries)
+	return entries, err
+}
+
+// Migrations returns the schema version of the database and the state of
+// every migration.
+func (c *Client) Migrations(ctx context.Context) (int64, []MigrationInfo, error) {
+	var result struct {
+		CurrentVersion int64           `json:"current_version"`
+		Migrations     []MigrationInfo `json:"migrations"`
+	}
+	err := c.do(ctx, "GET", "admin/migrations", nil, nil, &result)
+	return result.CurrentVersion, result.Migrations, err
+}
+
+// MigrateUp applies the pending migrations and returns them. With dryRun it
+// only returns the pending migrations.
+func (c *Client) MigrateUp(ctx context.Context, dryRun bool) ([]MigrationInfo, []MigrationResult, error) {
+	query := url.Values{}
+	setBool(query, "dryRun", dryRun)
+	var result struct {
+		Pending []MigrationInfo   `json:"pending"`
+		Applied []MigrationResult `json:"applied"`
+	}
+	err := c.do(ctx, "POST", "admin/migrations/up", query, nil, &result)
+	return result.Pending, result.Applied, err
+}
+
+// MigrateDown rolls back the latest migration, whose version confirm must be.
+func (c *Client) MigrateDown(ctx context.Context, confirm int64) (*MigrationResult, error) {
+	query := url.Values{"confirm": {strconv.FormatInt(confirm, 10)}}
+	var result struct {
+		RolledBack *MigrationResult `json:"rolled_back"`
+	}
+	err := c.do(ctx, "POST", "admin/migrations/down", query, nil, &result)
+	return result.RolledBack, err
+}
+
+// Metrics returns the request, cache and database metrics of the server.
+func (c *Client) Metrics(ctx context.Context) (*Metrics, error) {
+	var metrics Metrics
+	return &metrics, c.do(ctx, "GET", "metrics", nil, nil, &metrics)
+}
+
+// OpenAPI returns the OpenAPI specification of the API as JSON.
+func (c *Client) OpenAPI(ctx context.Context) ([]byte, error) {
+	spec, err := c.download(ctx, "openapi.json", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer spec.Close()
+	return io.ReadAll(spec)
+}
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"time"
+)
+
+// Me returns the user the client is authenticated as.
+func (c *Client) Me(ctx context.Context) (*User, error) {
+	var user User
+	return &user, c.do(ctx, "GET", "auth/me", nil, nil, &user)
+}
+
+// Logout ends the single sign-on session of the client's token.
+func (c *Client) Logout(ctx context.Context) error {
+	return c.do(ctx, "POST", "auth/logout", nil, nil, nil)
+}
+
+// SignedURL is a URL that can be fetched without a token until it expires.
+type SignedURL struct {
+	URL       string    `json:"url"` // path and query, relative to the server
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// SignURL signs a GET path of the API, such as
+// /api/v1/workspaces/x/file?f_name=out.csv, for ttl, the server's default if
+// 0.
+func (c *Client) SignURL(ctx context.Context, path string, ttl time.Duration) (*SignedURL, error) {
+	body := struct {
+		Path string `json:"path"`
+		TTL  string `json:"ttl,omitempty"`
+	}{Path: path}
+	if ttl > 0 {
+		body.TTL = ttl.String()
+	}
+	var signed SignedURL
+	return &signed, c.do(ctx, "POST", "signed-urls", nil, body, &signed)
+}
@@ -0,0 +1,253 @@
+// Package client is a Go client of the maestro API. It only depends on the
+// standard library and golang.org/x/net/websocket, so programs can use it
+// without pulling in the container engines maestro itself talks to.
+//
+//	c := client.New("http://localhost:3003", token)
+//	page, err := c.ListWorkspaces(ctx, client.ListOptions{Status: "running"})
+//
+// Every method maps to one endpoint. The browser-only endpoints, the OIDC
+// login and Swagger UI, have no method.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// apiPrefix is the path of the API version the client speaks.
+const apiPrefix = "/api/v1"
+
+// Client calls a maestro server. It is safe for concurrent use.
+type Client struct {
+	base  string
+	token string
+
+	// HTTP sends the requests, http.DefaultClient unless set. Its timeout
+	// also bounds streams such as the event stream and build logs.
+	HTTP *http.Client
+}
+
+// New returns a client of the maestro at baseURL, such as
+// http://localhost:3003, authenticating with the bearer token. An empty token
+// makes anonymous requests.
+func New(baseURL, token string) *Client {
+	base := strings.TrimRight(baseURL, "/")
+	base = strings.TrimSuffix(base, apiPrefix)
+	return &Client{base: base + apiPrefix, token: token}
+}
+
+// Error is an error response of the API.
+type Error struct {
+	Status  int            `json:"-"`
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("maestro: %s (%d %s)", e.Message, e.Status, e.Code)
+}
+
+// IsCode reports whether err is an error response with the code, such as
+// CodeNotFound.
+func IsCode(err error, code string) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// FieldErrors returns the error of each invalid field of a request rejected
+// with CodeValidationFailed, keyed by the field's JSON path, or nil.
+func FieldErrors(err error) map[string]string {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Code != CodeValidationFailed {
+		return nil
+	}
+	raw, _ := apiErr.Details["fields"].(map[string]any)
+	fields := make(map[string]string, len(raw))
+	for name, message := range raw {
+		fields[name], _ = message.(string)
+	}
+	return fields
+}
+
+// Codes of the error responses clients commonly act on.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeUnauthenticated  = "unauthenticated"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeTimeout          = "timeout"
+	CodeConflict         = "conflict"
+	CodeRateLimited      = "rate_limited"
+	CodeAlreadyExists    = "already_exists"
+	CodeContainerRunning = "container_running"
+	CodeNotRunning       = "not_running"
+	CodeOffsetMismatch   = "offset_mismatch"
+	CodeProtected        = "protected"
+	CodePolicyDenied     = "policy_denied"
+	CodeQuarantined      = "quarantined"
+	CodeUnschedulable    = "unschedulable"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeKeyReused        = "idempotency_key_reused"
+	CodeValidationFailed = "validation_failed"
+)
+
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a context whose requests carry the idempotency
+// key. Retrying CreateWorkspace, Run or Build with the same key, such as after
+// a network error, returns the first result instead of acting again.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// Message is the response of endpoints that only confirm an action.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// endpoint returns the URL of the API path, whose segments the caller
+// escaped, with the query. Paths starting with / are relative to the server
+// root instead.
+func (c *Client) endpoint(path string, query url.Values) string {
+	endpoint := c.base + "/" + path
+	if strings.HasPrefix(path, "/") {
+		endpoint = strings.TrimSuffix(c.base, apiPrefix) + path
+	}
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	return endpoint
+}
+
+// send makes a request and returns the response if its status is a success,
+// otherwise the error it carries. The caller closes the response body.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body io.Reader, contentType string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.endpoint(path, query), body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok && key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	return nil, decodeError(resp)
+}
+
+// decodeError reads the error of a failed response.
+func decodeError(resp *http.Response) error {
+	apiErr := &Error{Status: resp.StatusCode}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(raw, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Code = strconv.Itoa(resp.StatusCode)
+		apiErr.Message = strings.TrimSpace(string(raw))
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+	}
+	return apiErr
+}
+
+// do sends the JSON of in, unless nil, and decodes the response into out,
+// unless nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(raw)
+		contentType = "application/json"
+	}
+
+	resp, err := c.send(ctx, method, path, query, body, contentType, nil)
+	if err != nil {
+		return err
+	}
+	return decodeInto(resp, out)
+}
+
+// decodeInto decodes the JSON response into out, unless nil, and closes it.
+func decodeInto(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// download returns the body of a GET request for the caller to read and
+// close.
+func (c *Client) download(ctx context.Context, path string, query url.Values, header http.Header) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, "GET", path, query, nil, "", header)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// segments joins path segments, escaping each.
+func segments(parts ...string) string {
+	escaped := make([]string, len(parts))
+	for i, part := range parts {
+		escaped[i] = url.PathEscape(part)
+	}
+	return strings.Join(escaped, "/")
+}
+
+// workspacePath returns the path of a workspace's endpoint, such as
+// workspaces/x/files for "files".
+func workspacePath(name string, rest ...string) string {
+	return segments(append([]string{"workspaces", name}, rest...)...)
+}
+
+// runPath returns the path of an endpoint of a workspace's run, such as
+// workspaces/x/runs/current/stop for "stop".
+func runPath(name, run string, rest ...string) string {
+	return workspacePath(name, append([]string{"runs", run}, rest...)...)
+}
+
+// setBool sets the query parameter to true when the flag is.
+func setBool(query url.Values, key string, flag bool) {
+	if flag {
+		query.Set(key, "true")
+	}
+}
+
+// setString sets the query parameter unless the value is empty.
+func setString(query url.Values, key, value string) {
+	if value != "" {
+		query.Set(key, value)
+	}
+}
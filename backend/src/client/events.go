@@ -0,0 +1,49 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Events streams the lifecycle events of the images the user can access to
+// handle until ctx is done or the stream breaks. Heartbeats are skipped.
+func (c *Client) Events(ctx context.Context, handle func(Event)) error {
+	resp, err := c.send(ctx, "GET", "events/stream", nil, nil, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var eventType string
+	var data strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if eventType != "heartbeat" && data.Len() > 0 {
+				var event Event
+				if err := json.Unmarshal([]byte(data.String()), &event); err != nil {
+					return err
+				}
+				handle(event)
+			}
+			eventType = ""
+			data.Reset()
+		case strings.HasPrefix(line, "event:"):
+			eventType = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return scanner.Err()
+}
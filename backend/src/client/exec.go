@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// ExecMessage is a JSON message of an exec session. Clients send input and
+// resize messages; the server sends exit or error once the command ended,
+// after its output as binary frames.
+type ExecMessage struct {
+	Type     string `json:"type"`           // input, resize, exit or error
+	Data     string `json:"data,omitempty"` // of input
+	Cols     uint16 `json:"cols,omitempty"` // of resize
+	Rows     uint16 `json:"rows,omitempty"`
+	ExitCode int    `json:"exit_code,omitempty"` // of exit
+	Error    string `json:"error,omitempty"`
+}
+
+// Exec runs cmd, a shell if empty, on a TTY in the running container of a
+// run. Send ExecMessage input and resize messages with websocket.JSON and read
+// the terminal's output from the connection until the exit message.
+func (c *Client) Exec(ctx context.Context, name, run string, cmd ...string) (*websocket.Conn, error) {
+	return c.dialWebSocket(ctx, runPath(name, run, "exec"), url.Values{"cmd": cmd})
+}
+
+// AttachStdin connects to the input of the running container of a run that
+// was run interactive. What is written to the connection goes to the
+// container's stdin; a detached message arrives once the container exits.
+func (c *Client) AttachStdin(ctx context.Context, name, run string) (*websocket.Conn, error) {
+	return c.dialWebSocket(ctx, runPath(name, run, "stdin"), nil)
+}
+
+// dialWebSocket opens a WebSocket to the API path.
+func (c *Client) dialWebSocket(ctx context.Context, path string, query url.Values) (*websocket.Conn, error) {
+	location := c.endpoint(path, query)
+	origin := c.base
+	switch {
+	case strings.HasPrefix(location, "https://"):
+		location = "wss://" + strings.TrimPrefix(location, "https://")
+	case strings.HasPrefix(location, "http://"):
+		location = "ws://" + strings.TrimPrefix(location, "http://")
+	}
+
+	config, err := websocket.NewConfig(location, origin)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		config.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return config.DialContext(ctx)
+}
@@ -0,0 +1,237 @@
+package client
+
+import (
+	"context"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"path"
+	"time"
+)
+
+// ListFiles returns a page of the names of the files at the top of an
+// image's directory.
+func (c *Client) ListFiles(ctx context.Context, name string, opts ListOptions) (*Page[string], error) {
+	var page Page[string]
+	return &page, c.do(ctx, "GET", workspacePath(name, "files"), opts.query(), nil, &page)
+}
+
+// FileListOptions selects the workspace entries ListFileDetails returns.
+type FileListOptions struct {
+	ListOptions        // sortable by path, size or mod_time
+	Dir         string // directory to list, the workspace if empty
+	Recursive   bool   // descend into subdirectories
+	Checksums   bool   // include the SHA-256 of every file
+}
+
+// ListFileDetails returns a page of the files and directories in a workspace
+// directory with their sizes and modification times.
+func (c *Client) ListFileDetails(ctx context.Context, name string, opts FileListOptions) (*Page[FileEntry], error) {
+	query := opts.query()
+	query.Set("details", "true")
+	setString(query, "dir", opts.Dir)
+	setBool(query, "recursive", opts.Recursive)
+	setBool(query, "checksums", opts.Checksums)
+	var page Page[FileEntry]
+	return &page, c.do(ctx, "GET", workspacePath(name, "files"), query, nil, &page)
+}
+
+// File is a file to upload.
+type File struct {
+	Path    string // relative to the upload's directory, may contain directories
+	Content io.Reader
+}
+
+// UploadFiles uploads the files below dir of an image's directory, the
+// workspace if empty, creating missing directories.
+func (c *Client) UploadFiles(ctx context.Context, name, dir string, files ...File) error {
+	query := url.Values{}
+	setString(query, "dir", dir)
+	return c.postMultipart(ctx, workspacePath(name, "files"), query, func(form *multipart.Writer) error {
+		for _, file := range files {
+			if err := form.WriteField("paths", file.Path); err != nil {
+				return err
+			}
+			part, err := form.CreateFormFile("files", path.Base(file.Path))
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(part, file.Content); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// ArchiveOptions picks the format of a downloaded workspace archive.
+type ArchiveOptions struct {
+	Format      string // zip (the default) or tar
+	Compression string // of tar archives, gzip or zstd
+	NoLogs      bool   // leave out captured logs
+}
+
+// DownloadArchive downloads an image's directory as an archive. The caller
+// closes it.
+func (c *Client) DownloadArchive(ctx context.Context, name string, opts ArchiveOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	setString(query, "format", opts.Format)
+	setString(query, "compression", opts.Compression)
+	if opts.NoLogs {
+		query.Set("logs", "false")
+	}
+	return c.download(ctx, workspacePath(name, "files", "archive"), query, nil)
+}
+
+// ExtractArchive extracts a zip or tar.gz archive into an image's directory,
+// below dir unless empty, and returns the files written.
+func (c *Client) ExtractArchive(ctx context.Context, name, dir, fileName string, archive io.Reader) ([]string, error) {
+	query := url.Values{}
+	setString(query, "dir", dir)
+	var result struct {
+		Files []string `json:"files"`
+	}
+	err := c.postMultipart(ctx, workspacePath(name, "files", "archive"), query, func(form *multipart.Writer) error {
+		part, err := form.CreateFormFile("archive", fileName)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(part, archive)
+		return err
+	}, &result)
+	return result.Files, err
+}
+
+// GetFile downloads a workspace file. The caller closes it.
+func (c *Client) GetFile(ctx context.Context, name, file string) (io.ReadCloser, error) {
+	return c.download(ctx, workspacePath(name, "file"), url.Values{"f_name": {file}}, nil)
+}
+
+// PutFile replaces a workspace file with the content, creating it and its
+// directories if needed. Large files go through CreateUpload.
+func (c *Client) PutFile(ctx context.Context, name, file string, content io.Reader) error {
+	resp, err := c.send(ctx, "PUT", workspacePath(name, "file"), url.Values{"f_name": {file}}, content, "application/octet-stream", nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// MoveFile renames or moves a workspace file or directory. An existing
+// destination file is only replaced with overwrite.
+func (c *Client) MoveFile(ctx context.Context, name, file, to string, overwrite bool) error {
+	query := url.Values{"f_name": {file}, "to": {to}}
+	setBool(query, "overwrite", overwrite)
+	return c.do(ctx, "PATCH", workspacePath(name, "file"), query, nil, nil)
+}
+
+// DeleteFile removes a workspace file or empty directory, or a directory with
+// its contents when recursive.
+func (c *Client) DeleteFile(ctx context.Context, name, file string, recursive bool) error {
+	query := url.Values{"f_name": {file}}
+	setBool(query, "recursive", recursive)
+	return c.do(ctx, "DELETE", workspacePath(name, "file"), query, nil, nil)
+}
+
+// ProtectFile marks a workspace file as admin-only and returns the protected
+// files of the workspace.
+func (c *Client) ProtectFile(ctx context.Context, name, file string) ([]string, error) {
+	return c.setProtection(ctx, "PUT", name, file)
+}
+
+// UnprotectFile lets collaborators change a workspace file again and returns
+// the protected files of the workspace.
+func (c *Client) UnprotectFile(ctx context.Context, name, file string) ([]string, error) {
+	return c.setProtection(ctx, "DELETE", name, file)
+}
+
+func (c *Client) setProtection(ctx context.Context, method, name, file string) ([]string, error) {
+	var result struct {
+		ProtectedFiles []string `json:"protected_files"`
+	}
+	err := c.do(ctx, method, workspacePath(name, "file", "protect"), url.Values{"f_name": {file}}, nil, &result)
+	return result.ProtectedFiles, err
+}
+
+// GetStorage reports the space used by an image's source files, run logs and
+// artifacts.
+func (c *Client) GetStorage(ctx context.Context, name string) (*StorageReport, error) {
+	var report StorageReport
+	return &report, c.do(ctx, "GET", workspacePath(name, "storage"), nil, nil, &report)
+}
+
+// CleanStorage deletes the files of a storage category, only those not
+// modified within olderThan unless it is 0.
+func (c *Client) CleanStorage(ctx context.Context, name, category string, olderThan time.Duration) (*CleanupResult, error) {
+	query := url.Values{}
+	if olderThan > 0 {
+		query.Set("olderThan", olderThan.String())
+	}
+	var result CleanupResult
+	return &result, c.do(ctx, "DELETE", workspacePath(name, "storage", category), query, nil, &result)
+}
+
+// GetRepo returns the repository an image's directory was cloned from.
+func (c *Client) GetRepo(ctx context.Context, name string) (*WorkspaceRepo, error) {
+	var repo WorkspaceRepo
+	return &repo, c.do(ctx, "GET", workspacePath(name, "git"), nil, nil, &repo)
+}
+
+// CloneRequest names a repository to clone into a workspace.
+type CloneRequest struct {
+	URL           string   `json:"url"`
+	Ref           string   `json:"ref,omitempty"`            // ref to follow, the remote HEAD if empty
+	DeployKey     string   `json:"deploy_key,omitempty"`     // secret holding the deploy key of an ssh repository
+	Trigger       []string `json:"trigger,omitempty"`        // push and tag events of the repository's webhook that pull and run the workspace
+	TriggerSecret string   `json:"trigger_secret,omitempty"` // secret the repository's webhook is signed with, required with Trigger
+}
+
+// Clone clones a repository into an image's directory and returns the commit
+// checked out.
+func (c *Client) Clone(ctx context.Context, name string, req CloneRequest) (string, error) {
+	var result struct {
+		Commit string `json:"commit"`
+	}
+	err := c.do(ctx, "POST", workspacePath(name, "git", "clone"), nil, req, &result)
+	return result.Commit, err
+}
+
+// Pull checks out the latest commit of the ref an image's directory was
+// cloned from and returns it.
+func (c *Client) Pull(ctx context.Context, name string) (string, error) {
+	var result struct {
+		Commit string `json:"commit"`
+	}
+	err := c.do(ctx, "POST", workspacePath(name, "git", "pull"), nil, nil, &result)
+	return result.Commit, err
+}
+
+// SetTrigger sets the events of the repository's webhook, push and tag, that
+// pull and run an image's directory, and the secret the webhook is signed
+// with. No events stop the triggers.
+func (c *Client) SetTrigger(ctx context.Context, name, secret string, events ...string) (*WorkspaceRepo, error) {
+	body := map[string]any{"events": events, "secret": secret}
+	var repo WorkspaceRepo
+	return &repo, c.do(ctx, "PUT", workspacePath(name, "git", "trigger"), nil, body, &repo)
+}
+
+// postMultipart posts the form write fills in, streaming it, and decodes the
+// response into out unless nil.
+func (c *Client) postMultipart(ctx context.Context, path string, query url.Values, fill func(*multipart.Writer) error, out any) error {
+	body, pipe := io.Pipe()
+	form := multipart.NewWriter(pipe)
+	go func() {
+		err := fill(form)
+		if err == nil {
+			err = form.Close()
+		}
+		pipe.CloseWithError(err)
+	}()
+
+	resp, err := c.send(ctx, "POST", path, query, body, form.FormDataContentType(), nil)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	return decodeInto(resp, out)
+}
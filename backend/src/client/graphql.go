@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// GraphQLError is an error of a GraphQL query, such as an unknown field.
+type GraphQLError struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// GraphQLErrors are the errors of a GraphQL query. The data of the fields
+// that did resolve is still decoded.
+type GraphQLErrors []GraphQLError
+
+func (e GraphQLErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return "maestro: graphql: " + strings.Join(messages, "; ")
+}
+
+// GraphQL resolves a query and decodes its data into out, unless nil.
+//
+//	var data struct {
+//		Workspaces []struct {
+//			Name      string
+//			LatestRun *struct{ Status string }
+//		}
+//	}
+//	err := c.GraphQL(ctx, "{ workspaces { name latestRun { status } } }", nil, &data)
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]any, out any) error {
+	body := map[string]any{"query": query, "variables": variables}
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors GraphQLErrors   `json:"errors"`
+	}
+	if err := c.do(ctx, "POST", "graphql", nil, body, &result); err != nil {
+		return err
+	}
+	if out != nil && len(result.Data) > 0 && string(result.Data) != "null" {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return err
+		}
+	}
+	if len(result.Errors) > 0 {
+		return result.Errors
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+package client
+
+import "context"
+
+// ListNotifications returns the notification channels the user can see.
+func (c *Client) ListNotifications(ctx context.Context) ([]NotificationChannel, error) {
+	var channels []NotificationChannel
+	err := c.do(ctx, "GET", "notifications", nil, nil, &channels)
+	return channels, err
+}
+
+// CreateNotification adds a Slack or Discord channel, given by its incoming
+// webhook URL, notified of the finished, failed and delayed runs of a
+// workspace, or of every workspace the user owns if empty. No events means all
+// of them.
+func (c *Client) CreateNotification(ctx context.Context, provider, webhookURL, workspace string, events ...string) (*NotificationChannel, error) {
+	body := map[string]any{"provider": provider, "url": webhookURL, "workspace": workspace, "events": events}
+	var channel NotificationChannel
+	return &channel, c.do(ctx, "POST", "notifications", nil, body, &channel)
+}
+
+// DeleteNotification removes a notification channel.
+func (c *Client) DeleteNotification(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", segments("notifications", id), nil, nil, nil)
+}
+
+// TestNotification posts a test message to a notification channel.
+func (c *Client) TestNotification(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", segments("notifications", id, "test"), nil, nil, nil)
+}
@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// OperationFilter selects the operations ListOperations returns. Zero fields
+// do not filter.
+type OperationFilter struct {
+	Kind   string
+	Status string
+	Image  string
+	Limit  int
+}
+
+// ListOperations returns the most recent operations the user can access.
+func (c *Client) ListOperations(ctx context.Context, filter OperationFilter) ([]Operation, error) {
+	query := url.Values{}
+	setString(query, "kind", filter.Kind)
+	setString(query, "status", filter.Status)
+	setString(query, "image", filter.Image)
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	var operations []Operation
+	err := c.do(ctx, "GET", "operations", query, nil, &operations)
+	return operations, err
+}
+
+// GetOperation returns an operation with its steps.
+func (c *Client) GetOperation(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	return &op, c.do(ctx, "GET", segments("operations", id), nil, nil, &op)
+}
+
+// CancelOperation stops a running operation.
+func (c *Client) CancelOperation(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	return &op, c.do(ctx, "POST", segments("operations", id, "cancel"), nil, nil, &op)
+}
+
+// ResumeOperation retries a failed run from the step that failed.
+func (c *Client) ResumeOperation(ctx context.Context, id string) (*RunResult, error) {
+	var result RunResult
+	return &result, c.do(ctx, "POST", segments("operations", id, "resume"), nil, nil, &result)
+}
+
+// CleanupOperation removes what a failed operation left behind and closes it.
+func (c *Client) CleanupOperation(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	return &op, c.do(ctx, "POST", segments("operations", id, "cleanup"), nil, nil, &op)
+}
@@ -0,0 +1,15 @@
+package client
+
+import "context"
+
+// Healthz checks that the maestro process is up.
+func (c *Client) Healthz(ctx context.Context) error {
+	return c.do(ctx, "GET", "/healthz", nil, nil, nil)
+}
+
+// Readyz checks that maestro can serve the API: its database is reachable and
+// at least one server is online. Otherwise the error's details tell which
+// check failed.
+func (c *Client) Readyz(ctx context.Context) error {
+	return c.do(ctx, "GET", "/readyz", nil, nil, nil)
+}
@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"time"
+)
+
+// CurrentRun names the current run of a workspace, the one whose container
+// is running or ran last, in place of a run ID.
+const CurrentRun = "current"
+
+// ListRuns returns a page of an image's runs, most recent first unless
+// sorted otherwise.
+func (c *Client) ListRuns(ctx context.Context, name string, opts ListOptions) (*Page[Run], error) {
+	var page Page[Run]
+	return &page, c.do(ctx, "GET", workspacePath(name, "runs"), opts.query(), nil, &page)
+}
+
+// GetRun returns a run of a workspace, or its current one for CurrentRun.
+func (c *Client) GetRun(ctx context.Context, name, run string) (*Run, error) {
+	var result Run
+	return &result, c.do(ctx, "GET", runPath(name, run), nil, nil, &result)
+}
+
+// RunLogs downloads the logs of a run as a tar archive compressed with gzip or
+// zstd, gzip if empty. The caller closes it.
+func (c *Client) RunLogs(ctx context.Context, name, run, compression string) (io.ReadCloser, error) {
+	query := url.Values{}
+	setString(query, "compression", compression)
+	return c.download(ctx, runPath(name, run, "logs"), query, nil)
+}
+
+// RehydrateRun extracts the logs of an archived run back into the workspace.
+func (c *Client) RehydrateRun(ctx context.Context, name, run string) (*Run, error) {
+	var result Run
+	return &result, c.do(ctx, "POST", runPath(name, run, "rehydrate"), nil, nil, &result)
+}
+
+// Placement explains why the scheduler placed a run where it did.
+func (c *Client) Placement(ctx context.Context, run string) (*PlacementTrace, error) {
+	var trace PlacementTrace
+	return &trace, c.do(ctx, "GET", segments("runs", run, "placement-explain"), nil, nil, &trace)
+}
+
+// The actions on the container of a run below only apply to the current run
+// of a workspace, they fail with CodeNotRunning for other runs.
+
+// Stop stops the container of a run.
+func (c *Client) Stop(ctx context.Context, name, run string) error {
+	return c.do(ctx, "POST", runPath(name, run, "stop"), nil, nil, nil)
+}
+
+// Restart restarts the container of a run, running or exited, and returns how
+// often it was restarted.
+func (c *Client) Restart(ctx context.Context, name, run string) (int, error) {
+	var result struct {
+		Restarts int `json:"restarts"`
+	}
+	err := c.do(ctx, "POST", runPath(name, run, "restart"), nil, nil, &result)
+	return result.Restarts, err
+}
+
+// Kill sends a signal, such as SIGUSR1 or HUP, to the main process of a run's
+// container, SIGKILL if empty.
+func (c *Client) Kill(ctx context.Context, name, run, signal string) error {
+	query := url.Values{}
+	setString(query, "signal", signal)
+	return c.do(ctx, "POST", runPath(name, run, "kill"), query, nil, nil)
+}
+
+// WaitResult is the exit of a container.
+type WaitResult struct {
+	Container string `json:"container"`
+	Run       string `json:"run"`
+	ExitCode  int    `json:"exit_code"`
+}
+
+// Wait blocks until the container of a run exits, giving up with CodeTimeout
+// after the timeout unless it is 0.
+func (c *Client) Wait(ctx context.Context, name, run string, timeout time.Duration) (*WaitResult, error) {
+	query := url.Values{}
+	if timeout > 0 {
+		query.Set("timeout", timeout.String())
+	}
+	var result WaitResult
+	return &result, c.do(ctx, "GET", runPath(name, run, "wait"), query, nil, &result)
+}
+
+// Pause freezes the running container of a run.
+func (c *Client) Pause(ctx context.Context, name, run string) error {
+	return c.do(ctx, "POST", runPath(name, run, "pause"), nil, nil, nil)
+}
+
+// Unpause lets the paused container of a run continue.
+func (c *Client) Unpause(ctx context.Context, name, run string) error {
+	return c.do(ctx, "POST", runPath(name, run, "unpause"), nil, nil, nil)
+}
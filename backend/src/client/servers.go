@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"net/url"
+	"time"
+)
+
+// ListServers returns the connected servers by name.
+func (c *Client) ListServers(ctx context.Context) (map[string]Connection, error) {
+	var servers map[string]Connection
+	err := c.do(ctx, "GET", "servers", nil, nil, &servers)
+	return servers, err
+}
+
+// ListServerGroups returns the server groups.
+func (c *Client) ListServerGroups(ctx context.Context) ([]ServerGroup, error) {
+	var groups []ServerGroup
+	err := c.do(ctx, "GET", "servers/groups", nil, nil, &groups)
+	return groups, err
+}
+
+// PutServerGroup creates or replaces a server group.
+func (c *Client) PutServerGroup(ctx context.Context, group string, members []string) (*ServerGroup, error) {
+	body := map[string][]string{"members": members}
+	var result ServerGroup
+	return &result, c.do(ctx, "PUT", segments("servers", "groups", group), nil, body, &result)
+}
+
+// DeleteServerGroup removes a server group.
+func (c *Client) DeleteServerGroup(ctx context.Context, group string) error {
+	return c.do(ctx, "DELETE", segments("servers", "groups", group), nil, nil, nil)
+}
+
+// AddServer connects a server and registers it to be connected on startup.
+func (c *Client) AddServer(ctx context.Context, server ServerRegistration) (*Server, error) {
+	var result Server
+	return &result, c.do(ctx, "POST", "servers", nil, server, &result)
+}
+
+// DrainResult counts the runs a draining server still has.
+type DrainResult struct {
+	Message string `json:"message"`
+	Queued  int    `json:"queued"`
+	Running int    `json:"running"`
+}
+
+// RemoveServer unregisters a server. It disconnects once its runs finished.
+func (c *Client) RemoveServer(ctx context.Context, name string) (*DrainResult, error) {
+	var result DrainResult
+	return &result, c.do(ctx, "DELETE", segments("servers", name), nil, nil, &result)
+}
+
+// DrainServer stops placing runs on a server, stopping its running containers
+// too with stop.
+func (c *Client) DrainServer(ctx context.Context, name string, stop bool) (*DrainResult, error) {
+	query := url.Values{}
+	setBool(query, "stop", stop)
+	var result DrainResult
+	return &result, c.do(ctx, "POST", segments("servers", name, "drain"), query, nil, &result)
+}
+
+// ResumeServer puts a drained server back in service.
+func (c *Client) ResumeServer(ctx context.Context, name string) (*DrainResult, error) {
+	var result DrainResult
+	return &result, c.do(ctx, "POST", segments("servers", name, "resume"), nil, nil, &result)
+}
+
+// ServerTimeline returns the builds and runs of a server overlapping the
+// range. Zero times default to the last 24 hours.
+func (c *Client) ServerTimeline(ctx context.Context, name string, from, to time.Time) (*Timeline, error) {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query.Set("to", to.Format(time.RFC3339))
+	}
+	var timeline Timeline
+	return &timeline, c.do(ctx, "GET", segments("servers", name, "timeline"), query, nil, &timeline)
+}
+
+// ServerHealth checks a server in depth.
+func (c *Client) ServerHealth(ctx context.Context, name string) (*HealthReport, error) {
+	var report HealthReport
+	return &report, c.do(ctx, "GET", segments("servers", name, "health"), nil, nil, &report)
+}
+
+// ServerInfo describes the container engine of a server.
+func (c *Client) ServerInfo(ctx context.Context, name string) (*EngineInfo, error) {
+	var info EngineInfo
+	return &info, c.do(ctx, "GET", segments("servers", name, "info"), nil, nil, &info)
+}
+
+// ServerQueue returns the runs waiting for a server, next first.
+func (c *Client) ServerQueue(ctx context.Context, name string) ([]QueuedRun, error) {
+	var runs []QueuedRun
+	err := c.do(ctx, "GET", segments("servers", name, "queue"), nil, nil, &runs)
+	return runs, err
+}
+
+// PullImages pulls images onto a server in the background.
+func (c *Client) PullImages(ctx context.Context, server string, images ...string) (*OperationResult, error) {
+	body := map[string][]string{"images": images}
+	var result OperationResult
+	return &result, c.do(ctx, "POST", segments("servers", server, "pull"), nil, body, &result)
+}
+
+// PrewarmServers pulls the configured prewarm images onto every server and
+// returns the operations pulling them.
+func (c *Client) PrewarmServers(ctx context.Context) ([]string, error) {
+	var result struct {
+		Operations []string `json:"operations"`
+	}
+	err := c.do(ctx, "POST", "servers/prewarm", nil, nil, &result)
+	return result.Operations, err
+}
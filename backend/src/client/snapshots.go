@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/url"
+)
+
+// CreateSnapshot records the project files of a workspace, named after the
+// current time if snapshot is empty. With keepImage the image last built is
+// kept with it.
+func (c *Client) CreateSnapshot(ctx context.Context, name, snapshot string, keepImage bool) (*Snapshot, error) {
+	query := url.Values{}
+	setString(query, "name", snapshot)
+	setBool(query, "image", keepImage)
+	var result Snapshot
+	return &result, c.do(ctx, "POST", workspacePath(name, "snapshots"), query, nil, &result)
+}
+
+// ListSnapshots returns the snapshots of a workspace.
+func (c *Client) ListSnapshots(ctx context.Context, name string) ([]Snapshot, error) {
+	var snapshots []Snapshot
+	err := c.do(ctx, "GET", workspacePath(name, "snapshots"), nil, nil, &snapshots)
+	return snapshots, err
+}
+
+// GetSnapshot returns a snapshot of a workspace.
+func (c *Client) GetSnapshot(ctx context.Context, name, snapshot string) (*Snapshot, error) {
+	var result Snapshot
+	return &result, c.do(ctx, "GET", workspacePath(name, "snapshots", snapshot), nil, nil, &result)
+}
+
+// DiffSnapshot compares a snapshot with another, or with the current
+// workspace if against is empty.
+func (c *Client) DiffSnapshot(ctx context.Context, name, snapshot, against string) (*SnapshotDiff, error) {
+	query := url.Values{}
+	setString(query, "against", against)
+	var diff SnapshotDiff
+	return &diff, c.do(ctx, "GET", workspacePath(name, "snapshots", snapshot, "diff"), query, nil, &diff)
+}
+
+// RestoreSnapshot replaces the project files of a workspace with a
+// snapshot's.
+func (c *Client) RestoreSnapshot(ctx context.Context, name, snapshot string) (*OperationResult, error) {
+	var result OperationResult
+	return &result, c.do(ctx, "POST", workspacePath(name, "snapshots", snapshot, "restore"), nil, nil, &result)
+}
@@ -0,0 +1,535 @@
+package client
+
+import (
+	"io/fs"
+	"time"
+)
+
+// Status is the state of a run.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusBuilding  Status = "building"
+	StatusStarting  Status = "starting"
+	StatusRunning   Status = "running"
+	StatusPaused    Status = "paused"
+	StatusExited    Status = "exited"
+	StatusFailed    Status = "failed"
+	StatusTimedOut  Status = "timed_out"
+	StatusCancelled Status = "cancelled"
+	StatusError     Status = "error"
+)
+
+// Terminal reports whether a run in the status is over.
+func (s Status) Terminal() bool {
+	switch s {
+	case StatusExited, StatusFailed, StatusTimedOut, StatusCancelled, StatusError:
+		return true
+	}
+	return false
+}
+
+// Page is one page of a listing.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"` // items matching the filters, on all pages
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+}
+
+// Workspace is a workspace and the image built from it.
+type Workspace struct {
+	ID            *string           `json:"id"`
+	Name          string            `json:"name"`
+	Owner         string            `json:"owner"`
+	Connection    *Connection       `json:"connection"` // server the image runs on
+	Container     *Run              `json:"container"`  // current run
+	Pending       []*Run            `json:"pending"`    // runs building or queued, oldest first
+	Quarantine    *QuarantineInfo   `json:"quarantine"`
+	Snapshot      string            `json:"snapshot"`
+	Prebuilt      string            `json:"prebuilt"`
+	Containerfile string            `json:"containerfile"`
+	Git           string            `json:"git"`
+	Commit        string            `json:"commit"`
+	Target        string            `json:"target"`
+	Labels        map[string]string `json:"labels"`
+	Platforms     map[string]string `json:"platforms"`
+	Manifest      string            `json:"manifest"`
+	ServerImages  map[string]string `json:"server_images"`
+
+	ProtectedFiles []string  `json:"protected_files"`
+	Disk           DiskUsage `json:"disk"`
+}
+
+// Run is a run of a workspace's image and its container.
+type Run struct {
+	ID            string        `json:"id"`
+	RunID         string        `json:"run_id"`
+	Name          string        `json:"name"`
+	Status        Status        `json:"status"`
+	CreatedAt     time.Time     `json:"created_at"`
+	FinishedAt    *time.Time    `json:"finished_at"`
+	ExitCode      *int          `json:"exit_code"`
+	OOMKilled     bool          `json:"oom_killed"`
+	Restarts      int           `json:"restarts"`
+	RestartedAt   *time.Time    `json:"restarted_at"`
+	StdinAttached bool          `json:"stdin_attached"`
+	Usage         ResourceUsage `json:"usage"`
+	ArchivedAt    *time.Time    `json:"archived_at"`
+	RehydratedAt  *time.Time    `json:"rehydrated_at"`
+	StdoutLog     string        `json:"stdout_log"`
+	StderrLog     string        `json:"stderr_log"`
+	BuildLog      string        `json:"build_log"`
+	Commit        string        `json:"commit"`
+	Artifacts     string        `json:"artifacts"`
+	RemovedAt     *time.Time    `json:"removed_at"`
+}
+
+// ResourceUsage summarizes the CPU and memory samples taken during a run.
+type ResourceUsage struct {
+	Samples       int       `json:"samples"`
+	PeakCPU       float64   `json:"peak_cpu_percent"`
+	AvgCPU        float64   `json:"avg_cpu_percent"`
+	PeakMemory    uint64    `json:"peak_memory_bytes"`
+	AvgMemory     uint64    `json:"avg_memory_bytes"`
+	LastSampledAt time.Time `json:"last_sampled_at"`
+}
+
+// QuarantineInfo describes why and when an image was quarantined.
+type QuarantineInfo struct {
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+	Paused   bool      `json:"paused"`
+	Isolated bool      `json:"isolated"`
+	Errors   []string  `json:"errors,omitempty"`
+}
+
+// DiskUsage is the space a workspace uses and may use.
+type DiskUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`
+	QuotaBytes int64 `json:"quota_bytes"` // 0 for unlimited
+}
+
+// Connection is a server maestro is connected to.
+type Connection struct {
+	Server Server `json:"server"`
+}
+
+// Server describes a server and its state.
+type Server struct {
+	Name                string            `json:"name"`
+	Engine              string            `json:"engine,omitempty"`
+	Capacity            Resources         `json:"capacity"`
+	Labels              map[string]string `json:"labels"`
+	MemTotal            string            `json:"memTotal"`
+	MemAvailable        string            `json:"memAvailable"`
+	Platform            string            `json:"platform"`
+	Status              string            `json:"status"`
+	ConsecutiveFailures int               `json:"consecutiveFailures"`
+	Maintenance         string            `json:"maintenance,omitempty"` // draining or maintenance, empty while in service
+}
+
+// Resources are CPUs, memory and GPUs reserved by a run or offered by a
+// server. Zero fields are unlimited.
+type Resources struct {
+	CPUs     float64 `json:"cpus"`
+	MemoryMB int64   `json:"memoryMB"`
+	GPUs     int     `json:"gpus"`
+}
+
+// ServerRegistration is a server to add.
+type ServerRegistration struct {
+	Name         string `json:"name"`
+	Engine       string `json:"engine,omitempty"` // podman (the default), docker or kubernetes
+	URI          string `json:"uri,omitempty"`    // unix://, tcp:// or ssh:// engine URI, instead of the fields below
+	Username     string `json:"username,omitempty"`
+	Host         string `json:"host,omitempty"`
+	Port         int    `json:"port,omitempty"`
+	PodmanSocket string `json:"podman_socket,omitempty"`
+	IdentityFile string `json:"identity_file,omitempty"`
+
+	IdentityPassphraseSecret string `json:"identity_passphrase_secret,omitempty"`
+	KnownHostsFile           string `json:"known_hosts_file,omitempty"`
+	InsecureIgnoreHostKey    bool   `json:"insecure_ignore_host_key,omitempty"`
+	PoolSize                 int    `json:"pool_size,omitempty"`
+	RemoteDir                string `json:"remote_dir,omitempty"`
+	Kubeconfig               string `json:"kubeconfig,omitempty"`
+	Namespace                string `json:"namespace,omitempty"`
+
+	Labels   map[string]string `json:"labels,omitempty"`
+	Capacity Resources         `json:"capacity"`
+}
+
+// ServerGroup is a named set of servers runs can target.
+type ServerGroup struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// Activity is a build or run on a server.
+type Activity struct {
+	Kind  string     `json:"kind"`
+	Image string     `json:"image"`
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end"`
+}
+
+// Timeline is the activity of a server within a range.
+type Timeline struct {
+	Server     string     `json:"server"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Activities []Activity `json:"activities"`
+}
+
+// HealthReport is the result of a deep health check of a server.
+type HealthReport struct {
+	Server              string        `json:"server"`
+	Status              string        `json:"status"`
+	PodmanVersion       string        `json:"podmanVersion,omitempty"`
+	Latency             time.Duration `json:"latencyNs"`
+	DiskAvailable       string        `json:"diskAvailable,omitempty"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	Error               string        `json:"error,omitempty"`
+	CheckedAt           time.Time     `json:"checkedAt"`
+}
+
+// EngineInfo describes the container engine of a server and its host.
+type EngineInfo struct {
+	Engine        string `json:"engine"`
+	Version       string `json:"version"`
+	OS            string `json:"os"`
+	Arch          string `json:"arch"`
+	MemTotal      int64  `json:"memTotal"`
+	StorageRoot   string `json:"storageRoot"`
+	Distribution  string `json:"distribution"`
+	Kernel        string `json:"kernel"`
+	CPUs          int    `json:"cpus"`
+	StorageDriver string `json:"storageDriver"`
+	Images        int    `json:"images"`
+	Containers    int    `json:"containers"`
+}
+
+// QueuedRun is a run waiting for its server.
+type QueuedRun struct {
+	ID       string        `json:"id"`
+	Image    string        `json:"image"`
+	Position int           `json:"position"`
+	QueuedAt time.Time     `json:"queued_at"`
+	Waited   time.Duration `json:"waited_ns"`
+}
+
+// RunOptions are the settings of a single run. Unset fields take the
+// server's defaults.
+type RunOptions struct {
+	Image          string            `json:"image,omitempty"` // prebuilt image to run instead of building the workspace
+	Env            map[string]string `json:"env,omitempty"`
+	Outputs        []string          `json:"outputs,omitempty"` // container paths collected into the run's artifacts
+	Workspace      *WorkspaceMount   `json:"workspace,omitempty"`
+	Resources      Resources         `json:"resources"`
+	Constraints    []string          `json:"constraints,omitempty"` // key=value, key!=value or key server labels
+	Interactive    bool              `json:"interactive,omitempty"`
+	TimeoutMinutes int               `json:"timeout_minutes,omitempty"`
+}
+
+// WorkspaceMount bind-mounts the workspace into a run's container.
+type WorkspaceMount struct {
+	Subdir   string `json:"subdir"`
+	Target   string `json:"target"` // container path, defaults to /workspace
+	ReadOnly bool   `json:"readOnly"`
+}
+
+// Operation is a long-running action such as a run, a build or an archival.
+type Operation struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Image      string          `json:"image"`
+	Target     string          `json:"target,omitempty"`
+	Server     string          `json:"server,omitempty"`
+	Group      string          `json:"group,omitempty"`
+	Status     string          `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Result     string          `json:"result,omitempty"`
+	Progress   float64         `json:"progress"` // 0 to 1
+	Steps      []OperationStep `json:"steps"`
+	Logs       []OperationLog  `json:"logs"`
+	Cancelable bool            `json:"cancelable"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+
+	ContainerID   string     `json:"container_id,omitempty"`
+	Snapshot      string     `json:"snapshot,omitempty"`
+	Containerfile string     `json:"containerfile,omitempty"`
+	Requested     RunOptions `json:"requested"`
+}
+
+// OperationStep is the state of one step of an operation.
+type OperationStep struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// OperationLog is a line of an operation's log.
+type OperationLog struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// PlacementTrace records how the scheduler chose the server of a run.
+type PlacementTrace struct {
+	RunID       string               `json:"run_id"`
+	Image       string               `json:"image"`
+	Server      string               `json:"server,omitempty"`
+	Group       string               `json:"group,omitempty"`
+	Constraints []string             `json:"constraints,omitempty"`
+	Selected    string               `json:"selected,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Candidates  []PlacementCandidate `json:"candidates"`
+	DecidedAt   time.Time            `json:"decided_at"`
+}
+
+// PlacementCandidate is a server the scheduler considered for a run.
+type PlacementCandidate struct {
+	Server   string    `json:"server"`
+	Eligible bool      `json:"eligible"`
+	Reason   string    `json:"reason,omitempty"`
+	Running  int       `json:"running"`
+	Queued   int       `json:"queued"`
+	Reserved Resources `json:"reserved"`
+}
+
+// FileEntry is a file or directory of a workspace.
+type FileEntry struct {
+	Path    string    `json:"path"` // slash-separated, relative to the workspace
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256,omitempty"`
+}
+
+// WorkspaceRepo is the repository a workspace was cloned from.
+type WorkspaceRepo struct {
+	URL       string   `json:"url"`
+	Ref       string   `json:"ref"`
+	DeployKey string   `json:"deploy_key"`
+	Commit    string   `json:"commit"`  // suffixed -dirty with local changes
+	Trigger   []string `json:"trigger"` // repository webhook events that pull and run the workspace
+
+	TriggerSecret string `json:"trigger_secret"` // secret the repository webhook is signed with
+}
+
+// Upload is a file being uploaded in chunks.
+type Upload struct {
+	ID        string    `json:"id"`
+	Image     string    `json:"image"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	SHA256    string    `json:"sha256"`
+	Offset    int64     `json:"offset"` // bytes received so far
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// StorageReport breaks down the space used by a workspace.
+type StorageReport struct {
+	Image      string                   `json:"image"`
+	TotalBytes int64                    `json:"total_bytes"`
+	Categories map[string]CategoryUsage `json:"categories"`
+}
+
+// CategoryUsage is the space used by one storage category.
+type CategoryUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+}
+
+// CleanupResult reports what a storage cleanup removed and what it left.
+type CleanupResult struct {
+	Category     string   `json:"category"`
+	Removed      []string `json:"removed"`
+	RemovedBytes int64    `json:"removed_bytes"`
+	Skipped      []string `json:"skipped"`
+}
+
+// Snapshot is an immutable manifest of a workspace's project files.
+type Snapshot struct {
+	Name       string         `json:"name"`
+	Image      string         `json:"image"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Files      []SnapshotFile `json:"files"`
+	BuiltImage *SnapshotImage `json:"built_image,omitempty"`
+}
+
+// SnapshotFile is a file recorded in a snapshot.
+type SnapshotFile struct {
+	Path   string      `json:"path"`
+	SHA256 string      `json:"sha256"`
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+}
+
+// SnapshotImage is the image a snapshot kept.
+type SnapshotImage struct {
+	ID       string `json:"id"`
+	Server   string `json:"server"`
+	Tag      string `json:"tag,omitempty"`
+	Prebuilt string `json:"prebuilt,omitempty"`
+}
+
+// SnapshotDiff lists the files that differ between two file sets.
+type SnapshotDiff struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// ImagePolicy restricts which images projects may build FROM or run.
+type ImagePolicy struct {
+	AllowedRegistries []string `json:"allowed_registries"`
+	DeniedRegistries  []string `json:"denied_registries"`
+	AllowedImages     []string `json:"allowed_images"`
+	DeniedImages      []string `json:"denied_images"`
+	DenyLatest        bool     `json:"deny_latest"`
+}
+
+// PolicyDecision is the outcome of checking one image reference.
+type PolicyDecision struct {
+	Image   string `json:"image"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SecretInfo is the metadata of a secret.
+type SecretInfo struct {
+	Name      string    `json:"name"`
+	KeyID     string    `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// User is who a request is authenticated as.
+type User struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"` // user name of single sign-on users, whose Name is their subject
+	Role        string `json:"role"`
+}
+
+// Event is a lifecycle change of an image or its container.
+type Event struct {
+	Type      string    `json:"type"`
+	Image     string    `json:"image"`
+	Server    string    `json:"server,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Position  int       `json:"position,omitempty"`
+	Suggested []string  `json:"suggested,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// AuditEntry is a request recorded in the audit log.
+type AuditEntry struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UserName   string    `json:"user_name"`
+	Role       string    `json:"role"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`
+	Status     int64     `json:"status"`
+	ClientIP   string    `json:"client_ip"`
+	RequestID  string    `json:"request_id"`
+	DurationMs int64     `json:"duration_ms"`
+}
+
+// MigrationInfo is an embedded database migration and its state.
+type MigrationInfo struct {
+	Version   int64      `json:"version"`
+	Path      string     `json:"path"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// MigrationResult describes a migration that was run.
+type MigrationResult struct {
+	Version   int64         `json:"version"`
+	Path      string        `json:"path"`
+	Direction string        `json:"direction"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// Metrics are the request, cache and database metrics of the server.
+type Metrics struct {
+	Endpoints map[string]EndpointStats `json:"endpoints"`
+	Cache     map[string]CacheStats    `json:"cache"`
+	Database  map[string]any           `json:"database"`
+}
+
+// EndpointStats aggregates the requests served by one route.
+type EndpointStats struct {
+	Count  int64         `json:"count"`
+	Errors int64         `json:"errors"`
+	Total  time.Duration `json:"total_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+// CacheStats counts the lookups of one listing cache.
+type CacheStats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+// Webhook is a URL notified of run lifecycle events.
+type Webhook struct {
+	ID        string    `json:"id"`
+	Workspace string    `json:"workspace,omitempty"` // empty for webhooks of every workspace
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`           // every event if empty
+	Headers   []string  `json:"headers"`          // names of the custom headers
+	Secret    string    `json:"secret,omitempty"` // only returned by CreateWebhook
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID         int64     `json:"id"`
+	WebhookID  string    `json:"webhook_id"`
+	DeliveryID string    `json:"delivery_id"` // shared by the attempts of one event
+	Event      string    `json:"event"`
+	Attempt    int64     `json:"attempt"`
+	StatusCode int64     `json:"status_code"` // 0 if no response was received
+	Error      string    `json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookPayload is the body posted to webhooks.
+type WebhookPayload struct {
+	Delivery  string    `json:"delivery"`
+	Event     string    `json:"event"` // queued, started, finished, failed or delayed
+	Workspace string    `json:"workspace"`
+	Server    string    `json:"server,omitempty"`
+	Run       string    `json:"run,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Position  int       `json:"position,omitempty"`  // queue position of queued and delayed runs
+	Suggested []string  `json:"suggested,omitempty"` // servers with free capacity for delayed runs
+	Time      time.Time `json:"time"`
+}
+
+// NotificationChannel is a Slack or Discord channel notified of runs.
+type NotificationChannel struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"` // slack or discord
+	URL       string    `json:"url"`      // only the host of the webhook URL
+	Workspace string    `json:"workspace,omitempty"`
+	User      string    `json:"user,omitempty"` // set for the channels of a user's workspaces
+	Events    []string  `json:"events"`         // every event if empty
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+)
+
+// CreateUpload starts a resumable upload of a workspace file of the size.
+// The file is checked against the SHA-256 on completion unless it is empty.
+func (c *Client) CreateUpload(ctx context.Context, name, path string, size int64, sha256 string) (*Upload, error) {
+	body := struct {
+		Path   string `json:"path"`
+		Size   int64  `json:"size"`
+		SHA256 string `json:"sha256,omitempty"`
+	}{path, size, sha256}
+	var upload Upload
+	return &upload, c.do(ctx, "POST", workspacePath(name, "uploads"), nil, body, &upload)
+}
+
+// GetUpload returns the progress of an upload, whose offset is where to
+// resume it.
+func (c *Client) GetUpload(ctx context.Context, name, id string) (*Upload, error) {
+	var upload Upload
+	return &upload, c.do(ctx, "GET", workspacePath(name, "uploads", id), nil, nil, &upload)
+}
+
+// AppendUpload sends the chunk of an upload starting at offset. It fails with
+// CodeOffsetMismatch unless offset is the upload's current offset.
+func (c *Client) AppendUpload(ctx context.Context, name, id string, offset int64, chunk []byte) (*Upload, error) {
+	header := http.Header{"Upload-Offset": {strconv.FormatInt(offset, 10)}}
+	resp, err := c.send(ctx, "PATCH", workspacePath(name, "uploads", id), nil, bytes.NewReader(chunk), "application/offset+octet-stream", header)
+	if err != nil {
+		return nil, err
+	}
+	var upload Upload
+	return &upload, decodeInto(resp, &upload)
+}
+
+// CompleteUpload verifies a fully sent upload and moves it into the
+// workspace.
+func (c *Client) CompleteUpload(ctx context.Context, name, id string) error {
+	return c.do(ctx, "POST", workspacePath(name, "uploads", id, "complete"), nil, nil, nil)
+}
+
+// AbortUpload discards an upload and what it received.
+func (c *Client) AbortUpload(ctx context.Context, name, id string) error {
+	return c.do(ctx, "DELETE", workspacePath(name, "uploads", id), nil, nil, nil)
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListWebhooks returns the webhooks of the workspaces the user can access, and
+// the global ones to admins.
+func (c *Client) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	var hooks []Webhook
+	err := c.do(ctx, "GET", "webhooks", nil, nil, &hooks)
+	return hooks, err
+}
+
+// WebhookOptions describes the webhook CreateWebhook registers.
+type WebhookOptions struct {
+	URL       string            `json:"url"`
+	Workspace string            `json:"workspace,omitempty"` // every workspace if empty
+	Events    []string          `json:"events,omitempty"`    // every event if empty
+	Headers   map[string]string `json:"headers,omitempty"`   // sent with every delivery
+}
+
+// CreateWebhook registers a webhook notified of run lifecycle events. The
+// returned webhook carries the secret its payloads are signed with.
+func (c *Client) CreateWebhook(ctx context.Context, opts WebhookOptions) (*Webhook, error) {
+	var hook Webhook
+	return &hook, c.do(ctx, "POST", "webhooks", nil, opts, &hook)
+}
+
+// DeleteWebhook removes a webhook with its delivery history.
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", segments("webhooks", id), nil, nil, nil)
+}
+
+// WebhookDeliveries returns the most recent delivery attempts of a webhook,
+// 100 unless limit is set.
+func (c *Client) WebhookDeliveries(ctx context.Context, id string, limit int) ([]WebhookDelivery, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var deliveries []WebhookDelivery
+	err := c.do(ctx, "GET", segments("webhooks", id, "deliveries"), query, nil, &deliveries)
+	return deliveries, err
+}
+
+// VerifyWebhook checks that a payload received by a webhook was signed with
+// its secret no longer than maxAge ago, to reject replays.
+func VerifyWebhook(secret string, header http.Header, body []byte, maxAge time.Duration) error {
+	signature, ok := strings.CutPrefix(header.Get("X-Maestro-Signature"), "sha256=")
+	if !ok {
+		return errors.New("maestro: missing webhook signature")
+	}
+	timestamp := header.Get("X-Maestro-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("maestro: invalid webhook timestamp")
+	}
+	if time.Since(time.Unix(sent, 0)) > maxAge {
+		return errors.New("maestro: webhook payload too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, mac.Sum(nil)) {
+		return errors.New("maestro: invalid webhook signature")
+	}
+	return nil
+}
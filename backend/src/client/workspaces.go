@@ -0,0 +1,235 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ListOptions pages, filters and sorts a listing. Zero fields take the
+// server's defaults; filters a listing does not support are ignored.
+type ListOptions struct {
+	Page   int
+	Limit  int
+	Status string
+	Server string
+	Sort   string // field to sort by, prefixed with - for descending order
+}
+
+func (o ListOptions) query() url.Values {
+	query := url.Values{}
+	if o.Page > 0 {
+		query.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Limit > 0 {
+		query.Set("limit", strconv.Itoa(o.Limit))
+	}
+	setString(query, "status", o.Status)
+	setString(query, "server", o.Server)
+	setString(query, "sort", o.Sort)
+	return query
+}
+
+// ListWorkspaces returns a page of the workspaces the user can access. They
+// can be sorted by name, owner, status or created_at.
+func (c *Client) ListWorkspaces(ctx context.Context, opts ListOptions) (*Page[Workspace], error) {
+	var page Page[Workspace]
+	return &page, c.do(ctx, "GET", "workspaces", opts.query(), nil, &page)
+}
+
+// GetWorkspace returns a workspace.
+func (c *Client) GetWorkspace(ctx context.Context, name string) (*Workspace, error) {
+	var workspace Workspace
+	return &workspace, c.do(ctx, "GET", workspacePath(name), nil, nil, &workspace)
+}
+
+// CreateWorkspace creates an empty workspace owned by the user.
+func (c *Client) CreateWorkspace(ctx context.Context, name string) error {
+	return c.do(ctx, "POST", workspacePath(name), nil, nil, nil)
+}
+
+// DeleteOptions tunes what DeleteWorkspace removes.
+type DeleteOptions struct {
+	Force   bool // remove running containers too
+	Volumes bool // remove the anonymous volumes of the containers
+}
+
+// DeleteWorkspace removes a workspace's containers, images and files.
+func (c *Client) DeleteWorkspace(ctx context.Context, name string, opts DeleteOptions) error {
+	query := url.Values{}
+	setBool(query, "force", opts.Force)
+	setBool(query, "volumes", opts.Volumes)
+	return c.do(ctx, "DELETE", workspacePath(name), query, nil, nil)
+}
+
+// SetOwner transfers a workspace to another user.
+func (c *Client) SetOwner(ctx context.Context, name, owner string) error {
+	body := map[string]string{"owner": owner}
+	return c.do(ctx, "PUT", workspacePath(name, "owner"), nil, body, nil)
+}
+
+// RunRequest is where and how to run an image.
+type RunRequest struct {
+	Server        string // server to run on, empty lets the scheduler pick
+	Group         string // server group to run on
+	Snapshot      string // snapshot to build from instead of the workspace
+	Containerfile string // Containerfile relative to the workspace
+	Options       *RunOptions
+}
+
+// RunResult is the accepted run of an image.
+type RunResult struct {
+	Message   string `json:"message"`
+	QueueID   string `json:"queue_id"`
+	Operation string `json:"operation"`
+	Position  int    `json:"position"` // in its server's queue
+}
+
+// Run builds the image if needed and queues it to run.
+func (c *Client) Run(ctx context.Context, name string, req RunRequest) (*RunResult, error) {
+	query := url.Values{}
+	setString(query, "serverName", req.Server)
+	setString(query, "serverGroup", req.Group)
+	setString(query, "snapshot", req.Snapshot)
+	setString(query, "containerfile", req.Containerfile)
+
+	var in any
+	if req.Options != nil {
+		in = req.Options
+	}
+	var result RunResult
+	return &result, c.do(ctx, "POST", workspacePath(name, "runs"), query, in, &result)
+}
+
+// BuildRequest is where and how to build an image.
+type BuildRequest struct {
+	Server  string   // server to build on, "all" for every server
+	Servers []string // servers to build on at once
+
+	Snapshot      string // snapshot to build from instead of the workspace
+	Containerfile string
+	Git           string // repository to build from instead of the workspace
+	Ref           string
+	Subdir        string
+	DeployKey     string // secret holding the deploy key of an ssh repository
+
+	NoCache    bool
+	PullPolicy string
+	ForceRm    bool
+	Platforms  []string
+	Target     string // Containerfile stage to build
+	Labels     map[string]string
+
+	Push bool   // push to the configured registry once built
+	Tag  string // tag to push as, latest if empty
+}
+
+// BuildResult is a started build.
+type BuildResult struct {
+	Message   string   `json:"message"`
+	Build     string   `json:"build"`
+	Operation string   `json:"operation"`
+	Servers   []string `json:"servers,omitempty"` // of builds on several servers
+}
+
+// Build starts a build of an image in the background, see GetBuild.
+func (c *Client) Build(ctx context.Context, name string, req BuildRequest) (*BuildResult, error) {
+	query := url.Values{}
+	setString(query, "serverName", req.Server)
+	setString(query, "servers", strings.Join(req.Servers, ","))
+	setString(query, "snapshot", req.Snapshot)
+	setString(query, "containerfile", req.Containerfile)
+	setString(query, "git", req.Git)
+	setString(query, "ref", req.Ref)
+	setString(query, "subdir", req.Subdir)
+	setString(query, "deploy_key", req.DeployKey)
+	setBool(query, "noCache", req.NoCache)
+	setString(query, "pullPolicy", req.PullPolicy)
+	setBool(query, "forceRm", req.ForceRm)
+	setString(query, "platforms", strings.Join(req.Platforms, ","))
+	setString(query, "target", req.Target)
+	for key, value := range req.Labels {
+		query.Add("label", key+"="+value)
+	}
+	setBool(query, "push", req.Push)
+	setString(query, "tag", req.Tag)
+
+	var result BuildResult
+	return &result, c.do(ctx, "POST", workspacePath(name, "build"), query, nil, &result)
+}
+
+// GetBuild returns the progress and result of a build.
+func (c *Client) GetBuild(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	return &op, c.do(ctx, "GET", segments("builds", id), nil, nil, &op)
+}
+
+// CancelBuild stops a running build.
+func (c *Client) CancelBuild(ctx context.Context, id string) (*Operation, error) {
+	var op Operation
+	return &op, c.do(ctx, "POST", segments("builds", id, "cancel"), nil, nil, &op)
+}
+
+// BuildLog streams the output of the image's latest build until it finishes.
+// The caller closes the log.
+func (c *Client) BuildLog(ctx context.Context, name string) (io.ReadCloser, error) {
+	return c.download(ctx, workspacePath(name, "build", "log"), nil, nil)
+}
+
+// OperationResult names the operation an action started.
+type OperationResult struct {
+	Message   string `json:"message"`
+	Operation string `json:"operation"`
+}
+
+// Transfer copies the image built on server from, the server it last ran on
+// if empty, to server to.
+func (c *Client) Transfer(ctx context.Context, name, from, to string) (*OperationResult, error) {
+	query := url.Values{"to": {to}}
+	setString(query, "from", from)
+	var result OperationResult
+	return &result, c.do(ctx, "POST", workspacePath(name, "transfer"), query, nil, &result)
+}
+
+// ScaffoldRequest picks the template of a starter Containerfile.
+type ScaffoldRequest struct {
+	Template   string `json:"template"` // python, r, node or cuda
+	Entrypoint bool   `json:"entrypoint"`
+	Overwrite  bool   `json:"overwrite"`
+}
+
+// Scaffold writes a starter Containerfile into the workspace and returns the
+// files written.
+func (c *Client) Scaffold(ctx context.Context, name string, req ScaffoldRequest) ([]string, error) {
+	var result struct {
+		Files []string `json:"files"`
+	}
+	err := c.do(ctx, "POST", workspacePath(name, "scaffold"), nil, req, &result)
+	return result.Files, err
+}
+
+// Quarantine pauses and/or isolates an image's container, per mode pause,
+// isolate or both (the default), and blocks further runs.
+func (c *Client) Quarantine(ctx context.Context, name, reason, mode string) (*QuarantineInfo, error) {
+	query := url.Values{"reason": {reason}}
+	setString(query, "mode", mode)
+	var result struct {
+		Quarantine *QuarantineInfo `json:"quarantine"`
+	}
+	err := c.do(ctx, "POST", workspacePath(name, "quarantine"), query, nil, &result)
+	return result.Quarantine, err
+}
+
+// Release lifts the quarantine of an image.
+func (c *Client) Release(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", workspacePath(name, "quarantine"), nil, nil, nil)
+}
+
+// ListImageOperations returns the most recent operations of an image.
+func (c *Client) ListImageOperations(ctx context.Context, name string) ([]Operation, error) {
+	var operations []Operation
+	err := c.do(ctx, "GET", workspacePath(name, "operations"), nil, nil, &operations)
+	return operations, err
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"log/slog"
+	"maestro/src/database/schema"
+	"time"
+
+	"github.com/pressly/goose/v3"
+	_ "modernc.org/sqlite"
+)
+
+var (
+	//go:embed migrations/*.sql
+	embedMigrations embed.FS
+)
+
+// Config locates the database file and tunes migrations and instrumentation.
+type Config struct {
+	Path           string `yaml:"path"`           // sqlite file, defaults to db.sqlite in the working directory
+	SkipMigrations bool   `yaml:"skipMigrations"` // only report pending migrations at startup
+	SlowQueryMs    int    `yaml:"slowQueryMs"`    // slow query log threshold, defaults to 200ms
+}
+
+// DB is an open database with its generated queries.
+type DB struct {
+	Conn  *sql.DB
+	Query *schema.Queries
+
+	provider *goose.Provider
+	metrics  *queryMetrics
+	log      *slog.Logger
+}
+
+// Open connects to the database described by cfg and, unless disabled, applies
+// pending migrations. Migrations and slow queries are logged to log.
+func Open(ctx context.Context, cfg Config, log *slog.Logger) (*DB, error) {
+	path := cfg.Path
+	if path == "" {
+		path = "db.sqlite"
+	}
+
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", path, err)
+	}
+
+	// Check if the connection is working
+	if err := conn.PingContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to sqlite database %s: %w", path, err)
+	}
+
+	provider, err := newProvider(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	slowThreshold := defaultSlowQuery
+	if cfg.SlowQueryMs > 0 {
+		slowThreshold = time.Duration(cfg.SlowQueryMs) * time.Millisecond
+	}
+
+	db := &DB{
+		Conn:     conn,
+		provider: provider,
+		metrics:  &queryMetrics{stats: map[string]*QueryStats{}, slowThreshold: slowThreshold, log: log},
+		log:      log,
+	}
+
+	// Create the queries, timing every statement they run
+	db.Query = schema.New(&instrumentedDB{db: conn, metrics: db.metrics})
+
+	if err := db.autoMigrate(ctx, !cfg.SkipMigrations); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	log.Info("Connected to sqlite database", "path", path)
+
+	return db, nil
+}
+
+// Ping checks that the database is reachable.
+func (db *DB) Ping(ctx context.Context) error {
+	return db.Conn.PingContext(ctx)
+}
+
+// Close closes the underlying connection pool.
+func (db *DB) Close() error {
+	return db.Conn.Close()
+}
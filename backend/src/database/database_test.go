@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// importChildEnv marks the copy of the test binary TestImportOpensNoDatabase
+// runs, which only initialises the package.
+const importChildEnv = "MAESTRO_DATABASE_IMPORT_CHILD"
+
+// The package must not open a database on import: tests, tools and the
+// migration commands import it without one. The test binary is run again in
+// an empty directory, where a database opened on import would be created.
+func TestImportOpensNoDatabase(t *testing.T) {
+	if os.Getenv(importChildEnv) != "" {
+		return
+	}
+
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestImportOpensNoDatabase$")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), importChildEnv+"=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("run package initialisation: %v\n%s", err, out)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		t.Errorf("importing the package created %s", entry.Name())
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name           string
+		skipMigrations bool
+		pending        bool
+	}{
+		{"migrates", false, false},
+		{"skips migrations", true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Path: filepath.Join(t.TempDir(), "db.sqlite"), SkipMigrations: tt.skipMigrations}
+			db, err := Open(context.Background(), cfg, slog.New(slog.DiscardHandler))
+			if err != nil {
+				t.Fatalf("Open: %v", err)
+			}
+			defer db.Close()
+
+			pending, err := db.PendingMigrations(context.Background())
+			if err != nil {
+				t.Fatalf("PendingMigrations: %v", err)
+			}
+			if got := len(pending) > 0; got != tt.pending {
+				t.Errorf("pending migrations = %d, want pending %v", len(pending), tt.pending)
+			}
+		})
+	}
+}
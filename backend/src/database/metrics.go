@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultSlowQuery is the slow query threshold when none is configured.
+const defaultSlowQuery = 200 * time.Millisecond
+
+// QueryStats aggregates the executions of one named query.
+type QueryStats struct {
+	Count  int64         `json:"count"`
+	Errors int64         `json:"errors"`
+	Slow   int64         `json:"slow"`
+	Total  time.Duration `json:"total_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+type queryMetrics struct {
+	stats         map[string]*QueryStats
+	slowThreshold time.Duration
+	log           *slog.Logger
+
+	mu sync.Mutex
+}
+
+// QueryMetrics returns a copy of the per-query statistics.
+func (db *DB) QueryMetrics() map[string]QueryStats {
+	db.metrics.mu.Lock()
+	defer db.metrics.mu.Unlock()
+
+	metrics := make(map[string]QueryStats, len(db.metrics.stats))
+	for name, stats := range db.metrics.stats {
+		metrics[name] = *stats
+	}
+	return metrics
+}
+
+// PoolStats returns the connection pool statistics of the database.
+func (db *DB) PoolStats() sql.DBStats {
+	return db.Conn.Stats()
+}
+
+// queryName extracts the sqlc query name from the "-- name: X :kind" header of
+// generated queries, falling back to the first line of the statement.
+func queryName(query string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(query), "\n")
+	if rest, ok := strings.CutPrefix(line, "-- name: "); ok {
+		name, _, _ := strings.Cut(rest, " ")
+		return name
+	}
+	return line
+}
+
+func (m *queryMetrics) observe(query string, start time.Time, err error) {
+	elapsed := time.Since(start)
+	name := queryName(query)
+	slow := elapsed >= m.slowThreshold
+
+	m.mu.Lock()
+	stats, ok := m.stats[name]
+	if !ok {
+		stats = &QueryStats{}
+		m.stats[name] = stats
+	}
+	stats.Count++
+	stats.Total += elapsed
+	stats.Max = max(stats.Max, elapsed)
+	if err != nil && err != sql.ErrNoRows {
+		stats.Errors++
+	}
+	if slow {
+		stats.Slow++
+	}
+	m.mu.Unlock()
+
+	if slow {
+		m.log.Warn("Slow query", "query", name, "duration", elapsed, "threshold", m.slowThreshold)
+	}
+}
+
+// instrumentedDB times every statement sent through the sqlc queries and logs
+// the ones slower than the threshold.
+type instrumentedDB struct {
+	db      *sql.DB
+	metrics *queryMetrics
+}
+
+func (i *instrumentedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := i.db.ExecContext(ctx, query, args...)
+	i.metrics.observe(query, start, err)
+	return result, err
+}
+
+func (i *instrumentedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	start := time.Now()
+	stmt, err := i.db.PrepareContext(ctx, query)
+	i.metrics.observe(query, start, err)
+	return stmt, err
+}
+
+func (i *instrumentedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := i.db.QueryContext(ctx, query, args...)
+	i.metrics.observe(query, start, err)
+	return rows, err
+}
+
+func (i *instrumentedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := i.db.QueryRowContext(ctx, query, args...)
+	i.metrics.observe(query, start, row.Err())
+	return row
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/pressly/goose/v3"
+)
+
+// MigrationInfo describes one embedded migration and whether it is applied.
+type MigrationInfo struct {
+	Version   int64      `json:"version"`
+	Path      string     `json:"path"`
+	State     string     `json:"state"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// MigrationResult describes a migration that was (or would be) run.
+type MigrationResult struct {
+	Version   int64         `json:"version"`
+	Path      string        `json:"path"`
+	Direction string        `json:"direction"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+func newProvider(conn *sql.DB) (*goose.Provider, error) {
+	fsys, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return goose.NewProvider(goose.DialectSQLite3, conn, fsys)
+}
+
+// MigrationStatus lists every embedded migration with its state.
+func (db *DB) MigrationStatus(ctx context.Context) ([]MigrationInfo, error) {
+	statuses, err := db.provider.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]MigrationInfo, 0, len(statuses))
+	for _, status := range statuses {
+		info := MigrationInfo{
+			Version: status.Source.Version,
+			Path:    status.Source.Path,
+			State:   string(status.State),
+		}
+		if status.State == goose.StateApplied {
+			appliedAt := status.AppliedAt
+			info.AppliedAt = &appliedAt
+		}
+		migrations = append(migrations, info)
+	}
+	return migrations, nil
+}
+
+// PendingMigrations lists the migrations MigrateUp would apply, without
+// applying them.
+func (db *DB) PendingMigrations(ctx context.Context) ([]MigrationInfo, error) {
+	migrations, err := db.MigrationStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []MigrationInfo{}
+	for _, migration := range migrations {
+		if migration.State == string(goose.StatePending) {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// CurrentVersion returns the version of the last applied migration.
+func (db *DB) CurrentVersion(ctx context.Context) (int64, error) {
+	return db.provider.GetDBVersion(ctx)
+}
+
+// MigrateUp applies all pending migrations.
+func (db *DB) MigrateUp(ctx context.Context) ([]MigrationResult, error) {
+	results, err := db.provider.Up(ctx)
+	return convertResults(results), err
+}
+
+// MigrateDown rolls back the most recently applied migration.
+func (db *DB) MigrateDown(ctx context.Context) (*MigrationResult, error) {
+	result, err := db.provider.Down(ctx)
+	if result == nil {
+		return nil, err
+	}
+	converted := convertResults([]*goose.MigrationResult{result})
+	return &converted[0], err
+}
+
+func convertResults(results []*goose.MigrationResult) []MigrationResult {
+	converted := make([]MigrationResult, 0, len(results))
+	for _, result := range results {
+		converted = append(converted, MigrationResult{
+			Version:   result.Source.Version,
+			Path:      result.Source.Path,
+			Direction: result.Direction,
+			Duration:  result.Duration,
+		})
+	}
+	return converted
+}
+
+// autoMigrate applies pending migrations at startup unless disabled, in which
+// case pending migrations are only reported.
+func (db *DB) autoMigrate(ctx context.Context, enabled bool) error {
+	if !enabled {
+		pending, err := db.PendingMigrations(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			db.log.Warn("Pending migrations not applied, auto-migration is disabled", "pending", len(pending))
+		}
+		return nil
+	}
+
+	results, err := db.MigrateUp(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to run migrations: %w", err)
+	}
+	db.log.Info("Migrations ran successfully", "applied", len(results))
+	return nil
+}
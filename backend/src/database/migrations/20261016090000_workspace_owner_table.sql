@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS workspace_owner (
+    image TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_owner_owner ON workspace_owner(owner);
+
+-- +goose Down
+DROP TABLE IF EXISTS workspace_owner;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS operation (
+    id TEXT PRIMARY KEY,
+    kind TEXT NOT NULL,
+    image TEXT NOT NULL,
+    server TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL,
+    data TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_operation_image ON operation(image, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_operation_status ON operation(status);
+
+-- +goose Down
+DROP TABLE IF EXISTS operation;
@@ -0,0 +1,17 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS notification_channel (
+    id TEXT PRIMARY KEY,
+    provider TEXT NOT NULL,
+    url TEXT NOT NULL,
+    image TEXT NOT NULL DEFAULT '',
+    user_name TEXT NOT NULL DEFAULT '',
+    events TEXT NOT NULL DEFAULT '',
+    created_by TEXT NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_channel_image ON notification_channel(image);
+CREATE INDEX IF NOT EXISTS idx_notification_channel_user ON notification_channel(user_name);
+
+-- +goose Down
+DROP TABLE IF EXISTS notification_channel;
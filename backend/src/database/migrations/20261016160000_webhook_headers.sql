@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE webhook ADD COLUMN headers TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE webhook DROP COLUMN headers;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS run (
+    id TEXT PRIMARY KEY,
+    image TEXT NOT NULL,
+    status TEXT NOT NULL,
+    data TEXT NOT NULL,
+    hot_since DATETIME,
+    archived_at DATETIME,
+    archive_path TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_run_image ON run(image, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_run_hot_since ON run(hot_since) WHERE archived_at IS NULL;
+
+-- +goose Down
+DROP TABLE IF EXISTS run;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- sessions are keyed on the subject from now on, those keyed on the user
+-- name have to log in again
+DELETE FROM session;
+ALTER TABLE session ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE session DROP COLUMN display_name;
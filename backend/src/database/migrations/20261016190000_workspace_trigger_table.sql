@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS workspace_trigger (
+    image TEXT PRIMARY KEY,
+    repository TEXT NOT NULL,
+    ref TEXT NOT NULL DEFAULT '',
+    events TEXT NOT NULL,
+    secret TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_workspace_trigger_repository ON workspace_trigger(repository);
+
+-- +goose Down
+DROP TABLE IF EXISTS workspace_trigger;
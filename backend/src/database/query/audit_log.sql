@@ -0,0 +1,13 @@
+-- name: InsertAuditLog :exec
+INSERT INTO audit_log (created_at, user_name, role, method, path, route, status, client_ip, request_id, duration_ms)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListAuditLog :many
+SELECT * FROM audit_log
+WHERE (@user_name = '' OR user_name = @user_name)
+  AND (@method = '' OR method = @method)
+  AND path LIKE @path_prefix || '%'
+  AND created_at >= @since
+  AND created_at < @until
+ORDER BY id DESC
+LIMIT @row_limit;
@@ -0,0 +1,25 @@
+-- name: CreateIdempotencyKey :execrows
+INSERT INTO idempotency_key (user_name, idempotency_key, fingerprint, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (user_name, idempotency_key) DO NOTHING;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_key
+WHERE user_name = ? AND idempotency_key = ? AND expires_at > ?;
+
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_key
+SET status = ?, content_type = ?, body = ?
+WHERE user_name = ? AND idempotency_key = ?;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_key
+WHERE user_name = ? AND idempotency_key = ?;
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_key
+WHERE expires_at <= ?;
+
+-- name: DeletePendingIdempotencyKeys :execrows
+DELETE FROM idempotency_key
+WHERE status = 0;
@@ -0,0 +1,24 @@
+-- name: CreateNotificationChannel :exec
+INSERT INTO notification_channel (id, provider, url, image, user_name, events, created_by, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetNotificationChannel :one
+SELECT * FROM notification_channel
+WHERE id = ?;
+
+-- name: ListNotificationChannels :many
+SELECT * FROM notification_channel
+ORDER BY created_at;
+
+-- name: ListRunNotificationChannels :many
+SELECT * FROM notification_channel
+WHERE image = ? OR (image = '' AND user_name = ?)
+ORDER BY created_at;
+
+-- name: DeleteNotificationChannel :exec
+DELETE FROM notification_channel
+WHERE id = ?;
+
+-- name: DeleteImageNotificationChannels :exec
+DELETE FROM notification_channel
+WHERE image = ?;
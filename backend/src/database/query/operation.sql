@@ -0,0 +1,31 @@
+-- name: UpsertOperation :exec
+INSERT INTO operation (id, kind, image, server, status, data, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+    server = excluded.server,
+    status = excluded.status,
+    data = excluded.data,
+    updated_at = excluded.updated_at;
+
+-- name: GetOperation :one
+SELECT * FROM operation
+WHERE id = ?;
+
+-- name: ListImageOperations :many
+SELECT * FROM operation
+WHERE image = ?
+ORDER BY created_at DESC
+LIMIT ?;
+
+-- name: ListOperationsByStatus :many
+SELECT * FROM operation
+WHERE status = ?
+ORDER BY created_at;
+
+-- name: ListOperations :many
+SELECT * FROM operation
+WHERE (@kind = '' OR kind = @kind)
+  AND (@status = '' OR status = @status)
+  AND (@image = '' OR image = @image)
+ORDER BY created_at DESC
+LIMIT @row_limit;
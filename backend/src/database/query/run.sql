@@ -0,0 +1,23 @@
+-- name: UpsertRun :exec
+INSERT INTO run (id, image, status, data, hot_since, archived_at, archive_path, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT (id) DO UPDATE SET
+    status = excluded.status,
+    data = excluded.data,
+    hot_since = excluded.hot_since,
+    archived_at = excluded.archived_at,
+    archive_path = excluded.archive_path,
+    updated_at = excluded.updated_at;
+
+-- name: GetRun :one
+SELECT * FROM run
+WHERE image = ? AND id = ?;
+
+-- name: ListRunsToArchive :many
+SELECT * FROM run
+WHERE archived_at IS NULL AND hot_since < ?
+ORDER BY image, hot_since;
+
+-- name: DeleteImageRuns :exec
+DELETE FROM run
+WHERE image = ?;
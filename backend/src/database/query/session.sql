@@ -0,0 +1,15 @@
+-- name: CreateSession :exec
+INSERT INTO session (token_hash, user_name, role, provider, created_at, expires_at, display_name)
+VALUES (?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetSession :one
+SELECT * FROM session
+WHERE token_hash = ? AND expires_at > ?;
+
+-- name: DeleteSession :exec
+DELETE FROM session
+WHERE token_hash = ?;
+
+-- name: DeleteExpiredSessions :execrows
+DELETE FROM session
+WHERE expires_at <= ?;
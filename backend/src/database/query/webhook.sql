@@ -0,0 +1,46 @@
+-- name: CreateWebhook :exec
+INSERT INTO webhook (id, image, url, secret, events, created_by, created_at, headers)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: GetWebhook :one
+SELECT * FROM webhook
+WHERE id = ?;
+
+-- name: ListWebhooks :many
+SELECT * FROM webhook
+ORDER BY created_at;
+
+-- name: ListImageWebhooks :many
+SELECT * FROM webhook
+WHERE image = '' OR image = ?
+ORDER BY created_at;
+
+-- name: DeleteWebhook :exec
+DELETE FROM webhook
+WHERE id = ?;
+
+-- name: DeleteImageWebhooks :exec
+DELETE FROM webhook
+WHERE image = ?;
+
+-- name: InsertWebhookDelivery :exec
+INSERT INTO webhook_delivery (webhook_id, delivery_id, event, attempt, status_code, error, duration_ms, created_at)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_delivery
+WHERE webhook_id = ?
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: DeleteWebhookDeliveries :exec
+DELETE FROM webhook_delivery
+WHERE webhook_id = ?;
+
+-- name: DeleteImageWebhookDeliveries :exec
+DELETE FROM webhook_delivery
+WHERE webhook_id IN (SELECT id FROM webhook WHERE image = ?);
+
+-- name: DeleteOldWebhookDeliveries :execrows
+DELETE FROM webhook_delivery
+WHERE created_at < ?;
@@ -0,0 +1,12 @@
+-- name: ListWorkspaceOwners :many
+SELECT * FROM workspace_owner
+ORDER BY image;
+
+-- name: SetWorkspaceOwner :exec
+INSERT INTO workspace_owner (image, owner)
+VALUES (?, ?)
+ON CONFLICT (image) DO UPDATE SET owner = excluded.owner;
+
+-- name: DeleteWorkspaceOwner :exec
+DELETE FROM workspace_owner
+WHERE image = ?;
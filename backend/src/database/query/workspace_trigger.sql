@@ -0,0 +1,17 @@
+-- name: ListRepositoryTriggers :many
+SELECT * FROM workspace_trigger
+WHERE repository = ?
+ORDER BY image;
+
+-- name: SetWorkspaceTrigger :exec
+INSERT INTO workspace_trigger (image, repository, ref, events, secret)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (image) DO UPDATE SET
+    repository = excluded.repository,
+    ref = excluded.ref,
+    events = excluded.events,
+    secret = excluded.secret;
+
+-- name: DeleteWorkspaceTrigger :exec
+DELETE FROM workspace_trigger
+WHERE image = ?;
@@ -8,6 +8,20 @@ import (
 	"time"
 )
 
+type AuditLog struct {
+	ID         int64     `db:"id" json:"id"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	UserName   string    `db:"user_name" json:"user_name"`
+	Role       string    `db:"role" json:"role"`
+	Method     string    `db:"method" json:"method"`
+	Path       string    `db:"path" json:"path"`
+	Route      string    `db:"route" json:"route"`
+	Status     int64     `db:"status" json:"status"`
+	ClientIp   string    `db:"client_ip" json:"client_ip"`
+	RequestID  string    `db:"request_id" json:"request_id"`
+	DurationMs int64     `db:"duration_ms" json:"duration_ms"`
+}
+
 type Container struct {
 	ID         int64     `db:"id" json:"id"`
 	Name       string    `db:"name" json:"name"`
@@ -27,3 +41,95 @@ type File struct {
 	CreatedAt   time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
 }
+
+type IdempotencyKey struct {
+	UserName       string    `db:"user_name" json:"user_name"`
+	IdempotencyKey string    `db:"idempotency_key" json:"idempotency_key"`
+	Fingerprint    string    `db:"fingerprint" json:"fingerprint"`
+	Status         int64     `db:"status" json:"status"`
+	ContentType    string    `db:"content_type" json:"content_type"`
+	Body           []byte    `db:"body" json:"body"`
+	CreatedAt      time.Time `db:"created_at" json:"created_at"`
+	ExpiresAt      time.Time `db:"expires_at" json:"expires_at"`
+}
+
+type NotificationChannel struct {
+	ID        string    `db:"id" json:"id"`
+	Provider  string    `db:"provider" json:"provider"`
+	Url       string    `db:"url" json:"url"`
+	Image     string    `db:"image" json:"image"`
+	UserName  string    `db:"user_name" json:"user_name"`
+	Events    string    `db:"events" json:"events"`
+	CreatedBy string    `db:"created_by" json:"created_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type Operation struct {
+	ID        string    `db:"id" json:"id"`
+	Kind      string    `db:"kind" json:"kind"`
+	Image     string    `db:"image" json:"image"`
+	Server    string    `db:"server" json:"server"`
+	Status    string    `db:"status" json:"status"`
+	Data      string    `db:"data" json:"data"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type Run struct {
+	ID          string     `db:"id" json:"id"`
+	Image       string     `db:"image" json:"image"`
+	Status      string     `db:"status" json:"status"`
+	Data        string     `db:"data" json:"data"`
+	HotSince    *time.Time `db:"hot_since" json:"hot_since"`
+	ArchivedAt  *time.Time `db:"archived_at" json:"archived_at"`
+	ArchivePath string     `db:"archive_path" json:"archive_path"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+type Session struct {
+	TokenHash   string    `db:"token_hash" json:"token_hash"`
+	UserName    string    `db:"user_name" json:"user_name"`
+	Role        string    `db:"role" json:"role"`
+	Provider    string    `db:"provider" json:"provider"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	ExpiresAt   time.Time `db:"expires_at" json:"expires_at"`
+	DisplayName string    `db:"display_name" json:"display_name"`
+}
+
+type Webhook struct {
+	ID        string    `db:"id" json:"id"`
+	Image     string    `db:"image" json:"image"`
+	Url       string    `db:"url" json:"url"`
+	Secret    string    `db:"secret" json:"secret"`
+	Events    string    `db:"events" json:"events"`
+	CreatedBy string    `db:"created_by" json:"created_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	Headers   string    `db:"headers" json:"headers"`
+}
+
+type WebhookDelivery struct {
+	ID         int64     `db:"id" json:"id"`
+	WebhookID  string    `db:"webhook_id" json:"webhook_id"`
+	DeliveryID string    `db:"delivery_id" json:"delivery_id"`
+	Event      string    `db:"event" json:"event"`
+	Attempt    int64     `db:"attempt" json:"attempt"`
+	StatusCode int64     `db:"status_code" json:"status_code"`
+	Error      string    `db:"error" json:"error"`
+	DurationMs int64     `db:"duration_ms" json:"duration_ms"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+type WorkspaceOwner struct {
+	Image     string    `db:"image" json:"image"`
+	Owner     string    `db:"owner" json:"owner"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type WorkspaceTrigger struct {
+	Image      string `db:"image" json:"image"`
+	Repository string `db:"repository" json:"repository"`
+	Ref        string `db:"ref" json:"ref"`
+	Events     string `db:"events" json:"events"`
+	Secret     string `db:"secret" json:"secret"`
+}
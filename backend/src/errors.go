@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"maestro/src/manager"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCode tells clients what went wrong without matching on the message.
+// Codes are part of the API: new ones may be added, existing ones do not
+// change.
+type ErrorCode string
+
+const (
+	CodeInvalidRequest  ErrorCode = "invalid_request"
+	CodeUnauthenticated ErrorCode = "unauthenticated"
+	CodeForbidden       ErrorCode = "forbidden"
+	CodeNotFound        ErrorCode = "not_found"
+	CodeTimeout         ErrorCode = "timeout"
+	CodeConflict        ErrorCode = "conflict"
+	CodeGone            ErrorCode = "gone"
+	CodeTooLarge        ErrorCode = "too_large"
+	CodeUnprocessable   ErrorCode = "unprocessable"
+	CodeRateLimited     ErrorCode = "rate_limited"
+	CodeInternal        ErrorCode = "internal"
+	CodeUpstream        ErrorCode = "upstream_failed" // a server or identity provider maestro relies on failed
+	CodeUnavailable     ErrorCode = "unavailable"
+
+	CodeAlreadyExists    ErrorCode = "already_exists"
+	CodeContainerRunning ErrorCode = "container_running" // stop the image's container first
+	CodeNotRunning       ErrorCode = "not_running"       // the image has no container in the state the request needs
+	CodeNotCancelable    ErrorCode = "not_cancelable"
+	CodeOffsetMismatch   ErrorCode = "offset_mismatch" // resume the upload from the offset in the details
+	CodeChecksumMismatch ErrorCode = "checksum_mismatch"
+	CodeProtected        ErrorCode = "protected" // the file is protected, only admins may change it
+	CodePolicyDenied     ErrorCode = "policy_denied"
+	CodeQuarantined      ErrorCode = "quarantined"
+	CodeUnschedulable    ErrorCode = "unschedulable" // no server can take the run now
+	CodeSecretsDisabled  ErrorCode = "secrets_disabled"
+	CodeQuotaExceeded    ErrorCode = "quota_exceeded"
+	CodeKeyReused        ErrorCode = "idempotency_key_reused" // the Idempotency-Key was sent with a different request
+	CodeValidationFailed ErrorCode = "validation_failed"      // the details map each invalid field to its error
+)
+
+// errorStatus is the HTTP status of each error code.
+var errorStatus = map[ErrorCode]int{
+	CodeInvalidRequest:  400,
+	CodeUnauthenticated: 401,
+	CodeForbidden:       403,
+	CodeNotFound:        404,
+	CodeTimeout:         408,
+	CodeConflict:        409,
+	CodeGone:            410,
+	CodeTooLarge:        413,
+	CodeUnprocessable:   422,
+	CodeRateLimited:     429,
+	CodeInternal:        500,
+	CodeUpstream:        502,
+	CodeUnavailable:     503,
+
+	CodeAlreadyExists:    409,
+	CodeContainerRunning: 409,
+	CodeNotRunning:       409,
+	CodeNotCancelable:    409,
+	CodeOffsetMismatch:   409,
+	CodeChecksumMismatch: 422,
+	CodeProtected:        403,
+	CodePolicyDenied:     403,
+	CodeQuarantined:      423,
+	CodeUnschedulable:    503,
+	CodeSecretsDisabled:  503,
+	CodeQuotaExceeded:    507,
+	CodeKeyReused:        422,
+	CodeValidationFailed: 422,
+}
+
+// errorCodes maps the errors of the manager package and of the handlers to
+// their codes, the first match wins.
+var errorCodes = []struct {
+	err  error
+	code ErrorCode
+}{
+	{manager.ErrUploadNotFound, CodeNotFound},
+	{manager.ErrUploadBusy, CodeConflict},
+	{manager.ErrUploadOffset, CodeOffsetMismatch},
+	{manager.ErrUploadIncomplete, CodeConflict},
+	{manager.ErrUploadOverflow, CodeTooLarge},
+	{manager.ErrUploadChecksum, CodeChecksumMismatch},
+	{manager.ErrContainerRunning, CodeContainerRunning},
+	{manager.ErrInvalidTransition, CodeConflict},
+	{manager.ErrNotCancelable, CodeNotCancelable},
+	{manager.ErrQuotaExceeded, CodeQuotaExceeded},
+	{manager.ErrSecretsDisabled, CodeSecretsDisabled},
+	{errSecretReference, CodeForbidden},
+}
+
+// APIError is the body of every error response.
+type APIError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details gin.H     `json:"details,omitempty"` // what a client needs to recover, such as the operation that failed
+}
+
+// errorCode returns the code of a manager error, or fallback for errors
+// without one.
+func errorCode(err error, fallback ErrorCode) ErrorCode {
+	for _, mapping := range errorCodes {
+		if errors.Is(err, mapping.err) {
+			return mapping.code
+		}
+	}
+	return fallback
+}
+
+// respondError responds with the error envelope and the status of the code.
+func respondError(c *gin.Context, code ErrorCode, message string) {
+	respondErrorDetails(c, code, message, nil)
+}
+
+// respondErrorDetails responds like respondError, adding the details.
+func respondErrorDetails(c *gin.Context, code ErrorCode, message string, details gin.H) {
+	c.JSON(errorStatus[code], APIError{Code: code, Message: message, Details: details})
+}
+
+// abortWithError responds like respondError and skips the remaining
+// handlers, for middleware.
+func abortWithError(c *gin.Context, code ErrorCode, message string) {
+	c.AbortWithStatusJSON(errorStatus[code], APIError{Code: code, Message: message})
+}
+
+// handleNoRoute answers requests no route matches.
+func handleNoRoute(c *gin.Context) {
+	respondError(c, CodeNotFound, "No such endpoint: "+c.Request.Method+" "+c.Request.URL.Path)
+}
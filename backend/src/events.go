@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"maestro/src/broker"
+	"maestro/src/manager"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// heartbeatInterval keeps idle event streams alive through proxies.
+const heartbeatInterval = 30 * time.Second
+
+// handleEventStream pushes lifecycle events to the client as server-sent
+// events until the client disconnects.
+func handleEventStream(c *gin.Context) {
+	events := serviceManager.Events.Subscribe()
+	defer serviceManager.Events.Unsubscribe(events)
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event := <-events:
+			// only show events of workspaces the user can access
+			if !canAccessImage(c, event.Image) {
+				return true
+			}
+			c.SSEvent(string(event.Type), event)
+			return true
+		case <-heartbeat.C:
+			c.SSEvent("heartbeat", gin.H{"time": time.Now()})
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// publishEvents publishes every lifecycle event received from the bus to the
+// broker, as the JSON the event stream sends, under a topic named after its
+// type. Events of all workspaces are published; access to the broker decides
+// who reads them. The events come from a queued subscription, so none are
+// dropped while the broker is slow or unreachable.
+func publishEvents(events <-chan manager.Event, publisher broker.Publisher) {
+	log := loggers.For("broker")
+	for event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			log.Error("Failed to encode event", "type", event.Type, "error", err)
+			continue
+		}
+		if err := publisher.Publish(string(event.Type), payload); err != nil {
+			log.Warn("Failed to publish event", "type", event.Type, "image", event.Image, "error", err)
+		}
+	}
+}
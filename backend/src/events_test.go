@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"maestro/src/manager"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowPublisher is a broker that takes delay for every message it publishes.
+type slowPublisher struct {
+	delay time.Duration
+
+	mu       sync.Mutex
+	received []manager.Event
+}
+
+func (p *slowPublisher) Publish(name string, payload []byte) error {
+	time.Sleep(p.delay)
+	var event manager.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.received = append(p.received, event)
+	return nil
+}
+
+func (p *slowPublisher) Close() {}
+
+func (p *slowPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.received)
+}
+
+func TestPublishEventsBurst(t *testing.T) {
+	var bus manager.EventBus
+	events := bus.SubscribeQueued()
+	defer bus.Unsubscribe(events)
+
+	publisher := &slowPublisher{delay: time.Millisecond}
+	done := make(chan struct{})
+	go func() {
+		publishEvents(events, publisher)
+		close(done)
+	}()
+
+	const burst = 500
+	for i := range burst {
+		bus.Publish(manager.Event{Type: manager.EventQueued, Image: "app", Position: i})
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for publisher.count() < burst && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	bus.Unsubscribe(events)
+	<-done
+
+	if len(publisher.received) != burst {
+		t.Fatalf("broker received %d of %d events", len(publisher.received), burst)
+	}
+	for i, event := range publisher.received {
+		if event.Position != i {
+			t.Fatalf("event %d published as %d", i, event.Position)
+		}
+	}
+}
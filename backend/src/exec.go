@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maestro/src/manager"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// websocketBearerProtocol is the subprotocol browsers pass their token after.
+const websocketBearerProtocol = "bearer"
+
+// defaultExecCmd is the command of an exec session that names none.
+var defaultExecCmd = []string{"/bin/sh"}
+
+// execMessage is a message of the client of an exec session: keyboard input
+// or a size change of its terminal.
+type execMessage struct {
+	Type string `json:"type"` // input or resize
+	Data string `json:"data"`
+	manager.TerminalSize
+}
+
+// handleExecContainer opens an interactive shell, or the command given by the
+// repeated `cmd` query parameter, on a TTY in the running container of an
+// image and bridges it to a WebSocket. The client sends JSON messages
+// {"type":"input","data":"..."} and {"type":"resize","cols":..,"rows":..}. The
+// terminal's output comes back as binary frames, followed by
+// {"type":"exit","exit_code":..} or {"type":"error","error":"..."}.
+func handleExecContainer(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.RLock()
+	container := imageManager.Container
+	connectionManager := imageManager.Connection
+	running := container != nil && connectionManager != nil && container.Status == manager.Running
+	var containerID, containerName string
+	if running {
+		containerID, containerName = container.ID, container.Name
+	}
+	imageManager.Mu.RUnlock()
+	if !running {
+		respondError(c, CodeNotRunning, fmt.Sprintf("No running container for image %s", name))
+		return
+	}
+
+	cmd := c.QueryArray("cmd")
+	if len(cmd) == 0 {
+		cmd = defaultExecCmd
+	}
+	log := requestLog(c)
+
+	websocket.Server{
+		Handshake: acceptBearerProtocol,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			ws.PayloadType = websocket.BinaryFrame
+			log.Info("Exec session started", "image", name, "container", containerName, "cmd", cmd)
+
+			stdin, input := io.Pipe()
+			sizes := make(chan manager.TerminalSize)
+			done := make(chan struct{})
+			go func() {
+				defer input.Close()
+				defer close(sizes)
+				for {
+					var message execMessage
+					if err := websocket.JSON.Receive(ws, &message); err != nil {
+						return
+					}
+					switch message.Type {
+					case "input":
+						if _, err := io.WriteString(input, message.Data); err != nil {
+							return
+						}
+					case "resize":
+						select {
+						case sizes <- message.TerminalSize:
+						case <-done:
+							return
+						}
+					}
+				}
+			}()
+
+			exitCode, err := connectionManager.Runtime.ExecContainer(containerID, manager.Exec{
+				Cmd:    cmd,
+				Stdin:  stdin,
+				Output: ws,
+				Resize: sizes,
+			})
+			close(done)
+			stdin.Close()
+			if err != nil {
+				log.Error("Exec session failed", "image", name, "container", containerName, "error", err)
+				websocket.JSON.Send(ws, gin.H{"type": "error", "error": err.Error()})
+				return
+			}
+			log.Info("Exec session ended", "image", name, "container", containerName, "exit_code", exitCode)
+			websocket.JSON.Send(ws, gin.H{"type": "exit", "exit_code": exitCode})
+		},
+	}.ServeHTTP(c.Writer, c.Request)
+}
+
+// acceptBearerProtocol accepts WebSocket handshakes from any origin, like the
+// CORS policy, and only echoes the bearer subprotocol of browsers, never their
+// token.
+func acceptBearerProtocol(config *websocket.Config, r *http.Request) error {
+	if slices.Contains(config.Protocol, websocketBearerProtocol) {
+		config.Protocol = []string{websocketBearerProtocol}
+	} else {
+		config.Protocol = nil
+	}
+	return nil
+}
+
+// handleAttachStdin bridges a WebSocket to the input of the running container
+// of an image that was run interactive. Every frame the client sends is
+// written to the container's stdin as is, the output goes to the run's log
+// files as usual. One client is attached at a time; the input stays open when
+// it leaves, and {"type":"detached"} is sent once the container exits.
+func handleAttachStdin(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	container := imageManager.Container
+	connectionManager := imageManager.Connection
+	if container == nil || connectionManager == nil || !container.Active() {
+		imageManager.Mu.Unlock()
+		respondError(c, CodeNotRunning, fmt.Sprintf("No running container for image %s", name))
+		return
+	}
+	if !container.Options.Interactive {
+		imageManager.Mu.Unlock()
+		respondError(c, CodeConflict, fmt.Sprintf("The container for image %s was not run interactive", name))
+		return
+	}
+	if container.StdinAttached {
+		imageManager.Mu.Unlock()
+		respondError(c, CodeConflict, fmt.Sprintf("Another client is attached to the input of the container for image %s", name))
+		return
+	}
+	container.StdinAttached = true
+	imageManager.Mu.Unlock()
+
+	defer func() {
+		imageManager.Mu.Lock()
+		container.StdinAttached = false
+		imageManager.Mu.Unlock()
+	}()
+
+	log := requestLog(c)
+	websocket.Server{
+		Handshake: acceptBearerProtocol,
+		Handler: func(ws *websocket.Conn) {
+			defer ws.Close()
+			log.Info("Attached to container input", "image", name, "container", container.Name)
+
+			if err := connectionManager.Runtime.AttachStdin(container.ID, ws); err != nil {
+				log.Error("Failed to attach to container input", "image", name, "container", container.Name, "error", err)
+				websocket.JSON.Send(ws, gin.H{"type": "error", "error": err.Error()})
+				return
+			}
+			log.Info("Detached from container input", "image", name, "container", container.Name)
+			websocket.JSON.Send(ws, gin.H{"type": "detached"})
+		},
+	}.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maestro/src/manager"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// workspaceGitDir returns the directory the repository of a workspace cloned
+// from git is kept in, apart from its files.
+func workspaceGitDir(image string) string {
+	return filepath.Join(config.StateDir, "git", image)
+}
+
+// CloneRequest names the repository handleCloneWorkspace clones.
+type CloneRequest struct {
+	URL           string   `json:"url" binding:"required"`
+	Ref           string   `json:"ref"`
+	DeployKey     string   `json:"deploy_key"`
+	Trigger       []string `json:"trigger" binding:"dive,oneof=push tag"`
+	TriggerSecret string   `json:"trigger_secret"`
+}
+
+// handleCloneWorkspace clones a repository into an image's directory. The body
+// names the repository `url`, optionally the `ref` to follow, the `deploy_key`
+// secret for ssh repositories and the `trigger` events of the repository's
+// webhook that pull and run the workspace, signed with the `trigger_secret`
+// secret. Only admins may name secrets. Builds of the workspace record the
+// commit it has checked out.
+func (s *server) handleCloneWorkspace(c *gin.Context) {
+	name := c.Param("name")
+
+	var body CloneRequest
+	if !bindJSON(c, &body, "clone request") {
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	source := manager.GitSource{URL: body.URL, Ref: body.Ref}
+	if err := source.Validate(); err != nil {
+		respondError(c, CodeInvalidRequest, err.Error())
+		return
+	}
+	if err := checkSecretReference(c, body.DeployKey); err != nil {
+		respondError(c, CodeForbidden, err.Error())
+		return
+	}
+	if err := gitCredentials(&source, body.DeployKey); err != nil {
+		respondError(c, CodeInvalidRequest, err.Error())
+		return
+	}
+	if !checkTriggerSecret(c, body.Trigger, body.TriggerSecret, "") {
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(c, gitCloneTimeout)
+	defer cancel()
+	commit, err := manager.CloneWorkspace(ctx, source, body.DeployKey, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		if errors.Is(err, manager.ErrGitWorkspace) {
+			respondError(c, CodeAlreadyExists, fmt.Sprintf("Image %s already has a repository; pull it instead", name))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to clone %s: %v", body.URL, err))
+		return
+	}
+	if len(body.Trigger) > 0 {
+		if err := manager.SetWorkspaceTrigger(ctx, imageManager.GitDir, imageManager.FilesDir, body.Trigger, body.TriggerSecret); err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Cloned %s but failed to set its trigger: %v", body.URL, err))
+			return
+		}
+	}
+	repo := &manager.WorkspaceRepo{URL: body.URL, Ref: body.Ref, Trigger: body.Trigger, TriggerSecret: body.TriggerSecret}
+	if err := s.indexWorkspaceTrigger(c, name, repo); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Cloned %s but failed to record its trigger: %v", body.URL, err))
+		return
+	}
+	requestLog(c).Info("Cloned workspace", "image", name, "repository", body.URL, "ref", body.Ref, "commit", commit, "trigger", body.Trigger)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Cloned %s into image %s", body.URL, name), "commit": commit})
+}
+
+// handlePullWorkspace checks out the latest commit of the ref an image's
+// directory was cloned from. Local changes to other files are kept.
+func handlePullWorkspace(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	// a pull may rewrite any project file, protected ones included
+	if len(imageManager.ProtectedFiles) > 0 && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("Image %s has protected files; only an admin can pull its repository", name))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c, gitCloneTimeout)
+	defer cancel()
+
+	repo, err := manager.ReadWorkspaceRepo(ctx, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		if errors.Is(err, manager.ErrNoGitWorkspace) {
+			respondError(c, CodeConflict, fmt.Sprintf("Image %s has no repository; clone one first", name))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read repository of image %s: %v", name, err))
+		return
+	}
+
+	source := manager.GitSource{URL: repo.URL, Ref: repo.Ref}
+	if err := gitCredentials(&source, repo.DeployKey); err != nil {
+		respondError(c, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	commit, err := manager.PullWorkspace(ctx, source, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to pull %s: %v", repo.URL, err))
+		return
+	}
+	requestLog(c).Info("Pulled workspace", "image", name, "repository", repo.URL, "ref", repo.Ref, "commit", commit)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Pulled %s into image %s", repo.URL, name), "commit": commit})
+}
+
+// handleGetWorkspaceRepo returns the repository an image's directory was
+// cloned from and the commit it has checked out.
+func handleGetWorkspaceRepo(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	imageManager.Mu.RLock()
+	defer imageManager.Mu.RUnlock()
+
+	repo, err := manager.ReadWorkspaceRepo(c, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		if errors.Is(err, manager.ErrNoGitWorkspace) {
+			respondError(c, CodeNotFound, fmt.Sprintf("Image %s has no repository", name))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read repository of image %s: %v", name, err))
+		return
+	}
+
+	c.JSON(200, repo)
+}
+
+// TriggerRequest lists the repository events handleSetWorkspaceTrigger makes
+// pull and run a workspace and names the secret their webhook is signed with.
+type TriggerRequest struct {
+	Events []string `json:"events" binding:"dive,oneof=push tag"`
+	Secret string   `json:"secret"`
+}
+
+// checkTriggerSecret checks that triggers name a readable secret to verify
+// their webhook with, which non-admins can only keep as recorded. It responds
+// with an error and returns false otherwise.
+func checkTriggerSecret(c *gin.Context, events []string, secret, recorded string) bool {
+	if len(events) == 0 {
+		return true
+	}
+	if secret == "" {
+		respondError(c, CodeInvalidRequest, "A secret is required to verify the repository webhook of triggers")
+		return false
+	}
+	if secret != recorded {
+		if err := checkSecretReference(c, secret); err != nil {
+			respondError(c, CodeForbidden, err.Error())
+			return false
+		}
+	}
+	if _, err := secretStore.Reveal(secret); err != nil {
+		respondError(c, errorCode(err, CodeInvalidRequest), fmt.Sprintf("Trigger secret %s: %v", secret, err))
+		return false
+	}
+	return true
+}
+
+// handleSetWorkspaceTrigger sets the events of the repository's webhook that
+// pull and run an image's directory: `push` for pushes to the ref it follows,
+// `tag` for new tags, which are checked out. The webhook must be signed with
+// the `secret` secret; non-admins can only keep the one recorded. No events
+// stop the triggers.
+func (s *server) handleSetWorkspaceTrigger(c *gin.Context) {
+	name := c.Param("name")
+
+	var body TriggerRequest
+	if !bindJSON(c, &body, "trigger") {
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	// triggered runs pull the repository, which may rewrite protected files
+	if len(body.Events) > 0 && len(imageManager.ProtectedFiles) > 0 && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("Image %s has protected files; only an admin can make its repository trigger runs", name))
+		return
+	}
+
+	repo, err := manager.ReadWorkspaceRepo(c, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		if errors.Is(err, manager.ErrNoGitWorkspace) {
+			respondError(c, CodeConflict, fmt.Sprintf("Image %s has no repository; clone one first", name))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read repository of image %s: %v", name, err))
+		return
+	}
+	if !checkTriggerSecret(c, body.Events, body.Secret, repo.TriggerSecret) {
+		return
+	}
+
+	if err := manager.SetWorkspaceTrigger(c, imageManager.GitDir, imageManager.FilesDir, body.Events, body.Secret); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to set trigger of image %s: %v", name, err))
+		return
+	}
+	requestLog(c).Info("Set workspace trigger", "image", name, "events", body.Events)
+
+	repo, err = manager.ReadWorkspaceRepo(c, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read repository of image %s: %v", name, err))
+		return
+	}
+	if err := s.indexWorkspaceTrigger(c, name, repo); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to record trigger of image %s: %v", name, err))
+		return
+	}
+	c.JSON(200, repo)
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maestro/src/database/schema"
+	"maestro/src/manager"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxGitHookPayload bounds the body of a repository webhook, the limit GitHub
+// caps its payloads at.
+const maxGitHookPayload = 25 << 20
+
+// zeroCommit is the commit GitLab reports for a deleted branch or tag.
+const zeroCommit = "0000000000000000000000000000000000000000"
+
+// gitPush is a push to a repository, reported by GitHub or GitLab.
+type gitPush struct {
+	repositories  []string // URLs of the repository
+	defaultBranch string
+	branch        string // set for pushes to a branch
+	tag           string // set for pushes of a tag
+	commit        string
+}
+
+// githubPush is the part of a GitHub push event maestro reads.
+type githubPush struct {
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Deleted    bool   `json:"deleted"`
+	Repository struct {
+		CloneURL      string `json:"clone_url"`
+		SSHURL        string `json:"ssh_url"`
+		HTMLURL       string `json:"html_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"repository"`
+}
+
+// gitlabPush is the part of a GitLab push or tag push event maestro reads.
+type gitlabPush struct {
+	Ref     string `json:"ref"`
+	After   string `json:"after"`
+	Project struct {
+		GitHTTPURL    string `json:"git_http_url"`
+		GitSSHURL     string `json:"git_ssh_url"`
+		WebURL        string `json:"web_url"`
+		DefaultBranch string `json:"default_branch"`
+	} `json:"project"`
+}
+
+// handleGitHook pulls, builds and runs the workspaces cloned from a repository
+// when its GitHub or GitLab webhook reports a push. A push to a branch
+// triggers the workspaces following it with the `push` trigger, a new tag
+// checks out the tag in those with the `tag` trigger. Only the workspaces
+// whose trigger secret the GitHub payload is signed with, or the GitLab token
+// is, are triggered. The runs are started in the background; the response
+// lists the workspaces. Failed verifications count against the IP like
+// invalid credentials.
+func (s *server) handleGitHook(c *gin.Context) {
+	if authFailuresExceeded(c) {
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxGitHookPayload))
+	if err != nil {
+		respondError(c, CodeTooLarge, fmt.Sprintf("Failed to read webhook payload: %v", err))
+		return
+	}
+
+	var push *gitPush
+	switch {
+	case c.GetHeader("X-GitHub-Event") != "":
+		push, err = parseGitHubEvent(c.GetHeader("X-GitHub-Event"), body)
+	case c.GetHeader("X-Gitlab-Event") != "":
+		push, err = parseGitLabEvent(c.GetHeader("X-Gitlab-Event"), body)
+	default:
+		respondError(c, CodeInvalidRequest, "Not a GitHub or GitLab webhook")
+		return
+	}
+	if err != nil {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid webhook payload: %v", err))
+		return
+	}
+	if push == nil {
+		c.JSON(200, gin.H{"message": "Event ignored", "workspaces": []string{}})
+		return
+	}
+
+	// the payload is only trusted by the workspaces whose secret signed it;
+	// pushes no workspace verifies are rejected alike, so callers without a
+	// secret cannot tell which repositories are followed. Nothing but the
+	// index of triggers is read before that.
+	targets, err := s.triggeredWorkspaces(c, push)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to look up triggered workspaces: %v", err))
+		return
+	}
+	var verified []gitTrigger
+	secrets := map[string][]byte{}
+	for _, target := range targets {
+		secret, revealed := secrets[target.secret]
+		if !revealed {
+			secret, err = secretStore.Reveal(target.secret)
+			if err != nil {
+				requestLog(c).Warn("Failed to read trigger secret", "image", target.image.Name, "secret", target.secret, "error", err)
+			}
+			secrets[target.secret] = secret
+		}
+		if secret != nil && authenticGitHook(c, secret, body) {
+			verified = append(verified, target)
+		}
+	}
+	if len(verified) == 0 {
+		rejectAuthentication(c, "Invalid webhook signature or token")
+		return
+	}
+
+	triggered := []string{}
+	for _, target := range verified {
+		triggered = append(triggered, target.image.Name)
+		go s.runTriggered(target, push)
+	}
+	slices.Sort(triggered)
+	requestLog(c).Info("Repository webhook received", "repository", push.repositories[0], "branch", push.branch, "tag", push.tag, "commit", push.commit, "workspaces", triggered)
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Triggered %d workspaces", len(triggered)), "workspaces": triggered})
+}
+
+// authenticGitHook reports whether the GitHub signature or the GitLab token of
+// the request matches the secret.
+func authenticGitHook(c *gin.Context, secret, body []byte) bool {
+	if c.GetHeader("X-GitHub-Event") != "" {
+		return validGitHubSignature(secret, c.GetHeader("X-Hub-Signature-256"), body)
+	}
+	return subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Gitlab-Token")), secret) == 1
+}
+
+// validGitHubSignature reports whether header is the sha256= prefixed hex
+// HMAC-SHA256 of the body keyed with the secret.
+func validGitHubSignature(secret []byte, header string, body []byte) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(expected, mac.Sum(nil))
+}
+
+// parseGitHubEvent reads a GitHub push event, nil for other events and for
+// deleted branches and tags.
+func parseGitHubEvent(event string, body []byte) (*gitPush, error) {
+	if event != "push" {
+		return nil, nil
+	}
+	var payload githubPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.Deleted {
+		return nil, nil
+	}
+	repo := payload.Repository
+	return newGitPush(payload.Ref, payload.After, repo.DefaultBranch, repo.CloneURL, repo.SSHURL, repo.HTMLURL)
+}
+
+// parseGitLabEvent reads a GitLab push or tag push event, nil for other events
+// and for deleted branches and tags.
+func parseGitLabEvent(event string, body []byte) (*gitPush, error) {
+	if event != "Push Hook" && event != "Tag Push Hook" {
+		return nil, nil
+	}
+	var payload gitlabPush
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if payload.After == zeroCommit {
+		return nil, nil
+	}
+	project := payload.Project
+	return newGitPush(payload.Ref, payload.After, project.DefaultBranch, project.GitHTTPURL, project.GitSSHURL, project.WebURL)
+}
+
+// newGitPush describes a push of the full ref, nil for refs other than
+// branches and tags.
+func newGitPush(ref, commit, defaultBranch string, repositories ...string) (*gitPush, error) {
+	repositories = slices.DeleteFunc(repositories, func(repository string) bool { return repository == "" })
+	if len(repositories) == 0 {
+		return nil, errors.New("no repository URL")
+	}
+	push := &gitPush{repositories: repositories, defaultBranch: defaultBranch, commit: commit}
+	if branch, ok := strings.CutPrefix(ref, "refs/heads/"); ok {
+		push.branch = branch
+	} else if tag, ok := strings.CutPrefix(ref, "refs/tags/"); ok {
+		push.tag = tag
+	} else {
+		return nil, nil
+	}
+	return push, nil
+}
+
+// repositoryKey reduces the URLs a repository is reached at, https, ssh or
+// scp-like, to its host and path, so they compare equal.
+func repositoryKey(raw string) string {
+	var host, path string
+	if parsed, err := url.Parse(raw); err == nil && parsed.Host != "" {
+		host, path = parsed.Hostname(), parsed.Path
+	} else {
+		// user@host:path
+		hostPart, pathPart, found := strings.Cut(raw, ":")
+		if !found {
+			return ""
+		}
+		_, host, _ = strings.Cut(hostPart, "@")
+		if host == "" {
+			host = hostPart
+		}
+		path = pathPart
+	}
+	path = strings.TrimSuffix(strings.Trim(path, "/"), ".git")
+	return strings.ToLower(host + "/" + path)
+}
+
+// gitTrigger is a workspace a push triggers, the ref it checks out and the
+// secret its webhook is signed with.
+type gitTrigger struct {
+	image  *manager.ImageManager
+	ref    string
+	secret string
+}
+
+// indexWorkspaceTrigger records the triggers of a workspace's repository in
+// the database, where repository webhooks look them up by repository without
+// touching the workspace. A workspace without verifiable triggers is dropped.
+func (s *server) indexWorkspaceTrigger(ctx context.Context, image string, repo *manager.WorkspaceRepo) error {
+	if len(repo.Trigger) == 0 || repo.TriggerSecret == "" {
+		return s.db.Query.DeleteWorkspaceTrigger(ctx, image)
+	}
+	return s.db.Query.SetWorkspaceTrigger(ctx, schema.SetWorkspaceTriggerParams{
+		Image:      image,
+		Repository: repositoryKey(repo.URL),
+		Ref:        repo.Ref,
+		Events:     strings.Join(repo.Trigger, ","),
+		Secret:     repo.TriggerSecret,
+	})
+}
+
+// triggeredWorkspaces returns the workspaces the push pulls and runs: those
+// cloned from the repository whose trigger includes the push, for branches
+// only those following the branch.
+func (s *server) triggeredWorkspaces(ctx context.Context, push *gitPush) ([]gitTrigger, error) {
+	var triggers []gitTrigger
+	seen := map[string]bool{}
+	for _, repository := range push.repositories {
+		key := repositoryKey(repository)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		indexed, err := s.db.Query.ListRepositoryTriggers(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		for _, trigger := range indexed {
+			imageManager, exists := serviceManager.Images.Load(trigger.Image)
+			if !exists {
+				continue
+			}
+
+			events := strings.Split(trigger.Events, ",")
+			ref := trigger.Ref
+			switch {
+			case push.branch != "" && slices.Contains(events, "push"):
+				following := ref == push.branch || ref == "refs/heads/"+push.branch || (ref == "" && push.branch == push.defaultBranch)
+				if !following {
+					continue
+				}
+			case push.tag != "" && slices.Contains(events, "tag"):
+				ref = "refs/tags/" + push.tag
+			default:
+				continue
+			}
+			triggers = append(triggers, gitTrigger{image: imageManager, ref: ref, secret: trigger.Secret})
+		}
+	}
+	return triggers, nil
+}
+
+// runTriggered pulls a triggered workspace and queues a run of it, which
+// builds the image from the new commit. Workspaces with protected files are
+// not pulled, only admins may change those. Failures are published as errors
+// of the workspace, so webhooks and notifications report them.
+func (s *server) runTriggered(target gitTrigger, push *gitPush) {
+	imageManager := target.image
+	name := imageManager.Name
+	log := loggers.For("githooks").With("image", name, "commit", push.commit)
+	fail := func(message string) {
+		log.Error("Triggered run failed", "error", message)
+		serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: name, Message: message})
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	if apiErr := runnableError(imageManager); apiErr != nil {
+		fail(apiErr.Message)
+		return
+	}
+	// a pull may rewrite any project file, protected ones included
+	if len(imageManager.ProtectedFiles) > 0 {
+		fail(fmt.Sprintf("image %s has protected files; only an admin can pull its repository", name))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), gitCloneTimeout)
+	defer cancel()
+	repo, err := manager.ReadWorkspaceRepo(ctx, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		fail(fmt.Sprintf("failed to read repository: %v", err))
+		return
+	}
+	source := manager.GitSource{URL: repo.URL, Ref: target.ref}
+	if err := gitCredentials(&source, repo.DeployKey); err != nil {
+		fail(err.Error())
+		return
+	}
+	commit, err := manager.PullWorkspace(ctx, source, imageManager.GitDir, imageManager.FilesDir)
+	if err != nil {
+		fail(fmt.Sprintf("failed to pull %s: %v", repo.URL, err))
+		return
+	}
+	log.Info("Pulled triggered workspace", "ref", target.ref, "pulled", commit)
+
+	op := manager.NewOperation(manager.NewRunID(), manager.OperationRun, name, "", manager.RunSteps, s.persistOperation)
+	serviceManager.Operations.Store(op.ID, op)
+	if _, _, apiErr := queueRun(imageManager, op, log); apiErr != nil {
+		fail(apiErr.Message)
+	}
+}
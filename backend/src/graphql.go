@@ -0,0 +1,345 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"fmt"
+	"maestro/src/manager"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	graphql "github.com/graph-gophers/graphql-go"
+)
+
+//go:embed schema.graphql
+var rawGraphQLSchema string
+
+// maxGraphQLRuns bounds the runs of a workspace one query returns.
+const maxGraphQLRuns = 1000
+
+// graphqlSchema resolves GraphQL queries. The depth bound keeps a query from
+// fanning out without end through runs and their servers.
+var graphqlSchema = graphql.MustParseSchema(rawGraphQLSchema, &queryResolver{},
+	graphql.MaxDepth(8),
+	graphql.MaxQueryLength(16<<10),
+)
+
+// graphqlRequestKey keys the request in the context of the resolvers, which
+// check access like the REST handlers do.
+type graphqlRequestKey struct{}
+
+// graphqlRequest returns the request a query is resolved for.
+func graphqlRequest(ctx context.Context) *gin.Context {
+	c, _ := ctx.Value(graphqlRequestKey{}).(*gin.Context)
+	return c
+}
+
+// handleGraphQL resolves a GraphQL query. Errors of the query, such as a
+// syntax error or an unknown field, are returned in the response's `errors`
+// with status 200, as GraphQL clients expect.
+func handleGraphQL(c *gin.Context) {
+	var body struct {
+		Query         string         `json:"query" binding:"required"`
+		OperationName string         `json:"operationName"`
+		Variables     map[string]any `json:"variables"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid GraphQL request: %v", err))
+		return
+	}
+
+	ctx := context.WithValue(c.Request.Context(), graphqlRequestKey{}, c)
+	c.JSON(200, graphqlSchema.Exec(ctx, body.Query, body.OperationName, body.Variables))
+}
+
+type queryResolver struct{}
+
+func (*queryResolver) Workspaces(ctx context.Context, args struct{ Status, Server *string }) []*workspaceResolver {
+	c := graphqlRequest(ctx)
+
+	result := []*workspaceResolver{}
+	serviceManager.Images.Range(func(_ string, imageManager *manager.ImageManager) bool {
+		if !canAccess(c, imageManager) {
+			return true
+		}
+		imageManager.Mu.RLock()
+		status, server := "", ""
+		if container := imageManager.Container; container != nil {
+			status = string(container.Status)
+		}
+		if imageManager.Connection != nil {
+			server = imageManager.Connection.Server.Name
+		}
+		imageManager.Mu.RUnlock()
+
+		if (args.Status == nil || *args.Status == status) && (args.Server == nil || *args.Server == server) {
+			result = append(result, &workspaceResolver{imageManager})
+		}
+		return true
+	})
+	slices.SortFunc(result, func(a, b *workspaceResolver) int {
+		return cmp.Compare(a.image.Name, b.image.Name)
+	})
+	return result
+}
+
+func (*queryResolver) Workspace(ctx context.Context, args struct{ Name string }) *workspaceResolver {
+	imageManager, exists := serviceManager.Images.Load(args.Name)
+	if !exists || !canAccess(graphqlRequest(ctx), imageManager) {
+		return nil
+	}
+	return &workspaceResolver{imageManager}
+}
+
+func (*queryResolver) Servers() []*serverResolver {
+	result := []*serverResolver{}
+	serviceManager.Connections.Range(func(_ string, connectionManager *manager.ConnectionManager) bool {
+		result = append(result, newServerResolver(connectionManager))
+		return true
+	})
+	slices.SortFunc(result, func(a, b *serverResolver) int {
+		return cmp.Compare(a.server.Name, b.server.Name)
+	})
+	return result
+}
+
+func (*queryResolver) Server(args struct{ Name string }) *serverResolver {
+	return serverByName(args.Name)
+}
+
+// workspaceResolver resolves the fields of a workspace, reading them under its
+// lock.
+type workspaceResolver struct {
+	image *manager.ImageManager
+}
+
+func (w *workspaceResolver) Name() string {
+	return w.image.Name
+}
+
+func (w *workspaceResolver) Owner() string {
+	w.image.Mu.RLock()
+	defer w.image.Mu.RUnlock()
+	return w.image.Owner
+}
+
+func (w *workspaceResolver) Quarantine() *string {
+	w.image.Mu.RLock()
+	defer w.image.Mu.RUnlock()
+	if w.image.Quarantine == nil {
+		return nil
+	}
+	reason := w.image.Quarantine.Reason
+	return &reason
+}
+
+func (w *workspaceResolver) Server() *serverResolver {
+	w.image.Mu.RLock()
+	connectionManager := w.image.Connection
+	w.image.Mu.RUnlock()
+	if connectionManager == nil {
+		return nil
+	}
+	return newServerResolver(connectionManager)
+}
+
+func (w *workspaceResolver) LatestRun() *runResolver {
+	w.image.Mu.RLock()
+	defer w.image.Mu.RUnlock()
+	runs := w.image.AllRuns()
+	if len(runs) == 0 {
+		return nil
+	}
+	return newRunResolver(runs[0])
+}
+
+func (w *workspaceResolver) Runs(args struct {
+	Status *string
+	Limit  int32
+}) ([]*runResolver, error) {
+	if args.Limit <= 0 || args.Limit > maxGraphQLRuns {
+		return nil, fmt.Errorf("invalid limit: %d, expected 1 to %d", args.Limit, maxGraphQLRuns)
+	}
+
+	w.image.Mu.RLock()
+	defer w.image.Mu.RUnlock()
+	result := []*runResolver{}
+	for _, run := range w.image.AllRuns() {
+		if len(result) == int(args.Limit) {
+			break
+		}
+		if args.Status == nil || *args.Status == string(run.Status) {
+			result = append(result, newRunResolver(run))
+		}
+	}
+	return result, nil
+}
+
+func (w *workspaceResolver) Run(args struct{ ID string }) *runResolver {
+	w.image.Mu.RLock()
+	defer w.image.Mu.RUnlock()
+
+	run, exists := w.image.Container, w.image.Container != nil
+	if args.ID != currentRun {
+		run, exists = w.image.FindRun(args.ID)
+	}
+	if !exists {
+		return nil
+	}
+	return newRunResolver(run)
+}
+
+// runResolver resolves the fields of a run, copied under its image's lock.
+type runResolver struct {
+	run    manager.ContainerManager
+	server string
+}
+
+// newRunResolver copies a run. The caller must hold the lock of its image.
+func newRunResolver(run *manager.ContainerManager) *runResolver {
+	return &runResolver{
+		run: manager.ContainerManager{
+			RunID:      run.RunID,
+			Name:       run.Name,
+			Status:     run.Status,
+			CreatedAt:  run.CreatedAt,
+			FinishedAt: run.FinishedAt,
+			ExitCode:   run.ExitCode,
+			OOMKilled:  run.OOMKilled,
+			Restarts:   run.Restarts,
+			Commit:     run.Commit,
+		},
+		server: run.Activity.Server(),
+	}
+}
+
+func (r *runResolver) ID() string {
+	return r.run.RunID
+}
+
+func (r *runResolver) Container() string {
+	return r.run.Name
+}
+
+func (r *runResolver) Status() string {
+	return string(r.run.Status)
+}
+
+func (r *runResolver) Server() *serverResolver {
+	return serverByName(r.server)
+}
+
+func (r *runResolver) CreatedAt() *graphql.Time {
+	if r.run.CreatedAt.IsZero() {
+		return nil
+	}
+	return &graphql.Time{Time: r.run.CreatedAt}
+}
+
+func (r *runResolver) FinishedAt() *graphql.Time {
+	if r.run.FinishedAt == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.run.FinishedAt}
+}
+
+func (r *runResolver) ExitCode() *int32 {
+	if r.run.ExitCode == nil {
+		return nil
+	}
+	code := int32(*r.run.ExitCode)
+	return &code
+}
+
+func (r *runResolver) OomKilled() bool {
+	return r.run.OOMKilled
+}
+
+func (r *runResolver) Restarts() int32 {
+	return int32(r.run.Restarts)
+}
+
+func (r *runResolver) Commit() string {
+	return r.run.Commit
+}
+
+// serverResolver resolves the fields of a server, copied under its lock.
+type serverResolver struct {
+	server manager.ServerInfo
+	queued int
+}
+
+func newServerResolver(connectionManager *manager.ConnectionManager) *serverResolver {
+	connectionManager.Mu.RLock()
+	defer connectionManager.Mu.RUnlock()
+	return &serverResolver{server: connectionManager.Server, queued: connectionManager.RunQueue.Len()}
+}
+
+// serverByName returns the resolver of a tracked server, nil if there is none
+// by the name.
+func serverByName(name string) *serverResolver {
+	connectionManager, exists := serviceManager.Connections.Load(name)
+	if !exists {
+		return nil
+	}
+	return newServerResolver(connectionManager)
+}
+
+func (s *serverResolver) Name() string {
+	return s.server.Name
+}
+
+func (s *serverResolver) Engine() string {
+	return cmp.Or(s.server.Engine, manager.EnginePodman)
+}
+
+func (s *serverResolver) Status() string {
+	return string(s.server.Status)
+}
+
+func (s *serverResolver) Maintenance() *string {
+	if s.server.Maintenance == "" {
+		return nil
+	}
+	return &s.server.Maintenance
+}
+
+func (s *serverResolver) Platform() string {
+	return s.server.Platform
+}
+
+func (s *serverResolver) MemTotal() string {
+	return s.server.MemTotal
+}
+
+func (s *serverResolver) MemAvailable() string {
+	return s.server.MemAvailable
+}
+
+func (s *serverResolver) Queued() int32 {
+	return int32(s.queued)
+}
+
+func (s *serverResolver) Labels() []*labelResolver {
+	result := []*labelResolver{}
+	for key, value := range s.server.Labels {
+		result = append(result, &labelResolver{key, value})
+	}
+	slices.SortFunc(result, func(a, b *labelResolver) int {
+		return cmp.Compare(a.key, b.key)
+	})
+	return result
+}
+
+type labelResolver struct {
+	key, value string
+}
+
+func (l *labelResolver) Key() string {
+	return l.key
+}
+
+func (l *labelResolver) Value() string {
+	return l.value
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"maestro/src/database/schema"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentRequestBytes = 1 << 20
+)
+
+// idempotencyExpiry is how long the result of a request with an idempotency
+// key is kept for retries.
+const idempotencyExpiry = 24 * time.Hour
+
+// idempotencyRecorder keeps a copy of the response body for replays.
+type idempotencyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// idempotent makes retries of a request carrying an Idempotency-Key header
+// return the response of the first attempt instead of acting again, such as
+// launching a second container. Keys are scoped to the user and kept for
+// idempotencyExpiry. Reusing a key for a different request is rejected, as is
+// a retry while the first attempt is still handled. Server errors are not
+// kept, so their retries act again.
+func (s *server) idempotent(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		abortWithError(c, CodeInvalidRequest, fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentRequestBytes+1))
+	if err != nil {
+		abortWithError(c, CodeInvalidRequest, fmt.Sprintf("Failed to read request body: %v", err))
+		return
+	}
+	if len(body) > maxIdempotentRequestBytes {
+		abortWithError(c, CodeTooLarge, "Request body too large for an idempotent request")
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	user := currentUser(c).Name
+	fingerprint := requestFingerprint(c, body)
+	now := time.Now().UTC()
+
+	if _, err := s.db.Query.DeleteExpiredIdempotencyKeys(c, now); err != nil {
+		requestLog(c).Error("Failed to delete expired idempotency keys", "error", err)
+	}
+	created, err := s.db.Query.CreateIdempotencyKey(c, schema.CreateIdempotencyKeyParams{
+		UserName:       user,
+		IdempotencyKey: key,
+		Fingerprint:    fingerprint,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(idempotencyExpiry),
+	})
+	if err != nil {
+		abortWithError(c, CodeInternal, fmt.Sprintf("Failed to record idempotency key: %v", err))
+		return
+	}
+	if created == 0 {
+		s.replayIdempotent(c, user, key, fingerprint, now)
+		return
+	}
+
+	recorder := &idempotencyRecorder{ResponseWriter: c.Writer}
+	c.Writer = recorder
+	handled := false
+	defer func() {
+		// a panicking handler is answered with a 500 by the recovery further
+		// out, so its key is released as for any server error while the
+		// panic goes on
+		s.saveIdempotent(c, recorder, user, key, handled)
+	}()
+	c.Next()
+	handled = true
+}
+
+// saveIdempotent keeps the response to a request with an idempotency key for
+// its retries, or releases the key when the request failed with a server
+// error or did not finish being handled.
+func (s *server) saveIdempotent(c *gin.Context, recorder *idempotencyRecorder, user, key string, handled bool) {
+	// the client may be gone, which is when it retries
+	ctx := context.WithoutCancel(c.Request.Context())
+	status := recorder.Status()
+	var err error
+	if !handled || status >= 500 {
+		err = s.db.Query.DeleteIdempotencyKey(ctx, schema.DeleteIdempotencyKeyParams{UserName: user, IdempotencyKey: key})
+	} else {
+		err = s.db.Query.CompleteIdempotencyKey(ctx, schema.CompleteIdempotencyKeyParams{
+			Status:         int64(status),
+			ContentType:    recorder.Header().Get("Content-Type"),
+			Body:           recorder.body.Bytes(),
+			UserName:       user,
+			IdempotencyKey: key,
+		})
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to save idempotent response", "key", key, "error", err)
+	}
+}
+
+// replayIdempotent answers a retry with the response kept for its key.
+func (s *server) replayIdempotent(c *gin.Context, user, key, fingerprint string, now time.Time) {
+	kept, err := s.db.Query.GetIdempotencyKey(c, schema.GetIdempotencyKeyParams{
+		UserName:       user,
+		IdempotencyKey: key,
+		ExpiresAt:      now,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// the first attempt failed and released the key meanwhile
+		abortWithError(c, CodeConflict, fmt.Sprintf("The request with idempotency key %s is being retried, try again", key))
+		return
+	}
+	if err != nil {
+		abortWithError(c, CodeInternal, fmt.Sprintf("Failed to look up idempotency key: %v", err))
+		return
+	}
+
+	switch {
+	case kept.Fingerprint != fingerprint:
+		abortWithError(c, CodeKeyReused, fmt.Sprintf("Idempotency key %s was used for a different request", key))
+	case kept.Status == 0:
+		abortWithError(c, CodeConflict, fmt.Sprintf("The request with idempotency key %s is still being handled", key))
+	default:
+		requestLog(c).Info("Replaying idempotent response", "key", key, "status", kept.Status)
+		c.Header(idempotentReplayedHeader, "true")
+		c.Data(int(kept.Status), kept.ContentType, kept.Body)
+		c.Abort()
+	}
+}
+
+// requestFingerprint identifies what a request asks for, so that a key reused
+// for another request is told apart from a retry.
+func requestFingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s?%s\n", c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentRequest is a request of an idempotency test and what it should
+// get: its code, whether it was replayed and how often the handler acted by
+// then.
+type idempotentRequest struct {
+	user     string
+	key      string
+	path     string
+	body     string
+	want     int
+	replayed bool
+	acted    int
+}
+
+func TestIdempotent(t *testing.T) {
+	long := strings.Repeat("k", maxIdempotencyKeyLength+1)
+
+	tests := []struct {
+		name     string
+		requests []idempotentRequest
+	}{
+		{
+			name: "without a key every request acts",
+			requests: []idempotentRequest{
+				{user: "alice", path: "/runs", body: "{}", want: 201, acted: 1},
+				{user: "alice", path: "/runs", body: "{}", want: 201, acted: 2},
+			},
+		},
+		{
+			name: "retry is replayed",
+			requests: []idempotentRequest{
+				{user: "alice", key: "k1", path: "/runs", body: "{}", want: 201, acted: 1},
+				{user: "alice", key: "k1", path: "/runs", body: "{}", want: 201, replayed: true, acted: 1},
+				{user: "alice", key: "k1", path: "/runs", body: "{}", want: 201, replayed: true, acted: 1},
+			},
+		},
+		{
+			name: "key reused for another body",
+			requests: []idempotentRequest{
+				{user: "alice", key: "k1", path: "/runs", body: `{"a":1}`, want: 201, acted: 1},
+				{user: "alice", key: "k1", path: "/runs", body: `{"a":2}`, want: 422, acted: 1},
+			},
+		},
+		{
+			name: "key reused for another path",
+			requests: []idempotentRequest{
+				{user: "alice", key: "k1", path: "/runs", body: "{}", want: 201, acted: 1},
+				{user: "alice", key: "k1", path: "/runs?server=b", body: "{}", want: 422, acted: 1},
+			},
+		},
+		{
+			name: "keys are scoped to the user",
+			requests: []idempotentRequest{
+				{user: "alice", key: "k1", path: "/runs", body: "{}", want: 201, acted: 1},
+				{user: "bob", key: "k1", path: "/runs", body: "{}", want: 201, acted: 2},
+				{user: "bob", key: "k1", path: "/runs", body: "{}", want: 201, replayed: true, acted: 2},
+			},
+		},
+		{
+			name: "client errors are kept",
+			requests: []idempotentRequest{
+				{user: "alice", key: "k1", path: "/invalid", body: "{}", want: 400, acted: 1},
+				{user: "alice", key: "k1", path: "/invalid", body: "{}", want: 400, replayed: true, acted: 1},
+			},
+		},
+		{
+			name: "server errors act again",
+			requests: []idempotentRequest{
+				{user: "alice", key: "k1", path: "/failing", body: "{}", want: 500, acted: 1},
+				{user: "alice", key: "k1", path: "/failing", body: "{}", want: 500, acted: 2},
+			},
+		},
+		{
+			name: "panics act again",
+			requests: []idempotentRequest{
+				{user: "alice", key: "k1", path: "/panicking", body: "{}", want: 500, acted: 1},
+				{user: "alice", key: "k1", path: "/panicking", body: "{}", want: 500, acted: 2},
+			},
+		},
+		{
+			name: "key too long",
+			requests: []idempotentRequest{
+				{user: "alice", key: long, path: "/runs", body: "{}", want: 400, acted: 0},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			srv := newTestServer(t)
+
+			acted := 0
+			engine := gin.New()
+			engine.Use(gin.RecoveryWithWriter(io.Discard), func(c *gin.Context) {
+				c.Set("user", User{Name: c.GetHeader("X-Test-User"), Role: RoleOperator})
+				c.Next()
+			}, srv.idempotent)
+			engine.POST("/runs", func(c *gin.Context) {
+				acted++
+				c.JSON(201, gin.H{"run": acted})
+			})
+			engine.POST("/invalid", func(c *gin.Context) {
+				acted++
+				respondError(c, CodeInvalidRequest, "invalid run")
+			})
+			engine.POST("/failing", func(c *gin.Context) {
+				acted++
+				respondError(c, CodeInternal, "failed")
+			})
+			engine.POST("/panicking", func(c *gin.Context) {
+				acted++
+				panic("failed")
+			})
+
+			// the first response per user and key, which retries replay
+			first := map[string]string{}
+			for i, req := range tt.requests {
+				header := http.Header{"X-Test-User": {req.user}}
+				if req.key != "" {
+					header.Set(idempotencyKeyHeader, req.key)
+				}
+				rec := send(t, engine, "POST", req.path, "", strings.NewReader(req.body), header)
+				if rec.Code != req.want {
+					t.Fatalf("request %d: code = %d, want %d, body %s", i, rec.Code, req.want, rec.Body)
+				}
+				if replayed := rec.Header().Get(idempotentReplayedHeader) == "true"; replayed != req.replayed {
+					t.Errorf("request %d: replayed = %v, want %v", i, replayed, req.replayed)
+				}
+				if acted != req.acted {
+					t.Errorf("request %d: handler acted %d times, want %d", i, acted, req.acted)
+				}
+				scope := req.user + " " + req.key
+				if !req.replayed {
+					first[scope] = rec.Body.String()
+				} else if rec.Body.String() != first[scope] {
+					t.Errorf("request %d: replayed body %s, want %s", i, rec.Body, first[scope])
+				}
+			}
+		})
+	}
+}
@@ -1,26 +1,36 @@
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maestro/src/broker"
+	"maestro/src/database"
+	"maestro/src/database/schema"
+	"maestro/src/logging"
 	"maestro/src/manager"
-	"net/url"
+	"maestro/src/outbound"
+	"mime"
+	"mime/multipart"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
-	"github.com/containers/podman/v6/pkg/bindings"
-	"github.com/containers/podman/v6/pkg/bindings/containers"
-	"github.com/containers/podman/v6/pkg/bindings/system"
-	"github.com/containers/podman/v6/pkg/specgen"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/ssh"
 	"gopkg.in/yaml.v3"
 
 	_ "embed"
@@ -28,8 +38,26 @@ import (
 
 // Config holds embedded configuration used at runtime.
 type Config struct {
-	InternalDir string                        `yaml:"internalDir"`
-	Servers     map[string]manager.ServerInfo `yaml:"servers"`
+	Logging        logging.Config                `yaml:"logging"`
+	Database       database.Config               `yaml:"database"`
+	Outbound       outbound.Config               `yaml:"outbound"`
+	InternalDir    string                        `yaml:"internalDir"`
+	StateDir       string                        `yaml:"stateDir"`
+	Auth           AuthConfig                    `yaml:"auth"`
+	Servers        map[string]manager.ServerInfo `yaml:"servers"`
+	Groups         map[string][]string           `yaml:"groups"`
+	ImagePolicy    manager.ImagePolicy           `yaml:"imagePolicy"`
+	Queue          manager.QueueConfig           `yaml:"queue"`
+	Retention      manager.RetentionConfig       `yaml:"retention"`
+	RateLimit      RateLimitConfig               `yaml:"rateLimit"`
+	Secrets        manager.SecretsConfig         `yaml:"secrets"`
+	Registry       manager.RegistryConfig        `yaml:"registry"`
+	Prewarm        []string                      `yaml:"prewarm"` // base images pulled onto every server at startup
+	Builds         manager.BuildConfig           `yaml:"builds"`
+	Quota          manager.QuotaConfig           `yaml:"quota"`
+	Orphans        string                        `yaml:"orphans"` // adopt, remove or ignore untracked containers at startup
+	Broker         broker.Config                 `yaml:"broker"`
+	TrustedProxies []string                      `yaml:"trustedProxies"` // proxies whose X-Forwarded-For header sets the client IP, none by default
 }
 
 // embed configuration file at build time
@@ -37,23 +65,152 @@ type Config struct {
 //go:embed config.yaml
 var rawConfigFile []byte
 
+// reconcileInterval is how often container states are re-inspected as a
+// fallback to the Podman event stream.
+const reconcileInterval = time.Minute
+
+// usageSampleInterval is how often running containers' resource usage is
+// sampled.
+const usageSampleInterval = 10 * time.Second
+
+// queueCheckInterval is how often queues are checked for runs waiting past the
+// threshold.
+const queueCheckInterval = 15 * time.Second
+
+// archiveInterval is how often runs are checked for archival.
+const archiveInterval = time.Hour
+
+// maxAttachRetries bounds the reattaches to a running container whose attach
+// dropped, the first after attachRetryDelay, each next one after twice as long.
+const (
+	maxAttachRetries = 6
+	attachRetryDelay = 2 * time.Second
+)
+
+// pruneInterval is how often servers are checked for exited containers to
+// remove.
+const pruneInterval = 10 * time.Minute
+
+// maxEditSize bounds the body of an inline file edit.
+const maxEditSize = 10 << 20
+
+// uploadExpiry is how long a resumable upload may go without a chunk before
+// it is discarded.
+const uploadExpiry = 24 * time.Hour
+
+// maxOpenUploads bounds the uploads in progress per workspace.
+const maxOpenUploads = 16
+
 var (
-	config         Config                 // parsed configuration
-	serviceManager manager.ServiceManager // global service manager (images + connections)
+	config         Config                  // parsed configuration
+	serviceManager manager.ServiceManager  // global service manager (images + connections)
+	snapshotStore  manager.SnapshotStore   // content-addressed workspace snapshots
+	secretStore    *manager.SecretStore    // encrypted secrets
+	uploadStore    manager.UploadStore     // resumable uploads in progress
+	serverRegistry *manager.ServerRegistry // servers added and removed through the API
+	eventBroker    broker.Publisher        // NATS or MQTT broker events are published to, nil if none
+	loggers        *logging.Loggers        // loggers of the components
+
+	imagePolicy atomic.Pointer[manager.ImagePolicy] // images projects may build FROM or run
 )
 
+// server is handed to the handlers and background tasks that use the
+// database.
+type server struct {
+	db *database.DB // persistent storage
+}
+
 func main() {
 	// Parse embedded YAML config.
 	err := yaml.Unmarshal(rawConfigFile, &config)
 	if err != nil {
-		fmt.Println("Error:", err)
+		slog.Error("Failed to parse config", "error", err)
+		os.Exit(1)
+	}
+
+	// Configure structured logging before anything else logs.
+	loggers, err = logging.New(config.Logging, os.Stderr)
+	if err != nil {
+		slog.Error("Failed to configure logging", "error", err)
+		os.Exit(1)
+	}
+	log := loggers.For("main")
+	monitorLog := loggers.For("monitor")
+
+	// Route maestro's own outbound HTTP calls through the configured proxies.
+	err = outbound.Setup(config.Outbound)
+	if err != nil {
+		log.Error("Failed to configure outbound proxy", "error", err)
+		os.Exit(1)
+	}
+
+	// Check request bodies against the binding tags of their DTOs.
+	registerValidators()
+
+	err = validateAuth(config.Auth)
+	if err != nil {
+		log.Error("Invalid auth config", "error", err)
+		os.Exit(1)
+	}
+	setupURLSigning(config.Auth, log)
+
+	err = manager.ValidateOrphanPolicy(config.Orphans)
+	if err != nil {
+		log.Error("Invalid orphans config", "error", err)
+		os.Exit(1)
+	}
+	err = manager.ValidateContainerPolicy(config.Retention.Containers)
+	if err != nil {
+		log.Error("Invalid retention config", "error", err)
 		os.Exit(1)
 	}
+	serviceManager.Retention = config.Retention
+	serviceManager.Registry = config.Registry
+
+	snapshotStore.Dir = filepath.Join(config.StateDir, "snapshots")
+	uploadStore.Dir = filepath.Join(config.StateDir, "uploads")
+
+	secretStore, err = manager.OpenSecretStore(config.StateDir, config.Secrets)
+	if err != nil {
+		log.Error("Failed to open secret store", "error", err)
+		os.Exit(1)
+	}
+	if unknown := secretStore.UnknownKeys(); len(unknown) > 0 {
+		log.Warn("Secrets are encrypted with keys that are not configured", "keys", unknown)
+	}
+
+	// A policy changed through the API takes precedence over the configured one.
+	policy, err := manager.LoadImagePolicy(config.StateDir)
+	if err != nil {
+		log.Error("Failed to load image policy", "error", err)
+		os.Exit(1)
+	}
+	if policy == nil {
+		policy = &config.ImagePolicy
+	}
+	imagePolicy.Store(policy)
+
+	// Open the database and apply pending migrations.
+	db, err := database.Open(context.Background(), config.Database, loggers.For("database"))
+	if err != nil {
+		log.Error("Failed to open database", "error", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	srv := &server{db: db}
+
+	// Requests still handled when the last instance stopped never finished,
+	// let their retries act again.
+	if released, err := db.Query.DeletePendingIdempotencyKeys(context.Background()); err != nil {
+		log.Error("Failed to release pending idempotency keys", "error", err)
+	} else if released > 0 {
+		log.Info("Released pending idempotency keys", "count", released)
+	}
 
 	// Load image directories from internal storage and register them.
 	imagesDir, err := os.ReadDir(config.InternalDir)
 	if err != nil {
-		fmt.Println("Error:", err)
+		log.Error("Failed to read images directory", "dir", config.InternalDir, "error", err)
 		os.Exit(1)
 	}
 
@@ -64,168 +221,142 @@ func main() {
 		imagePath := filepath.Join(config.InternalDir, image.Name())
 
 		imageManager := &manager.ImageManager{
-			ID:        nil,
-			Name:      image.Name(),
-			FilesDir:  imagePath,
-			Container: nil,
+			ID:         nil,
+			Name:       image.Name(),
+			FilesDir:   imagePath,
+			GitDir:     workspaceGitDir(image.Name()),
+			Container:  nil,
+			Disk:       manager.DiskUsage{QuotaBytes: config.Quota.Bytes()},
+			PersistRun: srv.persistRun,
 		}
 
-		serviceManager.Images.Store(image.Name(), imageManager)
-	}
-
-	// For each server in config: create a Podman connection and a worker
-	// goroutine that runs containers queued for that server.
-	for serverName, serverInfo := range config.Servers {
-		// Build SSH URI to Podman socket: ssh://user@host/path/to/socket
-		serverURI := fmt.Sprintf("%s@%s:%d", serverInfo.Username, serverInfo.Host, serverInfo.Port)
-		log.Printf("Connecting to server %s: user=%s host=%s port=%d socket=%s uri=%s", serverName, serverInfo.Username, serverInfo.Host, serverInfo.Port, serverInfo.PodmanSocket, serverURI)
-		uri, err := url.ParseRequestURI(fmt.Sprintf("ssh://%s%s", serverURI, serverInfo.PodmanSocket))
-		if err != nil {
-			log.Fatal(err)
+		if err := imageManager.LoadProtected(config.StateDir); err != nil {
+			log.Error("Failed to load protected files", "image", image.Name(), "error", err)
 		}
-
-		podmanConn, err := bindings.NewConnectionWithIdentity(context.Background(), uri.String(), serverInfo.IdentityFile, true)
-		if err != nil {
-			log.Fatal(err)
+		if moved, err := manager.MoveWorkspaceRepo(context.Background(), imageManager.GitDir, imageManager.FilesDir); err != nil {
+			log.Error("Failed to move workspace repository out of the workspace", "image", image.Name(), "error", err)
+		} else if moved {
+			log.Info("Moved workspace repository out of the workspace", "image", image.Name())
 		}
-
-		key, _ := os.ReadFile(serverInfo.IdentityFile)
-		signer, _ := ssh.ParsePrivateKey(key)
-
-		sshConfig := &ssh.ClientConfig{
-			User: serverInfo.Username,
-			Auth: []ssh.AuthMethod{
-				ssh.PublicKeys(signer),
-			},
-			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-			Timeout:         10 * time.Second,
+		if repo, err := manager.ReadWorkspaceRepo(context.Background(), imageManager.GitDir, imageManager.FilesDir); err == nil {
+			if err := srv.indexWorkspaceTrigger(context.Background(), image.Name(), repo); err != nil {
+				log.Error("Failed to record workspace trigger", "image", image.Name(), "error", err)
+			}
 		}
-
-		// TODO: V
-		addr := serverInfo.Host + ":22"
-		sshClient, err := ssh.Dial("tcp", addr, sshConfig)
-		if err != nil {
-			log.Fatal(err)
+		if _, err := imageManager.MeasureUsage(); err != nil {
+			log.Error("Failed to measure workspace usage", "image", image.Name(), "error", err)
 		}
-		defer sshClient.Close()
-
-		info, _ := system.Info(podmanConn, nil)
 
-		serverInfo.Name = serverName
-		serverInfo.MemTotal = fmt.Sprintf("%.2fGiB", float32(info.Host.MemTotal)/1024/1024/1024)
+		serviceManager.Images.Store(image.Name(), imageManager)
+	}
 
-		connectionManager := manager.ConnectionManager{
-			Conn:       podmanConn,
-			SshConn:    sshClient,
-			Server:     serverInfo,
-			ImageQueue: make(chan *manager.ImageManager),
-		}
+	if err := srv.failInterruptedOperations(context.Background()); err != nil {
+		log.Error("Failed to recover interrupted operations", "error", err)
+	}
 
-		serviceManager.Connections.Store(serverName, &connectionManager)
+	if err := srv.loadOwners(context.Background()); err != nil {
+		log.Error("Failed to load workspace owners", "error", err)
+		os.Exit(1)
+	}
 
-		// Worker: consume image jobs and create/start containers on this server.
-		go func() {
-			for imageManager := range connectionManager.ImageQueue {
-				func() {
-					imageManager.Mu.Lock()
-					defer imageManager.Mu.Unlock()
-
-					dateTime := time.Now().Format("02-01-2006_15-04-05")
-					containerName := fmt.Sprintf("container-%s", dateTime)
-
-					// Create container using the built image reference.
-					newContainer, err := containers.CreateWithSpec(podmanConn, &specgen.SpecGenerator{
-						ContainerBasicConfig: specgen.ContainerBasicConfig{
-							Name: containerName,
-						},
-						ContainerStorageConfig: specgen.ContainerStorageConfig{
-							Image: *imageManager.ID,
-						},
-						ContainerHealthCheckConfig: specgen.ContainerHealthCheckConfig{
-							HealthLogDestination: "/tmp",
-						},
-					}, nil)
-					if err != nil {
-						// Creation failed
-						log.Printf("Error creating container %s for image %s: %v", containerName, imageManager.Name, err)
-						imageManager.Container.Status = manager.Error
-						return
-					}
+	// For each configured server, and those added through the API: create a
+	// Podman connection and a worker goroutine that runs containers queued for
+	// that server.
+	serverRegistry, err = manager.LoadServerRegistry(config.StateDir)
+	if err != nil {
+		log.Error("Failed to load added servers", "error", err)
+		os.Exit(1)
+	}
+	// Unreachable servers start offline and are retried in the background.
+	for serverName, serverInfo := range serverRegistry.Servers(config.Servers) {
+		if _, err := srv.connectServer(serverName, serverInfo); err != nil {
+			log.Warn("Server unreachable, retrying in the background", "server", serverName, "error", err)
+			srv.registerOfflineServer(serverName, serverInfo)
+		}
+	}
 
-					// Prepare stdout/stderr files in the image's directory.
-					stdoutFileName := fmt.Sprintf("stdout-%s.log", dateTime)
-					stderrFileName := fmt.Sprintf("stderr-%s.log", dateTime)
-					stdoutPath := filepath.Join(imageManager.FilesDir, stdoutFileName)
-					stderrPath := filepath.Join(imageManager.FilesDir, stderrFileName)
+	// Track the containers left running by the last shutdown again. Their
+	// runs' operations can resume capturing their output.
+	restored, err := serviceManager.RestoreTracking(config.StateDir)
+	if err != nil {
+		log.Error("Failed to restore tracked containers", "error", err)
+	}
+	if restored > 0 {
+		log.Info("Restored running containers", "count", restored)
+	}
 
-					stdoutFD, err := os.OpenFile(stdoutPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-					if err != nil {
-						log.Printf("Error opening stdout file: %v", err)
-					}
+	// Containers still running that no image tracks, e.g. after a crash, are
+	// adopted or cleaned up.
+	serviceManager.Connections.Range(func(_ string, connectionManager *manager.ConnectionManager) bool {
+		if connectionManager.Status() != manager.ServerOffline {
+			srv.reconcileOrphans(connectionManager)
+		}
+		return true
+	})
 
-					stderrFD, err := os.OpenFile(stderrPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
-					if err != nil {
-						log.Printf("Error opening stderr file: %v", err)
-					}
+	// Server groups: groups changed through the API are saved in the state
+	// directory and take precedence over the configured ones.
+	loaded, err := serviceManager.LoadGroups(config.StateDir)
+	if err != nil {
+		log.Error("Failed to load server groups", "error", err)
+	}
+	if !loaded {
+		for groupName, members := range config.Groups {
+			if err := serviceManager.SetGroup(groupName, members); err != nil {
+				log.Error("Invalid server group", "group", groupName, "error", err)
+			}
+		}
+	}
 
-					// Track container metadata on the image manager.
-					imageManager.Container = &manager.ContainerManager{
-						ID:        newContainer.ID,
-						Name:      containerName,
-						Status:    manager.Running,
-						CreatedAt: time.Now(),
+	// Drop cached listings as soon as their workspaces change.
+	go listings.watch(&serviceManager.Events)
 
-						Stdout: stdoutFD,
-						Stderr: stderrFD,
-					}
+	// Notify the registered webhooks of run lifecycle events.
+	go srv.watchWebhooks(&serviceManager.Events)
 
-					// Start the container and update status on failure.
-					err = containers.Start(connectionManager.Conn, imageManager.Container.ID, nil)
-					if err != nil {
-						imageManager.Container.Status = manager.Error
-						return
-					}
+	// Post finished, failed and long-waiting runs to chat channels.
+	go srv.watchNotifications(&serviceManager.Events)
 
-					// Attach to container streams to capture logs in a separate thread.
-					go func() {
-						err = containers.Attach(connectionManager.Conn, imageManager.Container.ID, nil, stdoutFD, stderrFD, nil, &containers.AttachOptions{
-							Logs:   func(a bool) *bool { return &a }(true),
-							Stream: func(a bool) *bool { return &a }(true),
-						})
-						if err != nil {
-							imageManager.Mu.Lock()
-							defer imageManager.Mu.Lock()
-							log.Printf("Error attaching to container %s: %v", imageManager.Container.ID, err)
-							imageManager.Container.Status = manager.Error
-							return
-						}
-					}()
-				}()
+	// Publish every lifecycle event to the configured message broker.
+	if config.Broker.URL != "" {
+		password := ""
+		if config.Broker.PasswordSecret != "" {
+			revealed, err := secretStore.Reveal(config.Broker.PasswordSecret)
+			if err != nil {
+				log.Error("Failed to read broker password", "secret", config.Broker.PasswordSecret, "error", err)
+				os.Exit(1)
 			}
-		}()
+			password = string(revealed)
+		}
+		eventBroker, err = broker.Connect(config.Broker, password)
+		if err != nil {
+			log.Error("Invalid broker config", "error", err)
+			os.Exit(1)
+		}
+		go publishEvents(serviceManager.Events.SubscribeQueued(), eventBroker)
 	}
 
+	// Pull the configured base images so first builds do not wait for them.
+	srv.prewarmServers(config.Prewarm)
+
 	go func() {
 		for {
 			serviceManager.Connections.Range(func(serverName string, connectionManager *manager.ConnectionManager) bool {
-				// fetch memory info from the server
-				session, err := connectionManager.SshConn.NewSession()
-				if err != nil {
-					log.Printf("Error ssh session server %s: %v", serverName, err)
+				if connectionManager.Status() == manager.ServerOffline {
 					return true
 				}
-				defer session.Close()
 
-				var out bytes.Buffer
-				session.Stdout = &out
-
-				err = session.Run("awk '/MemAvailable/ {print $2}' /proc/meminfo")
+				// fetch memory info from the server
+				out, err := connectionManager.Shell("awk '/MemAvailable/ {print $2}' /proc/meminfo")
+				if errors.Is(err, manager.ErrNoShell) {
+					return true
+				}
 				if err != nil {
-					log.Printf("Error running free command on server %s: %v", serverName, err)
+					monitorLog.Error("Failed to read memory info", "server", serverName, "error", err)
 					return true
 				}
 
-				raw := strings.TrimSpace(out.String())
+				raw := strings.TrimSpace(out)
 				mem, _ := strconv.ParseFloat(raw, 64)
 
 				connectionManager.Mu.Lock()
@@ -239,292 +370,1133 @@ func main() {
 		}
 	}()
 
-	// Poll container states periodically to update status (finished, stopped).
+	// Sample CPU and memory of running containers for the run history.
+	go func() {
+		for {
+			if err := serviceManager.SampleUsage(); err != nil {
+				monitorLog.Error("Failed to sample container usage", "error", err)
+			}
+			time.Sleep(usageSampleInterval)
+		}
+	}()
+
+	// Report runs that wait in a queue for longer than the threshold, with
+	// servers that could take them instead.
+	if config.Queue.WaitThresholdSeconds > 0 {
+		threshold := time.Duration(config.Queue.WaitThresholdSeconds) * time.Second
+		go func() {
+			for {
+				serviceManager.Connections.Range(func(serverName string, connectionManager *manager.ConnectionManager) bool {
+					for _, run := range connectionManager.RunQueue.Overdue(threshold) {
+						suggested := serviceManager.FreeServers(serverName)
+						monitorLog.Warn("Run waiting in queue", "server", serverName, "image", run.Image, "position", run.Position, "waited", run.Waited)
+						serviceManager.Events.Publish(manager.Event{
+							Type:      manager.EventDelayed,
+							Image:     run.Image,
+							Server:    serverName,
+							Message:   fmt.Sprintf("run has waited %s in the queue", run.Waited.Round(time.Second)),
+							Position:  run.Position,
+							Suggested: suggested,
+						})
+					}
+					return true
+				})
+				time.Sleep(queueCheckInterval)
+			}
+		}()
+	}
+
+	// Move the logs of old runs to the archive.
+	if config.Retention.HotDays > 0 {
+		archiveDir := runArchiveDir()
+		compression, err := manager.ParseCompression(config.Retention.Compression)
+		if err != nil {
+			log.Error("Invalid retention config", "error", err)
+			os.Exit(1)
+		}
+
+		go func() {
+			for {
+				before := time.Now().AddDate(0, 0, -config.Retention.HotDays)
+
+				ctx, cancel := context.WithCancel(context.Background())
+				op := srv.newOperation(manager.OperationArchive, "", archiveDir, "")
+				op.SetCancel(func() error {
+					cancel()
+					return nil
+				})
+
+				// runs are archived from their records, so those that left the
+				// run history are too
+				due, err := srv.dueRuns(ctx, before)
+				archived := 0
+				if err == nil {
+					archived, err = serviceManager.ArchiveRuns(ctx, archiveDir, compression, due, op)
+				}
+				op.Finish(err)
+				cancel()
+				if err != nil {
+					monitorLog.Error("Failed to archive runs", "error", err)
+				}
+				if archived > 0 {
+					monitorLog.Info("Archived runs", "count", archived, "dir", archiveDir)
+				}
+				time.Sleep(archiveInterval)
+			}
+		}()
+	}
+
+	// Remove the exited containers the retention policy no longer keeps and
+	// dangling ones left behind on the servers.
+	go func() {
+		for {
+			time.Sleep(pruneInterval)
+			serviceManager.Connections.Range(func(serverName string, connectionManager *manager.ConnectionManager) bool {
+				if connectionManager.Status() == manager.ServerOffline {
+					return true
+				}
+				pruned, err := serviceManager.PruneContainers(connectionManager, time.Now())
+				if err != nil {
+					monitorLog.Error("Failed to prune exited containers", "server", serverName, "error", err)
+				}
+				if pruned > 0 {
+					monitorLog.Info("Pruned exited containers", "server", serverName, "count", pruned)
+				}
+				return true
+			})
+		}
+	}()
+
+	// Discard resumable uploads their clients gave up on, and old webhook
+	// deliveries.
+	go func() {
+		for {
+			pruned, err := uploadStore.Prune(time.Now().Add(-uploadExpiry))
+			if err != nil {
+				monitorLog.Error("Failed to prune uploads", "error", err)
+			}
+			if pruned > 0 {
+				monitorLog.Info("Pruned abandoned uploads", "count", pruned)
+			}
+			srv.pruneWebhookDeliveries()
+			time.Sleep(archiveInterval)
+		}
+	}()
+
+	// Reconcile container states periodically in case an event was missed
+	// while the event stream was down, and stop containers past their run's
+	// timeout.
 	go func() {
 		for {
 			serviceManager.Images.Range(func(imageName string, imageManager *manager.ImageManager) bool {
 				imageManager.Mu.Lock()
 				defer imageManager.Mu.Unlock()
-				if imageManager.Container != nil && imageManager.Connection != nil {
+				if container := imageManager.Container; container != nil && imageManager.Connection != nil && container.Overdue(time.Now()) {
+					serverName := imageManager.Connection.Info().Name
+					if err := imageManager.Connection.Runtime.StopContainer(container.ID); err != nil {
+						monitorLog.Error("Failed to stop container past its timeout", "image", imageName, "container", container.ID, "error", err)
+						return true
+					}
+					container.Transition(manager.TimedOut)
+					monitorLog.Info("Container stopped past its timeout", "server", serverName, "image", imageName, "container", container.Name, "timeout_minutes", container.Options.TimeoutMinutes)
+					serviceManager.Events.Publish(manager.Event{Type: manager.EventTimedOut, Image: imageName, Server: serverName, Container: container.Name})
+
+					// the exit is recorded right away, it is no longer reconciled below
+					if state, err := imageManager.Connection.Runtime.InspectContainer(container.ID); err == nil && state.Exited {
+						serviceManager.HandleExit(imageManager, imageManager.Connection, container, state.FinishedAt, state.ExitCode, state.OOMKilled)
+					} else {
+						container.Activity.Finish(time.Now())
+					}
+				}
+				if imageManager.Container != nil && imageManager.Container.Active() && imageManager.Connection != nil {
 					// Inspect the container to get current state.
-					containerReport, err := containers.Inspect(imageManager.Connection.Conn, imageManager.Container.ID, &containers.InspectOptions{
-						Size: func(a bool) *bool { return &a }(false),
-					})
+					state, err := imageManager.Connection.Runtime.InspectContainer(imageManager.Container.ID)
 					if err != nil {
-						log.Printf("Error inspecting container %s: %v", imageManager.Container.ID, err)
+						monitorLog.Error("Failed to inspect container", "image", imageName, "container", imageManager.Container.ID, "error", err)
 					} else {
 						// Update local state if container has exited.
-						switch containerReport.State.Status {
-						case "exited":
-							imageManager.Container.FinishedAt = &containerReport.State.FinishedAt
-							imageManager.Container.Status = manager.Finished
-							imageManager.Container.Stdout.Close()
-							imageManager.Container.Stderr.Close()
+						switch {
+						case state.Exited:
+							serviceManager.HandleExit(imageManager, imageManager.Connection, imageManager.Container, state.FinishedAt, state.ExitCode, state.OOMKilled)
 						}
 					}
 				}
 				return true
 			})
 
-			time.Sleep(time.Second * 5)
+			time.Sleep(reconcileInterval)
 		}
 	}()
 
-	log.Println("Starting server...")
+	log.Info("Starting server")
 
 	// Run Gin in release mode.
 	gin.SetMode(gin.ReleaseMode)
 
+	authFailures = newClientLimiters(config.RateLimit.FailedAuth)
+
 	// Initialize Gin engine and register middleware.
 	r := gin.New(func(e *gin.Engine) {
 		e.Use(cors.New(cors.Config{
 			AllowOrigins:     []string{"*"},
-			AllowMethods:     []string{"GET", "POST", "PUT", "HEAD", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With"},
+			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+			AllowHeaders:     []string{"Origin", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, Idempotency-Key, Upload-Offset, If-None-Match"},
+			ExposeHeaders:    []string{"Upload-Offset", "ETag", "Retry-After", "Idempotent-Replayed", "Content-Disposition"},
 			AllowCredentials: true,
 			MaxAge:           12 * time.Hour,
 		}))
 
-		e.Use(gin.Logger(), gin.Recovery())
+		e.Use(requestLogger(loggers.For("http")), requestMetrics, gin.Recovery(), srv.auditLog, srv.authenticate, newRateLimiter(config.RateLimit.Default))
 	})
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Error("Invalid trusted proxies", "error", err)
+		os.Exit(1)
+	}
 
-	// API endpoints for images/containers and file operations.
-	r.GET("containers", handleGetContainers)
-	r.GET("servers", handleGetServers)
-
-	r.POST("container/:name", handleNewContainer)
-	r.GET("container/:name", handleGetContainer)
-	r.DELETE("container/:name", handleDeleteContainer)
-
-	r.POST("container/:name/files", handlePostFile)
-	r.GET("container/:name/files", handleGetFiles)
-	r.GET("container/:name/file", handleGetFile)
-	r.DELETE("container/:name/file", handleDeleteFile)
-
-	r.POST("container/:name/run", handleRunContainer)
-	r.POST("container/:name/build", handleBuildContainer)
-	r.POST("container/:name/stop", handleStopContainer)
+	// tighter limits for endpoints that build, start containers or write files
+	limitExpensive := newRateLimiter(config.RateLimit.Expensive)
+
+	// API endpoints for workspaces, their runs and file operations.
+	api := r.Group(apiPrefix)
+	api.GET("auth/oidc/login", handleOIDCLogin)
+	api.GET("auth/oidc/callback", srv.handleOIDCCallback)
+	api.POST("auth/logout", srv.handleLogout)
+	api.GET("auth/me", handleGetMe)
+
+	api.POST("signed-urls", requireViewer, handleSignURL)
+
+	api.GET("workspaces", requireViewer, handleGetWorkspaces)
+	api.GET("servers", requireViewer, handleGetServers)
+	api.GET("servers/groups", requireViewer, handleGetServerGroups)
+	api.PUT("servers/groups/:group", requireAdmin, handlePutServerGroup)
+	api.DELETE("servers/groups/:group", requireAdmin, handleDeleteServerGroup)
+	api.POST("servers", requireAdmin, srv.handleAddServer)
+	api.DELETE("servers/:name", requireAdmin, handleRemoveServer)
+	api.POST("servers/:name/drain", requireAdmin, handleDrainServer)
+	api.POST("servers/:name/resume", requireAdmin, handleResumeServer)
+	api.GET("servers/:name/timeline", requireViewer, handleGetServerTimeline)
+	api.GET("servers/:name/health", requireViewer, handleGetServerHealth)
+	api.GET("servers/:name/info", requireViewer, handleGetServerInfo)
+	api.GET("servers/:name/queue", requireViewer, handleGetServerQueue)
+	api.POST("servers/:name/pull", requireOperator, limitExpensive, srv.handlePullImages)
+	api.POST("servers/prewarm", requireAdmin, srv.handlePrewarmServers)
+	api.GET("events/stream", requireViewer, handleEventStream)
+	api.GET("metrics", requireViewer, srv.handleGetMetrics)
+	api.POST("graphql", requireViewer, handleGraphQL)
+	api.POST("hooks/git", srv.handleGitHook)
+
+	api.POST("workspaces/:name", requireOperator, srv.idempotent, srv.handleNewWorkspace)
+	api.GET("workspaces/:name", requireViewer, requireOwner, handleGetWorkspace)
+	api.DELETE("workspaces/:name", requireAdmin, srv.handleDeleteWorkspace)
+	api.PUT("workspaces/:name/owner", requireAdmin, srv.handleSetOwner)
+
+	api.POST("workspaces/:name/files", requireOperator, requireOwner, limitExpensive, handlePostFile)
+	api.GET("workspaces/:name/files", requireViewer, requireOwner, handleGetFiles)
+	api.GET("workspaces/:name/files/archive", requireViewer, requireOwner, handleGetArchive)
+	api.POST("workspaces/:name/files/archive", requireOperator, requireOwner, limitExpensive, handlePostArchive)
+	api.GET("workspaces/:name/git", requireViewer, requireOwner, handleGetWorkspaceRepo)
+	api.POST("workspaces/:name/git/clone", requireOperator, requireOwner, limitExpensive, srv.handleCloneWorkspace)
+	api.POST("workspaces/:name/git/pull", requireOperator, requireOwner, limitExpensive, handlePullWorkspace)
+	api.PUT("workspaces/:name/git/trigger", requireOperator, requireOwner, srv.handleSetWorkspaceTrigger)
+	api.POST("workspaces/:name/uploads", requireOperator, requireOwner, handleCreateUpload)
+	api.GET("workspaces/:name/uploads/:id", requireOperator, requireOwner, handleGetUpload)
+	api.PATCH("workspaces/:name/uploads/:id", requireOperator, requireOwner, handleAppendUpload)
+	api.POST("workspaces/:name/uploads/:id/complete", requireOperator, requireOwner, limitExpensive, handleCompleteUpload)
+	api.DELETE("workspaces/:name/uploads/:id", requireOperator, requireOwner, handleAbortUpload)
+	api.GET("workspaces/:name/file", requireViewer, requireOwner, handleGetFile)
+	api.PUT("workspaces/:name/file", requireOperator, requireOwner, handlePutFile)
+	api.PATCH("workspaces/:name/file", requireOperator, requireOwner, handleMoveFile)
+	api.DELETE("workspaces/:name/file", requireOperator, requireOwner, handleDeleteFile)
+	api.PUT("workspaces/:name/file/protect", requireAdmin, handleProtectFile)
+	api.DELETE("workspaces/:name/file/protect", requireAdmin, handleUnprotectFile)
+	api.GET("workspaces/:name/storage", requireViewer, requireOwner, handleGetStorage)
+	api.DELETE("workspaces/:name/storage/:category", requireOperator, requireOwner, srv.handleCleanStorage)
+
+	api.GET("runs/:id/placement-explain", requireViewer, handleGetPlacement)
+	api.GET("operations", requireViewer, srv.handleGetOperations)
+	api.GET("operations/:id", requireViewer, srv.handleGetOperation)
+	api.POST("operations/:id/cancel", requireOperator, srv.handleCancelOperation)
+	api.POST("operations/:id/resume", requireOperator, limitExpensive, srv.handleResumeOperation)
+	api.POST("operations/:id/cleanup", requireOperator, srv.handleCleanupOperation)
+	api.GET("workspaces/:name/operations", requireViewer, requireOwner, srv.handleGetImageOperations)
+	api.GET("workspaces/:name/runs", requireViewer, requireOwner, handleGetRuns)
+	api.POST("workspaces/:name/runs", requireOperator, requireOwner, limitExpensive, srv.idempotent, srv.handleCreateRun)
+	api.GET("workspaces/:name/runs/:run", requireViewer, requireOwner, srv.handleGetRun)
+	api.GET("workspaces/:name/runs/:run/logs", requireViewer, requireOwner, srv.handleGetRunLogs)
+	api.POST("workspaces/:name/runs/:run/rehydrate", requireOperator, requireOwner, srv.handleRehydrateRun)
+
+	api.POST("workspaces/:name/build", requireOperator, requireOwner, limitExpensive, srv.idempotent, srv.handleBuildContainer)
+	api.POST("workspaces/:name/transfer", requireOperator, requireOwner, limitExpensive, srv.handleTransferImage)
+	api.POST("workspaces/:name/scaffold", requireOperator, requireOwner, handleScaffold)
+	api.GET("workspaces/:name/build/log", requireViewer, requireOwner, handleGetBuildLog)
+	api.GET("builds/:id", requireViewer, srv.handleGetBuild)
+	api.POST("builds/:id/cancel", requireOperator, srv.handleCancelBuild)
+	api.POST("workspaces/:name/runs/:run/stop", requireOperator, requireOwner, requireCurrentRun, handleStopContainer)
+	api.POST("workspaces/:name/runs/:run/restart", requireOperator, requireOwner, requireCurrentRun, limitExpensive, srv.handleRestartContainer)
+	api.GET("workspaces/:name/runs/:run/stdin", requireOperator, requireOwner, requireCurrentRun, handleAttachStdin)
+	api.GET("workspaces/:name/runs/:run/exec", requireOperator, requireOwner, requireCurrentRun, handleExecContainer)
+	api.POST("workspaces/:name/runs/:run/kill", requireOperator, requireOwner, requireCurrentRun, handleKillContainer)
+	api.GET("workspaces/:name/runs/:run/wait", requireViewer, requireOwner, requireCurrentRun, handleWaitContainer)
+	api.POST("workspaces/:name/runs/:run/pause", requireOperator, requireOwner, requireCurrentRun, handlePauseContainer)
+	api.POST("workspaces/:name/runs/:run/unpause", requireOperator, requireOwner, requireCurrentRun, handleUnpauseContainer)
+
+	api.POST("workspaces/:name/snapshots", requireOperator, requireOwner, handleCreateSnapshot)
+	api.GET("workspaces/:name/snapshots", requireViewer, requireOwner, handleGetSnapshots)
+	api.GET("workspaces/:name/snapshots/:snapshot", requireViewer, requireOwner, handleGetSnapshot)
+	api.GET("workspaces/:name/snapshots/:snapshot/diff", requireViewer, requireOwner, handleDiffSnapshot)
+	api.POST("workspaces/:name/snapshots/:snapshot/restore", requireOperator, requireOwner, limitExpensive, srv.handleRestoreSnapshot)
+
+	api.GET("admin/image-policy", requireAdmin, handleGetImagePolicy)
+	api.PUT("admin/image-policy", requireAdmin, handlePutImagePolicy)
+	api.POST("image-policy/test", requireViewer, handleTestImagePolicy)
+
+	api.GET("secrets", requireOperator, handleGetSecrets)
+	api.PUT("secrets/:secret", requireAdmin, handlePutSecret)
+	api.DELETE("secrets/:secret", requireAdmin, handleDeleteSecret)
+	api.POST("admin/secrets/rotate", requireAdmin, handleRotateSecrets)
+
+	api.GET("webhooks", requireViewer, srv.handleGetWebhooks)
+	api.POST("webhooks", requireOperator, srv.handleCreateWebhook)
+	api.DELETE("webhooks/:id", requireOperator, srv.handleDeleteWebhook)
+	api.GET("webhooks/:id/deliveries", requireViewer, srv.handleGetWebhookDeliveries)
+
+	api.GET("notifications", requireViewer, srv.handleGetNotifications)
+	api.POST("notifications", requireOperator, srv.handleCreateNotification)
+	api.DELETE("notifications/:id", requireOperator, srv.handleDeleteNotification)
+	api.POST("notifications/:id/test", requireOperator, srv.handleTestNotification)
+
+	api.GET("admin/audit", requireAdmin, srv.handleGetAuditLog)
+	api.GET("admin/migrations", requireAdmin, srv.handleGetMigrations)
+	api.POST("admin/migrations/up", requireAdmin, srv.handleMigrateUp)
+	api.POST("admin/migrations/down", requireAdmin, srv.handleMigrateDown)
+
+	api.POST("workspaces/:name/quarantine", requireAdmin, handleQuarantineContainer)
+	api.DELETE("workspaces/:name/quarantine", requireAdmin, handleReleaseContainer)
+
+	api.GET("openapi.json", handleGetOpenAPI)
+	api.GET("docs", handleGetDocs)
+	r.GET("healthz", handleHealthz)
+	r.GET("readyz", srv.handleReadyz)
+	r.NoRoute(handleNoRoute)
+
+	openapiSpec, err = buildOpenAPI(r.Routes())
+	if err != nil {
+		log.Error("Failed to build the API document", "error", err)
+		os.Exit(1)
+	}
 
 	const addr string = "localhost:3003"
-	log.Printf("Server started at %s", addr)
+	log.Info("Server started", "addr", addr)
 
-	// Start HTTP server (blocks).
-	r.Run(addr)
-
-	os.Exit(0)
+	// Serve until SIGINT or SIGTERM, then shut down.
+	if err := serve(legacyPaths(r), addr); err != nil {
+		log.Error("Server failed", "error", err)
+		db.Close()
+		os.Exit(1)
+	}
 }
 
-// handleGetContainers returns all tracked servers.
+// handleGetServers returns all tracked servers.
 func handleGetServers(c *gin.Context) {
 	servers := serviceManager.Connections.Pairs()
 
 	c.JSON(200, servers)
 }
 
-// handleGetContainers returns all tracked images.
-func handleGetContainers(c *gin.Context) {
-	images := serviceManager.Images.Pairs()
+// imageListing is an image in the containers listing with the fields it is
+// filtered and sorted by, read under the image's lock.
+type imageListing struct {
+	image     *manager.ImageManager
+	owner     string
+	status    manager.Status
+	server    string
+	createdAt time.Time
+}
+
+// handleGetWorkspaces returns a page of the tracked images the user can
+// access. They can be filtered by the `status` of their container and the
+// `server` they run on and sorted by name, owner, status or created_at, the
+// creation of their container.
+func handleGetWorkspaces(c *gin.Context) {
+	q, ok := parseListQuery(c, "name", "name", "owner", "status", "created_at")
+	if !ok {
+		return
+	}
 
-	c.JSON(200, images)
+	listings.serve(c, "workspaces", q.key(), func() any {
+		var images []imageListing
+		serviceManager.Images.Range(func(_ string, imageManager *manager.ImageManager) bool {
+			if !canAccess(c, imageManager) {
+				return true
+			}
+			imageManager.Mu.RLock()
+			listing := imageListing{image: imageManager, owner: imageManager.Owner}
+			if container := imageManager.Container; container != nil {
+				listing.status = container.Status
+				listing.createdAt = container.CreatedAt
+			}
+			if imageManager.Connection != nil {
+				listing.server = imageManager.Connection.Server.Name
+			}
+			imageManager.Mu.RUnlock()
+			images = append(images, listing)
+			return true
+		})
+
+		page := paginate(images, q, func(listing imageListing) bool {
+			return (q.Status == "" || string(listing.status) == q.Status) && (q.Server == "" || listing.server == q.Server)
+		}, func(a, b imageListing, field string) int {
+			switch field {
+			case "owner":
+				return cmp.Compare(a.owner, b.owner)
+			case "status":
+				return cmp.Compare(a.status, b.status)
+			case "created_at":
+				return a.createdAt.Compare(b.createdAt)
+			}
+			return cmp.Compare(a.image.Name, b.image.Name)
+		})
+		result := Page[*manager.ImageManager]{Items: []*manager.ImageManager{}, Total: page.Total, Page: page.Page, Limit: page.Limit}
+		for _, listing := range page.Items {
+			result.Items = append(result.Items, listing.image)
+		}
+		return result
+	})
 }
 
-// handleGetContainer returns a single image record by name.
-func handleGetContainer(c *gin.Context) {
+// handleGetWorkspace returns a single image record by name.
+func handleGetWorkspace(c *gin.Context) {
 	imageName := c.Param("name")
 	if len(imageName) == 0 {
-		c.JSON(400, gin.H{"error": "Container name is required"})
+		respondError(c, CodeInvalidRequest, "Container name is required")
 		return
 	}
 
 	imageManager, exists := serviceManager.Images.Load(imageName)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Container %s not found", imageName)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", imageName))
 		return
 	}
 
 	c.JSON(200, imageManager)
 }
 
-// handleNewContainer creates a new image directory and registers it.
-func handleNewContainer(c *gin.Context) {
+// handleNewWorkspace creates a new image directory and registers it.
+func (s *server) handleNewWorkspace(c *gin.Context) {
 	imageName := c.Param("name")
 	if len(imageName) == 0 {
-		c.JSON(400, gin.H{"error": "Container name is required"})
+		respondError(c, CodeInvalidRequest, "Container name is required")
 		return
 	}
 
-	imageFilesDir := filepath.Join(config.InternalDir, imageName)
-	if filepath.Dir(imageFilesDir) != config.InternalDir {
-		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid container name: %s", filepath.Base(imageFilesDir))})
+	if !validWorkspaceName(imageName) {
+		respondFieldError(c, "workspace", "name", fieldMessages["workspace_name"])
 		return
 	}
+	imageFilesDir := filepath.Join(config.InternalDir, imageName)
 
 	// create directory for image files
 	err := os.Mkdir(imageFilesDir, 0755)
 	if err != nil {
 		if errors.Is(err, os.ErrExist) {
-			c.JSON(409, gin.H{"error": fmt.Sprintf("Container %s already exists", imageName)})
+			respondError(c, CodeAlreadyExists, fmt.Sprintf("Container %s already exists", imageName))
 			return
 		} else {
-			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to create container: %v", err)})
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to create container: %v", err))
 			return
 		}
 	}
 
+	owner := currentUser(c).Name
+	err = s.db.Query.SetWorkspaceOwner(c, schema.SetWorkspaceOwnerParams{Image: imageName, Owner: owner})
+	if err != nil {
+		os.Remove(imageFilesDir)
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to record owner of container %s: %v", imageName, err))
+		return
+	}
+
 	// register the new image
 	serviceManager.Images.Store(imageName, &manager.ImageManager{
-		ID:        nil,
-		Name:      imageName,
-		FilesDir:  imageFilesDir,
-		Container: nil,
+		ID:         nil,
+		Name:       imageName,
+		Owner:      owner,
+		FilesDir:   imageFilesDir,
+		GitDir:     workspaceGitDir(imageName),
+		Container:  nil,
+		Disk:       manager.DiskUsage{QuotaBytes: config.Quota.Bytes()},
+		PersistRun: s.persistRun,
 	})
+	listings.invalidateImage(imageName)
 
 	c.JSON(201, gin.H{"message": fmt.Sprintf("New container %s created", imageName)})
 }
 
-// handleDeleteContainer removes image files and unregisters the image.
-func handleDeleteContainer(c *gin.Context) {
+// handleDeleteWorkspace removes the image's containers and images from the
+// servers, its files, and unregisters the image. Running containers are only
+// removed with force=true, their anonymous volumes with volumes=true.
+func (s *server) handleDeleteWorkspace(c *gin.Context) {
 	imageName := c.Param("name")
 	if len(imageName) == 0 {
-		c.JSON(400, gin.H{"error": "Container name is required"})
+		respondError(c, CodeInvalidRequest, "Container name is required")
 		return
 	}
 
 	image, exists := serviceManager.Images.Load(imageName)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Container %s not found", imageName)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", imageName))
 		return
 	}
 
+	// the workspace's containers and images go with it, running containers
+	// only with force
+	opts := manager.RemovalOptions{
+		Force:   c.Query("force") == "true",
+		Volumes: c.Query("volumes") == "true",
+	}
+	image.Mu.Lock()
+	defer image.Mu.Unlock()
+
+	// the workspace is unregistered while it is removed so no run is queued
+	// for it meanwhile, and registered again if it stays
 	serviceManager.Images.Delete(image.Name)
+	err := serviceManager.RemoveFromServers(image, opts)
+	if err == nil {
+		// a new workspace of the same name must not inherit the owner
+		err = s.db.Query.DeleteWorkspaceOwner(c, image.Name)
+		if err != nil {
+			err = fmt.Errorf("failed to delete owner: %w", err)
+		}
+	}
+	if err != nil {
+		serviceManager.Images.Store(image.Name, image)
+	}
+	if errors.Is(err, manager.ErrContainerRunning) {
+		respondError(c, CodeContainerRunning, fmt.Sprintf("Container %s is running, stop it or delete with force=true: %v", imageName, err))
+		return
+	}
+	if err != nil {
+		requestLog(c).Error("Failed to remove workspace", "image", imageName, "error", err)
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to remove container %s: %v", imageName, err))
+		return
+	}
+	if image.Container != nil {
+		image.Container.CloseLogs()
+	}
+	listings.invalidateImage(image.Name)
+
+	// what is left of the workspace is removed as far as possible, failures
+	// are logged
+	log := requestLog(c).With("image", image.Name)
+	image.ProtectedFiles = nil
+	if err := image.SaveProtected(config.StateDir); err != nil {
+		log.Error("Failed to delete workspace protected files", "error", err)
+	}
+	if err := s.db.Query.DeleteWorkspaceTrigger(c, image.Name); err != nil {
+		log.Error("Failed to delete workspace trigger", "error", err)
+	}
+	if err := s.db.Query.DeleteImageRuns(c, image.Name); err != nil {
+		log.Error("Failed to delete workspace runs", "error", err)
+	}
+	if err := s.deleteImageWebhooks(c, image.Name); err != nil {
+		log.Error("Failed to delete workspace webhooks", "error", err)
+	}
+	if err := s.db.Query.DeleteImageNotificationChannels(c, image.Name); err != nil {
+		log.Error("Failed to delete workspace notification channels", "error", err)
+	}
+	if err := os.RemoveAll(filepath.Join(runArchiveDir(), image.Name)); err != nil {
+		log.Error("Failed to delete workspace run archive", "error", err)
+	}
+	if err := os.RemoveAll(image.GitDir); err != nil {
+		log.Error("Failed to delete workspace repository", "error", err)
+	}
 
 	// delete files on disk
-	err := os.RemoveAll(image.FilesDir)
-	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to delete container: %v", err)})
+	if err := os.RemoveAll(image.FilesDir); err != nil {
+		log.Error("Failed to delete workspace files", "error", err)
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to delete container: %v", err))
 		return
 	}
 
 	c.JSON(200, gin.H{"message": fmt.Sprintf("Container %s deleted successfully", imageName)})
 }
 
-// handlePostFile accepts multipart file uploads for an image.
+// workspaceFile validates a workspace file path from the request. It responds
+// with 400 and returns false when the path is invalid.
+func workspaceFile(c *gin.Context, fileName string) (string, bool) {
+	path, err := manager.WorkspacePath(fileName)
+	if err != nil {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid file path for file: %s", fileName))
+		return "", false
+	}
+	return path, true
+}
+
+// openWorkspace opens the workspace root of an image. It responds with 500
+// and returns nil when the workspace cannot be opened.
+func openWorkspace(c *gin.Context, imageManager *manager.ImageManager) *os.Root {
+	root, err := imageManager.OpenRoot()
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to open workspace of image %s: %v", imageManager.Name, err))
+		return nil
+	}
+	return root
+}
+
+// handlePostFile accepts multipart file uploads for an image. Files are saved
+// below the optional `dir` query parameter, or at the relative paths given as
+// one `paths` form value per file, such as a browser's webkitRelativePath.
+// Missing directories are created.
 func handlePostFile(c *gin.Context) {
 	name := c.Param("name")
 
 	imageManager, exists := serviceManager.Images.Load(name)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Container %s not found", name)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
 		return
 	}
 
 	form, err := c.MultipartForm()
 	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to parse multipart form: %v", err)})
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to parse multipart form: %v", err))
 		return
 	}
 
 	files := form.File["files"]
 	if len(files) == 0 {
-		c.JSON(400, gin.H{"error": "No file uploaded"})
+		respondError(c, CodeInvalidRequest, "No file uploaded")
+		return
+	}
+	paths := form.Value["paths"]
+	if len(paths) > 0 && len(paths) != len(files) {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Got %d paths for %d files", len(paths), len(files)))
 		return
 	}
+	dir := c.Query("dir")
 
 	imageManager.Mu.Lock()
 	defer imageManager.Mu.Unlock()
 
-	// save each uploaded file into the image's directory
+	var size int64
 	for _, file := range files {
-		filePath := filepath.Join(imageManager.FilesDir, file.Filename)
-		if filepath.Dir(filePath) != imageManager.FilesDir {
-			c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid file path for uploaded file: %v", file.Filename)})
-			return
-		}
-
-		c.SaveUploadedFile(file, filePath)
+		size += file.Size
 	}
-
-	c.JSON(200, gin.H{"message": fmt.Sprintf("Files uploaded for image %s", name)})
-}
-
-// handleGetFiles lists non-directory files in an image's directory.
-func handleGetFiles(c *gin.Context) {
-	name := c.Param("name")
-
-	imageManager, exists := serviceManager.Images.Load(name)
-	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Image %s not found", name)})
+	if !checkQuota(c, imageManager, size, "") {
 		return
 	}
 
-	entries, err := os.ReadDir(imageManager.FilesDir)
-	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to read files: %v", imageManager.Name)})
+	root := openWorkspace(c, imageManager)
+	if root == nil {
 		return
 	}
+	defer root.Close()
 
-	var files []string
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
+	// save each uploaded file into the image's directory
+	for i, file := range files {
+		// multipart file names carry no directories
+		fileName := path.Join(dir, file.Filename)
+		if len(paths) > 0 {
+			fileName = path.Join(dir, paths[i])
+		}
+		filePath, ok := workspaceFile(c, fileName)
+		if !ok {
+			return
+		}
+
+		if imageManager.IsProtected(filepath.ToSlash(filePath)) && !isAdmin(c) {
+			respondError(c, CodeProtected, fmt.Sprintf("File %s is protected and can only be changed by an admin", fileName))
+			return
+		}
+
+		if err := saveUploadedFile(root, file, filePath); err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to save file %s: %v", fileName, err))
+			return
 		}
-		files = append(files, entry.Name())
 	}
 
-	c.JSON(200, files)
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Files uploaded for image %s", name)})
 }
 
-// handleGetFile returns a single file as an attachment.
-func handleGetFile(c *gin.Context) {
+// handleGetArchive downloads an image's directory as a zip archive or, with
+// `format=tar`, as a tar archive compressed like the run log archives. Captured
+// logs are left out with `logs=false`.
+func handleGetArchive(c *gin.Context) {
 	name := c.Param("name")
-	fileName := c.Query("f_name")
+	format := c.DefaultQuery("format", "zip")
 
 	imageManager, exists := serviceManager.Images.Load(name)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Image %s not found", name)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
 		return
 	}
 
-	filePath := filepath.Join(imageManager.FilesDir, fileName)
-	if filepath.Dir(filePath) != imageManager.FilesDir {
-		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid file path for file: %s", fileName)})
+	if format != "zip" && format != "tar" {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid format: %s, expected zip or tar", format))
+		return
+	}
+	compression, ok := archiveCompression(c)
+	if !ok {
 		return
 	}
 
-	file, err := os.Open(filePath)
+	// files changed while the archive streams are picked up as they are, only
+	// the listing is consistent
+	imageManager.Mu.RLock()
+	files, err := manager.WorkspaceFiles(imageManager.FilesDir, c.Query("logs") != "false")
+	filesDir := imageManager.FilesDir
+	imageManager.Mu.RUnlock()
 	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to open file: %v", fileName)})
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list files of image %s: %v", name, err))
 		return
 	}
-	defer file.Close()
 
-	c.FileAttachment(filePath, fileName)
+	if format == "zip" {
+		c.Header("Content-Type", "application/zip")
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, name))
+		err = manager.WriteZip(c.Writer, filesDir, files)
+	} else {
+		c.Header("Content-Type", compression.ContentType())
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, name, compression.Ext()))
+		err = manager.WriteTar(c.Writer, filesDir, files, compression)
+	}
+	if err != nil {
+		// headers are already sent, so the archive is simply cut short
+		requestLog(c).Error("Failed to write workspace archive", "image", name, "error", err)
+	}
 }
 
-// handleDeleteFile removes a file from an image's directory.
-func handleDeleteFile(c *gin.Context) {
+// errProtectedFile rejects archives that would overwrite protected files.
+var errProtectedFile = errors.New("protected file")
+
+// handlePostArchive extracts an uploaded zip or tar.gz archive, the `archive`
+// form file, into an image's directory or below the optional `dir`. An archive
+// with unsafe paths, or with protected files when the caller is not an admin,
+// is rejected before anything is written.
+func handlePostArchive(c *gin.Context) {
 	name := c.Param("name")
-	fileName := c.Query("f_name")
+	dir := c.Query("dir")
 
 	imageManager, exists := serviceManager.Images.Load(name)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Container %s not found", name)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
 		return
 	}
 
-	filePath := filepath.Join(imageManager.FilesDir, fileName)
-	if filepath.Dir(filePath) != imageManager.FilesDir {
-		c.JSON(400, gin.H{"error": fmt.Sprintf("Invalid file path for file: %s", fileName)})
-		return
+	if dir != "" {
+		if _, ok := workspaceFile(c, dir); !ok {
+			return
+		}
+	}
+
+	header, err := c.FormFile("archive")
+	if err != nil {
+		respondError(c, CodeInvalidRequest, "No archive uploaded")
+		return
+	}
+	archive, err := header.Open()
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read archive: %v", err))
+		return
+	}
+	defer archive.Close()
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	headroom, err := quotaHeadroom(imageManager)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to check quota of image %s: %v", name, err))
+		return
+	}
+
+	admin := isAdmin(c)
+	var size int64
+	files, err := manager.ExtractArchive(root, dir, archive, header.Size, func(fileName string, fileSize int64) error {
+		if imageManager.IsProtected(fileName) && !admin {
+			return fmt.Errorf("%w: %s", errProtectedFile, fileName)
+		}
+		if size += fileSize; size > headroom {
+			return fmt.Errorf("%w: the archive unpacks to more than the %d bytes left", manager.ErrQuotaExceeded, headroom)
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, manager.ErrQuotaExceeded):
+			respondError(c, CodeQuotaExceeded, err.Error())
+		case errors.Is(err, errProtectedFile):
+			respondError(c, CodeForbidden, fmt.Sprintf("Archive contains a file that can only be changed by an admin: %v", err))
+		case errors.Is(err, manager.ErrArchiveTooLarge):
+			respondError(c, CodeTooLarge, "Archive unpacks to more than the allowed size")
+		case errors.Is(err, manager.ErrInvalidPath), errors.Is(err, manager.ErrUnknownCompression),
+			errors.Is(err, zip.ErrFormat), errors.Is(err, tar.ErrHeader):
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid archive: %v", err))
+		default:
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to extract archive: %v", err))
+		}
+		return
+	}
+
+	imageManager.Disk.UsedBytes += size
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Extracted %d files for image %s", len(files), name), "files": files})
+}
+
+func saveUploadedFile(root *os.Root, file *multipart.FileHeader, filePath string) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	return manager.WriteRootFile(root, filePath, src, 0644)
+}
+
+// handleGetFiles returns a page of the names of the files at the top of an
+// image's directory. With `details=true` it lists the files and directories in
+// the optional `dir` with their sizes and modification times, sortable by
+// path, size or mod_time, with `recursive=true` everything below it, and with
+// `checksums=true` the SHA-256 of each file as well.
+func handleGetFiles(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	opts := manager.ListOptions{
+		Recursive: c.Query("recursive") == "true",
+		Checksums: c.Query("checksums") == "true",
+	}
+	if c.Query("details") == "true" || opts.Recursive || opts.Checksums {
+		dir := "."
+		if raw := c.Query("dir"); raw != "" {
+			var ok bool
+			if dir, ok = workspaceFile(c, raw); !ok {
+				return
+			}
+		}
+
+		q, ok := parseListQuery(c, "path", "path", "size", "mod_time")
+		if !ok {
+			return
+		}
+
+		entries, err := manager.ListWorkspace(root, dir, opts)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				respondError(c, CodeNotFound, fmt.Sprintf("Directory %s does not exist for image %s", dir, name))
+				return
+			}
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to read files: %v", err))
+			return
+		}
+		c.JSON(200, paginate(entries, q, acceptAll, func(a, b manager.WorkspaceEntry, field string) int {
+			switch field {
+			case "size":
+				return cmp.Compare(a.Size, b.Size)
+			case "mod_time":
+				return a.ModTime.Compare(b.ModTime)
+			}
+			return cmp.Compare(a.Path, b.Path)
+		}))
+		return
+	}
+
+	q, ok := parseListQuery(c, "name", "name")
+	if !ok {
+		return
+	}
+
+	entries, err := fs.ReadDir(root.FS(), ".")
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read files: %v", imageManager.Name))
+		return
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		files = append(files, entry.Name())
+	}
+
+	c.JSON(200, paginate(files, q, acceptAll, func(a, b string, _ string) int {
+		return cmp.Compare(a, b)
+	}))
+}
+
+// conditionalRequest reports whether the request carries a precondition on
+// the ETag of what it gets.
+func conditionalRequest(r *http.Request) bool {
+	return r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Match") != "" || r.Header.Get("If-Range") != ""
+}
+
+// handleGetFile returns a single file as an attachment. The ETag is the file's
+// SHA-256, as the listing's checksums report it, so clients holding an
+// identical copy get 304 with If-None-Match. It is only computed for
+// conditional requests; other downloads read the file once.
+func handleGetFile(c *gin.Context) {
+	name := c.Param("name")
+	fileName := c.Query("f_name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	filePath, ok := workspaceFile(c, fileName)
+	if !ok {
+		return
+	}
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	file, err := root.Open(filePath)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to open file: %v", fileName))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to open file: %v", fileName))
+		return
+	}
+
+	if conditionalRequest(c.Request) {
+		digest, err := manager.HashReader(file)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to read file %s: %v", fileName, err))
+			return
+		}
+		c.Header("ETag", strconv.Quote(digest))
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(fileName)}))
+	http.ServeContent(c.Writer, c.Request, fileName, info.ModTime(), file)
+}
+
+// handlePutFile replaces a single file, `f_name`, with the raw request body,
+// creating it and its directories if needed. It is meant for editing
+// Containerfiles and scripts in place; large files go through uploads.
+func handlePutFile(c *gin.Context) {
+	name := c.Param("name")
+	fileName := c.Query("f_name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
 	}
 
-	err := os.Remove(filePath)
+	filePath, ok := workspaceFile(c, fileName)
+	if !ok {
+		return
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxEditSize))
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondError(c, CodeTooLarge, fmt.Sprintf("File %s is larger than %d bytes; upload it instead", fileName, maxEditSize))
+			return
+		}
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Failed to read file content: %v", err))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	if imageManager.IsProtected(filepath.ToSlash(filePath)) && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("File %s is protected and can only be changed by an admin", fileName))
+		return
+	}
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	// the edit replaces the file, only growing it counts against the quota
+	added := int64(len(content))
+	if info, err := root.Stat(filePath); err == nil {
+		if info.IsDir() {
+			respondError(c, CodeConflict, fmt.Sprintf("%s is a directory", fileName))
+			return
+		}
+		added -= info.Size()
+	}
+	if !checkQuota(c, imageManager, max(added, 0), "") {
+		return
+	}
+
+	if err := manager.WriteRootFile(root, filePath, bytes.NewReader(content), 0644); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save file %s: %v", fileName, err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("File %s saved for image %s", fileName, name)})
+}
+
+// handleMoveFile renames or moves a file or directory, `f_name`, to `to` within
+// an image's directory, creating missing parent directories. An existing
+// destination file is only replaced with `overwrite=true`.
+func handleMoveFile(c *gin.Context) {
+	name := c.Param("name")
+	fileName := c.Query("f_name")
+	target := c.Query("to")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	filePath, ok := workspaceFile(c, fileName)
+	if !ok {
+		return
+	}
+	targetPath, ok := workspaceFile(c, target)
+	if !ok {
+		return
+	}
+	if filePath == targetPath {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("File %s is already at %s", fileName, target))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	from, to := filepath.ToSlash(filePath), filepath.ToSlash(targetPath)
+	protected := imageManager.IsProtected(from) || imageManager.IsProtected(to) || len(imageManager.ProtectedUnder(from)) > 0
+	if protected && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("Moving %s to %s changes protected files, which only an admin can do", fileName, target))
+		return
+	}
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	if _, err := root.Lstat(filePath); err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			c.JSON(404, gin.H{"error": fmt.Sprintf("File %s does not exist for image %s", fileName, name)})
+			respondError(c, CodeNotFound, fmt.Sprintf("File %s does not exist for image %s", fileName, name))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to move file: %v", err))
+		return
+	}
+	if _, err := root.Lstat(targetPath); err == nil && c.Query("overwrite") != "true" {
+		respondError(c, CodeAlreadyExists, fmt.Sprintf("File %s already exists for image %s", target, name))
+		return
+	}
+
+	if dir := filepath.Dir(targetPath); dir != "." {
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to create directory %s: %v", filepath.ToSlash(dir), err))
+			return
+		}
+	}
+	if err := root.Rename(filePath, targetPath); err != nil {
+		if errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EISDIR) || errors.Is(err, syscall.ENOTDIR) {
+			respondError(c, CodeConflict, fmt.Sprintf("Cannot move %s to %s: %v", fileName, target, err))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to move file: %v", err))
+		return
+	}
+
+	if imageManager.MoveProtected(from, to) {
+		if err := imageManager.SaveProtected(config.StateDir); err != nil {
+			requestLog(c).Error("Failed to save protected files", "image", name, "error", err)
+		}
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("File %s moved to %s for image %s", fileName, target, name)})
+}
+
+// handleDeleteFile removes a file or an empty directory from an image's
+// directory. With `recursive=true` a directory is removed with its contents.
+func handleDeleteFile(c *gin.Context) {
+	name := c.Param("name")
+	fileName := c.Query("f_name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	filePath, ok := workspaceFile(c, fileName)
+	if !ok {
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	recursive := c.Query("recursive") == "true"
+	if imageManager.IsProtected(filepath.ToSlash(filePath)) && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("File %s is protected and can only be changed by an admin", fileName))
+		return
+	}
+	if protected := imageManager.ProtectedUnder(filepath.ToSlash(filePath)); recursive && len(protected) > 0 && !isAdmin(c) {
+		respondErrorDetails(c, CodeProtected, fmt.Sprintf("Directory %s contains protected files and can only be removed by an admin", fileName), gin.H{"protected_files": protected})
+		return
+	}
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	var err error
+	if recursive {
+		// RemoveAll succeeds for missing paths
+		if _, err = root.Lstat(filePath); err == nil {
+			err = root.RemoveAll(filePath)
+		}
+	} else {
+		err = root.Remove(filePath)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			respondError(c, CodeNotFound, fmt.Sprintf("File %s does not exist for image %s", fileName, name))
+			return
+		} else if errors.Is(err, syscall.ENOTEMPTY) {
+			respondError(c, CodeConflict, fmt.Sprintf("Directory %s is not empty; delete it with recursive=true", fileName))
 			return
 		} else {
-			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to delete file: %v", err)})
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to delete file: %v", err))
 			return
 		}
 	}
@@ -532,70 +1504,402 @@ func handleDeleteFile(c *gin.Context) {
 	c.JSON(200, gin.H{"message": fmt.Sprintf("File %s deleted for image %s", fileName, name)})
 }
 
-// handleRunContainer ensures image is built on the requested server and queues it to run.
-func handleRunContainer(c *gin.Context) {
+// handleCreateRun ensures image is built on the requested server and queues it to run.
+func (s *server) handleCreateRun(c *gin.Context) {
 	name := c.Param("name")
 	serverName := c.Query("serverName")
+	serverGroup := c.Query("serverGroup")
+
+	// the body is optional: a plain POST runs with the server defaults
+	var requested manager.RunOptions
+	if c.Request.ContentLength > 0 {
+		if !bindJSON(c, &requested, "run options") {
+			return
+		}
+	}
+
+	if err := manager.ValidateOutputs(requested.Outputs); err != nil {
+		respondFieldError(c, "run options", "outputs", "is invalid: "+err.Error())
+		return
+	}
+	if requested.Workspace != nil {
+		if err := requested.Workspace.Validate(); err != nil {
+			respondFieldError(c, "run options", "workspace", "is invalid: "+err.Error())
+			return
+		}
+	}
+	if err := manager.ValidateConstraints(requested.Constraints); err != nil {
+		respondFieldError(c, "run options", "constraints", "is invalid: "+err.Error())
+		return
+	}
 
 	imageManager, exists := serviceManager.Images.Load(name)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Image %s not found", name)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
 		return
 	}
 
 	imageManager.Mu.Lock()
 	defer imageManager.Mu.Unlock()
 
-	// prevent duplicate running containers for the same image
-	if imageManager.Container != nil && imageManager.Container.Status == manager.Running {
-		c.JSON(409, gin.H{"error": fmt.Sprintf("A container for image %s is already running. Please stop the existing container before starting a new one.", name)})
+	if !checkRunnable(c, imageManager) {
 		return
 	}
 
-	connectionManager, exists := serviceManager.Connections.Load(serverName)
-	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Server %s not found", serverName)})
+	// a writable mount of the workspace would change protected files behind
+	// their check, so only admins get one
+	if requested.Workspace != nil && !requested.Workspace.ReadOnly && len(imageManager.ProtectedFiles) > 0 && !isAdmin(c) {
+		requested.Workspace.ReadOnly = true
+		requestLog(c).Info("Mounting workspace read-only", "image", name, "reason", "protected files")
+	}
+
+	// a run targets either a single server or a group the scheduler picks from
+	if serverName != "" && serverGroup != "" {
+		respondError(c, CodeInvalidRequest, "Specify either serverName or serverGroup, not both")
 		return
 	}
 
-	// if image not built on the target server or not built at all, build it here
-	if imageManager.ID == nil || imageManager.Connection.Server.Name != serverName {
-		err := imageManager.Build(connectionManager)
-		if err != nil {
-			c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to build image %s on server %s: %v", name, serverName, err)})
-			return
+	op := manager.NewOperation(manager.NewRunID(), manager.OperationRun, name, currentUser(c).Name, manager.RunSteps, s.persistOperation)
+	op.Server = serverName
+	op.Group = serverGroup
+	op.Snapshot = c.Query("snapshot")
+	op.Containerfile = c.Query("containerfile")
+	op.Requested = requested
+	serviceManager.Operations.Store(op.ID, op)
+
+	startRun(c, imageManager, op)
+}
+
+// checkRunnable rejects runs of quarantined images and of images that already
+// have a running container. The caller must hold imageManager.Mu.
+func checkRunnable(c *gin.Context, imageManager *manager.ImageManager) bool {
+	if apiErr := runnableError(imageManager); apiErr != nil {
+		respondError(c, apiErr.Code, apiErr.Message)
+		return false
+	}
+	return true
+}
+
+// runnableError is the error checkRunnable responds with, nil if the image
+// can run. The caller must hold imageManager.Mu.
+func runnableError(imageManager *manager.ImageManager) *APIError {
+	name := imageManager.Name
+
+	// quarantined images stay blocked until an admin releases them
+	if imageManager.Quarantine != nil {
+		return &APIError{Code: CodeQuarantined, Message: fmt.Sprintf("Image %s is quarantined pending review: %s", name, imageManager.Quarantine.Reason)}
+	}
+
+	// prevent duplicate running containers for the same image
+	if imageManager.Container != nil && imageManager.Container.Active() {
+		return &APIError{Code: CodeContainerRunning, Message: fmt.Sprintf("A container for image %s is already running. Please stop the existing container before starting a new one.", name)}
+	}
+
+	return nil
+}
+
+// startRun places, builds if needed and queues the run described by op,
+// recording each step on it. The caller must hold imageManager.Mu.
+func startRun(c *gin.Context, imageManager *manager.ImageManager, op *manager.Operation) {
+	serverName, position, apiErr := queueRun(imageManager, op, requestLog(c))
+	if apiErr != nil {
+		respondErrorDetails(c, apiErr.Code, apiErr.Message, apiErr.Details)
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Container for image %s started successfully on server %s", imageManager.Name, serverName), "queue_id": op.ID, "operation": op.ID, "position": position})
+}
+
+// queueRun does the work of startRun without a request, for runs maestro
+// starts itself. It returns the server the run was queued on and its
+// position, or the error to report. The caller must hold imageManager.Mu.
+func queueRun(imageManager *manager.ImageManager, op *manager.Operation, log *slog.Logger) (string, int, *APIError) {
+	name := imageManager.Name
+	requested := op.Requested
+
+	// once placed, a resumed run stays on the selected server
+	serverName, serverGroup := op.Server, op.Group
+	if serverName != "" {
+		serverGroup = ""
+	}
+
+	// the run is recorded as pending until its server starts it, a run that
+	// fails before it is queued ends in Error
+	run := imageManager.BeginRun(op.ID)
+	queued := false
+	defer func() {
+		if !queued {
+			imageManager.AbortRun(run, manager.Error)
 		}
+	}()
+
+	op.Begin(manager.StepPlace)
+	// a run sent to a Kubernetes server it cannot run on is rejected up front
+	// rather than reported as unschedulable
+	if target, exists := serviceManager.Connections.Load(serverName); exists {
+		if err := manager.KubernetesRunError(target.Info(), requested, serviceManager.Registry); err != nil {
+			op.Fail(manager.StepPlace, err)
+			return "", 0, &APIError{Code: CodeInvalidRequest, Message: fmt.Sprintf("Server %s cannot run image %s: %v", serverName, name, err), Details: gin.H{"operation": op.ID}}
+		}
+	}
+	connectionManager, placement, err := serviceManager.Place(imageManager, op.ID, serverName, serverGroup, requested)
+	if err != nil {
+		op.Fail(manager.StepPlace, err)
+	}
+	switch {
+	case errors.Is(err, manager.ErrGroupNotFound):
+		return "", 0, &APIError{Code: CodeNotFound, Message: fmt.Sprintf("Server group %s not found", serverGroup), Details: gin.H{"operation": op.ID}}
+	case errors.Is(err, manager.ErrServerNotFound):
+		return "", 0, &APIError{Code: CodeNotFound, Message: fmt.Sprintf("Server %s not found", serverName), Details: gin.H{"operation": op.ID}}
+	case err != nil:
+		return "", 0, &APIError{Code: CodeUnschedulable, Message: fmt.Sprintf("Cannot schedule image %s: %v", name, err), Details: gin.H{"placement": placement, "operation": op.ID}}
 	}
+	server := connectionManager.Info()
+	serverName = server.Name
+	op.SetServer(serverName)
+	op.Succeed(manager.StepPlace)
 
-	connectionManager.ImageQueue <- imageManager
+	op.Begin(manager.StepBuild)
+	buildOpts, cleanup, err := buildOptionsFor(imageManager, op.Snapshot, op.Containerfile)
+	if err != nil {
+		op.Fail(manager.StepBuild, err)
+		return "", 0, &APIError{Code: CodeInvalidRequest, Message: err.Error(), Details: gin.H{"operation": op.ID}}
+	}
+	defer cleanup()
+
+	// a build on several servers left an image on the target server
+	if requested.Image == "" && imageManager.Connection != connectionManager {
+		imageManager.UseServerImage(connectionManager)
+	}
+
+	// prebuilt images are pulled instead of built, both only when the server
+	// does not already have the image the run needs
+	stale := imageManager.ID == nil || imageManager.Connection.Info().Name != serverName
+	changed := imageManager.Prebuilt != "" || imageManager.Snapshot != buildOpts.Snapshot || imageManager.Git != "" || imageManager.Target != "" || imageManager.Containerfile != buildOpts.Containerfile || imageManager.Commit != buildOpts.Commit
+	if requested.Image != "" {
+		decision := imagePolicy.Load().Check(requested.Image)
+		if !decision.Allowed {
+			op.Fail(manager.StepBuild, fmt.Errorf("image not allowed: %s", decision.Reason))
+			return "", 0, &APIError{Code: CodePolicyDenied, Message: fmt.Sprintf("Image %s is not allowed: %s", requested.Image, decision.Reason), Details: gin.H{"operation": op.ID}}
+		}
+
+		if stale || imageManager.Prebuilt != requested.Image {
+			run.Transition(manager.Building)
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilding, Image: name, Server: serverName, Message: "pulling " + requested.Image})
+			err := imageManager.UsePrebuilt(connectionManager, requested.Image)
+			if err != nil {
+				op.Fail(manager.StepBuild, err)
+				log.Error("Pull failed", "image", name, "server", serverName, "ref", requested.Image, "error", err)
+				serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: name, Server: serverName, Message: err.Error()})
+				return "", 0, &APIError{Code: CodeInternal, Message: fmt.Sprintf("Failed to pull image %s on server %s: %v", requested.Image, serverName, err), Details: gin.H{"operation": op.ID}}
+			}
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilt, Image: name, Server: serverName})
+			op.Succeed(manager.StepBuild)
+		} else {
+			op.Skip(manager.StepBuild)
+		}
+	} else if stale || changed {
+		// if image not built on the target server, not built at all, or not
+		// built from the requested snapshot, Containerfile and checked-out
+		// commit of the workspace, build it here. Kubernetes servers cannot
+		// build, their runs are built on another server and pulled from the
+		// registry.
+		buildServer := connectionManager
+		if server.Engine == manager.EngineKubernetes {
+			buildServer = serviceManager.BuildServer(imageManager)
+			if buildServer == nil {
+				err := errors.New("no Podman or Docker server online to build on")
+				op.Fail(manager.StepBuild, err)
+				return "", 0, &APIError{Code: CodeUnschedulable, Message: fmt.Sprintf("Cannot build image %s for server %s: %v", name, serverName, err), Details: gin.H{"operation": op.ID}}
+			}
+			imageManager.UseServerImage(buildServer)
+		}
+		buildServerName := buildServer.Server.Name
+
+		run.Transition(manager.Building)
+		if imageManager.ID == nil || imageManager.Connection != buildServer || changed {
+			if apiErr := buildPolicyError(imageManager, buildServer, buildOpts); apiErr != nil {
+				op.Fail(manager.StepBuild, errors.New("base image not allowed by the image policy"))
+				return "", 0, apiErr
+			}
+
+			ctx, cancel := config.Builds.BuildContext()
+			op.SetCancel(func() error {
+				cancel()
+				return nil
+			})
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilding, Image: name, Server: buildServerName})
+			err := imageManager.Build(ctx, buildServer, buildOpts)
+			op.SetCancel(nil)
+			canceled := errors.Is(ctx.Err(), context.Canceled)
+			cancel()
+			if err != nil && canceled {
+				queued = true
+				imageManager.AbortRun(run, manager.Cancelled)
+			}
+			if err != nil {
+				op.Fail(manager.StepBuild, err)
+				log.Error("Build failed", "image", name, "server", buildServerName, "error", err)
+				serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: name, Server: buildServerName, Message: err.Error()})
+				return "", 0, &APIError{Code: CodeInternal, Message: fmt.Sprintf("Failed to build image %s on server %s: %v", name, buildServerName, err), Details: gin.H{"operation": op.ID}}
+			}
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilt, Image: name, Server: buildServerName})
+		}
+
+		if buildServer != connectionManager {
+			ref, err := pushBuild(imageManager, buildServer)
+			if err != nil {
+				op.Fail(manager.StepBuild, err)
+				log.Error("Push failed", "image", name, "server", buildServerName, "error", err)
+				serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: name, Server: buildServerName, Message: err.Error()})
+				return "", 0, &APIError{Code: CodeInternal, Message: fmt.Sprintf("Failed to push image %s for server %s: %v", name, serverName, err), Details: gin.H{"operation": op.ID}}
+			}
+			log.Info("Image pushed", "image", name, "server", buildServerName, "ref", ref)
+			imageManager.UsePushed(connectionManager, ref)
+		}
+		op.Succeed(manager.StepBuild)
+	} else {
+		op.Skip(manager.StepBuild)
+	}
 
-	c.JSON(200, gin.H{"message": fmt.Sprintf("Container for image %s started successfully on server %s", name, serverName)})
+	op.Begin(manager.StepQueue)
+	if run.Status == manager.Building {
+		run.Transition(manager.Queued)
+	}
+	job := &manager.RunJob{
+		ID:        op.ID,
+		Image:     imageManager,
+		Options:   manager.ResolveRunOptions(server.Defaults, requested),
+		Operation: op,
+		Run:       run,
+	}
+	run.Options = job.Options
+	queue := connectionManager.RunQueue
+	position := queue.Push(job)
+	queued = true
+	op.Succeed(manager.StepQueue)
+	op.SetCancel(func() error {
+		if !queue.Remove(job.ID) {
+			return fmt.Errorf("%w: run %s already left the queue", manager.ErrNotCancelable, job.ID)
+		}
+		imageManager.Mu.Lock()
+		defer imageManager.Mu.Unlock()
+		imageManager.AbortRun(run, manager.Cancelled)
+		return nil
+	})
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventQueued, Image: name, Server: serverName, Position: position})
+	log.Info("Run queued", "image", name, "server", serverName, "position", position)
+
+	return serverName, position, nil
 }
 
-// handleBuildContainer forces rebuild of an image on the specified server.
-func handleBuildContainer(c *gin.Context) {
+// handleBuildContainer starts a rebuild of an image on the specified server
+// and returns its build ID right away. The build runs in the background and is
+// polled through builds/:id. With `push=true` the image is pushed to the
+// configured registry as `tag` (default latest) once built. `serverName=all`
+// or a comma separated `servers` list builds on several servers at once.
+func (s *server) handleBuildContainer(c *gin.Context) {
 	name := c.Param("name")
 	serverName := c.Query("serverName")
 
 	imageManager, exists := serviceManager.Images.Load(name)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Image %s not found", name)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	if serverName == "all" || c.Query("servers") != "" {
+		s.buildOnServers(c, imageManager)
 		return
 	}
 
 	connectionManager, exists := serviceManager.Connections.Load(serverName)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Server %s not found", serverName)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+
+	buildOpts, cleanup, err := buildOptionsFromRequest(c, imageManager)
+	if err != nil {
+		respondError(c, errorCode(err, CodeInvalidRequest), err.Error())
+		return
+	}
+
+	if !checkBuildPolicy(c, imageManager, connectionManager, buildOpts) {
+		cleanup()
 		return
 	}
 
-	err := imageManager.Build(connectionManager)
+	push, err := pushFromRequest(c, name)
 	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to build image %s on server %s: %v", name, serverName, err)})
+		cleanup()
+		respondError(c, CodeInvalidRequest, err.Error())
 		return
 	}
 
-	c.JSON(201, gin.H{"message": fmt.Sprintf("Image %s built successfully on server %s", name, serverName)})
+	op := s.newOperation(manager.OperationBuild, name, "", currentUser(c).Name)
+	op.SetServer(serverName)
+	requestLog(c).Info("Build started", "image", name, "server", serverName, "build", op.ID)
+
+	ctx, cancel := config.Builds.BuildContext()
+	op.SetCancel(func() error {
+		cancel()
+		return nil
+	})
+
+	go func() {
+		defer cleanup()
+		defer cancel()
+		runBuild(ctx, imageManager, connectionManager, buildOpts, push, op)
+	}()
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Build of image %s started on server %s", name, serverName), "build": op.ID, "operation": op.ID})
+}
+
+// runBuild builds the image in the background and pushes it if requested,
+// recording the outcome on the build's operation. Canceling ctx stops the
+// build, also while it waits for a run or another build of the image.
+func runBuild(ctx context.Context, imageManager *manager.ImageManager, connectionManager *manager.ConnectionManager, buildOpts manager.BuildOptions, push *registryPush, op *manager.Operation) {
+	name, serverName := imageManager.Name, connectionManager.Server.Name
+	log := loggers.For("builds")
+
+	// builds of the same image, and runs, wait for each other
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	op.Logf("Building on server %s", serverName)
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilding, Image: name, Server: serverName})
+	err := imageManager.Build(ctx, connectionManager, buildOpts)
+	op.SetCancel(nil)
+	if buildLog := imageManager.LastBuildLog(); buildLog != nil {
+		op.Logf("Build output in %s", buildLog.Name)
+	}
+	if err != nil {
+		op.Finish(err)
+		log.Error("Build failed", "image", name, "server", serverName, "build", op.ID, "error", err)
+		serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: name, Server: serverName, Message: err.Error()})
+		return
+	}
+	log.Info("Build finished", "image", name, "server", serverName, "build", op.ID)
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventBuilt, Image: name, Server: serverName})
+
+	if push != nil {
+		op.Logf("Pushing %s", push.ref)
+		digest, err := imageManager.Push(connectionManager, push.ref, config.Registry, push.password)
+		if err != nil {
+			op.Finish(err)
+			log.Error("Push failed", "image", name, "ref", push.ref, "build", op.ID, "error", err)
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: name, Server: serverName, Message: err.Error()})
+			return
+		}
+		result := push.ref
+		if digest != "" {
+			result += "@" + digest
+		}
+		op.SetResult(result)
+		log.Info("Image pushed", "image", name, "ref", push.ref, "digest", digest)
+	}
+	op.Finish(nil)
 }
 
 // handleStopContainer stops a running container and clears tracking.
@@ -604,31 +1908,344 @@ func handleStopContainer(c *gin.Context) {
 
 	imageManager, exists := serviceManager.Images.Load(name)
 	if !exists {
-		c.JSON(404, gin.H{"error": fmt.Sprintf("Image %s not found", name)})
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	if err := stopRunning(imageManager); err != nil {
+		requestLog(c).Error("Stop failed", "image", name, "error", err)
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to stop container: %v", err))
 		return
 	}
 
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Container for image %s stopped successfully", name)})
+}
+
+// stopRunning stops the container of an image, if it has one, and clears
+// tracking. A run still going is Cancelled.
+func stopRunning(imageManager *manager.ImageManager) error {
 	imageManager.Mu.Lock()
 	defer imageManager.Mu.Unlock()
 
 	// nothing to do if no container/connection
 	if imageManager.Connection == nil || imageManager.Container == nil {
-		c.JSON(200, gin.H{"message": fmt.Sprintf("Container for image %s stopped successfully", name)})
-		return
+		return nil
 	}
 
 	// clear container reference after stopping
 	defer imageManager.ClearContainer()
 
-	err := containers.Stop(imageManager.Connection.Conn, imageManager.Container.ID, &containers.StopOptions{
-		Ignore:  func(a bool) *bool { return &a }(false),
-		Timeout: func(a uint) *uint { return &a }(0),
-	})
+	if err := imageManager.Connection.Runtime.StopContainer(imageManager.Container.ID); err != nil {
+		return fmt.Errorf("container %s: %v", imageManager.Container.ID, err)
+	}
+	if container := imageManager.Container; !container.Status.Terminal() {
+		now := time.Now()
+		container.Transition(manager.Cancelled)
+		container.FinishedAt = &now
+	}
+
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventStopped, Image: imageManager.Name, Server: imageManager.Connection.Server.Name, Container: imageManager.Container.Name})
+	return nil
+}
+
+// handleRestartContainer restarts the current container of an image, running
+// or exited, with the spec and metadata of its run. Its output is appended to
+// the run's log files.
+func (s *server) handleRestartContainer(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	if imageManager.Quarantine != nil {
+		respondError(c, CodeQuarantined, fmt.Sprintf("Image %s is quarantined pending review: %s", name, imageManager.Quarantine.Reason))
+		return
+	}
+	container := imageManager.Container
+	connectionManager := imageManager.Connection
+	if container == nil || connectionManager == nil {
+		respondError(c, CodeNotRunning, fmt.Sprintf("No container to restart for image %s", name))
+		return
+	}
+	if container.Status == manager.Paused {
+		respondError(c, CodeNotRunning, fmt.Sprintf("The container for image %s is paused, unpause it first", name))
+		return
+	}
+	if container.RemovedAt != nil {
+		respondError(c, CodeNotRunning, fmt.Sprintf("The container for image %s was removed from its server", name))
+		return
+	}
+
+	// the log files were closed when the container exited
+	if container.FinishedAt != nil || container.Stdout == nil || container.Stderr == nil {
+		for _, logFile := range []struct {
+			name string
+			file **os.File
+		}{{container.StdoutLog, &container.Stdout}, {container.StderrLog, &container.Stderr}} {
+			var err error
+			*logFile.file, err = os.OpenFile(filepath.Join(imageManager.FilesDir, logFile.name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				respondError(c, CodeInternal, fmt.Sprintf("Failed to reopen log file %s: %v", logFile.name, err))
+				return
+			}
+		}
+	}
 
+	if err := container.Transition(manager.Starting); err != nil {
+		respondError(c, CodeConflict, fmt.Sprintf("Cannot restart the container for image %s: %v", name, err))
+		return
+	}
+
+	op := manager.NewOperation(manager.NewRunID(), manager.OperationRestart, name, currentUser(c).Name, manager.RestartSteps, s.persistOperation)
+	op.Server = connectionManager.Server.Name
+	op.ContainerID = container.ID
+	serviceManager.Operations.Store(op.ID, op)
+
+	since := time.Now()
+	op.Begin(manager.StepStart)
+	err := connectionManager.Runtime.RestartContainer(container.ID)
+	if err == nil {
+		err = container.MarkRestarted(time.Now())
+	}
 	if err != nil {
-		c.JSON(500, gin.H{"error": fmt.Sprintf("Failed to stop container: %v", err)})
+		requestLog(c).Error("Restart failed", "image", name, "container", container.Name, "error", err)
+		container.Transition(manager.Error)
+		op.Fail(manager.StepStart, err)
+		respondErrorDetails(c, CodeInternal, fmt.Sprintf("Failed to restart container %s: %v", container.Name, err), gin.H{"operation": op.ID})
 		return
 	}
+	op.Succeed(manager.StepStart)
 
-	c.JSON(200, gin.H{"message": fmt.Sprintf("Container for image %s stopped successfully", name)})
+	container.Activity.Finish(since)
+	container.Activity = connectionManager.BeginActivity(manager.RunActivity, name)
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventRestarted, Image: name, Server: connectionManager.Server.Name, Container: container.Name})
+	requestLog(c).Info("Container restarted", "image", name, "container", container.Name, "restarts", container.Restarts)
+
+	// the output of the run before the restart was captured already
+	cursor := container.Captured
+	if cursor == nil {
+		cursor = manager.NewLogCursor(since)
+	}
+	go attachLogs(connectionManager, imageManager, container, cursor, op)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Container for image %s restarted", name), "operation": op.ID, "restarts": container.Restarts})
+}
+
+// handleKillContainer sends the signal in the `signal` query parameter, such
+// as SIGUSR1 or HUP, to the main process of an image's container, SIGKILL if
+// none is given. The container keeps tracking as usual, it only stops if the
+// process exits on the signal.
+func handleKillContainer(c *gin.Context) {
+	name := c.Param("name")
+
+	signal, err := manager.ParseSignal(c.Query("signal"))
+	if err != nil {
+		respondError(c, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.RLock()
+	defer imageManager.Mu.RUnlock()
+
+	container := imageManager.Container
+	if container == nil || imageManager.Connection == nil || !container.Active() {
+		respondError(c, CodeNotRunning, fmt.Sprintf("No running container for image %s", name))
+		return
+	}
+
+	if err := imageManager.Connection.Runtime.KillContainer(container.ID, signal); err != nil {
+		requestLog(c).Error("Kill failed", "image", name, "container", container.Name, "signal", signal, "error", err)
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to send %s to container %s: %v", signal, container.Name, err))
+		return
+	}
+
+	requestLog(c).Info("Signal sent", "image", name, "container", container.Name, "signal", signal)
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Sent %s to the container for image %s", signal, name), "signal": signal})
+}
+
+// handleWaitContainer blocks until the container of an image exits and returns
+// its exit code, giving up after the optional timeout, a duration such as 10m
+// or a number of seconds.
+func handleWaitContainer(c *gin.Context) {
+	name := c.Param("name")
+
+	ctx := c.Request.Context()
+	if raw := c.Query("timeout"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if seconds, convErr := strconv.Atoi(raw); convErr == nil {
+			timeout, err = time.Duration(seconds)*time.Second, nil
+		}
+		if err != nil || timeout <= 0 {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid timeout: %s", raw))
+			return
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	// the lock is not held while waiting, the exit handlers need it
+	imageManager.Mu.RLock()
+	container := imageManager.Container
+	connectionManager := imageManager.Connection
+	var exitCode *int
+	if container != nil && container.FinishedAt != nil {
+		exitCode = container.ExitCode
+	}
+	imageManager.Mu.RUnlock()
+
+	if container == nil || connectionManager == nil {
+		respondError(c, CodeNotRunning, fmt.Sprintf("No container to wait for for image %s", name))
+		return
+	}
+	if exitCode == nil {
+		code, err := connectionManager.Runtime.WaitContainer(ctx, container.ID)
+		if errors.Is(err, context.DeadlineExceeded) {
+			respondError(c, CodeTimeout, fmt.Sprintf("The container for image %s is still running", name))
+			return
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				requestLog(c).Error("Wait failed", "image", name, "container", container.Name, "error", err)
+			}
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to wait for container %s: %v", container.Name, err))
+			return
+		}
+		exitCode = &code
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("The container for image %s exited", name), "container": container.Name, "run": container.RunID, "exit_code": *exitCode})
+}
+
+// handlePauseContainer freezes the running container of an image. It keeps
+// its memory and reserved resources, but uses no CPU until it is unpaused.
+func handlePauseContainer(c *gin.Context) {
+	setPaused(c, true)
+}
+
+// handleUnpauseContainer lets a paused container continue.
+func handleUnpauseContainer(c *gin.Context) {
+	setPaused(c, false)
+}
+
+func setPaused(c *gin.Context, paused bool) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	from, to, event, verb := manager.Running, manager.Paused, manager.EventPaused, "paused"
+	if !paused {
+		from, to, event, verb = manager.Paused, manager.Running, manager.EventUnpaused, "unpaused"
+	}
+	container := imageManager.Container
+	if container == nil || imageManager.Connection == nil || container.Status != from {
+		respondError(c, CodeNotRunning, fmt.Sprintf("No %s container for image %s", from, name))
+		return
+	}
+
+	var err error
+	if paused {
+		err = imageManager.Connection.Runtime.PauseContainer(container.ID)
+	} else {
+		err = imageManager.Connection.Runtime.UnpauseContainer(container.ID)
+	}
+	if err != nil {
+		requestLog(c).Error("Pause failed", "image", name, "container", container.Name, "paused", paused, "error", err)
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to change container %s: %v", container.Name, err))
+		return
+	}
+
+	container.Transition(to)
+	serviceManager.Events.Publish(manager.Event{Type: event, Image: name, Server: imageManager.Connection.Server.Name, Container: container.Name})
+	requestLog(c).Info("Container "+verb, "image", name, "container", container.Name)
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Container for image %s %s", name, verb), "status": to})
+}
+
+// attachLogs streams the container's stdout and stderr into its log files
+// until the container exits, recording the outcome on the run's attach step.
+// The output before the cursor is skipped. An attach that drops while the
+// container still runs is retried from the last line captured, by the
+// engine's timestamp, so the logs go on without a gap or duplicate lines.
+func attachLogs(connectionManager *manager.ConnectionManager, imageManager *manager.ImageManager, container *manager.ContainerManager, cursor *manager.LogCursor, op *manager.Operation) {
+	op.Begin(manager.StepAttach)
+
+	imageManager.Mu.Lock()
+	restarts := container.Restarts
+	container.Captured = cursor
+	imageManager.Mu.Unlock()
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = connectionManager.Runtime.AttachContainer(container.ID, cursor, container.Stdout, container.Stderr)
+		if shuttingDown.Load() {
+			// the capture ended with maestro, the container keeps running
+			return
+		}
+		if attempt == maxAttachRetries || !attachDropped(connectionManager, imageManager, container, restarts) {
+			break
+		}
+
+		loggers.For("worker").Warn("Attach to container dropped, reattaching", "server", connectionManager.Server.Name, "image", imageManager.Name, "container", container.Name, "attempt", attempt+1, "error", err)
+		op.Logf("attach dropped, reattaching from %s", cursor.Since().Format(time.RFC3339Nano))
+		time.Sleep(attachRetryDelay << attempt)
+	}
+	if err != nil {
+		imageManager.Mu.Lock()
+		defer imageManager.Mu.Unlock()
+		if container.Transition(manager.Error) != nil {
+			// the run already ended, e.g. was stopped, and its capture with it
+			op.Succeed(manager.StepAttach)
+			return
+		}
+		loggers.For("worker").Error("Failed to attach to container", "server", connectionManager.Server.Name, "image", imageManager.Name, "container", container.Name, "error", err)
+		serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: imageManager.Name, Server: connectionManager.Server.Name, Container: container.Name, Message: err.Error()})
+		op.Fail(manager.StepAttach, err)
+		return
+	}
+	op.Succeed(manager.StepAttach)
+}
+
+// attachDropped reports whether an attach to the container ended while the
+// container still runs, as it does when the connection to the server drops.
+// An attach ended by an exit, a restart or the removal of the container did
+// not drop.
+func attachDropped(connectionManager *manager.ConnectionManager, imageManager *manager.ImageManager, container *manager.ContainerManager, restarts int) bool {
+	imageManager.Mu.RLock()
+	ended := container.FinishedAt != nil || container.Restarts != restarts || container.RemovedAt != nil
+	imageManager.Mu.RUnlock()
+	if ended {
+		return false
+	}
+
+	state, err := connectionManager.Runtime.InspectContainer(container.ID)
+	if err != nil {
+		// the server may still be unreachable
+		return true
+	}
+	return !state.Exited
 }
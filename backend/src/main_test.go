@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maestro/src/database"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// asUser authenticates every request as the user, for handlers tested
+// without tokens.
+func asUser(user User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user", user)
+		c.Next()
+	}
+}
+
+// send sends a request to the engine from the remote address and returns the
+// recorded response.
+func send(t *testing.T, engine http.Handler, method, target, remoteAddr string, body io.Reader, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, body)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	return rec
+}
+
+// bearer returns the Authorization header of the token.
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+// newTestServer returns a server on a migrated database in a temporary
+// directory, closed when the test ends.
+func newTestServer(t *testing.T) *server {
+	t.Helper()
+	db, err := database.Open(context.Background(), database.Config{Path: filepath.Join(t.TempDir(), "db.sqlite")}, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &server{db: db}
+}
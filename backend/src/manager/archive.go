@@ -0,0 +1,379 @@
+package manager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the compression applied to tar archives.
+type Compression string
+
+const (
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+var ErrUnknownCompression = errors.New("unknown compression")
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCompression parses a compression name. An empty name means gzip.
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "", "gzip", "gz":
+		return CompressionGzip, nil
+	case "zstd", "zst":
+		return CompressionZstd, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnknownCompression, name)
+}
+
+// Ext returns the file extension of tar archives with this compression.
+func (c Compression) Ext() string {
+	if c == CompressionZstd {
+		return ".tar.zst"
+	}
+	return ".tar.gz"
+}
+
+// ContentType returns the media type of archives with this compression.
+func (c Compression) ContentType() string {
+	if c == CompressionZstd {
+		return "application/zstd"
+	}
+	return "application/gzip"
+}
+
+func (c Compression) newWriter(w io.Writer) (io.WriteCloser, error) {
+	if c == CompressionZstd {
+		return zstd.NewWriter(w)
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// decompress detects the compression of r from its magic bytes.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		decoder, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	}
+	return nil, ErrUnknownCompression
+}
+
+// Recompress copies a compressed stream from r to w with the given
+// compression.
+func Recompress(w io.Writer, r io.Reader, c Compression) error {
+	in, err := decompress(r)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := c.newWriter(w)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// WriteTar writes the named files from dir into a compressed tar stream.
+// Files that no longer exist are skipped.
+func WriteTar(w io.Writer, dir string, names []string, c Compression) error {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	out, err := c.newWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(out)
+
+	for _, name := range names {
+		if err := addTarFile(tw, root, name); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func addTarFile(tw *tar.Writer, root *os.Root, name string) error {
+	file, err := root.Open(filepath.FromSlash(name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// ExtractTar unpacks the regular files of a gzip or zstd compressed tar
+// stream into dir. Entries with paths outside dir are rejected.
+func ExtractTar(r io.Reader, dir string) ([]string, error) {
+	in, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	var names []string
+	tr := tar.NewReader(in)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return names, nil
+		}
+		if err != nil {
+			return names, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		target, err := WorkspacePath(header.Name)
+		if err != nil {
+			return names, fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
+		if err := WriteRootFile(root, target, tr, 0600); err != nil {
+			return names, err
+		}
+		root.Chtimes(target, header.ModTime, header.ModTime)
+		names = append(names, header.Name)
+	}
+}
+
+var ErrArchiveTooLarge = errors.New("archive too large")
+
+// maxExtractSize bounds the unpacked size of an uploaded archive.
+const maxExtractSize = 8 << 30
+
+var zipMagic = []byte("PK\x03\x04")
+
+// ExtractArchive unpacks the regular files of a zip archive, or of a gzip or
+// zstd compressed tar archive, below dir inside root and returns their
+// slash-separated workspace paths. The whole archive is checked before
+// anything is written: entries with paths outside the workspace are rejected,
+// and so is the archive when check returns an error for one of its paths and
+// sizes.
+func ExtractArchive(root *os.Root, dir string, r io.ReaderAt, size int64, check func(name string, size int64) error) ([]string, error) {
+	var names []string
+	var total int64
+	err := walkArchive(r, size, func(name string, fileSize int64, _ time.Time, _ io.Reader) error {
+		// the entry must stay below dir, not just inside the workspace
+		if _, err := WorkspacePath(name); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPath, name)
+		}
+		target, err := WorkspacePath(path.Join(filepath.ToSlash(dir), name))
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidPath, name)
+		}
+		if total += fileSize; total > maxExtractSize {
+			return ErrArchiveTooLarge
+		}
+		if err := check(filepath.ToSlash(target), fileSize); err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(target))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkArchive(r, size, func(name string, _ int64, modTime time.Time, body io.Reader) error {
+		target, _ := WorkspacePath(path.Join(filepath.ToSlash(dir), name))
+		if err := WriteRootFile(root, target, body, 0644); err != nil {
+			return err
+		}
+		root.Chtimes(target, modTime, modTime)
+		return nil
+	})
+	return names, err
+}
+
+// walkArchive calls fn with every regular file of a zip or compressed tar
+// archive.
+func walkArchive(r io.ReaderAt, size int64, fn func(name string, size int64, modTime time.Time, body io.Reader) error) error {
+	magic := make([]byte, len(zipMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if bytes.Equal(magic, zipMagic) {
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return err
+		}
+		for _, file := range zr.File {
+			if !file.Mode().IsRegular() {
+				continue
+			}
+			body, err := file.Open()
+			if err != nil {
+				return err
+			}
+			// the zip reader fails files that unpack to more than their
+			// recorded size
+			err = fn(file.Name, int64(file.UncompressedSize64), file.Modified, body)
+			body.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	in, err := decompress(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tr := tar.NewReader(in)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := fn(header.Name, header.Size, header.ModTime, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// WorkspaceFiles lists the regular files under dir as slash-separated paths,
+// leaving out captured logs unless logs is set.
+func WorkspaceFiles(dir string, logs bool) ([]string, error) {
+	var names []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || (!logs && IsLogFile(entry.Name())) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
+
+// WriteZip writes the named files from dir into a zip stream. Files that no
+// longer exist are skipped.
+func WriteZip(w io.Writer, dir string, names []string) error {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	zw := zip.NewWriter(w)
+	for _, name := range names {
+		if err := addZipFile(zw, root, name); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func addZipFile(zw *zip.Writer, root *os.Root, name string) error {
+	file, err := root.Open(filepath.FromSlash(name))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(name)
+	header.Method = zip.Deflate
+
+	out, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, file)
+	return err
+}
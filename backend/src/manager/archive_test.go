@@ -0,0 +1,229 @@
+package manager
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// archiveEntry is a file of a test archive, a symlink when link is set.
+type archiveEntry struct {
+	name, body, link string
+}
+
+var errRejected = errors.New("rejected")
+
+func tarArchive(t *testing.T, c Compression, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	out, err := c.newWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(out)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.body)), Typeflag: tar.TypeReg}
+		if entry.link != "" {
+			header = &tar.Header{Name: entry.name, Linkname: entry.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(entry.body))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipArchive(t *testing.T, _ Compression, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		body := entry.body
+		if entry.link != "" {
+			header.SetMode(os.ModeSymlink | 0777)
+			body = entry.link
+		}
+		w, err := zw.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchive(t *testing.T) {
+	formats := []struct {
+		name  string
+		build func(*testing.T, Compression, []archiveEntry) []byte
+		c     Compression
+	}{
+		{"tar.gz", tarArchive, CompressionGzip},
+		{"tar.zst", tarArchive, CompressionZstd},
+		{"zip", zipArchive, ""},
+	}
+	tests := []struct {
+		name      string
+		dir       string
+		entries   []archiveEntry
+		want      []string
+		wantErr   error
+		rejectAll bool // check refuses every file
+	}{
+		{
+			name:    "files",
+			entries: []archiveEntry{{name: "a.txt", body: "a"}, {name: "src/b.txt", body: "b"}},
+			want:    []string{"a.txt", "src/b.txt"},
+		},
+		{
+			name:    "below a directory",
+			dir:     "data",
+			entries: []archiveEntry{{name: "a.txt", body: "a"}},
+			want:    []string{"data/a.txt"},
+		},
+		{
+			name:    "symlinks are skipped",
+			entries: []archiveEntry{{name: "a.txt", body: "a"}, {name: "link", link: "../../etc/passwd"}},
+			want:    []string{"a.txt"},
+		},
+		{
+			name:    "parent traversal",
+			entries: []archiveEntry{{name: "a.txt", body: "a"}, {name: "../escape.txt", body: "x"}},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "nested traversal",
+			entries: []archiveEntry{{name: "src/../../escape.txt", body: "x"}},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{{name: "/escape.txt", body: "x"}},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "git directory",
+			entries: []archiveEntry{{name: "a.txt", body: "a"}, {name: "src/.git/config", body: "x"}},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:    "out of the directory",
+			dir:     "data",
+			entries: []archiveEntry{{name: "../escape.txt", body: "x"}},
+			wantErr: ErrInvalidPath,
+		},
+		{
+			name:      "rejected by check",
+			entries:   []archiveEntry{{name: "a.txt", body: "a"}},
+			wantErr:   errRejected,
+			rejectAll: true,
+		},
+	}
+	for _, format := range formats {
+		for _, tt := range tests {
+			t.Run(format.name+"/"+tt.name, func(t *testing.T) {
+				raw := format.build(t, format.c, tt.entries)
+				parent := t.TempDir()
+				workspace := filepath.Join(parent, "workspace")
+				if err := os.Mkdir(workspace, 0755); err != nil {
+					t.Fatal(err)
+				}
+				root, err := os.OpenRoot(workspace)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer root.Close()
+
+				check := func(string, int64) error {
+					if tt.rejectAll {
+						return errRejected
+					}
+					return nil
+				}
+				names, err := ExtractArchive(root, tt.dir, bytes.NewReader(raw), int64(len(raw)), check)
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("ExtractArchive error = %v, want %v", err, tt.wantErr)
+				}
+
+				written, walkErr := WorkspaceFiles(workspace, true)
+				if walkErr != nil {
+					t.Fatal(walkErr)
+				}
+				if tt.wantErr != nil {
+					// the archive is checked whole before anything is written
+					if len(written) > 0 {
+						t.Errorf("rejected archive wrote %v", written)
+					}
+				} else {
+					if !slices.Equal(names, tt.want) {
+						t.Errorf("names = %v, want %v", names, tt.want)
+					}
+					if !slices.Equal(written, tt.want) {
+						t.Errorf("written = %v, want %v", written, tt.want)
+					}
+				}
+				if _, err := os.Stat(filepath.Join(parent, "escape.txt")); err == nil {
+					t.Error("extracted a file outside the workspace")
+				}
+			})
+		}
+	}
+}
+
+func TestExtractTar(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		want    []string
+		wantErr bool
+	}{
+		{"files", []archiveEntry{{name: "a.txt", body: "a"}, {name: "src/b.txt", body: "b"}}, []string{"a.txt", "src/b.txt"}, false},
+		{"symlinks are skipped", []archiveEntry{{name: "link", link: "/etc/passwd"}}, nil, false},
+		{"parent traversal", []archiveEntry{{name: "../escape.txt", body: "x"}}, nil, true},
+		{"absolute path", []archiveEntry{{name: "/escape.txt", body: "x"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw := tarArchive(t, CompressionGzip, tt.entries)
+			parent := t.TempDir()
+			workspace := filepath.Join(parent, "workspace")
+			if err := os.Mkdir(workspace, 0755); err != nil {
+				t.Fatal(err)
+			}
+
+			names, err := ExtractTar(bytes.NewReader(raw), workspace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ExtractTar error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(names, tt.want) {
+				t.Errorf("names = %v, want %v", names, tt.want)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "escape.txt")); err == nil {
+				t.Error("extracted a file outside the workspace")
+			}
+		})
+	}
+}
+
+func TestExtractTarUnknownCompression(t *testing.T) {
+	_, err := ExtractTar(bytes.NewReader([]byte("plain text")), t.TempDir())
+	if !errors.Is(err, ErrUnknownCompression) {
+		t.Fatalf("ExtractTar error = %v, want %v", err, ErrUnknownCompression)
+	}
+}
@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// ValidateOutputs checks that run outputs are absolute container paths.
+func ValidateOutputs(outputs []string) error {
+	for _, output := range outputs {
+		if !path.IsAbs(output) || path.Clean(output) == "/" {
+			return fmt.Errorf("invalid output %q: expected an absolute path below /", output)
+		}
+	}
+	return nil
+}
+
+// CollectArtifacts copies the declared outputs of an exited run out of its
+// container into artifacts/<run ID> of the workspace and publishes the outcome.
+// Outputs missing from the container are skipped. It takes the image lock
+// itself, so exit handlers call it in a goroutine after releasing theirs.
+func (sm *ServiceManager) CollectArtifacts(im *ImageManager, mc *ConnectionManager, cm *ContainerManager) {
+	im.Mu.Lock()
+	defer im.Mu.Unlock()
+
+	if len(cm.Options.Outputs) == 0 || cm.Artifacts != "" {
+		return
+	}
+
+	dir := path.Join(ArtifactsDir, cm.RunID)
+	collected, err := im.collectArtifacts(mc, cm.ID, dir, cm.Options.Outputs)
+	event := Event{Type: EventArtifact, Image: im.Name, Server: mc.Server.Name, Container: cm.Name, Message: fmt.Sprintf("%d files in %s", collected, dir)}
+	if err != nil {
+		event.Type = EventError
+		event.Message = fmt.Sprintf("failed to collect artifacts: %v", err)
+	}
+	if collected > 0 {
+		cm.Artifacts = dir
+	}
+	sm.Events.Publish(event)
+}
+
+func (im *ImageManager) collectArtifacts(mc *ConnectionManager, containerID, dir string, outputs []string) (int, error) {
+	root, err := im.OpenRoot()
+	if err != nil {
+		return 0, err
+	}
+	defer root.Close()
+
+	collected := 0
+	var errs []error
+	for _, output := range outputs {
+		// the archive holds the output under its base name
+		reader, writer := io.Pipe()
+		go func() { writer.CloseWithError(mc.Runtime.CopyFromContainer(containerID, output, writer)) }()
+
+		n, err := extractTarInto(root, dir, reader)
+		// stop the copy if the archive was rejected half way
+		reader.CloseWithError(io.ErrClosedPipe)
+		collected += n
+		// outputs the run did not create are skipped
+		if err != nil && !errors.Is(err, ErrNoSuchPath) {
+			errs = append(errs, fmt.Errorf("%s: %v", output, err))
+		}
+	}
+	return collected, errors.Join(errs...)
+}
+
+// extractTarInto unpacks the regular files and directories of an uncompressed
+// tar stream below dir inside root and returns how many files it wrote.
+// Entries with paths outside dir are rejected, links are skipped.
+func extractTarInto(root *os.Root, dir string, r io.Reader) (int, error) {
+	written := 0
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+
+		if _, err := WorkspacePath(header.Name); err != nil {
+			return written, fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+		target := filepath.Join(filepath.FromSlash(dir), filepath.FromSlash(path.Clean(header.Name)))
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := root.MkdirAll(target, 0755); err != nil {
+				return written, err
+			}
+		case tar.TypeReg:
+			if err := WriteRootFile(root, target, tr, header.FileInfo().Mode().Perm()|0600); err != nil {
+				return written, err
+			}
+			root.Chtimes(target, header.ModTime, header.ModTime)
+			written++
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package manager
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventQueued    EventType = "queued"
+	EventDelayed   EventType = "queue_delayed"
+	EventBuilding  EventType = "building"
+	EventBuilt     EventType = "built"
+	EventStarted   EventType = "started"
+	EventExited    EventType = "exited"
+	EventArtifact  EventType = "artifacts_collected"
+	EventStopped   EventType = "stopped"
+	EventTimedOut  EventType = "timed_out"
+	EventRestarted EventType = "restarted"
+	EventAdopted   EventType = "adopted" // an orphaned container is tracked again
+	EventPaused    EventType = "paused"
+	EventUnpaused  EventType = "unpaused"
+	EventError     EventType = "error"
+
+	EventServerOffline EventType = "server_offline"
+	EventServerOnline  EventType = "server_online" // an offline server was reconnected
+
+	EventServerDraining    EventType = "server_draining"
+	EventServerMaintenance EventType = "server_maintenance" // a draining server's containers all exited
+	EventServerResumed     EventType = "server_resumed"
+)
+
+// Event is a lifecycle change of an image or its container.
+type Event struct {
+	Type      EventType `json:"type"`
+	Image     string    `json:"image"`
+	Server    string    `json:"server,omitempty"`
+	Container string    `json:"container,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Position  int       `json:"position,omitempty"`  // queue position of queued and delayed runs
+	Suggested []string  `json:"suggested,omitempty"` // servers with free capacity for delayed runs
+	Time      time.Time `json:"time"`
+}
+
+// ExitedEvent describes the exit of a container marked with MarkExited.
+func ExitedEvent(image, server string, container *ContainerManager) Event {
+	event := Event{
+		Type:      EventExited,
+		Image:     image,
+		Server:    server,
+		Container: container.Name,
+		Message:   string(container.Status),
+		ExitCode:  container.ExitCode,
+	}
+	if container.FinishedAt != nil {
+		event.Time = *container.FinishedAt
+	}
+	if container.OOMKilled {
+		event.Message += " (out of memory)"
+	}
+	return event
+}
+
+// subscriberBuffer is how many events a slow subscriber may lag behind before
+// further events are dropped for it.
+const subscriberBuffer = 64
+
+// EventBus fans lifecycle events out to subscribers without blocking the
+// publisher.
+type EventBus struct {
+	subscribers map[chan Event]*eventQueue // nil for subscribers that may miss events
+	dropped     atomic.Int64
+
+	mu sync.Mutex
+}
+
+// Subscribe returns a channel receiving all events published from now on.
+// Events are dropped for a subscriber lagging subscriberBuffer events behind.
+func (b *EventBus) Subscribe() chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan Event]*eventQueue)
+	}
+	ch := make(chan Event, subscriberBuffer)
+	b.subscribers[ch] = nil
+	return ch
+}
+
+// SubscribeQueued returns a channel receiving all events published from now
+// on, none dropped: the events a slow subscriber has not taken yet are queued
+// for it in memory. It is for subscribers that must see every event, such as
+// deliveries with a history.
+func (b *EventBus) SubscribeQueued() chan Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers == nil {
+		b.subscribers = make(map[chan Event]*eventQueue)
+	}
+	ch := make(chan Event)
+	queue := &eventQueue{wake: make(chan struct{}, 1), done: make(chan struct{})}
+	b.subscribers[ch] = queue
+	go queue.forward(ch)
+	return ch
+}
+
+// Unsubscribe stops delivery to ch and closes it.
+func (b *EventBus) Unsubscribe(ch chan Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queue, ok := b.subscribers[ch]
+	if !ok {
+		return
+	}
+	delete(b.subscribers, ch)
+	if queue != nil {
+		// the queue closes ch once it stopped sending to it
+		close(queue.done)
+		return
+	}
+	close(ch)
+}
+
+// Publish delivers the event to every subscriber with room in its buffer and
+// queues it for the subscribers that see every event.
+func (b *EventBus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch, queue := range b.subscribers {
+		if queue != nil {
+			queue.push(event)
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns how many events were dropped for subscribers lagging
+// behind.
+func (b *EventBus) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// eventQueue holds the events published for a subscriber that sees every
+// event until it takes them.
+type eventQueue struct {
+	mu      sync.Mutex
+	pending []Event
+	wake    chan struct{} // signaled when events are pushed
+	done    chan struct{} // closed when the subscriber unsubscribes
+}
+
+func (q *eventQueue) push(event Event) {
+	q.mu.Lock()
+	q.pending = append(q.pending, event)
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// forward sends the queued events to ch in order until the subscriber
+// unsubscribes, then closes ch.
+func (q *eventQueue) forward(ch chan Event) {
+	defer close(ch)
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.mu.Unlock()
+			select {
+			case <-q.wake:
+				continue
+			case <-q.done:
+				return
+			}
+		}
+		event := q.pending[0]
+		q.pending[0] = Event{}
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		select {
+		case ch <- event:
+		case <-q.done:
+			return
+		}
+	}
+}
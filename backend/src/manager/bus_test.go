@@ -0,0 +1,40 @@
+package manager
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventBusQueued(t *testing.T) {
+	var bus EventBus
+	lossy := bus.Subscribe()
+	queued := bus.SubscribeQueued()
+
+	const published = 3 * subscriberBuffer
+	for i := range published {
+		bus.Publish(Event{Type: EventQueued, Position: i})
+	}
+
+	for i := range published {
+		select {
+		case event := <-queued:
+			if event.Position != i {
+				t.Fatalf("queued subscriber got event %d, want %d", event.Position, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("queued subscriber missed event %d", i)
+		}
+	}
+	if len(lossy) != subscriberBuffer {
+		t.Errorf("lossy subscriber buffered %d events, want %d", len(lossy), subscriberBuffer)
+	}
+	if got, want := bus.Dropped(), int64(published-subscriberBuffer); got != want {
+		t.Errorf("Dropped() = %d, want %d", got, want)
+	}
+
+	bus.Publish(Event{Type: EventStarted})
+	bus.Unsubscribe(queued)
+	for range queued {
+		// the events queued before unsubscribing may still arrive
+	}
+}
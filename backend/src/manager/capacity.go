@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"fmt"
+
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Resources are the CPU cores, memory and GPUs a run reserves, or a server
+// offers to its runs. A zero field reserves nothing, or does not limit runs.
+type Resources struct {
+	CPUs     float64 `yaml:"cpus" json:"cpus" binding:"gte=0"`
+	MemoryMB int64   `yaml:"memoryMB" json:"memoryMB" binding:"gte=0"`
+	GPUs     int     `yaml:"gpus" json:"gpus" binding:"gte=0"`
+}
+
+// Validate rejects negative amounts.
+func (r Resources) Validate() error {
+	if r.CPUs < 0 || r.MemoryMB < 0 || r.GPUs < 0 {
+		return fmt.Errorf("invalid resources: cpus, memoryMB and gpus must not be negative")
+	}
+	return nil
+}
+
+// Add returns the sum of both reservations.
+func (r Resources) Add(other Resources) Resources {
+	return Resources{
+		CPUs:     r.CPUs + other.CPUs,
+		MemoryMB: r.MemoryMB + other.MemoryMB,
+		GPUs:     r.GPUs + other.GPUs,
+	}
+}
+
+// Fits reports whether need fits into the capacity r once reserved is taken.
+// Resources the server does not declare always fit.
+func (r Resources) Fits(reserved, need Resources) bool {
+	return (r.CPUs == 0 || reserved.CPUs+need.CPUs <= r.CPUs) &&
+		(r.MemoryMB == 0 || reserved.MemoryMB+need.MemoryMB <= r.MemoryMB) &&
+		(r.GPUs == 0 || reserved.GPUs+need.GPUs <= r.GPUs)
+}
+
+// Reserved returns what the running containers of the server reserved.
+func (sm *ServiceManager) Reserved(cm *ConnectionManager) Resources {
+	var reserved Resources
+	sm.Images.Range(func(_ string, im *ImageManager) bool {
+		im.Mu.RLock()
+		defer im.Mu.RUnlock()
+		if im.Connection == cm && im.Container != nil && im.Container.Active() {
+			reserved = reserved.Add(im.Container.Options.Resources)
+		}
+		return true
+	})
+	return reserved
+}
+
+// specResources limits a container to the CPU and memory of a run. GPUs are
+// only reserved on Podman, which cannot hand out a number of them.
+func specResources(r Resources) *spec.LinuxResources {
+	if r.CPUs == 0 && r.MemoryMB == 0 {
+		return nil
+	}
+	resources := &spec.LinuxResources{}
+	if r.CPUs > 0 {
+		period := uint64(100000)
+		resources.CPU = &spec.LinuxCPU{
+			Period: &period,
+			Quota:  func(a int64) *int64 { return &a }(int64(r.CPUs * float64(period))),
+		}
+	}
+	if r.MemoryMB > 0 {
+		resources.Memory = &spec.LinuxMemory{Limit: func(a int64) *int64 { return &a }(r.MemoryMB * 1024 * 1024)}
+	}
+	return resources
+}
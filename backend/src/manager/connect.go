@@ -0,0 +1,240 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os/exec"
+
+	"github.com/containers/podman/v6/pkg/bindings"
+	"golang.org/x/crypto/ssh"
+)
+
+var ErrNoShell = errors.New("server has no shell access")
+
+// EngineURI returns the URI of a server's engine socket: its configured URI,
+// or an ssh:// URI built from its user, host, port and socket path.
+func EngineURI(server ServerInfo) (*url.URL, error) {
+	if server.URI == "" {
+		return url.ParseRequestURI(fmt.Sprintf("ssh://%s@%s:%d%s", server.Username, server.Host, server.Port, server.PodmanSocket))
+	}
+
+	uri, err := url.Parse(server.URI)
+	if err != nil {
+		return nil, err
+	}
+	switch uri.Scheme {
+	case "unix", "tcp":
+	case "ssh":
+		if uri.User == nil || uri.Hostname() == "" {
+			return nil, fmt.Errorf("ssh URI %s needs a user and host", server.URI)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, expected unix, tcp or ssh", uri.Scheme)
+	}
+	return uri, nil
+}
+
+// NewConnectionManager returns the server offline, not connected yet.
+func NewConnectionManager(server ServerInfo) *ConnectionManager {
+	server.Status = ServerOffline
+	cm := &ConnectionManager{Server: server, RunQueue: NewRunQueue()}
+	cm.Runtime, cm.Conn = offlineRuntime(server)
+	return cm
+}
+
+// offlineRuntime returns a runtime of the server's engine whose calls fail
+// until the server is connected.
+func offlineRuntime(server ServerInfo) (Runtime, context.Context) {
+	switch server.Engine {
+	case EngineKubernetes:
+		if runtime, err := NewKubernetesRuntime(server); err == nil {
+			return runtime, context.Background()
+		}
+	case EngineDocker:
+		if uri, err := EngineURI(server); err == nil {
+			if runtime, err := NewDockerRuntime(uri, nil); err == nil {
+				return runtime, context.Background()
+			}
+		}
+	}
+	return &PodmanRuntime{Conn: context.Background()}, context.Background()
+}
+
+// Dial connects to the engine of a server and, for ssh:// servers, opens an
+// SSH connection the engine API, commands and file copies all go through. A
+// unix:// or tcp:// server has no SSH connection, neither has a Kubernetes
+// cluster. The passphrase of the server's identity file is read from secrets.
+func Dial(server ServerInfo, secrets *SecretStore) (Runtime, *ssh.Client, error) {
+	if server.Engine == EngineKubernetes {
+		runtime, err := NewKubernetesRuntime(server)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to Kubernetes: %v", err)
+		}
+		// the client connects lazily, check the cluster answers
+		if _, err := runtime.Client.Discovery().ServerVersion(); err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to Kubernetes: %v", err)
+		}
+		return runtime, nil, nil
+	}
+
+	uri, err := EngineURI(server)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid server URI: %v", err)
+	}
+
+	var sshClient *ssh.Client
+	if uri.Scheme == "ssh" {
+		sshClient, err = dialSSH(server, uri, secrets)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var runtime Runtime
+	switch server.Engine {
+	case "", EnginePodman:
+		var pool *ConnPool
+		pool, err = dialPodmanPool(server, uri, sshClient, secrets)
+		if err != nil {
+			err = fmt.Errorf("failed to connect to Podman: %v", err)
+			break
+		}
+		runtime = &PodmanRuntime{Conn: pool.conns[0], Pool: pool}
+	case EngineDocker:
+		runtime, err = NewDockerRuntime(uri, sshClient)
+		if err != nil {
+			err = fmt.Errorf("failed to connect to Docker: %v", err)
+		}
+	default:
+		err = fmt.Errorf("unknown engine %q, expected podman, docker or kubernetes", server.Engine)
+	}
+	if err != nil {
+		if sshClient != nil {
+			sshClient.Close()
+		}
+		return nil, nil, err
+	}
+	return runtime, sshClient, nil
+}
+
+// dialPodmanPool opens the server's pool of Podman connections. Over SSH the
+// first connection goes through sshClient and every other one through an SSH
+// connection of its own, closed along with sshClient.
+func dialPodmanPool(server ServerInfo, uri *url.URL, sshClient *ssh.Client, secrets *SecretStore) (*ConnPool, error) {
+	size := server.PoolSize
+	if size <= 0 {
+		size = DefaultPoolSize
+	}
+
+	conns := make([]context.Context, 0, size)
+	for i := 0; i < size; i++ {
+		podmanURI := uri.String()
+		if uri.Scheme == "ssh" {
+			client := sshClient
+			if i > 0 {
+				extra, err := dialSSH(server, uri, secrets)
+				if err != nil {
+					return nil, err
+				}
+				go func() {
+					sshClient.Wait()
+					extra.Close()
+				}()
+				client = extra
+			}
+
+			// the bindings would open an SSH connection of their own, with
+			// the ambient agent and known_hosts
+			var err error
+			podmanURI, err = tunnelSocket(client, uri.Path)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		conn, err := bindings.NewConnection(context.Background(), podmanURI)
+		if err != nil {
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return NewConnPool(conns), nil
+}
+
+// Local reports whether the server is the host maestro runs on, reached
+// through a unix:// socket.
+func (cm *ConnectionManager) Local() bool {
+	uri, err := EngineURI(cm.Server)
+	return err == nil && uri.Scheme == "unix"
+}
+
+// Shell runs a shell command on the server and returns its output: over SSH,
+// or directly for a local server. tcp:// servers have no shell.
+func (cm *ConnectionManager) Shell(command string) (string, error) {
+	if cm.Local() {
+		out, err := exec.Command("sh", "-c", command).Output()
+		return string(out), err
+	}
+
+	cm.Mu.RLock()
+	client := cm.SshConn
+	cm.Mu.RUnlock()
+	if client == nil {
+		return "", ErrNoShell
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var out bytes.Buffer
+	session.Stdout = &out
+	err = session.Run(command)
+	return out.String(), err
+}
+
+// Reconnect opens the server's connections, replacing the old ones, such as
+// after the server rebooted and they went dead.
+func (cm *ConnectionManager) Reconnect() error {
+	runtime, sshClient, err := Dial(cm.Server, cm.Secrets)
+	if err != nil {
+		return err
+	}
+
+	// Podman-only features use the Podman connection directly
+	podmanConn := context.Background()
+	if podman, ok := runtime.(*PodmanRuntime); ok {
+		podmanConn = podman.Conn
+	}
+
+	cm.Mu.Lock()
+	oldSsh := cm.SshConn
+	cm.Runtime = runtime
+	cm.Conn = podmanConn
+	cm.SshConn = sshClient
+	cm.Mu.Unlock()
+
+	if oldSsh != nil {
+		oldSsh.Close()
+	}
+	return nil
+}
+
+// ReadInfo records the memory and platform the engine reports for the server.
+func (cm *ConnectionManager) ReadInfo() error {
+	info, err := cm.Runtime.Info()
+	if err != nil {
+		return fmt.Errorf("failed to read engine info: %v", err)
+	}
+
+	cm.Mu.Lock()
+	cm.Server.MemTotal = fmt.Sprintf("%.2fGiB", float32(info.MemTotal)/1024/1024/1024)
+	cm.Server.Platform = info.OS + "/" + info.Arch
+	cm.Mu.Unlock()
+	return nil
+}
@@ -0,0 +1,476 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/buildah/define"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	dockerregistry "github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/moby/go-archive"
+	"golang.org/x/crypto/ssh"
+)
+
+// DockerRuntime runs containers through the Docker Engine API.
+type DockerRuntime struct {
+	Client *client.Client
+}
+
+// NewDockerRuntime connects to the Docker daemon at uri. The socket of an
+// ssh:// daemon is reached through sshClient, a nil sshClient fails every
+// call with ErrServerOffline.
+func NewDockerRuntime(uri *url.URL, sshClient *ssh.Client) (*DockerRuntime, error) {
+	opts := []client.Opt{client.WithAPIVersionNegotiation()}
+	if uri.Scheme == "ssh" {
+		socket := uri.Path
+		opts = append(opts, client.WithHost("unix://"+socket), client.WithDialContext(func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if sshClient == nil {
+				return nil, ErrServerOffline
+			}
+			return sshClient.Dial("unix", socket)
+		}))
+	} else {
+		opts = append(opts, client.WithHost(uri.String()))
+	}
+
+	dockerClient, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &DockerRuntime{Client: dockerClient}, nil
+}
+
+func (r *DockerRuntime) Engine() string {
+	return EngineDocker
+}
+
+func (r *DockerRuntime) Info() (*EngineInfo, error) {
+	info, err := r.Client.Info(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return &EngineInfo{
+		Engine:      EngineDocker,
+		Version:     info.ServerVersion,
+		OS:          info.OSType,
+		Arch:        info.Architecture,
+		MemTotal:    info.MemTotal,
+		StorageRoot: info.DockerRootDir,
+
+		Distribution:  info.OperatingSystem,
+		Kernel:        info.KernelVersion,
+		CPUs:          info.NCPU,
+		StorageDriver: info.Driver,
+		Images:        info.Images,
+		Containers:    info.Containers,
+	}, nil
+}
+
+func (r *DockerRuntime) CreateContainer(spec ContainerSpec) (string, error) {
+	env := make([]string, 0, len(spec.Env))
+	for key, value := range spec.Env {
+		env = append(env, key+"="+value)
+	}
+	mounts := make([]mount.Mount, 0, len(spec.Mounts))
+	for _, m := range spec.Mounts {
+		mounts = append(mounts, mount.Mount{Type: mount.TypeBind, Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+
+	created, err := r.Client.ContainerCreate(context.Background(), &container.Config{
+		Image:     spec.Image,
+		Env:       env,
+		OpenStdin: spec.Interactive,
+		Labels:    spec.Labels,
+	}, &container.HostConfig{
+		Mounts:    mounts,
+		Resources: dockerResources(spec.Resources),
+	}, nil, nil, spec.Name)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func dockerResources(r Resources) container.Resources {
+	resources := container.Resources{
+		NanoCPUs: int64(r.CPUs * 1e9),
+		Memory:   r.MemoryMB * 1024 * 1024,
+	}
+	if r.GPUs > 0 {
+		resources.DeviceRequests = []container.DeviceRequest{{Count: r.GPUs, Capabilities: [][]string{{"gpu"}}}}
+	}
+	return resources
+}
+
+func (r *DockerRuntime) StartContainer(id string) error {
+	return r.Client.ContainerStart(context.Background(), id, container.StartOptions{})
+}
+
+func (r *DockerRuntime) StopContainer(id string) error {
+	return r.Client.ContainerStop(context.Background(), id, container.StopOptions{
+		Timeout: func(a int) *int { return &a }(0),
+	})
+}
+
+func (r *DockerRuntime) ListContainers() ([]ContainerSummary, error) {
+	listed, err := r.Client.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelImage)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ContainerSummary, 0, len(listed))
+	for _, c := range listed {
+		summary := ContainerSummary{
+			ID:        c.ID,
+			ImageID:   c.ImageID,
+			Labels:    c.Labels,
+			Running:   c.State == container.StateRunning || c.State == container.StatePaused,
+			Exited:    c.State == container.StateExited || c.State == container.StateDead,
+			CreatedAt: time.Unix(c.Created, 0),
+		}
+		if len(c.Names) > 0 {
+			summary.Name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (r *DockerRuntime) PauseContainer(id string) error {
+	return r.Client.ContainerPause(context.Background(), id)
+}
+
+func (r *DockerRuntime) UnpauseContainer(id string) error {
+	return r.Client.ContainerUnpause(context.Background(), id)
+}
+
+func (r *DockerRuntime) RemoveContainer(id string, force, volumes bool) error {
+	err := r.Client.ContainerRemove(context.Background(), id, container.RemoveOptions{
+		RemoveVolumes: volumes,
+		Force:         force,
+	})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *DockerRuntime) InspectContainer(id string) (*ContainerState, error) {
+	report, err := r.Client.ContainerInspect(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if report.State == nil {
+		return nil, fmt.Errorf("container %s has no state", id)
+	}
+	finishedAt, _ := time.Parse(time.RFC3339Nano, report.State.FinishedAt)
+	return &ContainerState{
+		Exited:     report.State.Status == container.StateExited,
+		ExitCode:   report.State.ExitCode,
+		OOMKilled:  report.State.OOMKilled,
+		FinishedAt: finishedAt,
+	}, nil
+}
+
+func (r *DockerRuntime) KillContainer(id, signal string) error {
+	return r.Client.ContainerKill(context.Background(), id, signal)
+}
+
+func (r *DockerRuntime) RestartContainer(id string) error {
+	return r.Client.ContainerRestart(context.Background(), id, container.StopOptions{
+		Timeout: func(a int) *int { return &a }(0),
+	})
+}
+
+func (r *DockerRuntime) WaitContainer(ctx context.Context, id string) (int, error) {
+	resultC, errC := r.Client.ContainerWait(ctx, id, container.WaitConditionNotRunning)
+	select {
+	case result := <-resultC:
+		if result.Error != nil {
+			return 0, errors.New(result.Error.Message)
+		}
+		return int(result.StatusCode), nil
+	case err := <-errC:
+		return 0, err
+	}
+}
+
+func (r *DockerRuntime) AttachContainer(id string, cursor *LogCursor, stdout, stderr io.Writer) error {
+	// the logs, unlike an attach, are timestamped and resume from a point in
+	// time
+	options := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     true,
+		Timestamps: true,
+	}
+	if since := cursor.Since(); !since.IsZero() {
+		options.Since = since.Format(time.RFC3339Nano)
+	}
+	logs, err := r.Client.ContainerLogs(context.Background(), id, options)
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	stdout, stderr, flush := cursor.Writers(stdout, stderr)
+	defer flush()
+	// without a TTY both streams are multiplexed over the connection
+	_, err = stdcopy.StdCopy(stdout, stderr, logs)
+	return err
+}
+
+// AttachStdin attaches to the input of the container only, the output is
+// captured by AttachContainer. Closing the stream leaves the input open.
+func (r *DockerRuntime) AttachStdin(id string, stdin io.Reader) error {
+	attached, err := r.Client.ContainerAttach(context.Background(), id, container.AttachOptions{
+		Stream: true,
+		Stdin:  true,
+	})
+	if err != nil {
+		return err
+	}
+	defer attached.Close()
+
+	go func() {
+		io.Copy(attached.Conn, stdin)
+		attached.Close()
+	}()
+	io.Copy(io.Discard, attached.Reader)
+	return nil
+}
+
+func (r *DockerRuntime) ExecContainer(id string, exec Exec) (int, error) {
+	created, err := r.Client.ContainerExecCreate(context.Background(), id, container.ExecOptions{
+		Cmd:          exec.Cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	attached, err := r.Client.ContainerExecAttach(context.Background(), created.ID, container.ExecAttachOptions{Tty: true})
+	if err != nil {
+		return 0, err
+	}
+	defer attached.Close()
+
+	go followResizes(exec.Resize, func(size TerminalSize) error {
+		return r.Client.ContainerExecResize(context.Background(), created.ID, container.ResizeOptions{
+			Height: uint(size.Rows),
+			Width:  uint(size.Cols),
+		})
+	})
+	go func() {
+		io.Copy(attached.Conn, exec.Stdin)
+		attached.CloseWrite()
+	}()
+	// with a TTY the output is not multiplexed
+	io.Copy(exec.Output, attached.Reader)
+
+	inspect, err := r.Client.ContainerExecInspect(context.Background(), created.ID)
+	if err != nil {
+		return 0, err
+	}
+	return inspect.ExitCode, nil
+}
+
+func (r *DockerRuntime) CopyFromContainer(id, path string, w io.Writer) error {
+	reader, _, err := r.Client.CopyFromContainer(context.Background(), id, path)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return ErrNoSuchPath
+		}
+		return err
+	}
+	defer reader.Close()
+
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+func (r *DockerRuntime) ContainerEvents(handle func(ContainerEvent)) error {
+	messages, errs := r.Client.Events(context.Background(), events.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("type", string(events.ContainerEventType))),
+	})
+	for {
+		select {
+		case message := <-messages:
+			switch message.Action {
+			case events.ActionOOM:
+				handle(ContainerEvent{ID: message.Actor.ID, Action: "oom", Time: time.Unix(0, message.TimeNano)})
+			case events.ActionDie:
+				exitCode, _ := strconv.Atoi(message.Actor.Attributes["exitCode"])
+				handle(ContainerEvent{ID: message.Actor.ID, Action: "died", ExitCode: exitCode, Time: time.Unix(0, message.TimeNano)})
+			}
+		case err := <-errs:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func (r *DockerRuntime) BuildImage(ctx context.Context, opts ImageBuild) (string, error) {
+	if len(opts.Platforms) > 1 || opts.Manifest != "" {
+		return "", fmt.Errorf("%w: multi-platform builds", ErrUnsupported)
+	}
+
+	buildContext, err := archive.TarWithOptions(opts.ContextDir, &archive.TarOptions{ExcludePatterns: opts.Excludes})
+	if err != nil {
+		return "", err
+	}
+	defer buildContext.Close()
+
+	args := map[string]*string{}
+	for key, value := range opts.Args {
+		args[key] = &value
+	}
+	labels := map[string]string{}
+	for _, label := range opts.Labels {
+		key, value, _ := strings.Cut(label, "=")
+		labels[key] = value
+	}
+	platform := ""
+	if len(opts.Platforms) == 1 {
+		platform = opts.Platforms[0].String()
+	}
+	// Docker only looks for a Dockerfile by default
+	dockerfile := ""
+	if opts.Containerfile != "" {
+		dockerfile, err = filepath.Rel(opts.ContextDir, opts.Containerfile)
+		if err != nil {
+			return "", err
+		}
+	} else if _, err := os.Stat(filepath.Join(opts.ContextDir, "Containerfile")); err == nil {
+		dockerfile = "Containerfile"
+	}
+
+	response, err := r.Client.ImageBuild(ctx, buildContext, build.ImageBuildOptions{
+		Dockerfile:  dockerfile,
+		BuildArgs:   args,
+		NoCache:     opts.NoCache,
+		PullParent:  opts.PullPolicy == define.PullAlways,
+		Remove:      true,
+		ForceRemove: opts.ForceRm,
+		Target:      opts.Target,
+		Labels:      labels,
+		Platform:    platform,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	// the ID of the built image arrives as an aux message of the stream
+	id := ""
+	err = jsonmessage.DisplayJSONMessagesStream(response.Body, opts.Out, 0, false, func(message jsonmessage.JSONMessage) {
+		var aux build.Result
+		if message.Aux != nil && json.Unmarshal(*message.Aux, &aux) == nil && aux.ID != "" {
+			id = aux.ID
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", errors.New("build returned no image")
+	}
+	return id, nil
+}
+
+func (r *DockerRuntime) PullImage(ref string, newer bool) (string, error) {
+	// the daemon only downloads layers it does not have yet
+	progress, err := r.Client.ImagePull(context.Background(), ref, image.PullOptions{})
+	if err != nil {
+		return "", err
+	}
+	defer progress.Close()
+	if err := jsonmessage.DisplayJSONMessagesStream(progress, io.Discard, 0, false, nil); err != nil {
+		return "", err
+	}
+
+	inspect, err := r.Client.ImageInspect(context.Background(), ref)
+	if err != nil {
+		return "", err
+	}
+	return inspect.ID, nil
+}
+
+// Push tags the image as ref and pushes it, returning the digest of the
+// pushed manifest. The daemon decides which registries skip TLS verification,
+// so cfg.SkipTLSVerify has no effect.
+func (r *DockerRuntime) Push(id, ref string, cfg RegistryConfig, password string) (string, error) {
+	auth := ""
+	if cfg.Username != "" {
+		var err error
+		auth, err = dockerregistry.EncodeAuthConfig(dockerregistry.AuthConfig{Username: cfg.Username, Password: password})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// Docker only pushes tags, the next build still removes the image by ID
+	if err := r.Client.ImageTag(context.Background(), id, ref); err != nil {
+		return "", fmt.Errorf("failed to tag %s: %v", ref, err)
+	}
+	progress, err := r.Client.ImagePush(context.Background(), ref, image.PushOptions{RegistryAuth: auth})
+	if err != nil {
+		return "", fmt.Errorf("failed to push %s: %v", ref, err)
+	}
+	defer progress.Close()
+
+	// the digest of the pushed manifest arrives as an aux message of the stream
+	digest := ""
+	err = jsonmessage.DisplayJSONMessagesStream(progress, io.Discard, 0, false, func(message jsonmessage.JSONMessage) {
+		var aux types.PushResult
+		if message.Aux != nil && json.Unmarshal(*message.Aux, &aux) == nil && aux.Digest != "" {
+			digest = aux.Digest
+		}
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to push %s: %v", ref, err)
+	}
+	return digest, nil
+}
+
+func (r *DockerRuntime) ImageExists(id string) (bool, error) {
+	_, err := r.Client.ImageInspect(context.Background(), id)
+	if client.IsErrNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *DockerRuntime) RemoveImage(id string) error {
+	_, err := r.Client.ImageRemove(context.Background(), id, image.RemoveOptions{PruneChildren: true})
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"io"
+	"time"
+)
+
+// Exec is an interactive command run in a container on a TTY.
+type Exec struct {
+	Cmd    []string
+	Stdin  io.Reader
+	Output io.Writer           // output of the TTY, stdout and stderr interleaved
+	Resize <-chan TerminalSize // size changes of the client's terminal, closed once it left
+}
+
+// TerminalSize is the size of a terminal in characters.
+type TerminalSize struct {
+	Cols uint16 `json:"cols"`
+	Rows uint16 `json:"rows"`
+}
+
+// resizeAttempts bounds the retries of a resize sent before the exec session's
+// TTY exists.
+const resizeAttempts = 10
+
+// followResizes applies the size changes of the client's terminal to an exec
+// session until the client leaves.
+func followResizes(sizes <-chan TerminalSize, resize func(TerminalSize) error) {
+	for size := range sizes {
+		for range resizeAttempts {
+			if resize(size) == nil {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var ErrInvalidGitSource = errors.New("invalid git source")
+
+// scpLikeGitURL matches the user@host:path form of ssh URLs.
+var scpLikeGitURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9.-]+:[^/-][^:]*$`)
+
+// GitSource is a repository to build from instead of the workspace.
+type GitSource struct {
+	URL       string // https://, ssh:// or user@host:path
+	Ref       string // branch, tag or commit, defaults to the remote HEAD
+	Subdir    string // build context within the repository, defaults to its root
+	DeployKey []byte // private key for ssh URLs, if any
+	Proxy     string // proxy for https URLs, if any
+}
+
+// Validate checks that the source is a remote repository and its ref and
+// subdirectory cannot be mistaken for options or escape the checkout.
+func (src GitSource) Validate() error {
+	if strings.HasPrefix(src.URL, "-") || strings.HasPrefix(src.Ref, "-") {
+		return ErrInvalidGitSource
+	}
+	if !scpLikeGitURL.MatchString(src.URL) {
+		parsed, err := url.Parse(src.URL)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "ssh") {
+			return fmt.Errorf("%w: only https and ssh repositories are supported", ErrInvalidGitSource)
+		}
+	}
+	if src.Subdir != "" {
+		if _, err := WorkspacePath(src.Subdir); err != nil {
+			return fmt.Errorf("%w: subdirectory %s", ErrInvalidGitSource, src.Subdir)
+		}
+	}
+	return nil
+}
+
+// safeGitConfig keeps git from running commands named by a repository's own
+// config: workspace files are written by users, the host runs git.
+var safeGitConfig = []string{"-c", "core.fsmonitor=", "-c", "core.hooksPath=/dev/null", "-c", "protocol.ext.allow=never"}
+
+// gitCommand returns a func running git with the source's proxy and deploy
+// key, and a cleanup func removing the key file. git runs on the repository
+// in gitDir with the work tree dir, or in dir when gitDir is empty.
+func gitCommand(ctx context.Context, gitDir, dir string, src GitSource) (func(args ...string) (string, error), func(), error) {
+	cleanup := func() {}
+	env := append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ALLOW_PROTOCOL=https:ssh",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=advice.detachedHead",
+		"GIT_CONFIG_VALUE_0=false",
+		"GIT_CONFIG_KEY_1=http.proxy",
+		"GIT_CONFIG_VALUE_1="+src.Proxy,
+	)
+	if len(src.DeployKey) > 0 {
+		// the key never lives in the checkout, which may be a build context or
+		// a workspace
+		keyFile, err := os.CreateTemp("", "deploy-key-")
+		if err != nil {
+			return nil, cleanup, err
+		}
+		cleanup = func() { os.Remove(keyFile.Name()) }
+		if _, err := keyFile.Write(src.DeployKey); err != nil {
+			keyFile.Close()
+			cleanup()
+			return nil, func() {}, err
+		}
+		if err := keyFile.Close(); err != nil {
+			cleanup()
+			return nil, func() {}, err
+		}
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new -o BatchMode=yes", keyFile.Name()))
+	}
+
+	git := func(args ...string) (string, error) {
+		global := append(slices.Clip(safeGitConfig), "-C", dir)
+		if gitDir != "" {
+			global = append(slices.Clip(safeGitConfig), "--git-dir="+gitDir, "--work-tree="+dir)
+		}
+		cmd := exec.CommandContext(ctx, "git", append(global, args...)...)
+		cmd.Env = env
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+	return git, cleanup, nil
+}
+
+// CloneGit fetches the ref of the repository into dir, which must be empty,
+// without history. It returns the build context within dir and the commit
+// that was checked out.
+func CloneGit(ctx context.Context, src GitSource, dir string) (string, string, error) {
+	if err := src.Validate(); err != nil {
+		return "", "", err
+	}
+
+	git, cleanup, err := gitCommand(ctx, "", dir, src)
+	if err != nil {
+		return "", "", err
+	}
+	defer cleanup()
+
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := git("init", "--quiet"); err != nil {
+		return "", "", err
+	}
+	if _, err := git("fetch", "--depth", "1", "--no-tags", "--", src.URL, ref); err != nil {
+		return "", "", err
+	}
+	if _, err := git("checkout", "--quiet", "FETCH_HEAD"); err != nil {
+		return "", "", err
+	}
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+
+	// the build context is the checkout, not the repository
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		return "", "", err
+	}
+
+	contextDir := dir
+	if src.Subdir != "" {
+		subdir, _ := WorkspacePath(src.Subdir)
+		root, err := os.OpenRoot(dir)
+		if err != nil {
+			return "", "", err
+		}
+		defer root.Close()
+		// a symlinked subdirectory must not lead out of the checkout
+		if info, err := root.Stat(subdir); err != nil || !info.IsDir() {
+			return "", "", fmt.Errorf("%w: no directory %s at %s", ErrInvalidGitSource, src.Subdir, commit)
+		}
+		contextDir = filepath.Join(dir, subdir)
+	}
+	return contextDir, commit, nil
+}
+
+var (
+	ErrGitWorkspace   = errors.New("workspace already is a git checkout")
+	ErrNoGitWorkspace = errors.New("workspace is not a git checkout")
+)
+
+// workspaceExcludes keeps captured logs out of a workspace checkout's status.
+const workspaceExcludes = "stdout-*.log\nstderr-*.log\nbuild-*.log\n"
+
+// WorkspaceRepo is the repository a workspace was cloned from.
+type WorkspaceRepo struct {
+	URL       string   `json:"url"`
+	Ref       string   `json:"ref"`        // empty follows the remote HEAD
+	DeployKey string   `json:"deploy_key"` // secret holding the deploy key, if any
+	Commit    string   `json:"commit"`     // checked-out commit, suffixed -dirty with local changes
+	Trigger   []string `json:"trigger"`    // repository webhook events that pull and run the workspace
+	// TriggerSecret names the secret the repository webhook of the triggers
+	// is signed with.
+	TriggerSecret string `json:"trigger_secret"`
+}
+
+// The repository of a workspace lives in a git directory of its own, outside
+// the workspace dir: users write the workspace, and a config or hook written
+// there would run on the host. The maestro.* keys of its config hold the
+// settings of WorkspaceRepo.
+
+// CloneWorkspace checks out the ref of the repository into the workspace dir,
+// keeping the repository in gitDir so the workspace can be pulled later.
+// Existing files are kept and the clone fails rather than overwriting one.
+// keySecret names the secret src.DeployKey came from and is recorded for
+// pulls.
+func CloneWorkspace(ctx context.Context, src GitSource, keySecret, gitDir, dir string) (string, error) {
+	if err := src.Validate(); err != nil {
+		return "", err
+	}
+	if src.Subdir != "" {
+		return "", fmt.Errorf("%w: workspaces are cloned whole", ErrInvalidGitSource)
+	}
+	if _, err := os.Lstat(gitDir); err == nil {
+		return "", ErrGitWorkspace
+	}
+
+	git, cleanup, err := gitCommand(ctx, gitDir, dir, src)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	commit, err := func() (string, error) {
+		if err := initWorkspaceRepo(git, gitDir, map[string]string{"remote.origin.url": src.URL, "maestro.ref": src.Ref, "maestro.deployKey": keySecret}); err != nil {
+			return "", err
+		}
+		return checkoutRemote(git, src.Ref)
+	}()
+	if err != nil {
+		// leave the workspace as it was
+		os.RemoveAll(gitDir)
+		return "", err
+	}
+	return commit, nil
+}
+
+// initWorkspaceRepo creates the repository of a workspace in gitDir with the
+// config settings.
+func initWorkspaceRepo(git func(args ...string) (string, error), gitDir string, settings map[string]string) error {
+	if _, err := git("init", "--quiet"); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(gitDir, "info"), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(gitDir, "info", "exclude"), []byte(workspaceExcludes), 0644); err != nil {
+		return err
+	}
+	for key, value := range settings {
+		if _, err := git("config", key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workspaceRepoKeys are the config keys MoveWorkspaceRepo carries over.
+var workspaceRepoKeys = []string{"remote.origin.url", "maestro.ref", "maestro.deployKey", "maestro.trigger", "maestro.triggerSecret"}
+
+// MoveWorkspaceRepo moves the repository of a workspace cloned before
+// repositories were kept apart, from dir/.git to gitDir. Only the settings
+// maestro wrote to its config and only its objects, refs and checked-out
+// commit are taken over; anything else may have been written by users. It
+// reports whether there was a repository to move.
+func MoveWorkspaceRepo(ctx context.Context, gitDir, dir string) (bool, error) {
+	legacy := filepath.Join(dir, ".git")
+	if info, err := os.Lstat(legacy); err != nil || !info.IsDir() {
+		return false, nil
+	}
+	if _, err := os.Lstat(gitDir); err == nil {
+		return false, ErrGitWorkspace
+	}
+
+	git, cleanup, err := gitCommand(ctx, gitDir, dir, GitSource{})
+	if err != nil {
+		return false, err
+	}
+	defer cleanup()
+
+	old, err := os.OpenRoot(legacy)
+	if err != nil {
+		return false, err
+	}
+	defer old.Close()
+
+	settings := map[string]string{}
+	for _, key := range workspaceRepoKeys {
+		// a config given as a file is read without its includes; unset keys
+		// make git config fail, they are empty
+		settings[key], _ = git("config", "--file", filepath.Join(legacy, "config"), "--get", key)
+	}
+	head, err := old.ReadFile("HEAD")
+	if err != nil {
+		return false, err
+	}
+
+	err = func() error {
+		if err := initWorkspaceRepo(git, gitDir, settings); err != nil {
+			return err
+		}
+		for _, name := range []string{"objects", "refs"} {
+			from, err := fs.Sub(old.FS(), name)
+			if err != nil {
+				return err
+			}
+			if err := os.CopyFS(filepath.Join(gitDir, name), from); err != nil {
+				return err
+			}
+		}
+		// alternates would read objects from anywhere on the host
+		if err := os.RemoveAll(filepath.Join(gitDir, "objects", "info")); err != nil {
+			return err
+		}
+		// workspace checkouts are detached at a commit
+		if _, err := git("update-ref", "--no-deref", "HEAD", strings.TrimSpace(string(head))); err != nil {
+			return err
+		}
+		_, err := git("read-tree", "HEAD")
+		return err
+	}()
+	if err != nil {
+		os.RemoveAll(gitDir)
+		return false, err
+	}
+	return true, os.RemoveAll(legacy)
+}
+
+// PullWorkspace checks out the latest commit of the ref the workspace was
+// cloned from. Local changes are kept unless the new commit touches the same
+// files, in which case the pull fails.
+func PullWorkspace(ctx context.Context, src GitSource, gitDir, dir string) (string, error) {
+	if _, err := os.Lstat(gitDir); err != nil {
+		return "", ErrNoGitWorkspace
+	}
+
+	git, cleanup, err := gitCommand(ctx, gitDir, dir, src)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	return checkoutRemote(git, src.Ref)
+}
+
+// checkoutRemote fetches the ref of the origin remote without history and
+// checks it out, returning the commit.
+func checkoutRemote(git func(args ...string) (string, error), ref string) (string, error) {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := git("fetch", "--depth", "1", "--no-tags", "origin", "--", ref); err != nil {
+		return "", err
+	}
+	if _, err := git("checkout", "--quiet", "--detach", "FETCH_HEAD"); err != nil {
+		return "", err
+	}
+	return git("rev-parse", "HEAD")
+}
+
+// ReadWorkspaceRepo returns the repository the workspace dir was cloned from
+// and the commit it has checked out.
+func ReadWorkspaceRepo(ctx context.Context, gitDir, dir string) (*WorkspaceRepo, error) {
+	if _, err := os.Lstat(gitDir); err != nil {
+		return nil, ErrNoGitWorkspace
+	}
+
+	git, cleanup, err := gitCommand(ctx, gitDir, dir, GitSource{})
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var repo WorkspaceRepo
+	if repo.URL, err = git("config", "--get", "remote.origin.url"); err != nil {
+		return nil, err
+	}
+	// unset keys make git config fail, they are empty
+	repo.Ref, _ = git("config", "--get", "maestro.ref")
+	repo.DeployKey, _ = git("config", "--get", "maestro.deployKey")
+	repo.Trigger = []string{}
+	if trigger, _ := git("config", "--get", "maestro.trigger"); trigger != "" {
+		repo.Trigger = strings.Split(trigger, ",")
+	}
+	repo.TriggerSecret, _ = git("config", "--get", "maestro.triggerSecret")
+	repo.Commit = WorkspaceCommit(ctx, gitDir, dir)
+	return &repo, nil
+}
+
+// SetWorkspaceTrigger records the repository webhook events that pull and run
+// the workspace dir, none if empty, and the name of the secret the webhook is
+// signed with.
+func SetWorkspaceTrigger(ctx context.Context, gitDir, dir string, events []string, secret string) error {
+	if _, err := os.Lstat(gitDir); err != nil {
+		return ErrNoGitWorkspace
+	}
+
+	git, cleanup, err := gitCommand(ctx, gitDir, dir, GitSource{})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := git("config", "maestro.trigger", strings.Join(events, ",")); err != nil {
+		return err
+	}
+	_, err = git("config", "maestro.triggerSecret", secret)
+	return err
+}
+
+// WorkspaceCommit returns the commit checked out in the workspace dir,
+// suffixed -dirty when files differ from it, or empty when the workspace is
+// not a git checkout.
+func WorkspaceCommit(ctx context.Context, gitDir, dir string) string {
+	if _, err := os.Lstat(gitDir); err != nil {
+		return ""
+	}
+
+	git, cleanup, err := gitCommand(ctx, gitDir, dir, GitSource{})
+	if err != nil {
+		return ""
+	}
+	defer cleanup()
+
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return ""
+	}
+	if status, err := git("status", "--porcelain"); err != nil || status != "" {
+		commit += "-dirty"
+	}
+	return commit
+}
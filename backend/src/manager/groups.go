@@ -0,0 +1,81 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+)
+
+var ErrGroupNotFound = errors.New("server group not found")
+
+// ServerGroup is a named set of servers runs can target instead of a single
+// server.
+type ServerGroup struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// SetGroup creates or replaces a server group. Every member must be a known
+// server.
+func (sm *ServiceManager) SetGroup(name string, members []string) error {
+	for _, member := range members {
+		if !sm.Connections.Exists(member) {
+			return fmt.Errorf("server %s not found", member)
+		}
+	}
+
+	members = slices.Clone(members)
+	slices.Sort(members)
+	sm.Groups.Store(name, &ServerGroup{Name: name, Members: slices.Compact(members)})
+	return nil
+}
+
+// GroupList returns all server groups sorted by name.
+func (sm *ServiceManager) GroupList() []*ServerGroup {
+	groups := append([]*ServerGroup{}, sm.Groups.Values()...)
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+func groupsPath(stateDir string) string {
+	return filepath.Join(stateDir, "groups.json")
+}
+
+// LoadGroups restores the server groups saved in stateDir. It reports false if
+// no groups were saved yet.
+func (sm *ServiceManager) LoadGroups(stateDir string) (bool, error) {
+	raw, err := os.ReadFile(groupsPath(stateDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var groups []*ServerGroup
+	if err := json.Unmarshal(raw, &groups); err != nil {
+		return false, err
+	}
+	for _, group := range groups {
+		sm.Groups.Store(group.Name, group)
+	}
+	return true, nil
+}
+
+// SaveGroups persists the server groups to stateDir.
+func (sm *ServiceManager) SaveGroups(stateDir string) error {
+	raw, err := json.Marshal(sm.GroupList())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(groupsPath(stateDir), raw, 0600)
+}
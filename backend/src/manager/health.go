@@ -0,0 +1,146 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ServerStatus string
+
+const (
+	ServerOnline   ServerStatus = "online"
+	ServerDegraded ServerStatus = "degraded"
+	ServerOffline  ServerStatus = "offline"
+)
+
+// offlineAfter is the number of consecutive failed health checks after which a
+// server is considered offline rather than degraded.
+const offlineAfter = 3
+
+// HealthReport is the result of a deep health check of a server.
+type HealthReport struct {
+	Server              string        `json:"server"`
+	Status              ServerStatus  `json:"status"`
+	PodmanVersion       string        `json:"podmanVersion,omitempty"`
+	Latency             time.Duration `json:"latencyNs"`
+	DiskAvailable       string        `json:"diskAvailable,omitempty"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	Error               string        `json:"error,omitempty"`
+	CheckedAt           time.Time     `json:"checkedAt"`
+}
+
+// CheckHealth pings the Podman connection, measures its latency, reads the
+// free space of the Podman storage over SSH, and records the outcome in the
+// server's status.
+func (cm *ConnectionManager) CheckHealth() HealthReport {
+	report := HealthReport{Server: cm.Server.Name, CheckedAt: time.Now()}
+
+	err := cm.probe(&report)
+
+	cm.Mu.Lock()
+	if err != nil {
+		cm.Server.ConsecutiveFailures++
+		cm.Server.Status = ServerDegraded
+		if cm.Server.ConsecutiveFailures >= offlineAfter {
+			cm.Server.Status = ServerOffline
+		}
+		report.Error = err.Error()
+	} else {
+		cm.Server.ConsecutiveFailures = 0
+		cm.Server.Status = ServerOnline
+	}
+	report.Status = cm.Server.Status
+	report.ConsecutiveFailures = cm.Server.ConsecutiveFailures
+	cm.Mu.Unlock()
+
+	return report
+}
+
+// Status returns the status of the server recorded by its last health check.
+func (cm *ConnectionManager) Status() ServerStatus {
+	cm.Mu.RLock()
+	defer cm.Mu.RUnlock()
+	return cm.Server.Status
+}
+
+// Info returns a copy of the server's info, read under the lock health checks
+// update it with.
+func (cm *ConnectionManager) Info() ServerInfo {
+	cm.Mu.RLock()
+	defer cm.Mu.RUnlock()
+	return cm.Server
+}
+
+func (cm *ConnectionManager) probe(report *HealthReport) error {
+	start := time.Now()
+	info, err := cm.Runtime.Info()
+	if err != nil {
+		return fmt.Errorf("%s unreachable: %v", cm.Runtime.Engine(), err)
+	}
+	report.Latency = time.Since(start)
+	report.PodmanVersion = info.Version
+
+	// the disk of a tcp:// server cannot be checked
+	available, err := cm.diskAvailable(info.StorageRoot)
+	if errors.Is(err, ErrNoShell) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("disk check failed: %v", err)
+	}
+	report.DiskAvailable = fmt.Sprintf("%.2fGiB", float64(available)/1024/1024/1024)
+
+	return nil
+}
+
+// SystemInfo is what a server's engine reports about itself and its host,
+// along with the free space of its storage.
+type SystemInfo struct {
+	Server string `json:"server"`
+	*EngineInfo
+	DiskAvailable string `json:"diskAvailable,omitempty"` // empty if the server has no shell to check it
+	PoolInFlight  []int  `json:"poolInFlight,omitempty"`  // Podman calls in flight per pooled connection
+}
+
+// SystemInfo reads the engine and host details of the server.
+func (cm *ConnectionManager) SystemInfo() (*SystemInfo, error) {
+	info, err := cm.Runtime.Info()
+	if err != nil {
+		return nil, fmt.Errorf("%s unreachable: %v", cm.Runtime.Engine(), err)
+	}
+
+	system := &SystemInfo{Server: cm.Server.Name, EngineInfo: info}
+	if podman, ok := cm.Runtime.(*PodmanRuntime); ok && podman.Pool != nil {
+		system.PoolInFlight = podman.Pool.InFlight()
+	}
+	available, err := cm.diskAvailable(info.StorageRoot)
+	switch {
+	case errors.Is(err, ErrNoShell):
+	case err != nil:
+		return nil, fmt.Errorf("disk check failed: %v", err)
+	default:
+		system.DiskAvailable = fmt.Sprintf("%.2fGiB", float64(available)/1024/1024/1024)
+	}
+	return system, nil
+}
+
+// diskAvailable returns the free bytes of the filesystem holding path on the
+// server.
+func (cm *ConnectionManager) diskAvailable(path string) (uint64, error) {
+	out, err := cm.Shell(fmt.Sprintf("df -B1 --output=avail %s | tail -n 1", shellQuote(path)))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseUint(strings.TrimSpace(out), 10, 64)
+}
+
+// shellQuote quotes s as a single word for a POSIX shell: single quotes keep
+// every character literal, and a single quote itself ends the quoting, is
+// escaped and starts it again.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,39 @@
+package manager
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "/var/lib/containers", `'/var/lib/containers'`},
+		{"empty", "", `''`},
+		{"spaces", "/mnt/my disk", `'/mnt/my disk'`},
+		{"single quote", "/mnt/it's", `'/mnt/it'\''s'`},
+		{"expansions", "/mnt/$HOME/`id`/$(id)", "'/mnt/$HOME/`id`/$(id)'"},
+		{"backslashes and double quotes", `/mnt/a\\"b`, `'/mnt/a\\"b'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shellQuote(tt.in)
+			if got != tt.want {
+				t.Fatalf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+			}
+			if _, err := exec.LookPath("sh"); err != nil {
+				return
+			}
+			out, err := exec.Command("sh", "-c", "printf %s "+got).Output()
+			if err != nil {
+				t.Fatalf("sh: %v", err)
+			}
+			if string(out) != tt.in {
+				t.Fatalf("sh read %s as %q, want %q", got, out, tt.in)
+			}
+		})
+	}
+}
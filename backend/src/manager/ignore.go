@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strings"
+)
+
+// MaestroIgnoreFile lists build context exclusions on top of the
+// .containerignore or .dockerignore Podman reads.
+const MaestroIgnoreFile = ".maestroignore"
+
+// defaultExcludes keeps captured logs out of every build context.
+var defaultExcludes = []string{"stdout-*.log", "stderr-*.log", "build-*.log"}
+
+// BuildExcludes returns the patterns excluded from the build context in
+// contextDir: captured logs, then the patterns of .containerignore (or
+// .dockerignore) and of .maestroignore, so a later `!` pattern brings back
+// what an earlier one excluded.
+func BuildExcludes(contextDir string) ([]string, error) {
+	root, err := os.OpenRoot(contextDir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	excludes := append([]string(nil), defaultExcludes...)
+	for _, files := range [][]string{{".containerignore", ".dockerignore"}, {MaestroIgnoreFile}} {
+		for _, name := range files {
+			patterns, err := readIgnoreFile(root, name)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			excludes = append(excludes, patterns...)
+			break
+		}
+	}
+	return excludes, nil
+}
+
+// readIgnoreFile returns the patterns of an ignore file, without blank lines
+// and comments.
+func readIgnoreFile(root *os.Root, name string) ([]string, error) {
+	file, err := root.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var patterns []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
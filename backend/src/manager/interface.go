@@ -5,40 +5,110 @@ import (
 	"io"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
+// Status is the state of a run, see Transition for how it moves between them.
 type Status string
 
 const (
-	Running  Status = "running"
-	Finished Status = "Finished"
-	Stopped  Status = "stopped"
-	Waiting  Status = "waiting"
-	Error    Status = "error"
+	Queued    Status = "queued"    // accepted, waiting for its server to start it
+	Building  Status = "building"  // its image is built or pulled
+	Starting  Status = "starting"  // its container is created and starting
+	Running   Status = "running"   // its container runs
+	Paused    Status = "paused"    // its container is frozen
+	Exited    Status = "exited"    // its container exited with code 0
+	Failed    Status = "failed"    // its container exited with another code or ran out of memory
+	TimedOut  Status = "timed_out" // its container was stopped for running past its timeout
+	Cancelled Status = "cancelled" // it was stopped or taken out of the queue
+	Error     Status = "error"     // maestro failed to build, create, start or attach to it
 )
 
 type ServerInfo = struct {
 	Name         string `json:"name"`
+	Engine       string `yaml:"engine" json:"engine,omitempty"` // podman (the default), docker or kubernetes
+	URI          string `yaml:"uri" json:"-"`                   // unix://, tcp:// or ssh:// engine URI, instead of the fields below
 	Username     string `yaml:"username" json:"-"`
 	Host         string `yaml:"host" json:"-"`
 	Port         int    `yaml:"port" json:"-"`
 	PodmanSocket string `yaml:"podmanSocket" json:"-"`
 	SshClient    string `yaml:"sshClient" json:"-"`
 	IdentityFile string `yaml:"identityFile" json:"-"`
-	RemoteDir    string `yaml:"remoteDir" json:"-"`
+	// IdentityPassphraseSecret names the secret holding the passphrase of a
+	// passphrase-protected identity file.
+	IdentityPassphraseSecret string `yaml:"identityPassphraseSecret" json:"-"`
+	KnownHostsFile           string `yaml:"knownHostsFile" json:"-"`        // host keys the server's is checked against, ~/.ssh/known_hosts if empty
+	InsecureIgnoreHostKey    bool   `yaml:"insecureIgnoreHostKey" json:"-"` // skip the host key check
+	PoolSize                 int    `yaml:"poolSize" json:"-"`              // Podman connections calls are spread over, DefaultPoolSize if 0
+	RemoteDir                string `yaml:"remoteDir" json:"-"`
+	Kubeconfig               string `yaml:"kubeconfig" json:"-"` // kubeconfig of a kubernetes server, empty for the cluster maestro runs in
+	Namespace                string `yaml:"namespace" json:"-"`  // namespace a kubernetes server runs Jobs in, default if empty
+
+	Defaults RunDefaults       `yaml:"defaults" json:"-"`
+	Capacity Resources         `yaml:"capacity" json:"capacity"` // what runs may reserve, zero fields are unlimited
+	Labels   map[string]string `yaml:"labels" json:"labels"`     // matched by the placement constraints of runs
+
 	MemTotal     string `json:"memTotal"`
 	MemAvailable string `json:"memAvailable"`
+	Platform     string `json:"platform"` // os/arch images are built for by default
+
+	Status              ServerStatus `json:"status"`
+	ConsecutiveFailures int          `json:"consecutiveFailures"`
+	Maintenance         string       `yaml:"-" json:"maintenance,omitempty"` // draining or maintenance, empty while in service
 }
 
 type ContainerManager struct {
 	ID         string     `json:"id"`
+	RunID      string     `json:"run_id"`
 	Name       string     `json:"name"`
 	Status     Status     `json:"status"`
 	CreatedAt  time.Time  `json:"created_at"`
 	FinishedAt *time.Time `json:"finished_at"`
+	ExitCode   *int       `json:"exit_code"`
+	OOMKilled  bool       `json:"oom_killed"`
+
+	// Restarts counts the restarts of the container, the last at
+	// RestartedAt.
+	Restarts    int        `json:"restarts"`
+	RestartedAt *time.Time `json:"restarted_at"`
+
+	// StdinAttached is set while a client is attached to the input of an
+	// interactive run.
+	StdinAttached bool `json:"stdin_attached"`
+
+	Usage ResourceUsage `json:"usage"`
+
+	// ArchivedAt is set while the run's logs live in the archive at
+	// ArchivePath instead of the workspace.
+	ArchivedAt   *time.Time `json:"archived_at"`
+	ArchivePath  string     `json:"-"`
+	RehydratedAt *time.Time `json:"rehydrated_at"`
+
+	// workspace file names of the run's captured logs
+	StdoutLog string `json:"stdout_log"`
+	StderrLog string `json:"stderr_log"`
+	BuildLog  string `json:"build_log"`
+
+	Commit string `json:"commit"` // commit the run's image was built from, if any
+
+	// Artifacts is the workspace directory the run's outputs were collected
+	// into, set once they were.
+	Artifacts string `json:"artifacts"`
+
+	// RemovedAt is set once the exited container was removed from its
+	// server.
+	RemovedAt *time.Time `json:"removed_at"`
+
+	Options RunOptions `json:"-"` // resolved options the run was created with
+
+	Activity *Activity `json:"-"`
+
+	// Captured is how far the run's output was captured into its logs, set
+	// once the capture started.
+	Captured *LogCursor `json:"-"`
 
 	Stdin  io.Reader `json:"-"`
 	Stdout *os.File  `json:"-"`
@@ -48,20 +118,54 @@ type ContainerManager struct {
 }
 
 type ImageManager struct {
-	ID         *string            `json:"id"`
-	Name       string             `json:"name"`
-	FilesDir   string             `json:"-"`
-	Connection *ConnectionManager `json:"connection"`
-	Container  *ContainerManager  `json:"container"`
+	ID         *string             `json:"id"`
+	Name       string              `json:"name"`
+	Owner      string              `json:"owner"` // user that created the workspace, empty if unknown
+	FilesDir   string              `json:"-"`
+	GitDir     string              `json:"-"` // repository of a workspace cloned from git, kept outside FilesDir
+	Connection *ConnectionManager  `json:"connection"`
+	Container  *ContainerManager   `json:"container"`
+	Pending    []*ContainerManager `json:"pending"` // runs building or queued, oldest first
+	Runs       []*ContainerManager `json:"-"`       // finished runs, oldest first
+	Quarantine *QuarantineInfo     `json:"quarantine"`
+	Snapshot   string              `json:"snapshot"` // snapshot the image was built from, empty for the workspace
+	Prebuilt   string              `json:"prebuilt"` // prebuilt image reference run instead of a build, if any
+
+	Containerfile string `json:"containerfile"` // Containerfile the image was built from, empty for the default
+	Git           string `json:"git"`           // repository@commit the image was built from, if any
+	Commit        string `json:"commit"`        // commit of the checkout the image was built from, if any
+	Target        string `json:"target"`        // Containerfile stage the image was built from, empty for the last
+
+	Labels map[string]string `json:"labels"` // labels the build added to the image
+
+	Platforms map[string]string `json:"platforms"` // image ID or digest per platform of a cross-platform build
+	Manifest  string            `json:"manifest"`  // manifest list of a multi-platform build
+
+	ServerImages map[string]string `json:"server_images"` // image ID per server the last build made one on
+
+	ProtectedFiles []string `json:"protected_files"` // files only admins may change
+
+	Disk DiskUsage `json:"disk"`
+
+	// PersistRun, if set, saves a run once it enters the run history and
+	// whenever it is archived or rehydrated, so it outlives maxRunHistory. It
+	// is called with Mu held.
+	PersistRun func(image string, run *ContainerManager) `json:"-"`
+
+	buildLog atomic.Pointer[BuildLog]
 
 	Mu sync.RWMutex `json:"-"`
 }
 
 type ConnectionManager struct {
-	Conn       context.Context    `json:"-"`
-	SshConn    *ssh.Client        `json:"-"`
-	Server     ServerInfo         `json:"server"`
-	ImageQueue chan *ImageManager `json:"-"`
+	Runtime  Runtime         `json:"-"`
+	Conn     context.Context `json:"-"` // Podman connection, for Podman-only features
+	SshConn  *ssh.Client     `json:"-"`
+	Server   ServerInfo      `json:"server"`
+	RunQueue *RunQueue       `json:"-"`
+	Secrets  *SecretStore    `json:"-"` // holds the passphrase of the server's identity file
+
+	activities []*Activity
 
 	Mu sync.RWMutex `json:"-"`
 }
@@ -69,6 +173,13 @@ type ConnectionManager struct {
 type ServiceManager struct {
 	Connections SafeMap[string, *ConnectionManager] `json:"connections"`
 	Images      SafeMap[string, *ImageManager]      `json:"images"`
+	Groups      SafeMap[string, *ServerGroup]       `json:"-"`
+	Operations  SafeMap[string, *Operation]         `json:"-"` // running and failed operations
+	Events      EventBus                            `json:"-"`
+	Retention   RetentionConfig                     `json:"-"` // which exited containers FinishRun removes
+	Registry    RegistryConfig                      `json:"-"` // where builds run on Kubernetes servers are pushed
+
+	placements placementLog
 
 	Mu sync.RWMutex
 }
@@ -0,0 +1,465 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// managedByLabel marks the Jobs maestro created, so events of other workloads
+// in the namespace are ignored.
+const managedByLabel = "app.kubernetes.io/managed-by=maestro"
+
+// kubernetesPollInterval is how often a Job is checked while waiting for its
+// pod to start.
+const kubernetesPollInterval = time.Second
+
+var invalidJobName = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// KubernetesRuntime runs containers as Kubernetes Jobs of a single pod. The
+// cluster pulls images from their registry, so runs use prebuilt or pushed
+// images; builds, bind mounts and file copies are not supported.
+type KubernetesRuntime struct {
+	Client    kubernetes.Interface
+	Namespace string
+
+	// reported holds the pods whose exit was reported. It outlives a watch,
+	// as a new one lists the exited pods again.
+	reportedMu sync.Mutex
+	reported   map[types.UID]bool
+}
+
+// NewKubernetesRuntime connects to the cluster of the server's kubeconfig, or
+// to the cluster maestro runs in if it has none.
+func NewKubernetesRuntime(server ServerInfo) (*KubernetesRuntime, error) {
+	var restConfig *rest.Config
+	var err error
+	if server.Kubeconfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", server.Kubeconfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, err
+	}
+	restConfig.Timeout = 30 * time.Second
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	namespace := server.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+	return &KubernetesRuntime{Client: client, Namespace: namespace}, nil
+}
+
+func (r *KubernetesRuntime) Engine() string {
+	return EngineKubernetes
+}
+
+// Info reports the cluster's version and the memory and CPUs of its nodes.
+// The platform and host details are those of the first node, the containers
+// are maestro's Jobs.
+func (r *KubernetesRuntime) Info() (*EngineInfo, error) {
+	version, err := r.Client.Discovery().ServerVersion()
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := r.Client.CoreV1().Nodes().List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	info := &EngineInfo{Engine: EngineKubernetes, Version: version.GitVersion}
+	for _, node := range nodes.Items {
+		if info.OS == "" {
+			info.OS = node.Status.NodeInfo.OperatingSystem
+			info.Arch = node.Status.NodeInfo.Architecture
+			info.Distribution = node.Status.NodeInfo.OSImage
+			info.Kernel = node.Status.NodeInfo.KernelVersion
+		}
+		info.MemTotal += node.Status.Capacity.Memory().Value()
+		info.CPUs += int(node.Status.Capacity.Cpu().Value())
+	}
+
+	jobs, err := r.Client.BatchV1().Jobs(r.Namespace).List(context.Background(), metav1.ListOptions{LabelSelector: managedByLabel})
+	if err != nil {
+		return nil, err
+	}
+	info.Containers = len(jobs.Items)
+	return info, nil
+}
+
+// KubernetesRunError reports why a run with the requested options cannot run
+// on the server, nil if it can or the server does not run Kubernetes Jobs.
+// Jobs cannot mount host paths or keep their input open, and Kubernetes has
+// no builder, so runs of the workspace are built on another server and pushed
+// to the registry, which must be configured.
+func KubernetesRunError(server ServerInfo, requested RunOptions, registry RegistryConfig) error {
+	if server.Engine != EngineKubernetes {
+		return nil
+	}
+	switch {
+	case requested.Image == "" && registry.Repository == "":
+		return fmt.Errorf("%w: builds run on Kubernetes are pushed to it, configure one or run a prebuilt image", ErrNoRegistry)
+	case requested.Workspace != nil || len(server.Defaults.Mounts) > 0:
+		return fmt.Errorf("%w: mounts", ErrUnsupported)
+	case requested.Interactive:
+		return fmt.Errorf("%w: interactive runs", ErrUnsupported)
+	}
+	return nil
+}
+
+// BuildServer returns the server images run on Kubernetes are built on, nil if
+// no Podman or Docker server is online: one the last build of the image is
+// left on, or else the first by name.
+func (sm *ServiceManager) BuildServer(im *ImageManager) *ConnectionManager {
+	names := sm.Connections.Keys()
+	slices.Sort(names)
+	var first *ConnectionManager
+	for _, name := range names {
+		cm, exists := sm.Connections.Load(name)
+		if !exists || cm.Server.Engine == EngineKubernetes || cm.Status() != ServerOnline || cm.Maintenance() != "" {
+			continue
+		}
+		if _, built := im.ServerImages[name]; built && im.Prebuilt == "" {
+			return cm
+		}
+		if first == nil {
+			first = cm
+		}
+	}
+	return first
+}
+
+// CreateContainer creates a suspended Job, it starts running once
+// StartContainer resumes it. The Job's name is the container ID.
+func (r *KubernetesRuntime) CreateContainer(spec ContainerSpec) (string, error) {
+	if len(spec.Mounts) > 0 {
+		return "", fmt.Errorf("%w: mounts", ErrUnsupported)
+	}
+	if spec.Interactive {
+		return "", fmt.Errorf("%w: interactive runs", ErrUnsupported)
+	}
+
+	env := make([]corev1.EnvVar, 0, len(spec.Env))
+	for key, value := range spec.Env {
+		env = append(env, corev1.EnvVar{Name: key, Value: value})
+	}
+	labels := map[string]string{"app.kubernetes.io/managed-by": "maestro"}
+	name := strings.Trim(invalidJobName.ReplaceAllString(strings.ToLower(spec.Name), "-"), "-")
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			// the generated suffix keeps runs started in the same second apart
+			GenerateName: name + "-",
+			Labels:       labels,
+			// label values are too restricted for the run's labels
+			Annotations: spec.Labels,
+		},
+		Spec: batchv1.JobSpec{
+			Suspend:      func(a bool) *bool { return &a }(true),
+			BackoffLimit: func(a int32) *int32 { return &a }(0),
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:      "run",
+						Image:     spec.Image,
+						Env:       env,
+						Resources: kubernetesResources(spec.Resources),
+					}},
+				},
+			},
+		},
+	}
+
+	created, err := r.Client.BatchV1().Jobs(r.Namespace).Create(context.Background(), job, metav1.CreateOptions{})
+	if err != nil {
+		return "", err
+	}
+	return created.Name, nil
+}
+
+// kubernetesResources requests and limits the run's resources, GPUs as the
+// NVIDIA device plugin's nvidia.com/gpu.
+func kubernetesResources(r Resources) corev1.ResourceRequirements {
+	limits := corev1.ResourceList{}
+	if r.CPUs > 0 {
+		limits[corev1.ResourceCPU] = *resource.NewMilliQuantity(int64(r.CPUs*1000), resource.DecimalSI)
+	}
+	if r.MemoryMB > 0 {
+		limits[corev1.ResourceMemory] = *resource.NewQuantity(r.MemoryMB*1024*1024, resource.BinarySI)
+	}
+	if r.GPUs > 0 {
+		limits["nvidia.com/gpu"] = *resource.NewQuantity(int64(r.GPUs), resource.DecimalSI)
+	}
+	// without requests of their own, the limits are requested
+	return corev1.ResourceRequirements{Limits: limits}
+}
+
+// ListContainers lists maestro's Jobs, their annotations are the run's
+// labels.
+func (r *KubernetesRuntime) ListContainers() ([]ContainerSummary, error) {
+	jobs, err := r.Client.BatchV1().Jobs(r.Namespace).List(context.Background(), metav1.ListOptions{LabelSelector: managedByLabel})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ContainerSummary, 0, len(jobs.Items))
+	for _, job := range jobs.Items {
+		summary := ContainerSummary{
+			ID:        job.Name,
+			Name:      job.Name,
+			Labels:    job.Annotations,
+			Running:   job.Status.CompletionTime == nil && job.Status.Failed == 0,
+			Exited:    job.Status.CompletionTime != nil || job.Status.Failed > 0,
+			CreatedAt: job.CreationTimestamp.Time,
+		}
+		if containers := job.Spec.Template.Spec.Containers; len(containers) > 0 {
+			summary.ImageID = containers[0].Image
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (r *KubernetesRuntime) StartContainer(id string) error {
+	_, err := r.Client.BatchV1().Jobs(r.Namespace).Patch(context.Background(), id, types.MergePatchType, []byte(`{"spec":{"suspend":false}}`), metav1.PatchOptions{})
+	return err
+}
+
+// StopContainer deletes the Job, which terminates its pod.
+func (r *KubernetesRuntime) StopContainer(id string) error {
+	return r.deleteJob(id, metav1.DeletePropagationForeground)
+}
+
+// RemoveContainer deletes the Job, its pod and the pod's volumes go with it.
+func (r *KubernetesRuntime) RemoveContainer(id string, force, volumes bool) error {
+	return r.deleteJob(id, metav1.DeletePropagationBackground)
+}
+
+func (r *KubernetesRuntime) deleteJob(id string, propagation metav1.DeletionPropagation) error {
+	err := r.Client.BatchV1().Jobs(r.Namespace).Delete(context.Background(), id, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *KubernetesRuntime) PauseContainer(id string) error {
+	return fmt.Errorf("%w: pausing a Job", ErrUnsupported)
+}
+
+func (r *KubernetesRuntime) UnpauseContainer(id string) error {
+	return fmt.Errorf("%w: pausing a Job", ErrUnsupported)
+}
+
+// jobPod returns the pod of a Job, nil if it has none yet.
+func (r *KubernetesRuntime) jobPod(id string) (*corev1.Pod, error) {
+	pods, err := r.Client.CoreV1().Pods(r.Namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: batchv1.JobNameLabel + "=" + id,
+	})
+	if err != nil || len(pods.Items) == 0 {
+		return nil, err
+	}
+	return &pods.Items[0], nil
+}
+
+// terminated returns the terminated state of the run container of a pod, nil
+// while it has not exited.
+func terminated(pod *corev1.Pod) *corev1.ContainerStateTerminated {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == "run" {
+			return status.State.Terminated
+		}
+	}
+	return nil
+}
+
+func (r *KubernetesRuntime) InspectContainer(id string) (*ContainerState, error) {
+	job, err := r.Client.BatchV1().Jobs(r.Namespace).Get(context.Background(), id, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pod, err := r.jobPod(id)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &ContainerState{}
+	if pod != nil {
+		if exit := terminated(pod); exit != nil {
+			state.Exited = true
+			state.ExitCode = int(exit.ExitCode)
+			state.OOMKilled = exit.Reason == "OOMKilled"
+			state.FinishedAt = exit.FinishedAt.Time
+			return state, nil
+		}
+	}
+
+	// a Job that failed before its pod ran, such as on an image pull error
+	// past its deadline, has no exit code
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			state.Exited = true
+			state.ExitCode = 1
+			state.FinishedAt = condition.LastTransitionTime.Time
+		}
+	}
+	return state, nil
+}
+
+func (r *KubernetesRuntime) KillContainer(id, signal string) error {
+	return fmt.Errorf("%w: signaling a Job", ErrUnsupported)
+}
+
+// RestartContainer fails, a Job's pod cannot be restarted.
+func (r *KubernetesRuntime) RestartContainer(id string) error {
+	return fmt.Errorf("%w: restarting a Job", ErrUnsupported)
+}
+
+// WaitContainer checks the Job every kubernetesPollInterval until its pod
+// exited.
+func (r *KubernetesRuntime) WaitContainer(ctx context.Context, id string) (int, error) {
+	for {
+		state, err := r.InspectContainer(id)
+		if err != nil {
+			return 0, err
+		}
+		if state.Exited {
+			return state.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(kubernetesPollInterval):
+		}
+	}
+}
+
+// AttachContainer waits for the Job's pod to start and streams its log. The
+// API merges stdout and stderr, so all output goes to stdout.
+func (r *KubernetesRuntime) AttachContainer(id string, cursor *LogCursor, stdout, stderr io.Writer) error {
+	for {
+		pod, err := r.jobPod(id)
+		if err != nil {
+			return err
+		}
+		if pod != nil && pod.Status.Phase != corev1.PodPending {
+			options := &corev1.PodLogOptions{Container: "run", Follow: true, Timestamps: true}
+			if since := cursor.Since(); !since.IsZero() {
+				// whole seconds only, the cursor drops the lines before it
+				options.SinceTime = &metav1.Time{Time: since}
+			}
+			logs, err := r.Client.CoreV1().Pods(r.Namespace).GetLogs(pod.Name, options).Stream(context.Background())
+			if err != nil {
+				return err
+			}
+			defer logs.Close()
+
+			stdout, _, flush := cursor.Writers(stdout, stderr)
+			defer flush()
+			_, err = io.Copy(stdout, logs)
+			return err
+		}
+		time.Sleep(kubernetesPollInterval)
+	}
+}
+
+func (r *KubernetesRuntime) AttachStdin(id string, stdin io.Reader) error {
+	return fmt.Errorf("%w: attaching to a Job", ErrUnsupported)
+}
+
+func (r *KubernetesRuntime) ExecContainer(id string, exec Exec) (int, error) {
+	return 0, fmt.Errorf("%w: exec into a Job", ErrUnsupported)
+}
+
+func (r *KubernetesRuntime) CopyFromContainer(id, path string, w io.Writer) error {
+	return fmt.Errorf("%w: copying files out of a Job", ErrUnsupported)
+}
+
+// ContainerEvents watches the pods of maestro's Jobs and reports their run
+// containers exiting.
+func (r *KubernetesRuntime) ContainerEvents(handle func(ContainerEvent)) error {
+	watcher, err := r.Client.CoreV1().Pods(r.Namespace).Watch(context.Background(), metav1.ListOptions{LabelSelector: managedByLabel})
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		pod, ok := event.Object.(*corev1.Pod)
+		if !ok {
+			continue
+		}
+		exit := terminated(pod)
+		if !r.reportExit(pod.UID, event.Type == watch.Deleted, exit != nil) {
+			continue
+		}
+
+		id := pod.Labels[batchv1.JobNameLabel]
+		if exit.Reason == "OOMKilled" {
+			handle(ContainerEvent{ID: id, Action: "oom", Time: exit.FinishedAt.Time})
+		}
+		handle(ContainerEvent{ID: id, Action: "died", ExitCode: int(exit.ExitCode), Time: exit.FinishedAt.Time})
+	}
+	return nil
+}
+
+// reportExit reports whether the exit of the pod is to be reported: the pod
+// exited and its exit was not reported yet, by this watch or an earlier one.
+// A pod is updated again after it exited and listed again by every new watch.
+// Deleted pods are forgotten, they are not seen again.
+func (r *KubernetesRuntime) reportExit(uid types.UID, deleted, exited bool) bool {
+	r.reportedMu.Lock()
+	defer r.reportedMu.Unlock()
+
+	if r.reported == nil {
+		r.reported = map[types.UID]bool{}
+	}
+	reported := r.reported[uid]
+	if deleted {
+		delete(r.reported, uid)
+	} else if exited {
+		r.reported[uid] = true
+	}
+	return exited && !reported
+}
+
+func (r *KubernetesRuntime) BuildImage(ctx context.Context, opts ImageBuild) (string, error) {
+	return "", fmt.Errorf("%w: builds, push the image to a registry and run it prebuilt", ErrUnsupported)
+}
+
+// PullImage returns the reference itself as the image ID, the nodes pull the
+// image when a Job runs it.
+func (r *KubernetesRuntime) PullImage(ref string, newer bool) (string, error) {
+	return ref, nil
+}
+
+func (r *KubernetesRuntime) ImageExists(id string) (bool, error) {
+	return true, nil
+}
+
+func (r *KubernetesRuntime) RemoveImage(id string) error {
+	return nil
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestKubernetesRunError(t *testing.T) {
+	kubernetes := ServerInfo{Engine: EngineKubernetes}
+	registry := RegistryConfig{Repository: "registry.example.com/maestro"}
+	tests := []struct {
+		name      string
+		server    ServerInfo
+		requested RunOptions
+		registry  RegistryConfig
+		want      error
+	}{
+		{"podman builds", ServerInfo{Engine: EnginePodman}, RunOptions{}, RegistryConfig{}, nil},
+		{"build pushed to the registry", kubernetes, RunOptions{}, registry, nil},
+		{"build without a registry", kubernetes, RunOptions{}, RegistryConfig{}, ErrNoRegistry},
+		{"prebuilt without a registry", kubernetes, RunOptions{Image: "alpine:3"}, RegistryConfig{}, nil},
+		{"workspace mount", kubernetes, RunOptions{Workspace: &WorkspaceMount{}}, registry, ErrUnsupported},
+		{"interactive", kubernetes, RunOptions{Image: "alpine:3", Interactive: true}, registry, ErrUnsupported},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := KubernetesRunError(tt.server, tt.requested, tt.registry)
+			if tt.want == nil && err != nil {
+				t.Fatalf("KubernetesRunError() = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("KubernetesRunError() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPushedReference(t *testing.T) {
+	const digest = "sha256:4d3c0b4ef1a1b7f0c1b0a2b1e1e4b1f1f1d0c4a5f6e7d8c9b0a1b2c3d4e5f6a7"
+	tests := []struct {
+		name   string
+		ref    string
+		digest string
+		want   string
+	}{
+		{"pinned to the digest", "registry.example.com/maestro/app:latest", digest, "registry.example.com/maestro/app@" + digest},
+		{"no digest reported", "registry.example.com/maestro/app:latest", "", "registry.example.com/maestro/app:latest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PushedReference(tt.ref, tt.digest)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("PushedReference() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := PushedReference("registry.example.com/maestro/app:latest", "not-a-digest"); err == nil {
+		t.Fatal("PushedReference() accepted an invalid digest")
+	}
+}
@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// constraint is a condition on a server label: key=value, key!=value, or a
+// bare key the server must have.
+type constraint struct {
+	key    string
+	value  string
+	negate bool
+	exists bool
+}
+
+func parseConstraint(raw string) (constraint, error) {
+	c := constraint{}
+	switch {
+	case strings.Contains(raw, "!="):
+		c.key, c.value, _ = strings.Cut(raw, "!=")
+		c.negate = true
+	case strings.Contains(raw, "="):
+		c.key, c.value, _ = strings.Cut(raw, "=")
+	default:
+		c.key = raw
+		c.exists = true
+	}
+	c.key = strings.TrimSpace(c.key)
+	c.value = strings.TrimSpace(c.value)
+	if c.key == "" {
+		return c, fmt.Errorf("invalid constraint %q: expected key, key=value or key!=value", raw)
+	}
+	return c, nil
+}
+
+func (c constraint) matches(labels map[string]string) bool {
+	value, exists := labels[c.key]
+	switch {
+	case c.exists:
+		return exists
+	case c.negate:
+		return value != c.value
+	default:
+		return exists && value == c.value
+	}
+}
+
+// ValidateConstraints checks the placement constraints of a run parse.
+func ValidateConstraints(constraints []string) error {
+	for _, raw := range constraints {
+		if _, err := parseConstraint(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Labels returns the labels of the server: the configured ones, and the os,
+// arch and engine the server reported unless configured otherwise.
+func (cm *ConnectionManager) Labels() map[string]string {
+	cm.Mu.RLock()
+	defer cm.Mu.RUnlock()
+
+	labels := map[string]string{"engine": cm.Server.Engine}
+	if labels["engine"] == "" {
+		labels["engine"] = EnginePodman
+	}
+	if os, arch, ok := strings.Cut(cm.Server.Platform, "/"); ok {
+		labels["os"] = os
+		labels["arch"] = arch
+	}
+	maps.Copy(labels, cm.Server.Labels)
+	return labels
+}
+
+// unmatchedConstraint returns the first constraint the server's labels do not
+// satisfy, empty if it satisfies all of them.
+func (cm *ConnectionManager) unmatchedConstraint(constraints []string) string {
+	labels := cm.Labels()
+	for _, raw := range constraints {
+		c, err := parseConstraint(raw)
+		if err != nil || !c.matches(labels) {
+			return raw
+		}
+	}
+	return ""
+}
@@ -0,0 +1,128 @@
+package manager
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// LogCursor is how far the output of a run was captured: the engine's
+// timestamp of the last line captured and how many lines carried it. Engines
+// timestamp lines as they are emitted, so a capture resumed from the cursor
+// neither loses output the engine had not delivered yet nor depends on
+// maestro's clock agreeing with the server's.
+type LogCursor struct {
+	mu    sync.Mutex
+	last  time.Time
+	lines int
+}
+
+// NewLogCursor returns a cursor skipping the output emitted before since, none
+// if since is zero.
+func NewLogCursor(since time.Time) *LogCursor {
+	return &LogCursor{last: since}
+}
+
+// Since returns the time to request output from, zero for all of it. Engines
+// return the lines of that time again; the writers of the cursor drop them.
+func (c *LogCursor) Since() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+// Writers returns writers for one capture of output whose lines are prefixed
+// with the engine's RFC 3339 timestamp and a space, as the log APIs return
+// them with timestamps. They drop the lines the cursor is past, strip the
+// timestamps of the others, write them to stdout and stderr and advance the
+// cursor. flush writes a last line left without a newline and must be called
+// once the capture ended.
+func (c *LogCursor) Writers(stdout, stderr io.Writer) (io.Writer, io.Writer, func()) {
+	c.mu.Lock()
+	capture := &logCapture{cursor: c, since: c.last, skip: c.lines}
+	c.mu.Unlock()
+
+	out := &timestampedWriter{capture: capture, w: stdout}
+	err := &timestampedWriter{capture: capture, w: stderr}
+	return out, err, func() {
+		out.flush()
+		err.flush()
+	}
+}
+
+// logCapture is one capture of a run's output, resumed from since after skip
+// lines of that time.
+type logCapture struct {
+	cursor  *LogCursor
+	since   time.Time
+	skip    int
+	skipped int
+}
+
+// accept reports whether the line emitted at t is past the cursor and
+// advances the cursor over it if so.
+func (l *logCapture) accept(t time.Time) bool {
+	c := l.cursor
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if t.Before(l.since) {
+		return false
+	}
+	if t.Equal(l.since) && l.skipped < l.skip {
+		l.skipped++
+		return false
+	}
+	switch {
+	case t.Equal(c.last):
+		c.lines++
+	case t.After(c.last):
+		c.last, c.lines = t, 1
+	}
+	return true
+}
+
+type timestampedWriter struct {
+	capture *logCapture
+	w       io.Writer
+	partial []byte
+}
+
+func (w *timestampedWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	for {
+		end := bytes.IndexByte(w.partial, '\n')
+		if end < 0 {
+			return len(p), nil
+		}
+		line := w.partial[:end+1]
+		if err := w.writeLine(line); err != nil {
+			return len(p), err
+		}
+		w.partial = w.partial[end+1:]
+	}
+}
+
+func (w *timestampedWriter) flush() {
+	if len(w.partial) > 0 {
+		w.writeLine(w.partial)
+		w.partial = nil
+	}
+}
+
+// writeLine writes the line without its timestamp if the capture accepts it.
+// Lines without a timestamp are written whole.
+func (w *timestampedWriter) writeLine(line []byte) error {
+	stamp, text, found := bytes.Cut(line, []byte(" "))
+	if found {
+		if t, err := time.Parse(time.RFC3339Nano, string(stamp)); err == nil {
+			if !w.capture.accept(t) {
+				return nil
+			}
+			line = text
+		}
+	}
+	_, err := w.w.Write(line)
+	return err
+}
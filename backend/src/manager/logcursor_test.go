@@ -0,0 +1,50 @@
+package manager
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLogCursorResume(t *testing.T) {
+	cursor := NewLogCursor(time.Time{})
+	var out, errs bytes.Buffer
+
+	stdout, stderr, flush := cursor.Writers(&out, &errs)
+	io.WriteString(stdout, "2026-01-02T03:04:05.000000001Z one\n2026-01-02T03:04:05.000000002Z tw")
+	io.WriteString(stdout, "o\n2026-01-02T03:04:05.000000002Z three\n")
+	io.WriteString(stderr, "2026-01-02T03:04:05.000000001Z oops\n")
+	flush()
+
+	want := time.Date(2026, 1, 2, 3, 4, 5, 2, time.UTC)
+	if got := cursor.Since(); !got.Equal(want) {
+		t.Fatalf("Since() = %s, want %s", got, want)
+	}
+
+	// the engine returns the lines of the cursor's time again on resume
+	stdout, _, flush = cursor.Writers(&out, &errs)
+	io.WriteString(stdout, "2026-01-02T03:04:05.000000002Z two\n2026-01-02T03:04:05.000000002Z three\n")
+	io.WriteString(stdout, "2026-01-02T03:04:05.000000002Z four\n2026-01-02T03:04:05.000000003Z five")
+	flush()
+
+	if got, want := out.String(), "one\ntwo\nthree\nfour\nfive"; got != want {
+		t.Fatalf("stdout = %q, want %q", got, want)
+	}
+	if got, want := errs.String(), "oops\n"; got != want {
+		t.Fatalf("stderr = %q, want %q", got, want)
+	}
+}
+
+func TestLogCursorSince(t *testing.T) {
+	cursor := NewLogCursor(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	var out bytes.Buffer
+
+	stdout, _, flush := cursor.Writers(&out, io.Discard)
+	io.WriteString(stdout, "2026-01-02T03:04:04Z before\n2026-01-02T03:04:05Z at\nno timestamp\n2026-01-02T03:04:06Z after\n")
+	flush()
+
+	if got, want := out.String(), "at\nno timestamp\nafter\n"; got != want {
+		t.Fatalf("stdout = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"slices"
+	"time"
+)
+
+// Maintenance states of a server. A draining server takes no new runs and
+// holds its queued ones, it is under maintenance once its running containers
+// exited.
+const (
+	MaintenanceDraining = "draining"
+	MaintenanceActive   = "maintenance"
+)
+
+// Maintenance returns the maintenance state of the server, empty if it is in
+// service.
+func (cm *ConnectionManager) Maintenance() string {
+	cm.Mu.RLock()
+	defer cm.Mu.RUnlock()
+	return cm.Server.Maintenance
+}
+
+// SetMaintenance changes the maintenance state of the server, empty puts it
+// back in service.
+func (cm *ConnectionManager) SetMaintenance(state string) {
+	cm.Mu.Lock()
+	defer cm.Mu.Unlock()
+	cm.Server.Maintenance = state
+}
+
+// WaitMaintenance waits until none of the draining server's containers runs
+// anymore, checking every interval, and puts it under maintenance. It reports
+// false if the server was resumed in the meantime.
+func (sm *ServiceManager) WaitMaintenance(cm *ConnectionManager, interval time.Duration) bool {
+	for len(sm.RunningOn(cm)) > 0 {
+		if cm.Maintenance() != MaintenanceDraining {
+			return false
+		}
+		time.Sleep(interval)
+	}
+
+	cm.Mu.Lock()
+	defer cm.Mu.Unlock()
+	if cm.Server.Maintenance != MaintenanceDraining {
+		return false
+	}
+	cm.Server.Maintenance = MaintenanceActive
+	return true
+}
+
+// SetMaintenance records whether a server is drained or under maintenance, so
+// it stays out of service after a restart.
+func (r *ServerRegistry) SetMaintenance(name string, on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Maintenance = slices.DeleteFunc(r.Maintenance, func(other string) bool { return other == name })
+	if on {
+		r.Maintenance = append(r.Maintenance, name)
+		slices.Sort(r.Maintenance)
+	}
+}
+
+// UnderMaintenance reports whether the server was left under maintenance.
+func (r *ServerRegistry) UnderMaintenance(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Contains(r.Maintenance, name)
+}
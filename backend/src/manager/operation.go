@@ -0,0 +1,415 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrNotCancelable = errors.New("operation cannot be canceled")
+
+type OperationStatus string
+
+const (
+	OperationRunning   OperationStatus = "running"
+	OperationSucceeded OperationStatus = "succeeded"
+	OperationFailed    OperationStatus = "failed"
+	OperationCanceled  OperationStatus = "canceled"
+	OperationCleanedUp OperationStatus = "cleaned_up"
+)
+
+// Kinds of operations, one per background subsystem.
+const (
+	OperationRun             = "run"
+	OperationBuild           = "build"
+	OperationArchive         = "archive"
+	OperationStorageCleanup  = "storage_cleanup"
+	OperationSnapshotRestore = "snapshot_restore"
+	OperationPull            = "pull"
+	OperationTransfer        = "transfer"
+	OperationRestart         = "restart"
+	OperationAdopt           = "adopt"
+)
+
+// maxOperationLogs bounds the log lines kept per operation.
+const maxOperationLogs = 200
+
+type StepStatus string
+
+const (
+	StepPending   StepStatus = "pending"
+	StepRunning   StepStatus = "running"
+	StepSucceeded StepStatus = "succeeded"
+	StepFailed    StepStatus = "failed"
+	StepSkipped   StepStatus = "skipped"
+)
+
+// Steps of a run operation, in order.
+const (
+	StepPlace  = "place"
+	StepBuild  = "build"
+	StepQueue  = "queue"
+	StepCreate = "create"
+	StepStart  = "start"
+	StepAttach = "attach"
+)
+
+// RunSteps are the steps every run goes through.
+var RunSteps = []string{StepPlace, StepBuild, StepQueue, StepCreate, StepStart, StepAttach}
+
+// RestartSteps are the steps of a restart of a run's container.
+var RestartSteps = []string{StepStart, StepAttach}
+
+// AdoptSteps are the steps of adopting an orphaned container.
+var AdoptSteps = []string{StepAttach}
+
+// OperationStep is the state of one step of an operation.
+type OperationStep struct {
+	Name       string     `json:"name"`
+	Status     StepStatus `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// OperationLog is a line of an operation's log.
+type OperationLog struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Operation is a long-running action such as a run, a build or an archival,
+// tracked with its progress and log so every background task can be listed in
+// one place. Multi-step operations are tracked step by step so a failure
+// midway is visible and can be resumed or cleaned up. Every change is passed
+// to the persist func given to NewOperation.
+type Operation struct {
+	ID         string          `json:"id"`
+	Kind       string          `json:"kind"`
+	Image      string          `json:"image"`
+	Owner      string          `json:"owner,omitempty"`  // user that started the operation, empty if maestro did
+	Target     string          `json:"target,omitempty"` // what the operation works on besides the image
+	Server     string          `json:"server,omitempty"` // requested, then selected server
+	Group      string          `json:"group,omitempty"`  // requested server group
+	Status     OperationStatus `json:"status"`
+	Error      string          `json:"error,omitempty"`
+	Result     string          `json:"result,omitempty"` // what the operation produced, such as a pushed image
+	Progress   float64         `json:"progress"`         // 0 to 1
+	Steps      []OperationStep `json:"steps"`
+	Logs       []OperationLog  `json:"logs"`
+	Cancelable bool            `json:"cancelable"`
+	CreatedAt  time.Time       `json:"created_at"`
+	UpdatedAt  time.Time       `json:"updated_at"`
+
+	// what a resume needs to repeat the failed steps
+	ContainerID   string     `json:"container_id,omitempty"`
+	Snapshot      string     `json:"snapshot,omitempty"`
+	Containerfile string     `json:"containerfile,omitempty"`
+	Requested     RunOptions `json:"requested"`
+
+	persist func(*Operation)
+	cancel  func() error
+	mu      sync.Mutex
+}
+
+// NewOperation returns a running operation with all steps pending, started by
+// owner.
+func NewOperation(id, kind, image, owner string, steps []string, persist func(*Operation)) *Operation {
+	now := time.Now()
+	op := &Operation{
+		ID:        id,
+		Kind:      kind,
+		Image:     image,
+		Owner:     owner,
+		Status:    OperationRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+		persist:   persist,
+	}
+	for _, name := range steps {
+		op.Steps = append(op.Steps, OperationStep{Name: name, Status: StepPending})
+	}
+	op.save()
+	return op
+}
+
+// Restore attaches the persist func to an operation loaded from storage.
+func (op *Operation) Restore(persist func(*Operation)) {
+	op.persist = persist
+}
+
+func (op *Operation) save() {
+	op.UpdatedAt = time.Now()
+	if op.persist != nil {
+		op.persist(op)
+	}
+}
+
+func (op *Operation) step(name string) *OperationStep {
+	for i := range op.Steps {
+		if op.Steps[i].Name == name {
+			return &op.Steps[i]
+		}
+	}
+	op.Steps = append(op.Steps, OperationStep{Name: name, Status: StepPending})
+	return &op.Steps[len(op.Steps)-1]
+}
+
+func (op *Operation) set(name string, status StepStatus, err error) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	now := time.Now()
+	step := op.step(name)
+	step.Status = status
+	step.Error = ""
+	switch status {
+	case StepRunning:
+		step.StartedAt = &now
+		step.FinishedAt = nil
+	case StepPending:
+		step.StartedAt = nil
+		step.FinishedAt = nil
+	default:
+		step.FinishedAt = &now
+	}
+
+	switch {
+	case op.Status == OperationCanceled:
+		// steps still finishing after a cancel do not revive the operation
+	case err != nil:
+		step.Error = err.Error()
+		op.Status = OperationFailed
+		op.Error = fmt.Sprintf("%s: %v", name, err)
+	case op.Status != OperationFailed && op.done():
+		op.Status = OperationSucceeded
+	}
+	op.Progress = op.stepProgress()
+	op.save()
+}
+
+// stepProgress is the share of steps that are finished.
+func (op *Operation) stepProgress() float64 {
+	if len(op.Steps) == 0 {
+		return op.Progress
+	}
+	finished := 0
+	for _, step := range op.Steps {
+		if step.Status == StepSucceeded || step.Status == StepSkipped {
+			finished++
+		}
+	}
+	return float64(finished) / float64(len(op.Steps))
+}
+
+// done reports whether every step succeeded or was skipped.
+func (op *Operation) done() bool {
+	for _, step := range op.Steps {
+		if step.Status != StepSucceeded && step.Status != StepSkipped {
+			return false
+		}
+	}
+	return true
+}
+
+// Begin marks a step as running. All step methods are no-ops on a nil
+// operation.
+func (op *Operation) Begin(step string) { op.set(step, StepRunning, nil) }
+
+// Succeed marks a step as succeeded.
+func (op *Operation) Succeed(step string) { op.set(step, StepSucceeded, nil) }
+
+// Skip marks a step as not needed.
+func (op *Operation) Skip(step string) { op.set(step, StepSkipped, nil) }
+
+// Fail marks a step and the operation as failed.
+func (op *Operation) Fail(step string, err error) { op.set(step, StepFailed, err) }
+
+// SetProgress records how much of an operation without steps is done.
+func (op *Operation) SetProgress(done, total int) {
+	if op == nil || total <= 0 {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.Progress = min(float64(done)/float64(total), 1)
+	op.save()
+}
+
+// Logf appends a line to the operation's log, dropping the oldest lines past
+// maxOperationLogs.
+func (op *Operation) Logf(format string, args ...any) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.Logs = append(op.Logs, OperationLog{Time: time.Now(), Message: fmt.Sprintf(format, args...)})
+	if len(op.Logs) > maxOperationLogs {
+		op.Logs = op.Logs[len(op.Logs)-maxOperationLogs:]
+	}
+	op.save()
+}
+
+// Finish ends an operation without steps, as failed if err is not nil.
+func (op *Operation) Finish(err error) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	op.cancel = nil
+	switch {
+	case op.Status == OperationCanceled:
+	case err != nil:
+		op.Status = OperationFailed
+		op.Error = err.Error()
+	default:
+		op.Status = OperationSucceeded
+		op.Progress = 1
+	}
+	op.save()
+}
+
+// SetCancel makes the operation cancelable through cancel, or no longer
+// cancelable when cancel is nil.
+func (op *Operation) SetCancel(cancel func() error) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.cancel = cancel
+}
+
+// Cancel stops a running operation that supports it and marks it canceled.
+func (op *Operation) Cancel() error {
+	op.mu.Lock()
+	cancel := op.cancel
+	running := op.Status == OperationRunning
+	op.mu.Unlock()
+	if !running || cancel == nil {
+		return ErrNotCancelable
+	}
+
+	// the cancel func may update the operation itself
+	if err := cancel(); err != nil {
+		return err
+	}
+
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.cancel = nil
+	op.Status = OperationCanceled
+	op.Logs = append(op.Logs, OperationLog{Time: time.Now(), Message: "canceled"})
+	op.save()
+	return nil
+}
+
+// SetResult records what the operation produced.
+func (op *Operation) SetResult(result string) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.Result = result
+	op.save()
+}
+
+// SetServer records the server the operation runs on.
+func (op *Operation) SetServer(server string) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.Server = server
+	op.save()
+}
+
+// SetContainer records the container created by the operation.
+func (op *Operation) SetContainer(containerID string) {
+	if op == nil {
+		return
+	}
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.ContainerID = containerID
+	op.save()
+}
+
+// FailedStep returns the name of the first failed step, or "" if none failed.
+func (op *Operation) FailedStep() string {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	for _, step := range op.Steps {
+		if step.Status == StepFailed {
+			return step.Name
+		}
+	}
+	return ""
+}
+
+// Retry resets the steps from the given one onwards to pending and marks the
+// operation running again.
+func (op *Operation) Retry(from string) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	reset := false
+	for i := range op.Steps {
+		if op.Steps[i].Name == from {
+			reset = true
+		}
+		if reset {
+			op.Steps[i] = OperationStep{Name: op.Steps[i].Name, Status: StepPending}
+		}
+	}
+	op.Status = OperationRunning
+	op.Error = ""
+	op.Progress = op.stepProgress()
+	op.save()
+}
+
+// MarkCleanedUp records that the leftovers of the failed operation were
+// removed.
+func (op *Operation) MarkCleanedUp() {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	op.Status = OperationCleanedUp
+	op.save()
+}
+
+// Copy returns a copy of the operation safe to serialize while steps change.
+func (op *Operation) Copy() *Operation {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	return &Operation{
+		ID:            op.ID,
+		Kind:          op.Kind,
+		Image:         op.Image,
+		Owner:         op.Owner,
+		Target:        op.Target,
+		Server:        op.Server,
+		Group:         op.Group,
+		Status:        op.Status,
+		Error:         op.Error,
+		Result:        op.Result,
+		Progress:      op.Progress,
+		Steps:         append([]OperationStep(nil), op.Steps...),
+		Logs:          append([]OperationLog(nil), op.Logs...),
+		Cancelable:    op.cancel != nil && op.Status == OperationRunning,
+		CreatedAt:     op.CreatedAt,
+		UpdatedAt:     op.UpdatedAt,
+		ContainerID:   op.ContainerID,
+		Snapshot:      op.Snapshot,
+		Containerfile: op.Containerfile,
+		Requested:     op.Requested,
+	}
+}
@@ -0,0 +1,132 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Labels of the containers maestro creates. They identify a run's container
+// once maestro lost track of it, e.g. after a crash.
+const (
+	LabelImage     = "maestro.image"
+	LabelRun       = "maestro.run"
+	LabelStdoutLog = "maestro.stdout-log"
+	LabelStderrLog = "maestro.stderr-log"
+	LabelOptions   = "maestro.options" // run options as JSON, without the environment
+)
+
+// Policies for orphans, the containers of maestro's found on a server at
+// startup that no image tracks.
+const (
+	OrphansAdopt  = "adopt"  // track them again and capture their output
+	OrphansRemove = "remove" // force-remove them
+	OrphansIgnore = "ignore" // leave them alone
+)
+
+// ValidateOrphanPolicy checks the configured orphan policy, empty means adopt.
+func ValidateOrphanPolicy(policy string) error {
+	switch policy {
+	case "", OrphansAdopt, OrphansRemove, OrphansIgnore:
+		return nil
+	}
+	return fmt.Errorf("unknown orphan policy %s, expected adopt, remove or ignore", policy)
+}
+
+// RunLabels returns the labels of a run's container. The environment is left
+// out, it may hold secrets and labels are readable by anyone on the server.
+func RunLabels(image, runID, stdoutLog, stderrLog string, options RunOptions) map[string]string {
+	options.Env = nil
+	raw, _ := json.Marshal(options)
+	return map[string]string{
+		LabelImage:     image,
+		LabelRun:       runID,
+		LabelStdoutLog: stdoutLog,
+		LabelStderrLog: stderrLog,
+		LabelOptions:   string(raw),
+	}
+}
+
+// Orphans returns the containers of maestro's on the server that are neither
+// the current nor a past run of any image.
+func (sm *ServiceManager) Orphans(cm *ConnectionManager) ([]ContainerSummary, error) {
+	listed, err := cm.Runtime.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	tracked := map[string]bool{}
+	sm.Images.Range(func(_ string, im *ImageManager) bool {
+		im.Mu.RLock()
+		defer im.Mu.RUnlock()
+		for _, run := range im.AllRuns() {
+			tracked[run.ID] = true
+		}
+		return true
+	})
+
+	var orphans []ContainerSummary
+	for _, container := range listed {
+		if !tracked[container.ID] {
+			orphans = append(orphans, container)
+		}
+	}
+	return orphans, nil
+}
+
+// Adopt makes a running orphan on the server the image's current container
+// again and reopens its log files. It returns the time its output should be
+// captured from: the last write to its logs. The caller must hold im.Mu.
+func (im *ImageManager) Adopt(cm *ConnectionManager, orphan ContainerSummary) (*ContainerManager, time.Time, error) {
+	if im.Container != nil && im.Container.Active() {
+		return nil, time.Time{}, fmt.Errorf("image %s already runs container %s", im.Name, im.Container.Name)
+	}
+
+	var options RunOptions
+	if raw := orphan.Labels[LabelOptions]; raw != "" {
+		if err := json.Unmarshal([]byte(raw), &options); err != nil {
+			return nil, time.Time{}, fmt.Errorf("invalid %s label: %v", LabelOptions, err)
+		}
+	}
+	container := &ContainerManager{
+		ID:        orphan.ID,
+		RunID:     orphan.Labels[LabelRun],
+		Name:      orphan.Name,
+		Status:    Running,
+		CreatedAt: orphan.CreatedAt,
+		StdoutLog: orphan.Labels[LabelStdoutLog],
+		StderrLog: orphan.Labels[LabelStderrLog],
+		Options:   options,
+	}
+	if container.RunID == "" {
+		container.RunID = NewRunID()
+	}
+
+	for _, logFile := range []struct {
+		name string
+		file **os.File
+	}{{container.StdoutLog, &container.Stdout}, {container.StderrLog, &container.Stderr}} {
+		// labels can be set by anyone creating containers on the server
+		if logFile.name == "" || filepath.Base(logFile.name) != logFile.name {
+			container.CloseLogs()
+			return nil, time.Time{}, fmt.Errorf("invalid log file name %q", logFile.name)
+		}
+		file, err := os.OpenFile(filepath.Join(im.FilesDir, logFile.name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			container.CloseLogs()
+			return nil, time.Time{}, err
+		}
+		*logFile.file = file
+	}
+
+	if im.ID == nil && orphan.ImageID != "" {
+		id := orphan.ImageID
+		im.ID = &id
+	}
+	im.Connection = cm
+	container.Activity = cm.BeginActivity(RunActivity, im.Name)
+	im.SetContainer(container)
+	return container, im.LastLogWrite(container), nil
+}
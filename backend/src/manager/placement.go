@@ -0,0 +1,197 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrServerNotFound   = errors.New("server not found")
+	ErrNoEligibleServer = errors.New("no eligible server")
+)
+
+// maxPlacementTraces bounds how many placement decisions are remembered.
+const maxPlacementTraces = 500
+
+// PlacementCandidate is a server the scheduler considered for a run.
+type PlacementCandidate struct {
+	Server   string    `json:"server"`
+	Eligible bool      `json:"eligible"`
+	Reason   string    `json:"reason,omitempty"` // why the server was filtered out or not selected
+	Running  int       `json:"running"`
+	Queued   int       `json:"queued"`
+	Reserved Resources `json:"reserved"` // what the server's running containers reserved
+
+	free bool // the server has room for the run right away
+}
+
+// PlacementTrace records how the scheduler chose the server of a run.
+type PlacementTrace struct {
+	RunID       string               `json:"run_id"`
+	Image       string               `json:"image"`
+	Server      string               `json:"server,omitempty"`      // requested server, empty for group runs
+	Group       string               `json:"group,omitempty"`       // requested group
+	Constraints []string             `json:"constraints,omitempty"` // requested label constraints
+	Selected    string               `json:"selected,omitempty"`
+	Error       string               `json:"error,omitempty"`
+	Candidates  []PlacementCandidate `json:"candidates"`
+	DecidedAt   time.Time            `json:"decided_at"`
+}
+
+// placementLog keeps the most recent placement traces by run ID.
+type placementLog struct {
+	mu     sync.Mutex
+	traces map[string]*PlacementTrace
+	order  []string
+}
+
+func (l *placementLog) record(trace *PlacementTrace) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.traces == nil {
+		l.traces = map[string]*PlacementTrace{}
+	}
+	if _, exists := l.traces[trace.RunID]; !exists {
+		l.order = append(l.order, trace.RunID)
+	}
+	l.traces[trace.RunID] = trace
+	if len(l.order) > maxPlacementTraces {
+		delete(l.traces, l.order[0])
+		l.order = l.order[1:]
+	}
+}
+
+// Placement returns the placement trace of a run.
+func (sm *ServiceManager) Placement(runID string) (*PlacementTrace, bool) {
+	sm.placements.mu.Lock()
+	defer sm.placements.mu.Unlock()
+
+	trace, exists := sm.placements.traces[runID]
+	return trace, exists
+}
+
+// Place chooses the server a run of the image goes to, either the requested
+// server or a member of the requested group, and records the decision under
+// the run's ID. A run with label constraints but neither a server nor a group
+// may go to any server. Servers whose labels do not satisfy the constraints,
+// whose capacity is too small for the resources the run needs, or which run
+// Kubernetes Jobs the run cannot be one of, are not eligible. Among eligible
+// servers those with room for the run right away win, then the one with the
+// fewest running containers, preferring the server the image is already
+// built on. The caller must hold im.Mu.
+func (sm *ServiceManager) Place(im *ImageManager, runID, server, group string, requested RunOptions) (*ConnectionManager, *PlacementTrace, error) {
+	need := requested.Resources
+	trace := &PlacementTrace{
+		RunID:       runID,
+		Image:       im.Name,
+		Server:      server,
+		Group:       group,
+		Constraints: requested.Constraints,
+		Candidates:  []PlacementCandidate{},
+		DecidedAt:   time.Now(),
+	}
+	defer sm.placements.record(trace)
+
+	fail := func(err error) (*ConnectionManager, *PlacementTrace, error) {
+		trace.Error = err.Error()
+		return nil, trace, err
+	}
+
+	members := []string{server}
+	if group != "" {
+		serverGroup, exists := sm.Groups.Load(group)
+		if !exists {
+			return fail(ErrGroupNotFound)
+		}
+		members = serverGroup.Members
+	} else if server == "" && len(requested.Constraints) > 0 {
+		members = sm.Connections.Keys()
+		slices.Sort(members)
+	} else if !sm.Connections.Exists(server) {
+		return fail(ErrServerNotFound)
+	}
+
+	running := map[*ConnectionManager]int{}
+	reserved := map[*ConnectionManager]Resources{}
+	sm.Images.Range(func(_ string, other *ImageManager) bool {
+		// im is already locked by the caller
+		if other == im {
+			return true
+		}
+		other.Mu.RLock()
+		defer other.Mu.RUnlock()
+		if other.Container != nil && other.Container.Active() {
+			running[other.Connection]++
+			reserved[other.Connection] = reserved[other.Connection].Add(other.Container.Options.Resources)
+		}
+		return true
+	})
+
+	var best *ConnectionManager
+	bestIndex := -1
+	for _, member := range members {
+		candidate := PlacementCandidate{Server: member}
+		cm, exists := sm.Connections.Load(member)
+		unmatched := ""
+		var unsupported error
+		if exists {
+			unmatched = cm.unmatchedConstraint(requested.Constraints)
+			unsupported = KubernetesRunError(cm.Server, requested, sm.Registry)
+		}
+		switch {
+		case !exists:
+			candidate.Reason = "server is not connected"
+		case cm.Status() == ServerOffline:
+			candidate.Reason = "server is offline"
+		case cm.Maintenance() != "":
+			candidate.Reason = "server is " + cm.Maintenance()
+		case unmatched != "":
+			candidate.Reason = fmt.Sprintf("labels do not satisfy %s", unmatched)
+		case unsupported != nil:
+			candidate.Reason = unsupported.Error()
+		case !cm.Server.Capacity.Fits(Resources{}, need):
+			candidate.Reason = "run needs more resources than the server has"
+		default:
+			candidate.Eligible = true
+			candidate.Running = running[cm]
+			candidate.Queued = cm.RunQueue.Len()
+			candidate.Reserved = reserved[cm]
+			candidate.free = cm.Server.Capacity.Fits(reserved[cm], need)
+		}
+		trace.Candidates = append(trace.Candidates, candidate)
+
+		if !candidate.Eligible {
+			continue
+		}
+		bestFree := bestIndex >= 0 && trace.Candidates[bestIndex].free
+		if best == nil || (candidate.free && !bestFree) ||
+			(candidate.free == bestFree && (running[cm] < running[best] ||
+				(running[cm] == running[best] && cm == im.Connection && im.ID != nil))) {
+			best = cm
+			bestIndex = len(trace.Candidates) - 1
+		}
+	}
+	if best == nil {
+		return fail(ErrNoEligibleServer)
+	}
+
+	trace.Selected = best.Server.Name
+	for i := range trace.Candidates {
+		candidate := &trace.Candidates[i]
+		if !candidate.Eligible || i == bestIndex {
+			continue
+		}
+		if trace.Candidates[bestIndex].free && !candidate.free {
+			candidate.Reason = "not enough free resources until running containers exit"
+		} else if candidate.Running > running[best] {
+			candidate.Reason = fmt.Sprintf("more running containers than %s", best.Server.Name)
+		} else {
+			candidate.Reason = fmt.Sprintf("image is already built on %s", best.Server.Name)
+		}
+	}
+	return best, trace, nil
+}
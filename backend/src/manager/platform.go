@@ -0,0 +1,82 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/containers/podman/v6/pkg/bindings/manifests"
+)
+
+// platformPattern matches os/arch and os/arch/variant, e.g. linux/arm64/v8.
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// Platform is a target OS, architecture and optional variant of a build.
+type Platform struct {
+	OS, Arch, Variant string
+}
+
+func (p Platform) String() string {
+	if p.Variant != "" {
+		return p.OS + "/" + p.Arch + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Arch
+}
+
+// ParsePlatforms parses platforms such as linux/amd64 and linux/arm64,
+// dropping duplicates.
+func ParsePlatforms(names []string) ([]Platform, error) {
+	var platforms []Platform
+	seen := map[string]bool{}
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !platformPattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid platform %s, expected os/arch such as linux/arm64", name)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		parts := append(strings.Split(name, "/"), "")
+		platforms = append(platforms, Platform{OS: parts[0], Arch: parts[1], Variant: parts[2]})
+	}
+	return platforms, nil
+}
+
+// manifestName is the local manifest list a multi-platform build of the image
+// is collected in.
+func manifestName(image string) string {
+	sum := sha256.Sum256([]byte(image))
+	return "localhost/maestro-manifest-" + hex.EncodeToString(sum[:8])
+}
+
+// platformImages maps each platform of a manifest list to its image digest.
+func platformImages(mc *ConnectionManager, manifest string) (map[string]string, error) {
+	conn, err := mc.podmanConn()
+	if err != nil {
+		return nil, err
+	}
+	list, err := manifests.Inspect(conn, manifest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect manifest list %s: %v", manifest, err)
+	}
+	images := map[string]string{}
+	for _, instance := range list.Manifests {
+		platform := Platform{OS: instance.Platform.OS, Arch: instance.Platform.Architecture, Variant: instance.Platform.Variant}
+		images[platform.String()] = instance.Digest.String()
+	}
+	return images, nil
+}
+
+// RunImage is the reference containers of the image are created from: the
+// manifest list of a multi-platform build, from which Podman picks the
+// server's platform, or the built image. Kubernetes servers pull the list as
+// it was pushed.
+func (im *ImageManager) RunImage() string {
+	if im.Manifest != "" && im.Connection.Server.Engine != EngineKubernetes {
+		return im.Manifest
+	}
+	return *im.ID
+}
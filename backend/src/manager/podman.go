@@ -0,0 +1,457 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/buildah/define"
+	"github.com/containers/podman/v6/pkg/api/handlers"
+	"github.com/containers/podman/v6/pkg/bindings"
+	"github.com/containers/podman/v6/pkg/bindings/containers"
+	"github.com/containers/podman/v6/pkg/bindings/images"
+	"github.com/containers/podman/v6/pkg/bindings/system"
+	"github.com/containers/podman/v6/pkg/domain/entities/types"
+	"github.com/containers/podman/v6/pkg/specgen"
+	dockercontainer "github.com/docker/docker/api/types/container"
+)
+
+// PodmanRuntime runs containers through the Podman bindings.
+type PodmanRuntime struct {
+	Conn context.Context // first connection of the pool
+	Pool *ConnPool       // nil while the server is not connected
+}
+
+// checkout returns a connection of the pool for a call, and the function that
+// returns it.
+func (r *PodmanRuntime) checkout() (context.Context, func()) {
+	if r.Pool == nil {
+		return r.Conn, func() {}
+	}
+	return r.Pool.Get()
+}
+
+func (r *PodmanRuntime) Engine() string {
+	return EnginePodman
+}
+
+func (r *PodmanRuntime) Info() (*EngineInfo, error) {
+	conn, release := r.checkout()
+	defer release()
+	info, err := system.Info(conn, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &EngineInfo{
+		Engine:      EnginePodman,
+		Version:     info.Version.Version,
+		OS:          info.Host.OS,
+		Arch:        info.Host.Arch,
+		MemTotal:    info.Host.MemTotal,
+		StorageRoot: info.Store.GraphRoot,
+
+		Distribution:  strings.TrimSpace(info.Host.Distribution.Distribution + " " + info.Host.Distribution.Version),
+		Kernel:        info.Host.Kernel,
+		CPUs:          info.Host.CPUs,
+		StorageDriver: info.Store.GraphDriverName,
+		Images:        info.Store.ImageStore.Number,
+		Containers:    info.Store.ContainerStore.Number,
+	}, nil
+}
+
+func (r *PodmanRuntime) CreateContainer(spec ContainerSpec) (string, error) {
+	conn, release := r.checkout()
+	defer release()
+	created, err := containers.CreateWithSpec(conn, &specgen.SpecGenerator{
+		ContainerBasicConfig: specgen.ContainerBasicConfig{
+			Name:   spec.Name,
+			Env:    spec.Env,
+			Stdin:  func(a bool) *bool { return &a }(spec.Interactive),
+			Labels: spec.Labels,
+		},
+		ContainerStorageConfig: specgen.ContainerStorageConfig{
+			Image:  spec.Image,
+			Mounts: SpecMounts(spec.Mounts),
+		},
+		ContainerResourceConfig: specgen.ContainerResourceConfig{
+			ResourceLimits: specResources(spec.Resources),
+		},
+		ContainerHealthCheckConfig: specgen.ContainerHealthCheckConfig{
+			HealthLogDestination: "/tmp",
+		},
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+func (r *PodmanRuntime) ListContainers() ([]ContainerSummary, error) {
+	conn, release := r.checkout()
+	defer release()
+	listed, err := containers.List(conn, &containers.ListOptions{
+		All:     func(a bool) *bool { return &a }(true),
+		Filters: map[string][]string{"label": {LabelImage}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]ContainerSummary, 0, len(listed))
+	for _, c := range listed {
+		summary := ContainerSummary{
+			ID:        c.ID,
+			ImageID:   c.ImageID,
+			Labels:    c.Labels,
+			Running:   c.State == "running" || c.State == "paused",
+			Exited:    c.Exited,
+			CreatedAt: c.Created,
+		}
+		if len(c.Names) > 0 {
+			summary.Name = c.Names[0]
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+func (r *PodmanRuntime) StartContainer(id string) error {
+	conn, release := r.checkout()
+	defer release()
+	return containers.Start(conn, id, nil)
+}
+
+func (r *PodmanRuntime) StopContainer(id string) error {
+	conn, release := r.checkout()
+	defer release()
+	return containers.Stop(conn, id, &containers.StopOptions{
+		Ignore:  func(a bool) *bool { return &a }(false),
+		Timeout: func(a uint) *uint { return &a }(0),
+	})
+}
+
+func (r *PodmanRuntime) RemoveContainer(id string, force, volumes bool) error {
+	conn, release := r.checkout()
+	defer release()
+	_, err := containers.Remove(conn, id, &containers.RemoveOptions{
+		Ignore:  func(a bool) *bool { return &a }(true),
+		Volumes: func(a bool) *bool { return &a }(volumes),
+		Force:   func(a bool) *bool { return &a }(force),
+		Timeout: func(a uint) *uint { return &a }(0),
+	})
+	return err
+}
+
+func (r *PodmanRuntime) PauseContainer(id string) error {
+	conn, release := r.checkout()
+	defer release()
+	return containers.Pause(conn, id, nil)
+}
+
+func (r *PodmanRuntime) UnpauseContainer(id string) error {
+	conn, release := r.checkout()
+	defer release()
+	return containers.Unpause(conn, id, nil)
+}
+
+func (r *PodmanRuntime) InspectContainer(id string) (*ContainerState, error) {
+	conn, release := r.checkout()
+	defer release()
+	report, err := containers.Inspect(conn, id, &containers.InspectOptions{
+		Size: func(a bool) *bool { return &a }(false),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ContainerState{
+		Exited:     report.State.Status == "exited",
+		ExitCode:   int(report.State.ExitCode),
+		OOMKilled:  report.State.OOMKilled,
+		FinishedAt: report.State.FinishedAt,
+	}, nil
+}
+
+func (r *PodmanRuntime) KillContainer(id, signal string) error {
+	conn, release := r.checkout()
+	defer release()
+	return containers.Kill(conn, id, &containers.KillOptions{Signal: &signal})
+}
+
+func (r *PodmanRuntime) RestartContainer(id string) error {
+	conn, release := r.checkout()
+	defer release()
+	return containers.Restart(conn, id, &containers.RestartOptions{
+		Timeout: func(a int) *int { return &a }(0),
+	})
+}
+
+func (r *PodmanRuntime) WaitContainer(ctx context.Context, id string) (int, error) {
+	conn, release := r.checkout()
+	defer release()
+	// the bindings find the connection in their context
+	conn, cancel := context.WithCancel(conn)
+	defer cancel()
+	defer context.AfterFunc(ctx, cancel)()
+
+	exitCode, err := containers.Wait(conn, id, &containers.WaitOptions{
+		Conditions: []string{"stopped", "exited"},
+	})
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+	return int(exitCode), err
+}
+
+func (r *PodmanRuntime) AttachContainer(id string, cursor *LogCursor, stdout, stderr io.Writer) error {
+	conn, release := r.checkout()
+	defer release()
+	stdout, stderr, flush := cursor.Writers(stdout, stderr)
+	defer flush()
+
+	// the log API, unlike an attach, timestamps the output and resumes it
+	// from a point in time
+	options := &containers.LogOptions{
+		Follow:     func(a bool) *bool { return &a }(true),
+		Stdout:     func(a bool) *bool { return &a }(true),
+		Stderr:     func(a bool) *bool { return &a }(true),
+		Timestamps: func(a bool) *bool { return &a }(true),
+	}
+	if since := cursor.Since(); !since.IsZero() {
+		options.Since = func(a string) *string { return &a }(since.Format(time.RFC3339Nano))
+	}
+	stdoutChan := make(chan string)
+	stderrChan := make(chan string)
+	followed := make(chan error, 1)
+	go func() {
+		followed <- containers.Logs(conn, id, options, stdoutChan, stderrChan)
+	}()
+	for {
+		select {
+		case frame := <-stdoutChan:
+			io.WriteString(stdout, frame)
+		case frame := <-stderrChan:
+			io.WriteString(stderr, frame)
+		case err := <-followed:
+			return err
+		}
+	}
+}
+
+// upgradeStream posts to an endpoint that hijacks the connection, such as an
+// attach, and returns the raw stream.
+func upgradeStream(conn context.Context, body io.Reader, params url.Values, endpoint string, pathValues ...string) (io.ReadWriteCloser, error) {
+	client, err := bindings.GetClient(conn)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.DoRequest(conn, body, http.MethodPost, endpoint, params, http.Header{
+		"Connection":   []string{"Upgrade"},
+		"Upgrade":      []string{"tcp"},
+		"Content-Type": []string{"application/json"},
+	}, pathValues...)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusSwitchingProtocols {
+		defer response.Body.Close()
+		return nil, response.Process(nil)
+	}
+	stream, ok := response.Body.(io.ReadWriteCloser)
+	if !ok {
+		response.Body.Close()
+		return nil, fmt.Errorf("%s: stream is not writable", response.Request.URL.Path)
+	}
+	return stream, nil
+}
+
+// AttachStdin attaches to the input of the container only, the output is
+// captured by AttachContainer. Closing the stream leaves the input open.
+func (r *PodmanRuntime) AttachStdin(id string, stdin io.Reader) error {
+	conn, release := r.checkout()
+	defer release()
+
+	params := url.Values{}
+	params.Set("stdin", "true")
+	params.Set("stream", "true")
+	stream, err := upgradeStream(conn, nil, params, "/containers/%s/attach", id)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	// the container's output is not attached, the stream only ends with it
+	go func() {
+		io.Copy(stream, stdin)
+		stream.Close()
+	}()
+	io.Copy(io.Discard, stream)
+	return nil
+}
+
+func (r *PodmanRuntime) ExecContainer(id string, exec Exec) (int, error) {
+	conn, release := r.checkout()
+	defer release()
+
+	sessionID, err := containers.ExecCreate(conn, id, &handlers.ExecCreateConfig{ExecOptions: dockercontainer.ExecOptions{
+		Cmd:          exec.Cmd,
+		Tty:          true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	}})
+	if err != nil {
+		return 0, err
+	}
+	defer containers.ExecRemove(conn, sessionID, nil)
+
+	// the bindings attach exec sessions to the terminal of the process
+	// itself, so the session's stream is upgraded here instead
+	stream, err := upgradeStream(conn, strings.NewReader(`{"Detach":false,"Tty":true}`), nil, "/exec/%s/start", sessionID)
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+
+	go followResizes(exec.Resize, func(size TerminalSize) error {
+		return containers.ResizeExecTTY(conn, sessionID, &containers.ResizeExecTTYOptions{
+			Height: func(a int) *int { return &a }(int(size.Rows)),
+			Width:  func(a int) *int { return &a }(int(size.Cols)),
+		})
+	})
+	go func() {
+		// the session hangs up once the client left
+		io.Copy(stream, exec.Stdin)
+		stream.Close()
+	}()
+	io.Copy(exec.Output, stream)
+
+	session, err := containers.ExecInspect(conn, sessionID, nil)
+	if err != nil {
+		return 0, err
+	}
+	return session.ExitCode, nil
+}
+
+func (r *PodmanRuntime) CopyFromContainer(id, path string, w io.Writer) error {
+	conn, release := r.checkout()
+	defer release()
+	copyFunc, err := containers.CopyToArchive(conn, id, path, w)
+	if err != nil {
+		if code, _ := bindings.CheckResponseCode(err); code == 404 {
+			return ErrNoSuchPath
+		}
+		return err
+	}
+	return copyFunc()
+}
+
+func (r *PodmanRuntime) ContainerEvents(handle func(ContainerEvent)) error {
+	conn, release := r.checkout()
+	defer release()
+	eventChan := make(chan types.Event)
+	err := system.Events(conn, eventChan, nil, &system.EventsOptions{
+		Filters: map[string][]string{"type": {"container"}},
+		Stream:  func(a bool) *bool { return &a }(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	for event := range eventChan {
+		switch event.Action {
+		case "oom":
+			handle(ContainerEvent{ID: event.Actor.ID, Action: "oom", Time: time.Unix(0, event.TimeNano)})
+		case "died":
+			exitCode, _ := strconv.Atoi(event.Actor.Attributes["containerExitCode"])
+			handle(ContainerEvent{ID: event.Actor.ID, Action: "died", ExitCode: exitCode, Time: time.Unix(0, event.TimeNano)})
+		}
+	}
+	return nil
+}
+
+func (r *PodmanRuntime) BuildImage(ctx context.Context, build ImageBuild) (string, error) {
+	var containerfiles []string
+	if build.Containerfile != "" {
+		containerfiles = []string{build.Containerfile}
+	}
+	var platformSpecs []struct{ OS, Arch, Variant string }
+	for _, platform := range build.Platforms {
+		platformSpecs = append(platformSpecs, struct{ OS, Arch, Variant string }{platform.OS, platform.Arch, platform.Variant})
+	}
+
+	// the connection context carries the Podman client, ctx the cancellation
+	pooled, release := r.checkout()
+	defer release()
+	conn, cancel := context.WithCancel(pooled)
+	defer cancel()
+	stop := context.AfterFunc(ctx, cancel)
+	defer stop()
+
+	report, err := images.BuildFromServerContext(conn, containerfiles, types.BuildOptions{
+		BuildOptions: define.BuildOptions{
+			ContextDirectory:        build.ContextDir,
+			Excludes:                build.Excludes,
+			Args:                    build.Args,
+			NoCache:                 build.NoCache,
+			PullPolicy:              build.PullPolicy,
+			ForceRmIntermediateCtrs: build.ForceRm,
+			Platforms:               platformSpecs,
+			Manifest:                build.Manifest,
+			Target:                  build.Target,
+			Labels:                  build.Labels,
+			Out:                     build.Out,
+			Err:                     build.Out,
+			ReportWriter:            build.Out,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return report.ID, nil
+}
+
+func (r *PodmanRuntime) PullImage(ref string, newer bool) (string, error) {
+	conn, release := r.checkout()
+	defer release()
+	options := &images.PullOptions{
+		Quiet: func(a bool) *bool { return &a }(true),
+	}
+	if newer {
+		options.Policy = func(a string) *string { return &a }("newer")
+	}
+	ids, err := images.Pull(conn, ref, options)
+	if err != nil {
+		return "", err
+	}
+	if len(ids) == 0 {
+		return "", fmt.Errorf("pulling image %s returned no image", ref)
+	}
+	return ids[0], nil
+}
+
+func (r *PodmanRuntime) ImageExists(id string) (bool, error) {
+	conn, release := r.checkout()
+	defer release()
+	return images.Exists(conn, id, nil)
+}
+
+func (r *PodmanRuntime) RemoveImage(id string) error {
+	conn, release := r.checkout()
+	defer release()
+	_, errs := images.Remove(conn, []string{id}, &images.RemoveOptions{
+		All:            func(a bool) *bool { return &a }(false),
+		Force:          func(a bool) *bool { return &a }(false),
+		Ignore:         func(a bool) *bool { return &a }(true),
+		LookupManifest: func(a bool) *bool { return &a }(false),
+		NoPrune:        func(a bool) *bool { return &a }(false),
+	})
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package manager
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.podman.io/image/v5/docker/reference"
+)
+
+// ImagePolicy restricts which images projects may build FROM or run. Empty
+// allow lists allow everything that is not denied.
+type ImagePolicy struct {
+	AllowedRegistries []string `yaml:"allowedRegistries" json:"allowed_registries"`
+	DeniedRegistries  []string `yaml:"deniedRegistries" json:"denied_registries"`
+	// AllowedImages and DeniedImages are path.Match patterns on the
+	// normalized repository name, e.g. "docker.io/library/*".
+	AllowedImages []string `yaml:"allowedImages" json:"allowed_images"`
+	DeniedImages  []string `yaml:"deniedImages" json:"denied_images"`
+	// DenyLatest rejects references tagged :latest or without any tag.
+	DenyLatest bool `yaml:"denyLatest" json:"deny_latest"`
+}
+
+// PolicyDecision is the outcome of checking one image reference.
+type PolicyDecision struct {
+	Image   string `json:"image"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func matchAny(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	})
+}
+
+// Check evaluates an image reference against the policy.
+func (p *ImagePolicy) Check(image string) PolicyDecision {
+	deny := func(format string, args ...any) PolicyDecision {
+		return PolicyDecision{Image: image, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return deny("invalid image reference: %v", err)
+	}
+	registry := reference.Domain(named)
+	repository := named.Name()
+
+	switch {
+	case slices.Contains(p.DeniedRegistries, registry):
+		return deny("registry %s is denied", registry)
+	case len(p.AllowedRegistries) > 0 && !slices.Contains(p.AllowedRegistries, registry):
+		return deny("registry %s is not allowed", registry)
+	case matchAny(p.DeniedImages, repository):
+		return deny("image %s is denied", repository)
+	case len(p.AllowedImages) > 0 && !matchAny(p.AllowedImages, repository):
+		return deny("image %s is not allowed", repository)
+	}
+
+	if p.DenyLatest {
+		_, digested := named.(reference.Digested)
+		tagged, hasTag := named.(reference.Tagged)
+		if !digested && (!hasTag || tagged.Tag() == "latest") {
+			return deny("image %s must be pinned to a tag other than latest", repository)
+		}
+	}
+
+	return PolicyDecision{Image: image, Allowed: true}
+}
+
+// Containerfile returns the path of the named Containerfile in the build
+// context or, when name is empty, of the Containerfile (or Dockerfile) at the
+// context root.
+func Containerfile(contextDir, name string) (string, error) {
+	if name != "" {
+		path, err := WorkspacePath(name)
+		if err != nil {
+			return "", fmt.Errorf("invalid Containerfile path %s", name)
+		}
+		root, err := os.OpenRoot(contextDir)
+		if err != nil {
+			return "", err
+		}
+		defer root.Close()
+		if info, err := root.Stat(path); err != nil || info.IsDir() {
+			return "", fmt.Errorf("no Containerfile %s in build context", name)
+		}
+		return filepath.Join(contextDir, path), nil
+	}
+
+	for _, name := range []string{"Containerfile", "Dockerfile"} {
+		candidate := filepath.Join(contextDir, name)
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("no Containerfile or Dockerfile in build context")
+}
+
+// BaseImages returns the external images a Containerfile of a build context
+// builds FROM, skipping scratch and references to earlier stages. Variables
+// are expanded from args and from ARG defaults declared before the first FROM.
+func BaseImages(contextDir, containerfile string, args map[string]string) ([]string, error) {
+	path, err := Containerfile(contextDir, containerfile)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	vars := map[string]string{}
+	stages := map[string]bool{}
+	var bases []string
+	seenFrom := false
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "ARG":
+			if seenFrom {
+				continue
+			}
+			name, value, _ := strings.Cut(fields[1], "=")
+			vars[name] = strings.Trim(value, `"'`)
+		case "FROM":
+			seenFrom = true
+			rest := slices.DeleteFunc(fields[1:], func(field string) bool {
+				return strings.HasPrefix(field, "--")
+			})
+			if len(rest) == 0 {
+				continue
+			}
+
+			image := os.Expand(rest[0], func(name string) string {
+				if value, ok := args[name]; ok {
+					return value
+				}
+				return vars[name]
+			})
+			if image != "scratch" && !stages[strings.ToLower(image)] && !slices.Contains(bases, image) {
+				bases = append(bases, image)
+			}
+			if len(rest) >= 3 && strings.EqualFold(rest[1], "AS") {
+				stages[strings.ToLower(rest[2])] = true
+			}
+		}
+	}
+	return bases, scanner.Err()
+}
+
+// CheckBuild evaluates every base image of a build context against the policy.
+func (p *ImagePolicy) CheckBuild(contextDir, containerfile string, args map[string]string) ([]PolicyDecision, error) {
+	bases, err := BaseImages(contextDir, containerfile, args)
+	if err != nil {
+		return nil, err
+	}
+
+	decisions := make([]PolicyDecision, 0, len(bases))
+	for _, base := range bases {
+		decisions = append(decisions, p.Check(base))
+	}
+	return decisions, nil
+}
+
+func imagePolicyPath(stateDir string) string {
+	return filepath.Join(stateDir, "image-policy.json")
+}
+
+// LoadImagePolicy reads the policy saved in stateDir. It returns nil if no
+// policy was saved yet.
+func LoadImagePolicy(stateDir string) (*ImagePolicy, error) {
+	raw, err := os.ReadFile(imagePolicyPath(stateDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var policy ImagePolicy
+	if err := json.Unmarshal(raw, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Save persists the policy to stateDir.
+func (p *ImagePolicy) Save(stateDir string) error {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(imagePolicyPath(stateDir), raw, 0600)
+}
@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultPoolSize is the number of Podman connections a server gets unless it
+// configures its poolSize.
+const DefaultPoolSize = 2
+
+// ConnPool spreads a server's Podman calls over several connections. Each call
+// checks out the connection with the fewest calls in flight, so long-lived
+// attaches, event streams and builds do not hold up the short calls behind
+// them.
+type ConnPool struct {
+	mu       sync.Mutex
+	conns    []context.Context
+	inFlight []int
+}
+
+// NewConnPool returns a pool of the connections.
+func NewConnPool(conns []context.Context) *ConnPool {
+	return &ConnPool{conns: conns, inFlight: make([]int, len(conns))}
+}
+
+// Get checks out the least busy connection. The caller must call release
+// once its call returned.
+func (p *ConnPool) Get() (conn context.Context, release func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	best := 0
+	for i := range p.conns {
+		if p.inFlight[i] < p.inFlight[best] {
+			best = i
+		}
+	}
+	p.inFlight[best]++
+
+	var once sync.Once
+	return p.conns[best], func() {
+		once.Do(func() {
+			p.mu.Lock()
+			p.inFlight[best]--
+			p.mu.Unlock()
+		})
+	}
+}
+
+// InFlight returns the number of calls in flight on each connection.
+func (p *ConnPool) InFlight() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]int(nil), p.inFlight...)
+}
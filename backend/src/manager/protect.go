@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// IsProtected reports whether the workspace file may only be changed by an
+// admin.
+func (im *ImageManager) IsProtected(fileName string) bool {
+	return slices.Contains(im.ProtectedFiles, fileName)
+}
+
+// ProtectedUnder returns the protected files inside the slash-separated
+// directory dir.
+func (im *ImageManager) ProtectedUnder(dir string) []string {
+	var protected []string
+	for _, fileName := range im.ProtectedFiles {
+		if strings.HasPrefix(fileName, dir+"/") {
+			protected = append(protected, fileName)
+		}
+	}
+	return protected
+}
+
+// SetProtected marks or unmarks a workspace file as admin-only.
+func (im *ImageManager) SetProtected(fileName string, protected bool) {
+	index := slices.Index(im.ProtectedFiles, fileName)
+	switch {
+	case protected && index < 0:
+		im.ProtectedFiles = append(im.ProtectedFiles, fileName)
+		slices.Sort(im.ProtectedFiles)
+	case !protected && index >= 0:
+		im.ProtectedFiles = slices.Delete(im.ProtectedFiles, index, index+1)
+	}
+}
+
+// MoveProtected carries the protection of a renamed file, or of the files in a
+// renamed directory, over to the new slash-separated path. It reports whether
+// any protected file moved.
+func (im *ImageManager) MoveProtected(from, to string) bool {
+	moved := false
+	for i, fileName := range im.ProtectedFiles {
+		switch {
+		case fileName == from:
+			im.ProtectedFiles[i] = to
+		case strings.HasPrefix(fileName, from+"/"):
+			im.ProtectedFiles[i] = to + strings.TrimPrefix(fileName, from)
+		default:
+			continue
+		}
+		moved = true
+	}
+	if moved {
+		// a file moved over a protected one is listed twice
+		slices.Sort(im.ProtectedFiles)
+		im.ProtectedFiles = slices.Compact(im.ProtectedFiles)
+	}
+	return moved
+}
+
+func protectedPath(stateDir, image string) string {
+	return filepath.Join(stateDir, "protected", image+".json")
+}
+
+// LoadProtected restores the image's protected file list from stateDir.
+func (im *ImageManager) LoadProtected(stateDir string) error {
+	raw, err := os.ReadFile(protectedPath(stateDir, im.Name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(raw, &im.ProtectedFiles)
+}
+
+// SaveProtected persists the image's protected file list to stateDir.
+func (im *ImageManager) SaveProtected(stateDir string) error {
+	path := protectedPath(stateDir, im.Name)
+	if len(im.ProtectedFiles) == 0 {
+		err := os.Remove(path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	raw, err := json.Marshal(im.ProtectedFiles)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0600)
+}
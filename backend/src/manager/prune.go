@@ -0,0 +1,141 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Policies for the containers of exited runs, see RetentionConfig.
+const (
+	ContainersRemove     = "remove"      // remove them from their server
+	ContainersKeepFailed = "keep-failed" // keep those of failed runs for debugging
+	ContainersKeep       = "keep"        // leave them to be pruned by hand
+)
+
+// collectGrace is how long the artifacts of a run that exited may take to be
+// collected before PruneContainers removes its container.
+const collectGrace = 10 * time.Minute
+
+// ValidateContainerPolicy checks the configured policy for exited containers,
+// empty means remove.
+func ValidateContainerPolicy(policy string) error {
+	switch policy {
+	case "", ContainersRemove, ContainersKeepFailed, ContainersKeep:
+		return nil
+	}
+	return fmt.Errorf("unknown container policy %s, expected remove, keep-failed or keep", policy)
+}
+
+// keepsContainer reports whether the policy keeps the container of the exited
+// run on its server.
+func (r RetentionConfig) keepsContainer(cm *ContainerManager) bool {
+	switch r.Containers {
+	case ContainersKeep:
+		return true
+	case ContainersKeepFailed:
+		return cm.Status != Exited
+	}
+	return false
+}
+
+// FinishRun collects the artifacts of an exited run, unless the retention
+// policy keeps exited containers for a while removes its container from the
+// server, and persists the run with its final usage. It takes the image lock
+// itself, so exit handlers call it in a goroutine after releasing theirs.
+func (sm *ServiceManager) FinishRun(im *ImageManager, mc *ConnectionManager, cm *ContainerManager) {
+	sm.CollectArtifacts(im, mc, cm)
+
+	im.Mu.Lock()
+	defer im.Mu.Unlock()
+	if sm.Retention.ContainerHours <= 0 {
+		sm.pruneRun(im, mc, cm)
+	}
+	im.persist(cm)
+}
+
+// pruneRun removes the container of the exited run from the server unless the
+// retention policy keeps it. Containers of quarantined images are kept for
+// review. The caller must hold im.Mu.
+func (sm *ServiceManager) pruneRun(im *ImageManager, mc *ConnectionManager, cm *ContainerManager) error {
+	if cm.FinishedAt == nil || cm.RemovedAt != nil || im.Quarantine != nil || sm.Retention.keepsContainer(cm) {
+		return nil
+	}
+	if err := mc.Runtime.RemoveContainer(cm.ID, false, true); err != nil {
+		sm.Events.Publish(Event{Type: EventError, Image: im.Name, Server: mc.Server.Name, Container: cm.Name, Message: fmt.Sprintf("failed to remove exited container: %v", err)})
+		return err
+	}
+	now := time.Now()
+	cm.RemovedAt = &now
+	return nil
+}
+
+// PruneContainers removes the exited containers of maestro's from the server
+// that the retention policy no longer keeps: those of runs that exited more
+// than containerHours ago and dangling ones, created as long ago but not
+// tracked by any image. It returns the number of containers removed.
+func (sm *ServiceManager) PruneContainers(mc *ConnectionManager, now time.Time) (int, error) {
+	listed, err := mc.Runtime.ListContainers()
+	if err != nil {
+		return 0, err
+	}
+
+	type trackedRun struct {
+		im  *ImageManager
+		run *ContainerManager
+	}
+	tracked := map[string]trackedRun{}
+	sm.Images.Range(func(_ string, im *ImageManager) bool {
+		im.Mu.RLock()
+		defer im.Mu.RUnlock()
+		for _, run := range im.AllRuns() {
+			tracked[run.ID] = trackedRun{im, run}
+		}
+		return true
+	})
+
+	cutoff := now.Add(-time.Duration(sm.Retention.ContainerHours) * time.Hour)
+	finishedBefore := cutoff
+	if graceCutoff := now.Add(-collectGrace); graceCutoff.Before(finishedBefore) {
+		finishedBefore = graceCutoff
+	}
+	pruned := 0
+	var errs []error
+	for _, container := range listed {
+		if !container.Exited {
+			continue
+		}
+
+		t, exists := tracked[container.ID]
+		if !exists {
+			if !container.CreatedAt.Before(cutoff) {
+				continue
+			}
+			if err := mc.Runtime.RemoveContainer(container.ID, false, true); err != nil {
+				errs = append(errs, fmt.Errorf("container %s: %v", container.Name, err))
+				continue
+			}
+			pruned++
+			continue
+		}
+
+		err := func() error {
+			t.im.Mu.Lock()
+			defer t.im.Mu.Unlock()
+			if t.run.FinishedAt == nil || !t.run.FinishedAt.Before(finishedBefore) || t.run.RemovedAt != nil {
+				return nil
+			}
+			if err := sm.pruneRun(t.im, mc, t.run); err != nil {
+				return fmt.Errorf("container %s: %v", container.Name, err)
+			}
+			if t.run.RemovedAt != nil {
+				pruned++
+			}
+			return nil
+		}()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return pruned, errors.Join(errs...)
+}
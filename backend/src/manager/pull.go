@@ -0,0 +1,25 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PullImages pulls images onto the server ahead of the builds that use them,
+// so the first build on a fresh server does not wait for its base layers.
+// Images already present are only pulled again when the registry has a newer
+// version. It pulls every image even if some fail and reports progress on op.
+func (cm *ConnectionManager) PullImages(refs []string, op *Operation) error {
+	var errs []error
+	for i, ref := range refs {
+		_, err := cm.Runtime.PullImage(ref, true)
+		if err != nil {
+			op.Logf("Failed to pull %s: %v", ref, err)
+			errs = append(errs, fmt.Errorf("failed to pull image %s: %v", ref, err))
+		} else {
+			op.Logf("Pulled %s", ref)
+		}
+		op.SetProgress(i+1, len(refs))
+	}
+	return errors.Join(errs...)
+}
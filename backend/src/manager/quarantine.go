@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/podman/v6/pkg/bindings/containers"
+	"github.com/containers/podman/v6/pkg/bindings/network"
+)
+
+// QuarantineInfo describes why and when an image was quarantined. While set,
+// no new runs of the image are accepted.
+type QuarantineInfo struct {
+	Reason   string    `json:"reason"`
+	At       time.Time `json:"at"`
+	Paused   bool      `json:"paused"`
+	Isolated bool      `json:"isolated"`
+	Errors   []string  `json:"errors,omitempty"`
+
+	// ForensicsDir holds the copied logs and filesystem diff of the container.
+	ForensicsDir string `json:"-"`
+}
+
+// Isolate quarantines the image: it blocks further runs, optionally pauses the
+// current container and disconnects it from all networks, and snapshots its
+// logs and filesystem diff into forensicsDir. Failing steps are recorded on the
+// returned info rather than aborting the quarantine.
+func (im *ImageManager) Isolate(reason string, pause, isolate bool, forensicsDir string) *QuarantineInfo {
+	info := &QuarantineInfo{
+		Reason:       reason,
+		At:           time.Now(),
+		ForensicsDir: forensicsDir,
+	}
+	im.Quarantine = info
+
+	if im.Container == nil || im.Connection == nil {
+		return info
+	}
+
+	containerID := im.Container.ID
+
+	fail := func(step string, err error) {
+		info.Errors = append(info.Errors, fmt.Sprintf("%s: %v", step, err))
+	}
+
+	// only the captured logs are kept of containers of other engines
+	conn, err := im.Connection.podmanConn()
+	if err != nil {
+		fail("quarantine", err)
+	}
+
+	if pause && conn != nil {
+		if err := containers.Pause(conn, containerID, nil); err != nil {
+			fail("pause", err)
+		} else {
+			info.Paused = true
+		}
+	}
+
+	if isolate && conn != nil {
+		containerReport, err := containers.Inspect(conn, containerID, nil)
+		if err != nil {
+			fail("inspect", err)
+		} else {
+			info.Isolated = true
+			for networkName := range containerReport.NetworkSettings.Networks {
+				err := network.Disconnect(conn, networkName, containerID, &network.DisconnectOptions{
+					Force: func(a bool) *bool { return &a }(true),
+				})
+				if err != nil {
+					info.Isolated = false
+					fail("disconnect "+networkName, err)
+				}
+			}
+		}
+	}
+
+	if err := os.MkdirAll(forensicsDir, 0700); err != nil {
+		fail("forensics", err)
+		return info
+	}
+
+	// snapshot the captured logs so later runs or user edits cannot alter them
+	for _, logFile := range []*os.File{im.Container.Stdout, im.Container.Stderr} {
+		if logFile == nil {
+			continue
+		}
+		if err := copyFile(logFile.Name(), filepath.Join(forensicsDir, filepath.Base(logFile.Name()))); err != nil {
+			fail("copy log", err)
+		}
+	}
+
+	if conn == nil {
+		return info
+	}
+	changes, err := containers.Diff(conn, containerID, nil)
+	if err != nil {
+		fail("diff", err)
+		return info
+	}
+
+	var diff strings.Builder
+	for _, change := range changes {
+		diff.WriteString(change.String())
+		diff.WriteByte('\n')
+	}
+	if err := os.WriteFile(filepath.Join(forensicsDir, "diff.txt"), []byte(diff.String()), 0600); err != nil {
+		fail("write diff", err)
+	}
+
+	return info
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
@@ -0,0 +1,201 @@
+package manager
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// QueueConfig tunes the run queues of all servers.
+type QueueConfig struct {
+	// WaitThresholdSeconds is how long a run may wait before a queue_delayed
+	// event is published. 0 disables the check.
+	WaitThresholdSeconds int `yaml:"waitThresholdSeconds"`
+}
+
+// RunJob is a run waiting in a server's queue.
+type RunJob struct {
+	ID       string        `json:"id"`
+	Image    *ImageManager `json:"-"`
+	Options  RunOptions    `json:"-"`
+	QueuedAt time.Time     `json:"queued_at"`
+
+	Operation *Operation        `json:"-"` // steps of the run, updated by the worker
+	Run       *ContainerManager `json:"-"` // record of the run, pending until the worker starts it
+
+	// delayNotified is set once the wait threshold breach was reported.
+	delayNotified bool
+}
+
+// QueuedRun is the listing form of a queued job.
+type QueuedRun struct {
+	ID       string        `json:"id"`
+	Image    string        `json:"image"`
+	Position int           `json:"position"`
+	QueuedAt time.Time     `json:"queued_at"`
+	Waited   time.Duration `json:"waited_ns"`
+}
+
+// RunQueue is a server's FIFO of runs waiting for its worker.
+type RunQueue struct {
+	mu     sync.Mutex
+	jobs   []*RunJob
+	ready  chan struct{}
+	closed bool
+}
+
+// NewRunQueue returns an empty queue.
+func NewRunQueue() *RunQueue {
+	return &RunQueue{ready: make(chan struct{}, 1)}
+}
+
+// Push appends a job and returns its 1-based position.
+func (q *RunQueue) Push(job *RunJob) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if job.ID == "" {
+		job.ID = NewRunID()
+	}
+	job.QueuedAt = time.Now()
+	q.jobs = append(q.jobs, job)
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return len(q.jobs)
+}
+
+// Pop blocks until a job is queued and removes it from the front. It returns
+// nil once the queue is closed and empty.
+func (q *RunQueue) Pop() *RunJob {
+	for {
+		q.mu.Lock()
+		if len(q.jobs) > 0 {
+			job := q.jobs[0]
+			q.jobs = slices.Delete(q.jobs, 0, 1)
+			q.mu.Unlock()
+			return job
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return nil
+		}
+		<-q.ready
+	}
+}
+
+// Close stops the queue's worker once the queued jobs were popped.
+func (q *RunQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Drain closes the queue and takes out the jobs still queued, so its worker
+// stops without running them.
+func (q *RunQueue) Drain() []*RunJob {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	jobs := q.jobs
+	q.jobs = nil
+	q.closed = true
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+	return jobs
+}
+
+// Closed reports whether the queue was closed.
+func (q *RunQueue) Closed() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closed
+}
+
+// Remove takes a job out of the queue before the worker picks it up. It
+// reports false if the job is not queued (anymore).
+func (q *RunQueue) Remove(id string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	index := slices.IndexFunc(q.jobs, func(job *RunJob) bool { return job.ID == id })
+	if index < 0 {
+		return false
+	}
+	q.jobs = slices.Delete(q.jobs, index, index+1)
+	return true
+}
+
+// Len returns the number of queued jobs.
+func (q *RunQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.jobs)
+}
+
+// List returns the queued jobs in order.
+func (q *RunQueue) List() []QueuedRun {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	runs := make([]QueuedRun, 0, len(q.jobs))
+	for i, job := range q.jobs {
+		runs = append(runs, QueuedRun{
+			ID:       job.ID,
+			Image:    job.Image.Name,
+			Position: i + 1,
+			QueuedAt: job.QueuedAt,
+			Waited:   now.Sub(job.QueuedAt),
+		})
+	}
+	return runs
+}
+
+// Overdue returns the jobs that have waited longer than threshold and were not
+// reported yet, marking them as reported.
+func (q *RunQueue) Overdue(threshold time.Duration) []QueuedRun {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var overdue []QueuedRun
+	for i, job := range q.jobs {
+		if job.delayNotified || now.Sub(job.QueuedAt) < threshold {
+			continue
+		}
+		job.delayNotified = true
+		overdue = append(overdue, QueuedRun{
+			ID:       job.ID,
+			Image:    job.Image.Name,
+			Position: i + 1,
+			QueuedAt: job.QueuedAt,
+			Waited:   now.Sub(job.QueuedAt),
+		})
+	}
+	return overdue
+}
+
+// FreeServers returns the online servers other than except whose queues are
+// empty, sorted by name.
+func (sm *ServiceManager) FreeServers(except string) []string {
+	var free []string
+	sm.Connections.Range(func(name string, cm *ConnectionManager) bool {
+		if name != except && cm.Status() == ServerOnline && cm.RunQueue.Len() == 0 {
+			free = append(free, name)
+		}
+		return true
+	})
+	slices.Sort(free)
+	return free
+}
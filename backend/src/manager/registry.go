@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/podman/v6/pkg/bindings/images"
+	"github.com/containers/podman/v6/pkg/bindings/manifests"
+	"go.podman.io/image/v5/docker/reference"
+)
+
+var ErrNoRegistry = errors.New("no registry configured")
+
+// RegistryConfig is the OCI registry built images can be pushed to.
+type RegistryConfig struct {
+	Repository     string `yaml:"repository"`     // e.g. registry.example.com/maestro, empty disables pushing
+	Username       string `yaml:"username"`       // empty pushes anonymously
+	PasswordSecret string `yaml:"passwordSecret"` // secret holding the password or token
+	SkipTLSVerify  bool   `yaml:"skipTLSVerify"`
+}
+
+// Reference returns the reference an image is pushed as, the image name below
+// the configured repository.
+func (cfg RegistryConfig) Reference(image, tag string) (string, error) {
+	if cfg.Repository == "" {
+		return "", ErrNoRegistry
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+	ref := fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(cfg.Repository, "/"), strings.ToLower(image), tag)
+	if _, err := reference.ParseNormalizedNamed(ref); err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %v", ref, err)
+	}
+	return ref, nil
+}
+
+// Push pushes the built image, or every image of a multi-platform build, to
+// the registry as ref and returns the digest of the pushed manifest.
+func (im *ImageManager) Push(mc *ConnectionManager, ref string, cfg RegistryConfig, password string) (string, error) {
+	if im.ID == nil {
+		return "", fmt.Errorf("image %s is not built", im.Name)
+	}
+	if docker, ok := mc.Runtime.(*DockerRuntime); ok {
+		return docker.Push(*im.ID, ref, cfg, password)
+	}
+	conn, err := mc.podmanConn()
+	if err != nil {
+		return "", err
+	}
+
+	options := &images.PushOptions{
+		Quiet:         func(a bool) *bool { return &a }(true),
+		SkipTLSVerify: func(a bool) *bool { return &a }(cfg.SkipTLSVerify),
+	}
+	if cfg.Username != "" {
+		options.Username = &cfg.Username
+		options.Password = &password
+	}
+
+	if im.Manifest != "" {
+		options.All = func(a bool) *bool { return &a }(true)
+		digest, err := manifests.Push(conn, im.Manifest, ref, options)
+		if err != nil {
+			return "", fmt.Errorf("failed to push %s: %v", ref, err)
+		}
+		return digest, nil
+	}
+
+	// push by ID, a local tag would keep the image from being replaced by the
+	// next build
+	if err := images.Push(conn, *im.ID, ref, options); err != nil {
+		return "", fmt.Errorf("failed to push %s: %v", ref, err)
+	}
+	if options.ManifestDigest == nil {
+		return "", nil
+	}
+	return *options.ManifestDigest, nil
+}
+
+// PushedReference returns the reference a push of ref is pulled by, pinned to
+// the pushed digest so the image cannot change under the reference, or ref
+// itself if the registry reported no digest.
+func PushedReference(ref, digest string) (string, error) {
+	if digest == "" {
+		return ref, nil
+	}
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %v", ref, err)
+	}
+	pinned := reference.TrimNamed(named).String() + "@" + digest
+	if _, err := reference.ParseNormalizedNamed(pinned); err != nil {
+		return "", fmt.Errorf("invalid image reference %s: %v", pinned, err)
+	}
+	return pinned, nil
+}
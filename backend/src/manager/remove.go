@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrContainerRunning = errors.New("container is still running")
+
+// RemovalOptions tunes what RemoveFromServers removes.
+type RemovalOptions struct {
+	Force   bool // stop and remove running containers too
+	Volumes bool // remove the anonymous volumes of the containers
+}
+
+// RemoveFromServers removes the workspace's containers, running or exited, and
+// the images built from it from the servers. Prebuilt images are left, other
+// workspaces may run them. Offline servers are skipped, their containers are
+// pruned as dangling once they are back. Without opts.Force it fails with
+// ErrContainerRunning before removing anything if a container still runs. The
+// caller must hold im.Mu.
+func (sm *ServiceManager) RemoveFromServers(im *ImageManager, opts RemovalOptions) error {
+	type serverContainer struct {
+		mc      *ConnectionManager
+		id      string
+		name    string
+		running bool
+	}
+	var found []serverContainer
+	seen := map[string]bool{}
+
+	if current := im.Container; current != nil && im.Connection != nil && current.RemovedAt == nil {
+		found = append(found, serverContainer{im.Connection, current.ID, current.Name, current.Active()})
+		seen[current.ID] = true
+	}
+
+	var errs []error
+	sm.Connections.Range(func(_ string, mc *ConnectionManager) bool {
+		if mc.Status() == ServerOffline {
+			return true
+		}
+		listed, err := mc.Runtime.ListContainers()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server %s: %v", mc.Server.Name, err))
+			return true
+		}
+		for _, container := range listed {
+			if container.Labels[LabelImage] == im.Name && !seen[container.ID] {
+				found = append(found, serverContainer{mc, container.ID, container.Name, container.Running})
+				seen[container.ID] = true
+			}
+		}
+		return true
+	})
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if !opts.Force {
+		for _, container := range found {
+			if container.running {
+				return fmt.Errorf("%w: %s", ErrContainerRunning, container.name)
+			}
+		}
+	}
+
+	for _, container := range found {
+		if err := container.mc.Runtime.RemoveContainer(container.id, opts.Force, opts.Volumes); err != nil {
+			errs = append(errs, fmt.Errorf("container %s: %v", container.name, err))
+		}
+	}
+	if current := im.Container; current != nil && seen[current.ID] && len(errs) == 0 {
+		now := time.Now()
+		current.Activity.Finish(now)
+		current.RemovedAt = &now
+	}
+
+	if im.Prebuilt == "" {
+		images := map[string]string{}
+		for server, id := range im.ServerImages {
+			images[server] = id
+		}
+		if im.ID != nil && im.Connection != nil {
+			images[im.Connection.Server.Name] = *im.ID
+		}
+		for server, id := range images {
+			mc, exists := sm.Connections.Load(server)
+			if !exists || mc.Status() == ServerOffline {
+				continue
+			}
+			if err := mc.Runtime.RemoveImage(id); err != nil {
+				errs = append(errs, fmt.Errorf("image on server %s: %v", server, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
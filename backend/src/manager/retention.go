@@ -0,0 +1,195 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrRunNotArchived = errors.New("run is not archived")
+
+// RetentionConfig sets how long runs keep their logs next to the workspace
+// before they are compressed into the archive directory, and which of their
+// exited containers stay on their server.
+type RetentionConfig struct {
+	HotDays     int    `yaml:"hotDays"`     // 0 disables archival
+	ArchiveDir  string `yaml:"archiveDir"`  // defaults to <stateDir>/archive, may be a mounted bucket
+	Compression string `yaml:"compression"` // gzip (default) or zstd
+
+	Containers     string `yaml:"containers"`     // policy for exited containers, remove (default), keep-failed or keep
+	ContainerHours int    `yaml:"containerHours"` // hours exited containers stay on their server before removal
+}
+
+// HotSince returns the time from which the run counts as recent: when it
+// finished or, if later, when it was last rehydrated. It is nil while the run
+// has not finished.
+func (cm *ContainerManager) HotSince() *time.Time {
+	if cm.FinishedAt == nil {
+		return nil
+	}
+	cutoff := *cm.FinishedAt
+	if cm.RehydratedAt != nil && cm.RehydratedAt.After(cutoff) {
+		cutoff = *cm.RehydratedAt
+	}
+	return &cutoff
+}
+
+// hotLogFiles returns the log files referenced by runs of the image that are
+// not archived. Build logs can be shared by several runs of the same build.
+func (im *ImageManager) hotLogFiles(except *ContainerManager) map[string]bool {
+	files := map[string]bool{}
+	for _, run := range im.AllRuns() {
+		if run == except || run.ArchivedAt != nil {
+			continue
+		}
+		for _, name := range run.LogFiles() {
+			files[name] = true
+		}
+	}
+	return files
+}
+
+// RunRecord is a persisted run of an image, which may have left its run
+// history.
+type RunRecord struct {
+	Image string
+	Run   *ContainerManager
+}
+
+// archiveRuns compresses the logs of the image's due runs into archiveDir and
+// removes them from the workspace. Runs still in the history are archived in
+// place of their records. The caller must hold im.Mu.
+func (im *ImageManager) archiveRuns(due []*ContainerManager, archiveDir string, compression Compression) (int, error) {
+	archived := 0
+	for _, run := range due {
+		if current, exists := im.FindRun(run.RunID); exists {
+			run = current
+		}
+		if run.ArchivedAt != nil || run.FinishedAt == nil {
+			continue
+		}
+		if err := im.archiveRun(run, archiveDir, compression); err != nil {
+			return archived, fmt.Errorf("run %s: %v", run.RunID, err)
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+func (im *ImageManager) archiveRun(run *ContainerManager, archiveDir string, compression Compression) error {
+	archivePath := filepath.Join(archiveDir, im.Name, run.RunID+compression.Ext())
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0700); err != nil {
+		return err
+	}
+
+	// write to a temporary name first so a crash never leaves a partial archive
+	tmpPath := archivePath + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = WriteTar(file, im.FilesDir, run.LogFiles(), compression)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, archivePath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	now := time.Now()
+	run.ArchivedAt = &now
+	run.ArchivePath = archivePath
+	im.persist(run)
+
+	root, err := im.OpenRoot()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	hot := im.hotLogFiles(run)
+	for _, name := range run.LogFiles() {
+		if hot[name] {
+			continue
+		}
+		if err := root.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rehydrate restores the logs of an archived run into the workspace and
+// removes its archive. The caller must hold im.Mu.
+func (im *ImageManager) Rehydrate(run *ContainerManager) error {
+	if run.ArchivedAt == nil {
+		return ErrRunNotArchived
+	}
+
+	file, err := os.Open(run.ArchivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := ExtractTar(file, im.FilesDir); err != nil {
+		return fmt.Errorf("failed to extract archive: %v", err)
+	}
+
+	now := time.Now()
+	run.ArchivedAt = nil
+	run.RehydratedAt = &now
+	os.Remove(run.ArchivePath)
+	run.ArchivePath = ""
+	im.persist(run)
+	return nil
+}
+
+// ArchiveRuns archives the due runs, grouped by image, reporting progress on
+// op. Runs of images that no longer exist are skipped. It stops between
+// images once ctx is canceled.
+func (sm *ServiceManager) ArchiveRuns(ctx context.Context, archiveDir string, compression Compression, due []RunRecord, op *Operation) (int, error) {
+	byImage := map[string][]*ContainerManager{}
+	var names []string
+	for _, record := range due {
+		if _, exists := byImage[record.Image]; !exists {
+			names = append(names, record.Image)
+		}
+		byImage[record.Image] = append(byImage[record.Image], record.Run)
+	}
+
+	var errs []error
+	total := 0
+	for i, name := range names {
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+		im, exists := sm.Images.Load(name)
+		if !exists {
+			continue
+		}
+
+		im.Mu.Lock()
+		archived, err := im.archiveRuns(byImage[name], archiveDir, compression)
+		im.Mu.Unlock()
+
+		total += archived
+		if archived > 0 {
+			op.Logf("archived %d runs of image %s", archived, im.Name)
+		}
+		if err != nil {
+			op.Logf("failed to archive runs of image %s: %v", im.Name, err)
+			errs = append(errs, fmt.Errorf("image %s: %w", im.Name, err))
+		}
+		op.SetProgress(i+1, len(names))
+	}
+	return total, errors.Join(errs...)
+}
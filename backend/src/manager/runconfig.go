@@ -0,0 +1,125 @@
+package manager
+
+import (
+	"fmt"
+	"maps"
+	"path"
+
+	spec "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// Mount is a host path bind-mounted into a run's container.
+type Mount struct {
+	Source   string `yaml:"source" json:"source"`
+	Target   string `yaml:"target" json:"target"`
+	ReadOnly bool   `yaml:"readOnly" json:"readOnly"`
+}
+
+// RunDefaults are site-specific settings a server injects into every run and
+// build on it, so users don't need to know them.
+type RunDefaults struct {
+	Env    map[string]string `yaml:"env"`
+	Mounts []Mount           `yaml:"mounts"`
+	// RegistryMirror is passed to builds as the REGISTRY_MIRROR build arg and
+	// to runs as the REGISTRY_MIRROR environment variable.
+	RegistryMirror string `yaml:"registryMirror"`
+}
+
+// RunOptions are the settings of a single run.
+type RunOptions struct {
+	// Image runs a prebuilt image reference instead of building the
+	// workspace.
+	Image  string            `json:"image"`
+	Env    map[string]string `json:"env"`
+	Mounts []Mount           `json:"-"` // only set from server defaults
+	// Outputs are absolute container paths copied into the run's artifacts
+	// directory of the workspace once the container exits.
+	Outputs []string `json:"outputs"`
+	// Workspace bind-mounts the workspace into the container instead of
+	// relying on the files baked into the image.
+	Workspace *WorkspaceMount `json:"workspace"`
+	// Resources are reserved on the server for as long as the run's
+	// container runs, and limit it.
+	Resources Resources `json:"resources"`
+	// Constraints restrict placement to servers whose labels satisfy all of
+	// them: key=value, key!=value or a bare key the server must have.
+	Constraints []string `json:"constraints"`
+	// Interactive keeps the container's input open, so clients can answer
+	// programs that prompt mid-run.
+	Interactive bool `json:"interactive"`
+	// TimeoutMinutes stops the container once it ran this long, 0 lets it
+	// run until it exits.
+	TimeoutMinutes int `json:"timeout_minutes" binding:"gte=0"`
+}
+
+// DefaultWorkspaceTarget is where the workspace is mounted unless a run says
+// otherwise.
+const DefaultWorkspaceTarget = "/workspace"
+
+// WorkspaceMount mounts the workspace, or a directory of it, into a run's
+// container. On servers with a RemoteDir the files are synced there first, so
+// writes of a read-write mount stay on the server.
+type WorkspaceMount struct {
+	Subdir   string `json:"subdir"`   // directory of the workspace, empty for all of it
+	Target   string `json:"target"`   // container path, defaults to /workspace
+	ReadOnly bool   `json:"readOnly"` // mount read-only, forced for non-admins when the workspace has protected files
+}
+
+// Validate checks the mount and fills in the default target.
+func (mount *WorkspaceMount) Validate() error {
+	if mount.Subdir != "" {
+		if _, err := WorkspacePath(mount.Subdir); err != nil {
+			return fmt.Errorf("invalid workspace subdirectory %s", mount.Subdir)
+		}
+	}
+	if mount.Target == "" {
+		mount.Target = DefaultWorkspaceTarget
+	}
+	if !path.IsAbs(mount.Target) || path.Clean(mount.Target) == "/" {
+		return fmt.Errorf("invalid workspace mount target %s: expected an absolute path below /", mount.Target)
+	}
+	return nil
+}
+
+// ResolveRunOptions merges the server defaults with the requested options.
+// Requested environment variables override the defaults.
+func ResolveRunOptions(defaults RunDefaults, requested RunOptions) RunOptions {
+	resolved := RunOptions{
+		Image:       requested.Image,
+		Env:         map[string]string{},
+		Mounts:      append([]Mount(nil), defaults.Mounts...),
+		Outputs:     requested.Outputs,
+		Workspace:   requested.Workspace,
+		Resources:   requested.Resources,
+		Constraints: requested.Constraints,
+		Interactive: requested.Interactive,
+
+		TimeoutMinutes: requested.TimeoutMinutes,
+	}
+
+	if defaults.RegistryMirror != "" {
+		resolved.Env["REGISTRY_MIRROR"] = defaults.RegistryMirror
+	}
+	maps.Copy(resolved.Env, defaults.Env)
+	maps.Copy(resolved.Env, requested.Env)
+
+	return resolved
+}
+
+// SpecMounts converts the mounts into OCI bind mounts.
+func SpecMounts(mounts []Mount) []spec.Mount {
+	specMounts := make([]spec.Mount, 0, len(mounts))
+	for _, mount := range mounts {
+		mode := "rw"
+		if mount.ReadOnly {
+			mode = "ro"
+		}
+		specMounts = append(specMounts, spec.Mount{
+			Type:        "bind",
+			Source:      mount.Source,
+			Destination: mount.Target,
+			Options:     []string{"rbind", mode},
+		})
+	}
+	return specMounts
+}
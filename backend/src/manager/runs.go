@@ -0,0 +1,151 @@
+package manager
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// maxRunHistory bounds how many finished runs are remembered per image. Older
+// ones are only kept by PersistRun.
+const maxRunHistory = 50
+
+// NewRunID returns a random identifier for a run.
+func NewRunID() string {
+	buf := make([]byte, 6)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// archiveContainer moves the current container into the run history.
+func (im *ImageManager) archiveContainer() {
+	if im.Container == nil {
+		return
+	}
+	im.addToHistory(im.Container)
+	im.Container = nil
+}
+
+func (im *ImageManager) addToHistory(run *ContainerManager) {
+	im.persist(run)
+	im.Runs = append(im.Runs, run)
+	if len(im.Runs) > maxRunHistory {
+		im.Runs = im.Runs[len(im.Runs)-maxRunHistory:]
+	}
+}
+
+// persist saves the run with PersistRun, if set.
+func (im *ImageManager) persist(run *ContainerManager) {
+	if im.PersistRun != nil {
+		im.PersistRun(im.Name, run)
+	}
+}
+
+// BeginRun records a run accepted for the image. It is pending, Queued, until
+// StartRun makes it the current container or AbortRun ends it. A retried run
+// that never started replaces its earlier record. The caller must hold im.Mu.
+func (im *ImageManager) BeginRun(runID string) *ContainerManager {
+	im.Runs = slices.DeleteFunc(im.Runs, func(run *ContainerManager) bool {
+		return run.RunID == runID && run.ID == ""
+	})
+	run := &ContainerManager{RunID: runID, Status: Queued}
+	im.Pending = append(im.Pending, run)
+	return run
+}
+
+// StartRun makes the pending run, once its container was created, the
+// image's current container, Starting. The caller must hold im.Mu.
+func (im *ImageManager) StartRun(run *ContainerManager) error {
+	if err := run.Transition(Starting); err != nil {
+		return err
+	}
+	im.Pending = slices.DeleteFunc(im.Pending, func(other *ContainerManager) bool { return other == run })
+	im.SetContainer(run)
+	return nil
+}
+
+// AbortRun ends the pending run before it started, Cancelled or Error, and
+// moves it into the run history. The caller must hold im.Mu.
+func (im *ImageManager) AbortRun(run *ContainerManager, status Status) error {
+	if err := run.Transition(status); err != nil {
+		return err
+	}
+	im.Pending = slices.DeleteFunc(im.Pending, func(other *ContainerManager) bool { return other == run })
+	im.addToHistory(run)
+	return nil
+}
+
+// Active reports whether the container has not exited yet: it runs or is
+// paused.
+func (cm *ContainerManager) Active() bool {
+	return cm.Status == Running || cm.Status == Paused
+}
+
+// LastLogWrite returns when the run's output was last written to its log
+// files, zero if it was not yet.
+func (im *ImageManager) LastLogWrite(cm *ContainerManager) time.Time {
+	var last time.Time
+	for _, name := range []string{cm.StdoutLog, cm.StderrLog} {
+		info, err := os.Stat(filepath.Join(im.FilesDir, name))
+		if err == nil && info.ModTime().After(last) {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+// SetContainer makes container the image's current run, moving the previous
+// one into the run history.
+func (im *ImageManager) SetContainer(container *ContainerManager) {
+	im.archiveContainer()
+	im.Container = container
+}
+
+// FindRun returns a pending, the current or a past run of the image by ID.
+func (im *ImageManager) FindRun(runID string) (*ContainerManager, bool) {
+	for _, run := range im.Pending {
+		if run.RunID == runID {
+			return run, true
+		}
+	}
+	if im.Container != nil && im.Container.RunID == runID {
+		return im.Container, true
+	}
+	for _, run := range im.Runs {
+		if run.RunID == runID {
+			return run, true
+		}
+	}
+	return nil, false
+}
+
+// AllRuns returns the image's runs, most recent first, pending ones
+// included.
+func (im *ImageManager) AllRuns() []*ContainerManager {
+	runs := make([]*ContainerManager, 0, len(im.Pending)+len(im.Runs)+1)
+	for i := len(im.Pending) - 1; i >= 0; i-- {
+		runs = append(runs, im.Pending[i])
+	}
+	if im.Container != nil {
+		runs = append(runs, im.Container)
+	}
+	for i := len(im.Runs) - 1; i >= 0; i-- {
+		runs = append(runs, im.Runs[i])
+	}
+	return runs
+}
+
+// LogFiles returns the names of the run's stdout, stderr and build logs that
+// were recorded, in that order.
+func (cm *ContainerManager) LogFiles() []string {
+	var files []string
+	for _, name := range []string{cm.StdoutLog, cm.StderrLog, cm.BuildLog} {
+		if name != "" {
+			files = append(files, name)
+		}
+	}
+	return files
+}
@@ -0,0 +1,163 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/containers/buildah/define"
+)
+
+// Container engines a server can run.
+const (
+	EnginePodman     = "podman"
+	EngineDocker     = "docker"
+	EngineKubernetes = "kubernetes"
+)
+
+var (
+	ErrUnsupported   = errors.New("not supported by the server's container engine")
+	ErrServerOffline = errors.New("server is offline")
+	ErrNoSuchPath    = errors.New("no such path in container")
+)
+
+// ContainerSpec describes a container to create.
+type ContainerSpec struct {
+	Name      string
+	Image     string
+	Env       map[string]string
+	Mounts    []Mount
+	Resources Resources // limits of the container, zero fields are unlimited
+	// Interactive keeps the container's input open for AttachStdin.
+	Interactive bool
+	Labels      map[string]string // describe the run, see RunLabels
+}
+
+// ContainerSummary is a container of maestro's as the engine lists it.
+type ContainerSummary struct {
+	ID        string
+	Name      string
+	ImageID   string
+	Labels    map[string]string
+	Running   bool // running or paused
+	Exited    bool // exited, unlike one only created
+	CreatedAt time.Time
+}
+
+// ContainerState is the state of a container as its engine reports it.
+type ContainerState struct {
+	Exited     bool
+	ExitCode   int
+	OOMKilled  bool
+	FinishedAt time.Time
+}
+
+// ContainerEvent is an exit or out-of-memory kill of a container.
+type ContainerEvent struct {
+	ID       string
+	Action   string // "died" or "oom"
+	ExitCode int
+	Time     time.Time
+}
+
+// EngineInfo describes the container engine of a server and its host.
+type EngineInfo struct {
+	Engine      string `json:"engine"`
+	Version     string `json:"version"`
+	OS          string `json:"os"`
+	Arch        string `json:"arch"`
+	MemTotal    int64  `json:"memTotal"`
+	StorageRoot string `json:"storageRoot"` // directory images and containers are stored in
+
+	Distribution  string `json:"distribution"` // e.g. fedora 42
+	Kernel        string `json:"kernel"`
+	CPUs          int    `json:"cpus"`
+	StorageDriver string `json:"storageDriver"`
+	Images        int    `json:"images"`
+	Containers    int    `json:"containers"`
+}
+
+// ImageBuild describes a build of an image from a context directory.
+type ImageBuild struct {
+	ContextDir    string
+	Containerfile string // absolute path, empty for the context's default
+	Excludes      []string
+	Args          map[string]string
+	NoCache       bool
+	PullPolicy    define.PullPolicy
+	ForceRm       bool
+	Platforms     []Platform
+	Manifest      string // manifest list a multi-platform build is collected in
+	Target        string
+	Labels        []string // key=value
+	Out           io.Writer
+}
+
+// Runtime is the API of the container engine a server runs containers with.
+// Podman servers implement it with the Podman bindings, Docker servers with
+// the Docker Engine API and Kubernetes servers with Jobs. Features only Podman offers, such as manifest lists,
+// image transfers and quarantine forensics, use the Podman connection
+// directly and fail with ErrUnsupported on other engines.
+type Runtime interface {
+	Engine() string
+	Info() (*EngineInfo, error)
+
+	CreateContainer(spec ContainerSpec) (string, error)
+	// ListContainers lists the containers created with RunLabels, exited
+	// ones included.
+	ListContainers() ([]ContainerSummary, error)
+	StartContainer(id string) error
+	StopContainer(id string) error
+	// RemoveContainer removes a container, stopping it first if force is
+	// set, and its anonymous volumes if volumes is set. A container that no
+	// longer exists is not an error.
+	RemoveContainer(id string, force, volumes bool) error
+	// PauseContainer freezes the processes of a running container until
+	// UnpauseContainer lets them continue.
+	PauseContainer(id string) error
+	UnpauseContainer(id string) error
+	InspectContainer(id string) (*ContainerState, error)
+	// KillContainer sends a signal, such as SIGUSR1, to the main process of
+	// a container.
+	KillContainer(id, signal string) error
+	// RestartContainer stops a container right away, like StopContainer, and
+	// starts it again.
+	RestartContainer(id string) error
+	// WaitContainer blocks until a container exits, or ctx is done, and
+	// returns its exit code.
+	WaitContainer(ctx context.Context, id string) (int, error)
+	// AttachContainer streams the output of a container until it exits,
+	// from the cursor on, and advances the cursor over the lines it writes.
+	AttachContainer(id string, cursor *LogCursor, stdout, stderr io.Writer) error
+	// AttachStdin writes stdin to the input of an interactive container until
+	// stdin ends or the container exits. The input stays open for the next
+	// attach.
+	AttachStdin(id string, stdin io.Reader) error
+	// ExecContainer runs an interactive command in a running container until
+	// it exits and returns its exit code.
+	ExecContainer(id string, exec Exec) (int, error)
+	// CopyFromContainer writes a tar archive of path in the container to w. It
+	// fails with ErrNoSuchPath if the path does not exist.
+	CopyFromContainer(id, path string, w io.Writer) error
+	// ContainerEvents passes container exits and OOM kills to handle until
+	// the stream ends.
+	ContainerEvents(handle func(ContainerEvent)) error
+
+	BuildImage(ctx context.Context, build ImageBuild) (string, error)
+	// PullImage pulls ref, only if the registry has a newer version when
+	// newer is set, and returns the image ID.
+	PullImage(ref string, newer bool) (string, error)
+	ImageExists(id string) (bool, error)
+	RemoveImage(id string) error
+}
+
+// podmanConn returns the Podman connection of the server, or ErrUnsupported
+// if the server runs another engine.
+func (cm *ConnectionManager) podmanConn() (context.Context, error) {
+	if cm.Server.Engine != "" && cm.Server.Engine != EnginePodman {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, cm.Server.Engine)
+	}
+	return cm.Conn, nil
+}
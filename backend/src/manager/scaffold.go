@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+var ErrUnknownTemplate = errors.New("unknown template")
+
+// ScaffoldFile is a file a template writes into the workspace.
+type ScaffoldFile struct {
+	Name    string
+	Content string
+	Mode    os.FileMode
+	// Keep leaves an existing file alone, e.g. the dependency list.
+	Keep bool
+}
+
+// scaffoldTemplate is a starter Containerfile for a kind of project.
+type scaffoldTemplate struct {
+	base    string
+	setup   string       // instructions between FROM and COPY of the workspace
+	command string       // default command, JSON array
+	starter ScaffoldFile // dependency list the setup installs from
+}
+
+var scaffoldTemplates = map[string]scaffoldTemplate{
+	"python": {
+		base: "docker.io/library/python:3.12-slim",
+		setup: `WORKDIR /app
+COPY requirements.txt ./
+RUN pip install --no-cache-dir -r requirements.txt`,
+		command: `["python", "main.py"]`,
+		starter: ScaffoldFile{Name: "requirements.txt", Content: "# one package per line, e.g. numpy==2.1.0\n", Mode: 0644, Keep: true},
+	},
+	"r": {
+		base: "docker.io/rocker/r-ver:4.4",
+		setup: `WORKDIR /app
+COPY install.R ./
+RUN Rscript install.R`,
+		command: `["Rscript", "main.R"]`,
+		starter: ScaffoldFile{Name: "install.R", Content: "# install the packages the project needs, e.g.\n# install.packages(c(\"data.table\"))\n", Mode: 0644, Keep: true},
+	},
+	"node": {
+		base: "docker.io/library/node:22-slim",
+		setup: `WORKDIR /app
+COPY package.json ./
+RUN npm install --omit=dev`,
+		command: `["node", "index.js"]`,
+		starter: ScaffoldFile{Name: "package.json", Content: "{\n  \"name\": \"workspace\",\n  \"private\": true,\n  \"dependencies\": {}\n}\n", Mode: 0644, Keep: true},
+	},
+	"cuda": {
+		base: "docker.io/nvidia/cuda:12.6.3-runtime-ubuntu24.04",
+		setup: `RUN apt-get update \
+    && apt-get install -y --no-install-recommends python3 python3-pip \
+    && rm -rf /var/lib/apt/lists/*
+WORKDIR /app
+COPY requirements.txt ./
+RUN pip3 install --no-cache-dir --break-system-packages -r requirements.txt`,
+		command: `["python3", "main.py"]`,
+		starter: ScaffoldFile{Name: "requirements.txt", Content: "# one package per line, e.g. torch==2.5.1\n", Mode: 0644, Keep: true},
+	},
+}
+
+const scaffoldEntrypoint = `#!/bin/sh
+# Runs before the command of every run, e.g. to fetch data or set up the
+# environment. The command and its arguments follow in "$@".
+set -e
+
+exec "$@"
+`
+
+// ScaffoldTemplates lists the available template names.
+func ScaffoldTemplates() []string {
+	return slices.Sorted(maps.Keys(scaffoldTemplates))
+}
+
+// ScaffoldBaseImage returns the image a template builds FROM.
+func ScaffoldBaseImage(template string) (string, error) {
+	tmpl, exists := scaffoldTemplates[template]
+	if !exists {
+		return "", fmt.Errorf("%w %s, expected one of %s", ErrUnknownTemplate, template, strings.Join(ScaffoldTemplates(), ", "))
+	}
+	return tmpl.base, nil
+}
+
+// Scaffold returns the files of a starter project: a Containerfile, the
+// dependency list it installs from and, if requested, an entrypoint script
+// run before every command.
+func Scaffold(template string, entrypoint bool) ([]ScaffoldFile, error) {
+	base, err := ScaffoldBaseImage(template)
+	if err != nil {
+		return nil, err
+	}
+	tmpl := scaffoldTemplates[template]
+
+	var containerfile strings.Builder
+	fmt.Fprintf(&containerfile, "# Generated by maestro from the %s template.\n", template)
+	fmt.Fprintf(&containerfile, "FROM %s\n\n%s\n\nCOPY . .\n", base, tmpl.setup)
+	if entrypoint {
+		containerfile.WriteString("\nCOPY entrypoint.sh /usr/local/bin/entrypoint.sh\nRUN chmod +x /usr/local/bin/entrypoint.sh\nENTRYPOINT [\"/usr/local/bin/entrypoint.sh\"]\n")
+	}
+	fmt.Fprintf(&containerfile, "CMD %s\n", tmpl.command)
+
+	files := []ScaffoldFile{
+		{Name: "Containerfile", Content: containerfile.String(), Mode: 0644},
+		tmpl.starter,
+	}
+	if entrypoint {
+		files = append(files, ScaffoldFile{Name: "entrypoint.sh", Content: scaffoldEntrypoint, Mode: 0755})
+	}
+	return files, nil
+}
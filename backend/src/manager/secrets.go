@@ -0,0 +1,362 @@
+package manager
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSecretNotFound   = errors.New("secret not found")
+	ErrSecretsDisabled  = errors.New("no secret key configured")
+	ErrInvalidSecretKey = errors.New("invalid secret key")
+)
+
+// secretNamePattern restricts secret names to what is safe in file names and
+// environment variables.
+var secretNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// SecretKey is a master key secrets are encrypted with. The key is 32 bytes,
+// base64 encoded, given inline or through an environment variable.
+type SecretKey struct {
+	ID  string `yaml:"id"`
+	Key string `yaml:"key"`
+	Env string `yaml:"env"`
+}
+
+// SecretsConfig lists the master keys. The first key encrypts new secrets and
+// the others only decrypt secrets not rotated yet.
+type SecretsConfig struct {
+	Keys []SecretKey `yaml:"keys"`
+}
+
+// Secret is a stored secret. The value only ever exists encrypted with
+// AES-256-GCM, bound to the secret's name.
+type Secret struct {
+	Name       string    `json:"name"`
+	KeyID      string    `json:"key_id"`
+	Nonce      []byte    `json:"nonce"`
+	Ciphertext []byte    `json:"ciphertext"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SecretInfo is the metadata of a secret exposed through the API.
+type SecretInfo struct {
+	Name      string    `json:"name"`
+	KeyID     string    `json:"key_id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SecretStore keeps encrypted secrets in a file of the state directory.
+type SecretStore struct {
+	path    string
+	primary string
+	ciphers map[string]cipher.AEAD
+
+	mu      sync.RWMutex
+	secrets map[string]*Secret
+}
+
+// ValidSecretName reports whether name can be used for a secret.
+func ValidSecretName(name string) bool {
+	return secretNamePattern.MatchString(name)
+}
+
+// OpenSecretStore loads the secrets saved in stateDir with the configured
+// keys. Without keys the store is disabled and every operation fails with
+// ErrSecretsDisabled.
+func OpenSecretStore(stateDir string, cfg SecretsConfig) (*SecretStore, error) {
+	s := &SecretStore{
+		path:    filepath.Join(stateDir, "secrets.json"),
+		ciphers: map[string]cipher.AEAD{},
+		secrets: map[string]*Secret{},
+	}
+
+	for _, key := range cfg.Keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("%w: key without id", ErrInvalidSecretKey)
+		}
+		if _, exists := s.ciphers[key.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate key %s", ErrInvalidSecretKey, key.ID)
+		}
+
+		encoded := key.Key
+		if key.Env != "" {
+			encoded = os.Getenv(key.Env)
+		}
+		raw, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("%w: key %s must be 32 bytes, base64 encoded", ErrInvalidSecretKey, key.ID)
+		}
+
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		s.ciphers[key.ID] = aead
+		if s.primary == "" {
+			s.primary = key.ID
+		}
+	}
+
+	raw, err := os.ReadFile(s.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	var secrets []*Secret
+	if err := json.Unmarshal(raw, &secrets); err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		s.secrets[secret.Name] = secret
+	}
+	return s, nil
+}
+
+// Enabled reports whether a master key is configured.
+func (s *SecretStore) Enabled() bool {
+	return s.primary != ""
+}
+
+// UnknownKeys lists the key IDs of stored secrets that no configured key can
+// decrypt.
+func (s *SecretStore) UnknownKeys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{}
+	var unknown []string
+	for _, secret := range s.secrets {
+		if _, exists := s.ciphers[secret.KeyID]; !exists && !seen[secret.KeyID] {
+			seen[secret.KeyID] = true
+			unknown = append(unknown, secret.KeyID)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// List returns the metadata of all secrets, sorted by name.
+func (s *SecretStore) List() []SecretInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	infos := []SecretInfo{}
+	for _, secret := range s.secrets {
+		infos = append(infos, secret.info())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos
+}
+
+// Info returns the metadata of a secret.
+func (s *SecretStore) Info(name string) (SecretInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secret, exists := s.secrets[name]
+	if !exists {
+		return SecretInfo{}, ErrSecretNotFound
+	}
+	return secret.info(), nil
+}
+
+// Set encrypts value with the primary key and stores it under name.
+func (s *SecretStore) Set(name string, value []byte) (SecretInfo, error) {
+	if !s.Enabled() {
+		return SecretInfo{}, ErrSecretsDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nonce, ciphertext, err := s.seal(s.primary, name, value)
+	if err != nil {
+		return SecretInfo{}, err
+	}
+
+	now := time.Now()
+	secret, exists := s.secrets[name]
+	if !exists {
+		secret = &Secret{Name: name, CreatedAt: now}
+	}
+	updated := *secret
+	updated.KeyID = s.primary
+	updated.Nonce = nonce
+	updated.Ciphertext = ciphertext
+	updated.UpdatedAt = now
+
+	s.secrets[name] = &updated
+	if err := s.save(); err != nil {
+		if exists {
+			s.secrets[name] = secret
+		} else {
+			delete(s.secrets, name)
+		}
+		return SecretInfo{}, err
+	}
+	return updated.info(), nil
+}
+
+// Delete removes a secret.
+func (s *SecretStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, exists := s.secrets[name]
+	if !exists {
+		return ErrSecretNotFound
+	}
+
+	delete(s.secrets, name)
+	if err := s.save(); err != nil {
+		s.secrets[name] = secret
+		return err
+	}
+	return nil
+}
+
+// Reveal decrypts a secret for internal use. Secret values are never
+// returned through the API.
+func (s *SecretStore) Reveal(name string) ([]byte, error) {
+	if !s.Enabled() {
+		return nil, ErrSecretsDisabled
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	secret, exists := s.secrets[name]
+	if !exists {
+		return nil, ErrSecretNotFound
+	}
+	return s.open(secret)
+}
+
+// Rotate re-encrypts every secret not encrypted with the primary key yet.
+// Once it succeeds, the older keys can be removed from the config.
+func (s *SecretStore) Rotate() (int, error) {
+	if !s.Enabled() {
+		return 0, ErrSecretsDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rotated := map[string]*Secret{}
+	for name, secret := range s.secrets {
+		if secret.KeyID == s.primary {
+			continue
+		}
+
+		value, err := s.open(secret)
+		if err != nil {
+			return 0, fmt.Errorf("secret %s: %v", name, err)
+		}
+		nonce, ciphertext, err := s.seal(s.primary, name, value)
+		if err != nil {
+			return 0, fmt.Errorf("secret %s: %v", name, err)
+		}
+
+		updated := *secret
+		updated.KeyID = s.primary
+		updated.Nonce = nonce
+		updated.Ciphertext = ciphertext
+		rotated[name] = &updated
+	}
+	if len(rotated) == 0 {
+		return 0, nil
+	}
+
+	previous := make(map[string]*Secret, len(rotated))
+	for name, secret := range rotated {
+		previous[name] = s.secrets[name]
+		s.secrets[name] = secret
+	}
+	if err := s.save(); err != nil {
+		for name, secret := range previous {
+			s.secrets[name] = secret
+		}
+		return 0, err
+	}
+	return len(rotated), nil
+}
+
+func (s *SecretStore) seal(keyID, name string, value []byte) ([]byte, []byte, error) {
+	aead := s.ciphers[keyID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	// the name is authenticated so ciphertexts cannot be swapped between secrets
+	return nonce, aead.Seal(nil, nonce, value, []byte(name)), nil
+}
+
+func (s *SecretStore) open(secret *Secret) ([]byte, error) {
+	aead, exists := s.ciphers[secret.KeyID]
+	if !exists {
+		return nil, fmt.Errorf("%w: key %s is not configured", ErrInvalidSecretKey, secret.KeyID)
+	}
+	value, err := aead.Open(nil, secret.Nonce, secret.Ciphertext, []byte(secret.Name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt with key %s: %v", secret.KeyID, err)
+	}
+	return value, nil
+}
+
+// save writes the secrets to a temporary file first so a crash never leaves
+// a truncated store. The caller must hold s.mu.
+func (s *SecretStore) save() error {
+	secrets := make([]*Secret, 0, len(s.secrets))
+	for _, secret := range s.secrets {
+		secrets = append(secrets, secret)
+	}
+	sort.Slice(secrets, func(i, j int) bool {
+		return secrets[i].Name < secrets[j].Name
+	})
+
+	raw, err := json.Marshal(secrets)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func (secret *Secret) info() SecretInfo {
+	return SecretInfo{
+		Name:      secret.Name,
+		KeyID:     secret.KeyID,
+		CreatedAt: secret.CreatedAt,
+		UpdatedAt: secret.UpdatedAt,
+	}
+}
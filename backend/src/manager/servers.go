@@ -0,0 +1,227 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerRegistration is a server added through the API rather than the
+// configuration.
+type ServerRegistration struct {
+	Name         string `json:"name" binding:"required,server_name"`
+	Engine       string `json:"engine" binding:"omitempty,oneof=podman docker kubernetes"` // podman (the default), docker or kubernetes
+	URI          string `json:"uri"`                                                       // unix://, tcp:// or ssh:// engine URI, instead of the fields below
+	Username     string `json:"username"`
+	Host         string `json:"host"`
+	Port         int    `json:"port" binding:"gte=0,lte=65535"`
+	PodmanSocket string `json:"podman_socket"`
+	IdentityFile string `json:"identity_file"`
+
+	IdentityPassphraseSecret string `json:"identity_passphrase_secret"`
+	KnownHostsFile           string `json:"known_hosts_file"`
+	InsecureIgnoreHostKey    bool   `json:"insecure_ignore_host_key"`
+	PoolSize                 int    `json:"pool_size" binding:"gte=0"`
+	RemoteDir                string `json:"remote_dir"`
+	Kubeconfig               string `json:"kubeconfig"`
+	Namespace                string `json:"namespace"`
+
+	Labels   map[string]string `json:"labels"`
+	Capacity Resources         `json:"capacity"`
+}
+
+// Validate checks the registration can be connected to.
+func (r ServerRegistration) Validate() error {
+	if r.Name == "" || strings.ContainsAny(r.Name, "/,: ") {
+		return fmt.Errorf("invalid server name %q", r.Name)
+	}
+	if r.PoolSize < 0 {
+		return fmt.Errorf("invalid pool size %d", r.PoolSize)
+	}
+	if err := r.Capacity.Validate(); err != nil {
+		return err
+	}
+	for key := range r.Labels {
+		if key == "" || strings.ContainsAny(key, "=! ") {
+			return fmt.Errorf("invalid label %q", key)
+		}
+	}
+	if r.Engine == EngineKubernetes {
+		return nil
+	}
+	if r.URI != "" {
+		_, err := EngineURI(r.Info())
+		return err
+	}
+	if r.Username == "" || r.Host == "" {
+		return fmt.Errorf("username and host are required without a uri")
+	}
+	if r.Port < 0 || r.Port > 65535 {
+		return fmt.Errorf("invalid port %d", r.Port)
+	}
+	if !strings.HasPrefix(r.PodmanSocket, "/") {
+		return fmt.Errorf("podman socket must be an absolute path")
+	}
+	return nil
+}
+
+// Info returns the server configuration of the registration.
+func (r ServerRegistration) Info() ServerInfo {
+	port := r.Port
+	if port == 0 {
+		port = 22
+	}
+	return ServerInfo{
+		Name:         r.Name,
+		Engine:       r.Engine,
+		URI:          r.URI,
+		Username:     r.Username,
+		Host:         r.Host,
+		Port:         port,
+		PodmanSocket: r.PodmanSocket,
+		IdentityFile: r.IdentityFile,
+
+		IdentityPassphraseSecret: r.IdentityPassphraseSecret,
+		KnownHostsFile:           r.KnownHostsFile,
+		InsecureIgnoreHostKey:    r.InsecureIgnoreHostKey,
+		PoolSize:                 r.PoolSize,
+		RemoteDir:                r.RemoteDir,
+		Kubeconfig:               r.Kubeconfig,
+		Namespace:                r.Namespace,
+		Labels:                   r.Labels,
+		Capacity:                 r.Capacity,
+	}
+}
+
+// ServerRegistry records the servers added and removed through the API, so
+// they are connected, or left out, again after a restart.
+type ServerRegistry struct {
+	Added   []ServerRegistration `json:"added"`
+	Removed []string             `json:"removed"` // configured servers removed through the API
+
+	Maintenance []string `json:"maintenance"` // servers drained for maintenance
+
+	mu sync.Mutex
+}
+
+func serversPath(stateDir string) string {
+	return filepath.Join(stateDir, "servers.json")
+}
+
+// LoadServerRegistry reads the registry saved in stateDir, empty if none was
+// saved yet.
+func LoadServerRegistry(stateDir string) (*ServerRegistry, error) {
+	registry := &ServerRegistry{}
+	raw, err := os.ReadFile(serversPath(stateDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return registry, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, registry); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+// Servers merges the registry into the configured servers.
+func (r *ServerRegistry) Servers(configured map[string]ServerInfo) map[string]ServerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	servers := make(map[string]ServerInfo, len(configured)+len(r.Added))
+	for name, info := range configured {
+		if !slices.Contains(r.Removed, name) {
+			servers[name] = info
+		}
+	}
+	for _, registration := range r.Added {
+		servers[registration.Name] = registration.Info()
+	}
+	return servers
+}
+
+// Add records a server added through the API.
+func (r *ServerRegistry) Add(registration ServerRegistration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Removed = slices.DeleteFunc(r.Removed, func(name string) bool { return name == registration.Name })
+	r.Added = append(r.Added, registration)
+	sort.Slice(r.Added, func(i, j int) bool {
+		return r.Added[i].Name < r.Added[j].Name
+	})
+}
+
+// Remove records a server removed through the API.
+func (r *ServerRegistry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Added = slices.DeleteFunc(r.Added, func(registration ServerRegistration) bool { return registration.Name == name })
+	r.Maintenance = slices.DeleteFunc(r.Maintenance, func(other string) bool { return other == name })
+	if !slices.Contains(r.Removed, name) {
+		r.Removed = append(r.Removed, name)
+	}
+}
+
+// Save persists the registry to stateDir.
+func (r *ServerRegistry) Save(stateDir string) error {
+	r.mu.Lock()
+	raw, err := json.Marshal(r)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(serversPath(stateDir), raw, 0600)
+}
+
+// RemoveServer takes a server out of placement and its groups. Its worker
+// runs the runs already queued and then stops.
+func (sm *ServiceManager) RemoveServer(cm *ConnectionManager) {
+	sm.Connections.Delete(cm.Server.Name)
+	for _, group := range sm.Groups.Values() {
+		if slices.Contains(group.Members, cm.Server.Name) {
+			members := slices.DeleteFunc(slices.Clone(group.Members), func(member string) bool { return member == cm.Server.Name })
+			sm.Groups.Store(group.Name, &ServerGroup{Name: group.Name, Members: members})
+		}
+	}
+	cm.RunQueue.Close()
+}
+
+// RunningOn returns the images with a container running on the server.
+func (sm *ServiceManager) RunningOn(cm *ConnectionManager) []string {
+	var running []string
+	sm.Images.Range(func(name string, im *ImageManager) bool {
+		im.Mu.RLock()
+		if im.Connection == cm && im.Container != nil && im.Container.FinishedAt == nil {
+			running = append(running, name)
+		}
+		im.Mu.RUnlock()
+		return true
+	})
+	slices.Sort(running)
+	return running
+}
+
+// Drain waits until the server's queue is empty and none of its containers
+// runs anymore, checking every interval, then closes its SSH connection.
+func (sm *ServiceManager) Drain(cm *ConnectionManager, interval time.Duration) {
+	for cm.RunQueue.Len() > 0 || len(sm.RunningOn(cm)) > 0 {
+		time.Sleep(interval)
+	}
+	if cm.SshConn != nil {
+		cm.SshConn.Close()
+	}
+}
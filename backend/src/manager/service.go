@@ -1,13 +1,20 @@
 package manager
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/containers/buildah/define"
-	"github.com/containers/podman/v6/pkg/bindings/containers"
-	"github.com/containers/podman/v6/pkg/bindings/images"
-	"github.com/containers/podman/v6/pkg/domain/entities/types"
+	"github.com/containers/podman/v6/pkg/bindings/manifests"
 )
 
 func (cm *ConnectionManager) MarshalJSON() ([]byte, error) {
@@ -35,42 +42,378 @@ func (im *ImageManager) MarshalJSON() ([]byte, error) {
 }
 
 func (im *ImageManager) ClearContainer() {
-	im.Container = nil
+	if im.Container != nil {
+		im.Container.Activity.Finish(time.Now())
+	}
+	im.archiveContainer()
+}
+
+// RemoveContainer force-removes a container and its anonymous volumes. A
+// container that no longer exists is not an error.
+func (cm *ConnectionManager) RemoveContainer(containerID string) error {
+	return cm.Runtime.RemoveContainer(containerID, true, true)
+}
+
+// BuildOptions tunes a single build. The zero value builds the workspace.
+type BuildOptions struct {
+	// ContextDir overrides the build context, e.g. with a materialized
+	// snapshot. Defaults to the image's FilesDir.
+	ContextDir string
+	// Snapshot names the snapshot the context was materialized from, if any.
+	Snapshot string
+	// Git is the repository and commit the context was cloned from, if any.
+	Git string
+	// Commit is the commit of a workspace checkout or cloned repository the
+	// context holds, suffixed -dirty with local changes. Empty otherwise.
+	Commit string
+	// Containerfile is the path of the Containerfile relative to the context,
+	// e.g. gpu/Containerfile. Defaults to the Containerfile or Dockerfile at
+	// the context root.
+	Containerfile string
+	// NoCache rebuilds every layer instead of reusing cached ones.
+	NoCache bool
+	// PullPolicy is missing (the default), always, ifnewer or never.
+	PullPolicy string
+	// ForceRm removes intermediate containers even when the build fails.
+	ForceRm bool
+	// Platforms are the os/arch targets of a cross-platform build, e.g.
+	// linux/arm64. Several platforms are collected in a manifest list. Empty
+	// builds for the server's own platform.
+	Platforms []string
+	// Target is the stage of a multi-stage Containerfile to build, e.g.
+	// builder. Defaults to the last stage.
+	Target string
+	// Labels are added to the built image.
+	Labels map[string]string
+}
+
+// stagePattern matches the stage names a Containerfile can declare with AS.
+var stagePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9._-]*$`)
+
+// ValidateStageAndLabels checks the target stage and the image labels of a
+// build.
+func ValidateStageAndLabels(target string, labels map[string]string) error {
+	if target != "" && !stagePattern.MatchString(target) {
+		return fmt.Errorf("invalid target stage %s", target)
+	}
+	for key := range labels {
+		if key == "" || strings.ContainsAny(key, "= \t\n") {
+			return fmt.Errorf("invalid label %q", key)
+		}
+	}
+	return nil
 }
 
-func (im *ImageManager) Build(mc *ConnectionManager) error {
+// ParsePullPolicy maps a pull policy name to buildah's, with "" meaning
+// missing.
+func ParsePullPolicy(name string) (define.PullPolicy, error) {
+	if name == "" {
+		return define.PullIfMissing, nil
+	}
+	policy, exists := define.PolicyMap[name]
+	if !exists {
+		return 0, fmt.Errorf("unknown pull policy %s, expected missing, always, ifnewer or never", name)
+	}
+	return policy, nil
+}
+
+// BuildConfig bounds the builds of all servers.
+type BuildConfig struct {
+	// TimeoutMinutes is how long a build may take before it is canceled. 0
+	// disables the timeout.
+	TimeoutMinutes int `yaml:"timeoutMinutes"`
+}
+
+// BuildContext returns the context builds run under, canceled once the
+// configured timeout passes.
+func (cfg BuildConfig) BuildContext() (context.Context, context.CancelFunc) {
+	if cfg.TimeoutMinutes <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutMinutes)*time.Minute)
+}
+
+// Build builds the image on the server and makes it the image the workspace
+// runs. Canceling ctx stops the build.
+func (im *ImageManager) Build(ctx context.Context, mc *ConnectionManager, opts BuildOptions) error {
+	// the previous image is only removed for a build that is going to run
+	if ctx.Err() != nil {
+		return errors.New("build canceled before it started")
+	}
+
 	if im.Container != nil {
-		containers.Remove(mc.Conn, im.Container.ID, &containers.RemoveOptions{
-			Ignore:  func(a bool) *bool { return &a }(true),
-			Volumes: func(a bool) *bool { return &a }(true),
-			Force:   func(a bool) *bool { return &a }(false),
-			Depend:  nil, // TODO: learn what this param does
-			Timeout: func(a uint) *uint { return &a }(0),
-		})
+		mc.Runtime.RemoveContainer(im.Container.ID, false, true)
+	}
+
+	// prebuilt images may be shared with other workspaces, so only remove
+	// images built from this workspace
+	if im.ID != nil && im.Prebuilt == "" {
+		removeImage(mc, *im.ID)
+	}
+
+	logName := fmt.Sprintf("build-%s.log", time.Now().Format("02-01-2006_15-04-05"))
+	built, err := im.buildImage(ctx, mc, opts, logName)
+	if err != nil {
+		return err
 	}
 
-	if im.ID != nil {
-		images.Remove(mc.Conn, []string{*im.ID}, &images.RemoveOptions{
-			All:            func(a bool) *bool { return &a }(false),
-			Force:          func(a bool) *bool { return &a }(false),
-			Ignore:         func(a bool) *bool { return &a }(true),
-			LookupManifest: func(a bool) *bool { return &a }(false),
-			NoPrune:        func(a bool) *bool { return &a }(false),
+	im.useBuild(mc, opts, built)
+	im.ServerImages = map[string]string{mc.Server.Name: built.id}
+	return nil
+}
+
+// BuildOnServers builds the image on every server at once and reports each
+// outcome to done. The caller must not hold im.Mu, it is only taken to record
+// the builds, so runs of the image are not blocked while the builds take. The
+// image then runs on any of the servers it was built on without a rebuild.
+func (im *ImageManager) BuildOnServers(ctx context.Context, connections []*ConnectionManager, opts BuildOptions, done func(server string, err error)) {
+	stamp := time.Now().Format("02-01-2006_15-04-05")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	builds := map[*ConnectionManager]*builtImage{}
+	for _, mc := range connections {
+		wg.Go(func() {
+			built, err := im.buildImage(ctx, mc, opts, fmt.Sprintf("build-%s-%s.log", mc.Server.Name, stamp))
+			if err == nil {
+				mu.Lock()
+				builds[mc] = built
+				mu.Unlock()
+			}
+			done(mc.Server.Name, err)
 		})
 	}
+	wg.Wait()
+	if len(builds) == 0 {
+		return
+	}
+
+	im.Mu.Lock()
+	defer im.Mu.Unlock()
 
-	buildReport, err := images.BuildFromServerContext(mc.Conn, nil, types.BuildOptions{
-		BuildOptions: define.BuildOptions{
-			ContextDirectory: im.FilesDir,
-		},
+	// keep running on the current server if it was rebuilt
+	primary := im.Connection
+	if _, exists := builds[primary]; !exists {
+		for _, mc := range connections {
+			if _, exists := builds[mc]; exists {
+				primary = mc
+				break
+			}
+		}
+	}
+
+	serverImages := map[string]string{}
+	for mc, built := range builds {
+		if old, exists := im.ServerImages[mc.Server.Name]; exists && im.Prebuilt == "" && old != built.id {
+			removeImage(mc, old)
+		}
+		serverImages[mc.Server.Name] = built.id
+	}
+	im.useBuild(primary, opts, builds[primary])
+	im.ServerImages = serverImages
+}
+
+// UseServerImage switches to the build of the image on the server, if the
+// last build made one there, and reports whether it did.
+func (im *ImageManager) UseServerImage(mc *ConnectionManager) bool {
+	id, exists := im.ServerImages[mc.Server.Name]
+	if !exists || im.Prebuilt != "" {
+		return false
+	}
+	im.ID = &id
+	im.Connection = mc
+	return true
+}
+
+// UsePushed switches to the build pushed as ref, for the Kubernetes server mc
+// to pull. The build stays on the server it was made on, so runs there do not
+// rebuild it.
+func (im *ImageManager) UsePushed(mc *ConnectionManager, ref string) {
+	im.ID = &ref
+	im.Connection = mc
+}
+
+// builtImage is the outcome of a build on one server.
+type builtImage struct {
+	id        string
+	manifest  string
+	platforms map[string]string
+}
+
+// useBuild makes a build the image the workspace runs.
+func (im *ImageManager) useBuild(mc *ConnectionManager, opts BuildOptions, built *builtImage) {
+	im.ID = &built.id
+	im.Manifest = built.manifest
+	im.Platforms = built.platforms
+	im.Connection = mc
+	im.Snapshot = opts.Snapshot
+	im.Git = opts.Git
+	im.Commit = opts.Commit
+	im.Containerfile = opts.Containerfile
+	im.Target = opts.Target
+	im.Labels = opts.Labels
+	im.Prebuilt = ""
+}
+
+func removeImage(mc *ConnectionManager, id string) {
+	mc.Runtime.RemoveImage(id)
+}
+
+// buildImage builds the image on the server, capturing the output in the
+// workspace file logName, without changing the image manager.
+func (im *ImageManager) buildImage(ctx context.Context, mc *ConnectionManager, opts BuildOptions, logName string) (*builtImage, error) {
+	// capture the build output next to the workspace files
+	logPath := filepath.Join(im.FilesDir, logName)
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build log: %v", err)
+	}
+	defer logFile.Close()
+
+	buildLog := &BuildLog{Name: logName, Path: logPath, done: make(chan struct{})}
+	im.buildLog.Store(buildLog)
+	defer close(buildLog.done)
+
+	activity := mc.BeginActivity(BuildActivity, im.Name)
+	defer func() { activity.Finish(time.Now()) }()
+
+	contextDir := opts.ContextDir
+	if contextDir == "" {
+		contextDir = im.FilesDir
+	}
+
+	pullPolicy, err := ParsePullPolicy(opts.PullPolicy)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateStageAndLabels(opts.Target, opts.Labels); err != nil {
+		return nil, err
+	}
+	var labels []string
+	for key, value := range opts.Labels {
+		labels = append(labels, key+"="+value)
+	}
+	sort.Strings(labels)
+	platforms, err := ParsePlatforms(opts.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	// a multi-platform build adds every image to a fresh manifest list
+	manifest := ""
+	if len(platforms) > 1 {
+		conn, err := mc.podmanConn()
+		if err != nil {
+			return nil, fmt.Errorf("multi-platform build: %w", err)
+		}
+		manifest = manifestName(im.Name)
+		manifests.Delete(conn, manifest)
+	}
+
+	containerfile := ""
+	if opts.Containerfile != "" {
+		containerfile, err = Containerfile(contextDir, opts.Containerfile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	excludes, err := BuildExcludes(contextDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore files: %v", err)
+	}
+
+	id, err := mc.Runtime.BuildImage(ctx, ImageBuild{
+		ContextDir:    contextDir,
+		Containerfile: containerfile,
+		Excludes:      excludes,
+		Args:          BuildArgs(mc.Server.Defaults),
+		NoCache:       opts.NoCache,
+		PullPolicy:    pullPolicy,
+		ForceRm:       opts.ForceRm,
+		Platforms:     platforms,
+		Manifest:      manifest,
+		Target:        opts.Target,
+		Labels:        labels,
+		Out:           logFile,
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to build image: %v", err)
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = errors.New("build timed out")
+		case ctx.Err() != nil:
+			err = errors.New("build canceled")
+		}
+		fmt.Fprintf(logFile, "Error: %v\n", err)
+		return nil, fmt.Errorf("failed to build image (see %s): %v", logName, err)
+	}
+
+	built := &builtImage{id: id, manifest: manifest}
+	switch {
+	case manifest != "":
+		built.platforms, err = platformImages(mc, manifest)
+		if err != nil {
+			return nil, err
+		}
+	case len(platforms) == 1:
+		built.platforms = map[string]string{platforms[0].String(): id}
+	}
+	return built, nil
+}
+
+// BuildArgs returns the build args a server passes to every build.
+func BuildArgs(defaults RunDefaults) map[string]string {
+	args := map[string]string{}
+	if defaults.RegistryMirror != "" {
+		args["REGISTRY_MIRROR"] = defaults.RegistryMirror
+	}
+	return args
+}
+
+// UsePrebuilt pulls a prebuilt image on the server and makes it the image the
+// workspace runs, in place of a build of the workspace.
+func (im *ImageManager) UsePrebuilt(mc *ConnectionManager, ref string) error {
+	if im.ID != nil && im.Prebuilt == "" && im.Connection != nil {
+		im.Connection.Runtime.RemoveImage(*im.ID)
+	}
+
+	id, err := mc.Runtime.PullImage(ref, false)
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %v", ref, err)
 	}
 
-	im.ID = &buildReport.ID
+	im.ID = &id
+	im.Manifest = ""
+	im.Platforms = nil
+	im.ServerImages = nil
 	im.Connection = mc
+	im.Snapshot = ""
+	im.Git = ""
+	im.Commit = ""
+	im.Containerfile = ""
+	im.Target = ""
+	im.Labels = nil
+	im.Prebuilt = ref
 
 	return nil
 }
+
+// BuildLog is the output file of a build. Done is closed once the build has
+// finished writing to it.
+type BuildLog struct {
+	Name string
+	Path string
+
+	done chan struct{}
+}
+
+// Done returns a channel closed when the build writing the log has finished.
+func (bl *BuildLog) Done() <-chan struct{} {
+	return bl.done
+}
+
+// LastBuildLog returns the log of the most recent build, or nil if the image
+// has not been built since startup. It does not require holding im.Mu, so the
+// log can be followed while a build holds the lock.
+func (im *ImageManager) LastBuildLog() *BuildLog {
+	return im.buildLog.Load()
+}
@@ -0,0 +1,32 @@
+package manager
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// ParseSignal normalizes the name of a signal to send to a container, such as
+// SIGUSR1, USR1 or 10, to its SIG name. Empty means SIGKILL.
+func ParseSignal(name string) (string, error) {
+	if name == "" {
+		return "SIGKILL", nil
+	}
+	if number, err := strconv.Atoi(name); err == nil {
+		if signal := unix.SignalName(unix.Signal(number)); signal != "" {
+			return signal, nil
+		}
+		return "", fmt.Errorf("unknown signal %s", name)
+	}
+
+	signal := strings.ToUpper(name)
+	if !strings.HasPrefix(signal, "SIG") {
+		signal = "SIG" + signal
+	}
+	if unix.SignalNum(signal) == 0 {
+		return "", fmt.Errorf("unknown signal %s", name)
+	}
+	return signal, nil
+}
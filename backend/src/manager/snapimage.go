@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/podman/v6/pkg/bindings/images"
+)
+
+var ErrNoSnapshotImage = errors.New("no image to snapshot")
+
+// snapshotImageRepo is the repository images kept by snapshots are tagged in.
+const snapshotImageRepo = "localhost/maestro-snapshot"
+
+// SnapshotImage is the image a workspace ran when a snapshot was taken.
+type SnapshotImage struct {
+	ID       string `json:"id"`
+	Server   string `json:"server"`
+	Tag      string `json:"tag,omitempty"`      // tag keeping a built image
+	Prebuilt string `json:"prebuilt,omitempty"` // reference of a prebuilt image
+}
+
+// KeepImage tags the image the workspace runs for the snapshot, so later
+// builds, which remove the previous image by ID, leave it in place.
+func (im *ImageManager) KeepImage(snapshotName string) (*SnapshotImage, error) {
+	if im.ID == nil || im.Connection == nil {
+		return nil, ErrNoSnapshotImage
+	}
+
+	kept := &SnapshotImage{ID: *im.ID, Server: im.Connection.Server.Name, Prebuilt: im.Prebuilt}
+	if im.Prebuilt != "" {
+		return kept, nil
+	}
+
+	conn, err := im.Connection.podmanConn()
+	if err != nil {
+		return nil, err
+	}
+	repo := snapshotImageRepo + "-" + strings.ToLower(im.Name)
+	if err := images.Tag(conn, *im.ID, snapshotName, repo, nil); err != nil {
+		return nil, fmt.Errorf("failed to tag image for snapshot %s: %v", snapshotName, err)
+	}
+	kept.Tag = repo + ":" + snapshotName
+	return kept, nil
+}
+
+// UseSnapshotImage makes the image recorded by a snapshot the image the
+// workspace runs again. It fails when the image no longer exists on its
+// server.
+func (im *ImageManager) UseSnapshotImage(mc *ConnectionManager, kept *SnapshotImage) error {
+	exists, err := mc.Runtime.ImageExists(kept.ID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("image %s of the snapshot no longer exists on server %s", kept.ID, mc.Server.Name)
+	}
+
+	id := kept.ID
+	im.useBuild(mc, BuildOptions{}, &builtImage{id: id})
+	im.ServerImages = map[string]string{mc.Server.Name: id}
+	im.Prebuilt = kept.Prebuilt
+	return nil
+}
@@ -0,0 +1,354 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSnapshotExists   = errors.New("snapshot already exists")
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrInvalidSnapshot  = errors.New("invalid snapshot name")
+)
+
+// digestPattern matches the hex SHA-256 digests objects are stored under.
+var digestPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// ValidSnapshotName reports whether a name can be used as a manifest file
+// name: it must not be empty, hidden or contain a path separator.
+func ValidSnapshotName(name string) bool {
+	return name != "" && filepath.Base(name) == name && !strings.HasPrefix(name, ".")
+}
+
+// IsLogFile reports whether a workspace file name is a captured run or build
+// log rather than a project file.
+func IsLogFile(name string) bool {
+	if !strings.HasSuffix(name, ".log") {
+		return false
+	}
+	return strings.HasPrefix(name, "stdout-") || strings.HasPrefix(name, "stderr-") || strings.HasPrefix(name, "build-")
+}
+
+// SnapshotFile is a single file recorded in a snapshot.
+type SnapshotFile struct {
+	Path   string      `json:"path"`
+	SHA256 string      `json:"sha256"`
+	Size   int64       `json:"size"`
+	Mode   fs.FileMode `json:"mode"`
+}
+
+// Snapshot is an immutable manifest of a workspace's project files. File
+// contents are stored once per digest in the store's object directory.
+type Snapshot struct {
+	Name      string         `json:"name"`
+	Image     string         `json:"image"`
+	CreatedAt time.Time      `json:"created_at"`
+	Files     []SnapshotFile `json:"files"`
+
+	BuiltImage *SnapshotImage `json:"built_image,omitempty"` // image the workspace ran, if recorded
+}
+
+// SnapshotSummary is the listing form of a snapshot.
+type SnapshotSummary struct {
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	FileCount int       `json:"file_count"`
+	Size      int64     `json:"size"`
+}
+
+// SnapshotDiff lists the paths that differ between two file sets.
+type SnapshotDiff struct {
+	Added    []string `json:"added"`
+	Removed  []string `json:"removed"`
+	Modified []string `json:"modified"`
+}
+
+// SnapshotStore keeps snapshot manifests per image and a shared
+// content-addressed object directory under Dir.
+type SnapshotStore struct {
+	Dir string
+}
+
+func (s *SnapshotStore) objectPath(digest string) string {
+	return filepath.Join(s.Dir, "objects", digest[:2], digest)
+}
+
+func (s *SnapshotStore) manifestPath(image, name string) string {
+	return filepath.Join(s.Dir, "manifests", image, name+".json")
+}
+
+// ScanWorkspace hashes every project file under dir, skipping captured logs.
+// When store is non-nil, file contents are also added to its object directory.
+func ScanWorkspace(dir string, store *SnapshotStore) ([]SnapshotFile, error) {
+	files := []SnapshotFile{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || IsLogFile(entry.Name()) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		digest, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		if store != nil {
+			if err := store.putObject(path, digest); err != nil {
+				return err
+			}
+		}
+
+		files = append(files, SnapshotFile{
+			Path:   filepath.ToSlash(rel),
+			SHA256: digest,
+			Size:   info.Size(),
+			Mode:   info.Mode().Perm(),
+		})
+		return nil
+	})
+	return files, err
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return HashReader(file)
+}
+
+// HashReader returns the hex SHA-256 digest of everything read from r.
+func HashReader(r io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// putObject copies the file into the object directory unless an object with
+// the same digest is already stored.
+func (s *SnapshotStore) putObject(path, digest string) error {
+	objectPath := s.objectPath(digest)
+	if _, err := os.Stat(objectPath); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0700); err != nil {
+		return err
+	}
+
+	// write to a temporary name first so a crash never leaves a partial object
+	tmpPath := objectPath + ".tmp"
+	if err := copyFile(path, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, objectPath)
+}
+
+// Create records the current project files of the image as a new snapshot,
+// along with the image the workspace runs when builtImage is set.
+func (s *SnapshotStore) Create(im *ImageManager, name string, builtImage *SnapshotImage) (*Snapshot, error) {
+	manifestPath := s.manifestPath(im.Name, name)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return nil, ErrSnapshotExists
+	}
+
+	files, err := ScanWorkspace(im.FilesDir, s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan workspace: %v", err)
+	}
+
+	snapshot := &Snapshot{
+		Name:       name,
+		Image:      im.Name,
+		CreatedAt:  time.Now(),
+		Files:      files,
+		BuiltImage: builtImage,
+	}
+
+	raw, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(manifestPath), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(manifestPath, raw, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write snapshot manifest: %v", err)
+	}
+
+	return snapshot, nil
+}
+
+// Get loads a snapshot manifest.
+func (s *SnapshotStore) Get(image, name string) (*Snapshot, error) {
+	if !ValidSnapshotName(name) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSnapshot, name)
+	}
+	raw, err := os.ReadFile(s.manifestPath(image, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrSnapshotNotFound
+		}
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	if err := json.Unmarshal(raw, &snapshot); err != nil {
+		return nil, fmt.Errorf("corrupt snapshot manifest %s: %v", name, err)
+	}
+	return &snapshot, nil
+}
+
+// List returns summaries of an image's snapshots, oldest first.
+func (s *SnapshotStore) List(image string) ([]SnapshotSummary, error) {
+	entries, err := os.ReadDir(filepath.Join(s.Dir, "manifests", image))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	summaries := []SnapshotSummary{}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		snapshot, err := s.Get(image, name)
+		if err != nil {
+			return nil, err
+		}
+
+		summary := SnapshotSummary{Name: snapshot.Name, CreatedAt: snapshot.CreatedAt, FileCount: len(snapshot.Files)}
+		for _, file := range snapshot.Files {
+			summary.Size += file.Size
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].CreatedAt.Before(summaries[j].CreatedAt)
+	})
+	return summaries, nil
+}
+
+// Materialize writes the snapshot's files into dir.
+func (s *SnapshotStore) Materialize(snapshot *Snapshot, dir string) error {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	for _, file := range snapshot.Files {
+		target, err := WorkspacePath(file.Path)
+		if err != nil {
+			return fmt.Errorf("invalid path in snapshot: %s", file.Path)
+		}
+
+		if err := s.restoreObject(root, file.SHA256, target); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", file.Path, err)
+		}
+		if err := root.Chmod(target, file.Mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreObject writes the object of the digest to target. Digests come from
+// manifests, so anything but a SHA-256 is refused rather than joined into a
+// path.
+func (s *SnapshotStore) restoreObject(root *os.Root, digest, target string) error {
+	if !digestPattern.MatchString(digest) {
+		return fmt.Errorf("invalid object digest %q", digest)
+	}
+	object, err := os.Open(s.objectPath(digest))
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	return WriteRootFile(root, target, object, 0600)
+}
+
+// Restore replaces the project files of the image with the snapshot's files.
+// Captured logs are kept.
+func (s *SnapshotStore) Restore(im *ImageManager, snapshot *Snapshot) error {
+	current, err := ScanWorkspace(im.FilesDir, nil)
+	if err != nil {
+		return fmt.Errorf("failed to scan workspace: %v", err)
+	}
+
+	root, err := im.OpenRoot()
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	keep := make(map[string]bool, len(snapshot.Files))
+	for _, file := range snapshot.Files {
+		keep[file.Path] = true
+	}
+	for _, file := range current {
+		if !keep[file.Path] {
+			if err := root.Remove(filepath.FromSlash(file.Path)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.Materialize(snapshot, im.FilesDir)
+}
+
+// DiffFiles compares two file sets by content digest.
+func DiffFiles(from, to []SnapshotFile) SnapshotDiff {
+	diff := SnapshotDiff{Added: []string{}, Removed: []string{}, Modified: []string{}}
+
+	before := make(map[string]string, len(from))
+	for _, file := range from {
+		before[file.Path] = file.SHA256
+	}
+
+	for _, file := range to {
+		digest, existed := before[file.Path]
+		switch {
+		case !existed:
+			diff.Added = append(diff.Added, file.Path)
+		case digest != file.SHA256:
+			diff.Modified = append(diff.Modified, file.Path)
+		}
+		delete(before, file.Path)
+	}
+	for path := range before {
+		diff.Removed = append(diff.Removed, path)
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+	return diff
+}
@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidSnapshotName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"v1", true},
+		{"before-refactor.2", true},
+		{"", false},
+		{".hidden", false},
+		{"..", false},
+		{"../other", false},
+		{"a/b", false},
+		{"/etc/passwd", false},
+	}
+	for _, tt := range tests {
+		if got := ValidSnapshotName(tt.name); got != tt.want {
+			t.Errorf("ValidSnapshotName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSnapshotStoreGet(t *testing.T) {
+	store := &SnapshotStore{Dir: t.TempDir()}
+	im := &ImageManager{Name: "demo", FilesDir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(im.FilesDir, "main.py"), []byte("print(1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Create(im, "v1", nil); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// a manifest outside the image's directory, as a traversal would reach
+	if err := os.WriteFile(filepath.Join(store.Dir, "manifests", "planted.json"), []byte(`{"name":"planted"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{"v1", nil},
+		{"v2", ErrSnapshotNotFound},
+		{"../planted", ErrInvalidSnapshot},
+		{".v1", ErrInvalidSnapshot},
+		{"", ErrInvalidSnapshot},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := store.Get("demo", tt.name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get(%q) error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			if err == nil && (snapshot.Name != tt.name || len(snapshot.Files) != 1) {
+				t.Errorf("Get(%q) = %+v", tt.name, snapshot)
+			}
+		})
+	}
+}
+
+func TestMaterializeDigests(t *testing.T) {
+	store := &SnapshotStore{Dir: t.TempDir()}
+	im := &ImageManager{Name: "demo", FilesDir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(im.FilesDir, "data.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := store.Create(im, "v1", nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	stored := snapshot.Files[0].SHA256
+
+	// a file outside the store a digest could point at
+	secret := filepath.Join(store.Dir, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		digest  string
+		wantErr bool
+	}{
+		{"stored", stored, false},
+		{"empty", "", true},
+		{"short", "a", true},
+		{"traversal", "../../secret", true},
+		{"uppercase", strings.ToUpper(stored), true},
+		{"too long", stored + "0", true},
+		{"missing", strings.Repeat("0", 64), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := &Snapshot{Name: "v1", Files: []SnapshotFile{{Path: "data.txt", SHA256: tt.digest, Mode: 0644}}}
+			dir := t.TempDir()
+			err := store.Materialize(manifest, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Materialize with digest %q: error = %v, wantErr %v", tt.digest, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			content, err := os.ReadFile(filepath.Join(dir, "data.txt"))
+			if err != nil || string(content) != "data" {
+				t.Errorf("restored %q, %v", content, err)
+			}
+		})
+	}
+}
+
+func TestMaterializePaths(t *testing.T) {
+	store := &SnapshotStore{Dir: t.TempDir()}
+	im := &ImageManager{Name: "demo", FilesDir: t.TempDir()}
+	if err := os.WriteFile(filepath.Join(im.FilesDir, "data.txt"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := store.Create(im, "v1", nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	digest := snapshot.Files[0].SHA256
+
+	tests := []struct {
+		path    string
+		wantErr bool
+	}{
+		{"data.txt", false},
+		{"nested/dir/data.txt", false},
+		{"../escape.txt", true},
+		{"/abs.txt", true},
+		{"nested/../../escape.txt", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			manifest := &Snapshot{Name: "v1", Files: []SnapshotFile{{Path: tt.path, SHA256: digest, Mode: 0644}}}
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "workspace")
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			err := store.Materialize(manifest, dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Materialize(%q): error = %v, wantErr %v", tt.path, err, tt.wantErr)
+			}
+			if _, err := os.Stat(filepath.Join(parent, "escape.txt")); err == nil {
+				t.Errorf("Materialize(%q) wrote outside the workspace", tt.path)
+			}
+		})
+	}
+}
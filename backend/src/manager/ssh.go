@@ -0,0 +1,159 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// dialSSH opens an SSH connection to the server with its identity file and
+// checks the server's host key against its known_hosts file.
+func dialSSH(server ServerInfo, uri *url.URL, secrets *SecretStore) (*ssh.Client, error) {
+	signer, err := identitySigner(server, secrets)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := hostKeyCallback(server)
+	if err != nil {
+		return nil, err
+	}
+
+	sshConfig := &ssh.ClientConfig{
+		User:            uri.User.Username(),
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}
+
+	port := uri.Port()
+	if port == "" {
+		port = "22"
+	}
+	addr := net.JoinHostPort(uri.Hostname(), port)
+	sshClient, err := ssh.Dial("tcp", addr, sshConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SSH connection to %s: %v", addr, err)
+	}
+	return sshClient, nil
+}
+
+// identitySigner reads the server's identity file, decrypting it with the
+// passphrase in the secret named by IdentityPassphraseSecret if it has one.
+func identitySigner(server ServerInfo, secrets *SecretStore) (ssh.Signer, error) {
+	if server.IdentityFile == "" {
+		return nil, errors.New("no identity file configured")
+	}
+	key, err := os.ReadFile(server.IdentityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %v", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity file %s: %v", server.IdentityFile, err)
+		}
+		return signer, nil
+	}
+
+	if server.IdentityPassphraseSecret == "" {
+		return nil, fmt.Errorf("identity file %s is passphrase-protected but no identityPassphraseSecret is configured", server.IdentityFile)
+	}
+	if secrets == nil {
+		return nil, fmt.Errorf("identity passphrase %s: %v", server.IdentityPassphraseSecret, ErrSecretsDisabled)
+	}
+	passphrase, err := secrets.Reveal(server.IdentityPassphraseSecret)
+	if err != nil {
+		return nil, fmt.Errorf("identity passphrase %s: %v", server.IdentityPassphraseSecret, err)
+	}
+	signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt identity file %s: %v", server.IdentityFile, err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback checks host keys against the server's known_hosts file,
+// ~/.ssh/known_hosts unless configured otherwise. Host keys are only left
+// unchecked if the server opts out with insecureIgnoreHostKey.
+func hostKeyCallback(server ServerInfo) (ssh.HostKeyCallback, error) {
+	if server.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	path := server.KnownHostsFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find known_hosts: %v", err)
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %v", err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		err := callback(hostname, remote, key)
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return fmt.Errorf("host key of %s is not in %s", hostname, path)
+			}
+			return fmt.Errorf("host key of %s does not match %s, it may have been replaced", hostname, path)
+		}
+		return err
+	}, nil
+}
+
+// tunnelSocket forwards a local unix socket to the socket at remotePath over
+// the SSH connection and returns its unix:// URI. The socket is removed once
+// the connection closes.
+func tunnelSocket(sshClient *ssh.Client, remotePath string) (string, error) {
+	dir, err := os.MkdirTemp("", "maestro-tunnel-")
+	if err != nil {
+		return "", err
+	}
+	localPath := filepath.Join(dir, "engine.sock")
+	listener, err := net.Listen("unix", localPath)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	go func() {
+		sshClient.Wait()
+		listener.Close()
+		os.RemoveAll(dir)
+	}()
+	go func() {
+		for {
+			local, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer local.Close()
+				remote, err := sshClient.Dial("unix", remotePath)
+				if err != nil {
+					return
+				}
+				defer remote.Close()
+
+				go io.Copy(remote, local)
+				io.Copy(local, remote)
+			}()
+		}
+	}()
+	return "unix://" + localPath, nil
+}
@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrInvalidTransition = errors.New("invalid run status transition")
+
+// transitions lists the statuses a run may move to from each status. Runs
+// begin Queued, adopted and restored ones Running. A restart starts an
+// exited container again and reattaching to a container moves it out of
+// Error.
+var transitions = map[Status][]Status{
+	Queued:    {Building, Starting, Cancelled, Error},
+	Building:  {Queued, Cancelled, Error},
+	Starting:  {Running, Exited, Failed, Cancelled, Error},
+	Running:   {Paused, Starting, Exited, Failed, TimedOut, Cancelled, Error},
+	Paused:    {Running, Exited, Failed, TimedOut, Cancelled, Error},
+	Exited:    {Starting},
+	Failed:    {Starting},
+	TimedOut:  {Starting},
+	Cancelled: {Starting},
+	Error:     {Starting, Running},
+}
+
+// Terminal reports whether a run in the status is over, unless it is
+// restarted.
+func (s Status) Terminal() bool {
+	switch s {
+	case Exited, Failed, TimedOut, Cancelled, Error:
+		return true
+	}
+	return false
+}
+
+// Overdue reports whether the container ran past the timeout of its run since
+// it was last started.
+func (cm *ContainerManager) Overdue(now time.Time) bool {
+	if cm.Options.TimeoutMinutes <= 0 || !cm.Active() {
+		return false
+	}
+	started := cm.CreatedAt
+	if cm.RestartedAt != nil {
+		started = *cm.RestartedAt
+	}
+	return now.Sub(started) > time.Duration(cm.Options.TimeoutMinutes)*time.Minute
+}
+
+// Transition moves the run to the status, failing with ErrInvalidTransition
+// if it cannot get there from its current one.
+func (cm *ContainerManager) Transition(to Status) error {
+	if !slices.Contains(transitions[cm.Status], to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, cm.Status, to)
+	}
+	cm.Status = to
+	return nil
+}
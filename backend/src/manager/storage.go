@@ -0,0 +1,215 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ArtifactsDir is the workspace directory runs write their outputs to.
+const ArtifactsDir = "artifacts"
+
+// StorageCategory groups workspace files for storage reporting and cleanup.
+type StorageCategory string
+
+const (
+	SourceStorage   StorageCategory = "files"
+	LogStorage      StorageCategory = "logs"
+	ArtifactStorage StorageCategory = "artifacts"
+)
+
+// StorageCategories lists every category in reporting order.
+var StorageCategories = []StorageCategory{SourceStorage, LogStorage, ArtifactStorage}
+
+// CategoryUsage is the space taken by one category of workspace files.
+type CategoryUsage struct {
+	Bytes int64 `json:"bytes"`
+	Files int   `json:"files"`
+}
+
+// StorageReport breaks down the space used by an image's workspace.
+type StorageReport struct {
+	Image      string                            `json:"image"`
+	TotalBytes int64                             `json:"total_bytes"`
+	Categories map[StorageCategory]CategoryUsage `json:"categories"`
+}
+
+// CleanupResult reports what a storage cleanup removed and what it left in
+// place.
+type CleanupResult struct {
+	Category     StorageCategory `json:"category"`
+	Removed      []string        `json:"removed"`
+	RemovedBytes int64           `json:"removed_bytes"`
+	Skipped      []string        `json:"skipped"`
+}
+
+// classify returns the storage category of a workspace path relative to the
+// files directory.
+func classify(rel string) StorageCategory {
+	rel = filepath.ToSlash(rel)
+	switch {
+	case strings.HasPrefix(rel, ArtifactsDir+"/"):
+		return ArtifactStorage
+	case !strings.Contains(rel, "/") && IsLogFile(rel):
+		return LogStorage
+	default:
+		return SourceStorage
+	}
+}
+
+// walkWorkspace calls fn for every regular file of the workspace with its path
+// relative to the files directory.
+func (im *ImageManager) walkWorkspace(fn func(rel string, info fs.FileInfo) error) error {
+	return filepath.WalkDir(im.FilesDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(im.FilesDir, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return fn(rel, info)
+	})
+}
+
+// Storage reports the bytes used by the image's source files, run logs and
+// artifacts.
+func (im *ImageManager) Storage() (*StorageReport, error) {
+	report := &StorageReport{Image: im.Name, Categories: map[StorageCategory]CategoryUsage{}}
+	for _, category := range StorageCategories {
+		report.Categories[category] = CategoryUsage{}
+	}
+
+	err := im.walkWorkspace(func(rel string, info fs.FileInfo) error {
+		category := classify(rel)
+		usage := report.Categories[category]
+		usage.Bytes += info.Size()
+		usage.Files++
+		report.Categories[category] = usage
+		report.TotalBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan workspace: %v", err)
+	}
+	return report, nil
+}
+
+// inUse returns the workspace files that must not be removed: logs still being
+// written by the current run or build.
+func (im *ImageManager) inUse() []string {
+	var files []string
+	if im.Container != nil && im.Container.FinishedAt == nil {
+		files = append(files, im.Container.LogFiles()...)
+	}
+	if buildLog := im.LastBuildLog(); buildLog != nil {
+		select {
+		case <-buildLog.Done():
+		default:
+			files = append(files, buildLog.Name)
+		}
+	}
+	return files
+}
+
+// CleanStorage removes the workspace files of a category last modified before
+// the given time. Protected files and logs still being written are skipped.
+func (im *ImageManager) CleanStorage(category StorageCategory, before time.Time) (*CleanupResult, error) {
+	if !slices.Contains(StorageCategories, category) {
+		return nil, fmt.Errorf("unknown storage category %q", category)
+	}
+
+	result := &CleanupResult{Category: category, Removed: []string{}, Skipped: []string{}}
+	inUse := im.inUse()
+
+	var removals []string
+	err := im.walkWorkspace(func(rel string, info fs.FileInfo) error {
+		if classify(rel) != category || !info.ModTime().Before(before) {
+			return nil
+		}
+		name := filepath.ToSlash(rel)
+		if im.IsProtected(name) || slices.Contains(inUse, name) {
+			result.Skipped = append(result.Skipped, name)
+			return nil
+		}
+		removals = append(removals, name)
+		result.RemovedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan workspace: %v", err)
+	}
+
+	root, err := im.OpenRoot()
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+
+	for _, name := range removals {
+		if err := root.Remove(filepath.FromSlash(name)); err != nil {
+			return result, fmt.Errorf("failed to remove %s: %v", name, err)
+		}
+		result.Removed = append(result.Removed, name)
+	}
+	return result, nil
+}
+
+var ErrQuotaExceeded = errors.New("workspace quota exceeded")
+
+// QuotaConfig limits the disk space every workspace may use.
+type QuotaConfig struct {
+	MaxGB float64 `yaml:"maxGB"` // 0 disables the quota
+}
+
+// Bytes returns the quota in bytes, 0 when there is none.
+func (cfg QuotaConfig) Bytes() int64 {
+	return int64(cfg.MaxGB * (1 << 30))
+}
+
+// DiskUsage is the space a workspace uses and may use.
+type DiskUsage struct {
+	UsedBytes  int64 `json:"used_bytes"`  // when last measured, including writes since admitted by the quota
+	QuotaBytes int64 `json:"quota_bytes"` // 0 for unlimited
+}
+
+// MeasureUsage walks the workspace and records the bytes it uses.
+func (im *ImageManager) MeasureUsage() (int64, error) {
+	var used int64
+	err := im.walkWorkspace(func(rel string, info fs.FileInfo) error {
+		used += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan workspace: %v", err)
+	}
+	im.Disk.UsedBytes = used
+	return used, nil
+}
+
+// CheckQuota measures the workspace and reports ErrQuotaExceeded when adding
+// bytes would take it over its quota, with staged bytes reserved for it
+// elsewhere, such as uploads in progress. Admitted bytes are counted as used
+// right away.
+func (im *ImageManager) CheckQuota(adding, staged int64) error {
+	used, err := im.MeasureUsage()
+	if err != nil {
+		return err
+	}
+	if quota := im.Disk.QuotaBytes; quota > 0 && used+staged+adding > quota {
+		return fmt.Errorf("%w: %d of %d bytes used, %d staged, %d more requested", ErrQuotaExceeded, used, quota, staged, adding)
+	}
+	im.Disk.UsedBytes += adding
+	return nil
+}
@@ -0,0 +1,168 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/sftp"
+)
+
+// syncManifestDir is the directory below a server's RemoteDir that records
+// the digests of the files synced into each workspace.
+const syncManifestDir = ".maestro-sync"
+
+// SyncWorkspace makes the workspace directory subdir available on the server
+// and returns its path there. Servers without a RemoteDir share the
+// filesystem with maestro and use the workspace itself; otherwise the files
+// are copied over SFTP into RemoteDir/<image>. The sync is incremental by
+// checksum: a manifest on the server records the digest of every file synced,
+// only files whose digest changed or that are missing on the server are
+// uploaded, and synced files since removed from the workspace are deleted.
+// Files runs wrote on the server are left alone. Captured logs are not synced.
+func (cm *ConnectionManager) SyncWorkspace(im *ImageManager, subdir string) (string, error) {
+	localDir := im.FilesDir
+	prefix := ""
+	if subdir != "" {
+		rel, err := WorkspacePath(subdir)
+		if err != nil {
+			return "", err
+		}
+		localDir = filepath.Join(im.FilesDir, rel)
+		prefix = filepath.ToSlash(rel)
+	}
+	if info, err := os.Stat(localDir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("no directory %s in workspace", subdir)
+	}
+	if cm.Server.RemoteDir == "" || cm.Local() {
+		return localDir, nil
+	}
+
+	if cm.SshConn == nil {
+		return "", ErrNoShell
+	}
+	imageDir := path.Join(cm.Server.RemoteDir, im.Name)
+	remoteDir := path.Join(imageDir, prefix)
+	client, err := sftp.NewClient(cm.SshConn)
+	if err != nil {
+		return "", fmt.Errorf("failed to open SFTP session: %v", err)
+	}
+	defer client.Close()
+
+	files, err := ScanWorkspace(localDir, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to scan workspace: %v", err)
+	}
+	manifestPath := path.Join(cm.Server.RemoteDir, syncManifestDir, im.Name+".json")
+	synced, err := readSyncManifest(client, manifestPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read sync manifest: %v", err)
+	}
+
+	if err := client.MkdirAll(remoteDir); err != nil {
+		return "", fmt.Errorf("failed to sync workspace to %s: %v", remoteDir, err)
+	}
+	present := make(map[string]bool, len(files))
+	for _, file := range files {
+		key := path.Join(prefix, file.Path)
+		present[key] = true
+		remotePath := path.Join(imageDir, key)
+
+		// a copy removed or resized on the server since is uploaded again
+		if remote, err := client.Stat(remotePath); err == nil && remote.Size() == file.Size && synced[key] == file.SHA256 {
+			continue
+		}
+		if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+			return "", fmt.Errorf("failed to sync %s: %v", key, err)
+		}
+		if err := uploadFile(client, filepath.Join(localDir, filepath.FromSlash(file.Path)), remotePath, file.Mode); err != nil {
+			return "", fmt.Errorf("failed to sync %s: %v", key, err)
+		}
+		synced[key] = file.SHA256
+	}
+
+	for key := range synced {
+		inSubdir := prefix == "" || strings.HasPrefix(key, prefix+"/")
+		if !inSubdir || present[key] {
+			continue
+		}
+		if err := client.Remove(path.Join(imageDir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("failed to remove %s: %v", key, err)
+		}
+		delete(synced, key)
+	}
+
+	if err := writeSyncManifest(client, manifestPath, synced); err != nil {
+		return "", fmt.Errorf("failed to write sync manifest: %v", err)
+	}
+	return remoteDir, nil
+}
+
+// readSyncManifest reads the digests of the files synced into a workspace on
+// the server, keyed by workspace path. It is empty before the first sync.
+func readSyncManifest(client *sftp.Client, manifestPath string) (map[string]string, error) {
+	synced := map[string]string{}
+	file, err := client.Open(manifestPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return synced, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := json.NewDecoder(file).Decode(&synced); err != nil {
+		return nil, err
+	}
+	return synced, nil
+}
+
+func writeSyncManifest(client *sftp.Client, manifestPath string, synced map[string]string) error {
+	if err := client.MkdirAll(path.Dir(manifestPath)); err != nil {
+		return err
+	}
+
+	// write to a temporary name first so an interrupted sync never leaves a
+	// partial manifest
+	tmpPath := manifestPath + ".tmp"
+	file, err := client.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(synced); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return client.PosixRename(tmpPath, manifestPath)
+}
+
+// uploadFile copies a local file to the server with the given mode.
+func uploadFile(client *sftp.Client, localPath, remotePath string, mode fs.FileMode) error {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	remote, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(remote, local); err != nil {
+		remote.Close()
+		return err
+	}
+	if err := remote.Close(); err != nil {
+		return err
+	}
+	return client.Chmod(remotePath, mode)
+}
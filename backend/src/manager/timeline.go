@@ -0,0 +1,84 @@
+package manager
+
+import "time"
+
+// activityRetention bounds how long finished activities are kept per server.
+const activityRetention = 7 * 24 * time.Hour
+
+type ActivityKind string
+
+const (
+	BuildActivity ActivityKind = "build"
+	RunActivity   ActivityKind = "run"
+)
+
+// Activity is a build or run interval on a server. End is nil while the
+// activity is in progress.
+type Activity struct {
+	Kind  ActivityKind `json:"kind"`
+	Image string       `json:"image"`
+	Start time.Time    `json:"start"`
+	End   *time.Time   `json:"end"`
+
+	conn *ConnectionManager
+}
+
+// BeginActivity records the start of a build or run on the server.
+func (cm *ConnectionManager) BeginActivity(kind ActivityKind, image string) *Activity {
+	cm.Mu.Lock()
+	defer cm.Mu.Unlock()
+
+	now := time.Now()
+	activity := &Activity{Kind: kind, Image: image, Start: now, conn: cm}
+
+	// drop activities that ended before the retention window
+	kept := cm.activities[:0]
+	for _, a := range cm.activities {
+		if a.End == nil || now.Sub(*a.End) < activityRetention {
+			kept = append(kept, a)
+		}
+	}
+	cm.activities = append(kept, activity)
+
+	return activity
+}
+
+// Finish marks the activity as ended at the given time. Finishing an activity
+// twice, or a nil activity, is a no-op.
+func (a *Activity) Finish(at time.Time) {
+	if a == nil {
+		return
+	}
+
+	a.conn.Mu.Lock()
+	defer a.conn.Mu.Unlock()
+
+	if a.End == nil {
+		a.End = &at
+	}
+}
+
+// Timeline returns a copy of the activities overlapping [from, to], ordered by
+// start time.
+func (cm *ConnectionManager) Timeline(from, to time.Time) []Activity {
+	cm.Mu.RLock()
+	defer cm.Mu.RUnlock()
+
+	timeline := []Activity{}
+	for _, a := range cm.activities {
+		if a.Start.After(to) || (a.End != nil && a.End.Before(from)) {
+			continue
+		}
+		timeline = append(timeline, *a)
+	}
+	return timeline
+}
+
+// Server returns the name of the server the activity ran on, empty for a nil
+// activity.
+func (a *Activity) Server() string {
+	if a == nil {
+		return ""
+	}
+	return a.conn.Server.Name
+}
@@ -0,0 +1,164 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// TrackedImage is the part of an image's state that outlives a restart of
+// maestro: the image it runs and the container still running it, if any.
+type TrackedImage struct {
+	ID           *string           `json:"id"`
+	Server       string            `json:"server"`
+	Prebuilt     string            `json:"prebuilt"`
+	Manifest     string            `json:"manifest"`
+	ServerImages map[string]string `json:"server_images"`
+	Container    *TrackedContainer `json:"container"`
+}
+
+// TrackedContainer is a container left running when maestro stopped.
+type TrackedContainer struct {
+	ID          string     `json:"id"`
+	RunID       string     `json:"run_id"`
+	Name        string     `json:"name"`
+	Status      Status     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Restarts    int        `json:"restarts"`
+	RestartedAt *time.Time `json:"restarted_at"`
+	StdoutLog   string     `json:"stdout_log"`
+	StderrLog   string     `json:"stderr_log"`
+	BuildLog    string     `json:"build_log"`
+	Commit      string     `json:"commit"`
+	Options     RunOptions `json:"options"`
+}
+
+func trackingPath(stateDir string) string {
+	return filepath.Join(stateDir, "tracking.json")
+}
+
+// SaveTracking records the images that were built or run and the containers
+// still running in stateDir, so RestoreTracking can pick them up after a
+// restart.
+func (sm *ServiceManager) SaveTracking(stateDir string) error {
+	tracked := map[string]TrackedImage{}
+	sm.Images.Range(func(name string, im *ImageManager) bool {
+		im.Mu.RLock()
+		defer im.Mu.RUnlock()
+		if im.ID == nil || im.Connection == nil {
+			return true
+		}
+
+		image := TrackedImage{
+			ID:           im.ID,
+			Server:       im.Connection.Server.Name,
+			Prebuilt:     im.Prebuilt,
+			Manifest:     im.Manifest,
+			ServerImages: im.ServerImages,
+		}
+		if container := im.Container; container != nil && container.Active() && container.FinishedAt == nil {
+			image.Container = &TrackedContainer{
+				ID:          container.ID,
+				RunID:       container.RunID,
+				Name:        container.Name,
+				Status:      container.Status,
+				CreatedAt:   container.CreatedAt,
+				Restarts:    container.Restarts,
+				RestartedAt: container.RestartedAt,
+				StdoutLog:   container.StdoutLog,
+				StderrLog:   container.StderrLog,
+				BuildLog:    container.BuildLog,
+				Commit:      container.Commit,
+				Options:     container.Options,
+			}
+		}
+		tracked[name] = image
+		return true
+	})
+
+	raw, err := json.Marshal(tracked)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		return err
+	}
+	tmpPath := trackingPath(stateDir) + ".tmp"
+	if err := os.WriteFile(tmpPath, raw, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, trackingPath(stateDir))
+}
+
+// RestoreTracking gives the images loaded into sm the state SaveTracking
+// recorded and returns the number of running containers tracked again. Their
+// log files stay closed until their output is captured again. The state is
+// removed once restored, so a crash later does not bring back stale
+// containers.
+func (sm *ServiceManager) RestoreTracking(stateDir string) (int, error) {
+	raw, err := os.ReadFile(trackingPath(stateDir))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	var tracked map[string]TrackedImage
+	if err := json.Unmarshal(raw, &tracked); err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for name, image := range tracked {
+		im, exists := sm.Images.Load(name)
+		if !exists {
+			continue
+		}
+		cm, exists := sm.Connections.Load(image.Server)
+		if !exists {
+			continue
+		}
+
+		im.Mu.Lock()
+		im.ID = image.ID
+		im.Connection = cm
+		im.Prebuilt = image.Prebuilt
+		im.Manifest = image.Manifest
+		im.ServerImages = image.ServerImages
+		if tc := image.Container; tc != nil {
+			im.SetContainer(&ContainerManager{
+				ID:          tc.ID,
+				RunID:       tc.RunID,
+				Name:        tc.Name,
+				Status:      tc.Status,
+				CreatedAt:   tc.CreatedAt,
+				Restarts:    tc.Restarts,
+				RestartedAt: tc.RestartedAt,
+				StdoutLog:   tc.StdoutLog,
+				StderrLog:   tc.StderrLog,
+				BuildLog:    tc.BuildLog,
+				Commit:      tc.Commit,
+				Options:     tc.Options,
+				Activity:    cm.BeginActivity(RunActivity, name),
+			})
+			restored++
+		}
+		im.Mu.Unlock()
+	}
+
+	return restored, os.Remove(trackingPath(stateDir))
+}
+
+// CloseLogs flushes the container's log files to disk and closes them. The
+// container keeps running, its output is no longer captured.
+func (cm *ContainerManager) CloseLogs() {
+	for _, logFile := range []*os.File{cm.Stdout, cm.Stderr} {
+		if logFile == nil {
+			continue
+		}
+		logFile.Sync()
+		logFile.Close()
+	}
+}
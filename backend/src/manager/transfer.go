@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containers/podman/v6/pkg/bindings/images"
+)
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// Transfer copies the image built on one server to another by streaming an
+// image archive from the source into the target, so the target can run it
+// without a rebuild. It returns the bytes copied. The caller must not hold
+// im.Mu, it is only taken to look up and record the image.
+func (im *ImageManager) Transfer(from, to *ConnectionManager) (int64, error) {
+	im.Mu.RLock()
+	id, exists := im.ServerImages[from.Server.Name]
+	if !exists && im.Connection == from && im.ID != nil {
+		id, exists = *im.ID, true
+	}
+	prebuilt, manifest := im.Prebuilt, im.Manifest
+	im.Mu.RUnlock()
+
+	switch {
+	case prebuilt != "":
+		return 0, fmt.Errorf("image %s runs the prebuilt image %s, pull it on %s instead", im.Name, prebuilt, to.Server.Name)
+	case manifest != "":
+		return 0, fmt.Errorf("image %s is a multi-platform build, push it to a registry instead", im.Name)
+	case !exists:
+		return 0, fmt.Errorf("image %s is not built on server %s", im.Name, from.Server.Name)
+	}
+	fromConn, err := from.podmanConn()
+	if err != nil {
+		return 0, err
+	}
+	toConn, err := to.podmanConn()
+	if err != nil {
+		return 0, err
+	}
+
+	reader, writer := io.Pipe()
+	counter := &countingWriter{}
+	exported := make(chan error, 1)
+	go func() {
+		err := images.Export(fromConn, []string{id}, io.MultiWriter(writer, counter), &images.ExportOptions{
+			Format: func(a string) *string { return &a }("docker-archive"),
+		})
+		writer.CloseWithError(err)
+		exported <- err
+	}()
+
+	_, loadErr := images.Load(toConn, reader)
+	// unblock the export if the load gave up early
+	reader.CloseWithError(errors.New("load finished"))
+	if err := <-exported; err != nil {
+		return counter.n, fmt.Errorf("failed to export image from %s: %v", from.Server.Name, err)
+	}
+	if loadErr != nil {
+		return counter.n, fmt.Errorf("failed to load image on %s: %v", to.Server.Name, loadErr)
+	}
+
+	// the archive keeps the image's config and with it its ID
+	if loaded, err := images.Exists(toConn, id, nil); err != nil || !loaded {
+		return counter.n, fmt.Errorf("image %s missing on %s after loading", id, to.Server.Name)
+	}
+
+	im.Mu.Lock()
+	defer im.Mu.Unlock()
+	current, exists := im.ServerImages[from.Server.Name]
+	if !exists && im.Connection == from && im.ID != nil {
+		current = *im.ID
+	}
+	if current != id {
+		// rebuilt meanwhile, the copy is outdated
+		removeImage(to, id)
+		return counter.n, fmt.Errorf("image %s was rebuilt during the transfer", im.Name)
+	}
+
+	if old, exists := im.ServerImages[to.Server.Name]; exists && old != id {
+		removeImage(to, old)
+	}
+	if im.ServerImages == nil {
+		im.ServerImages = map[string]string{}
+	}
+	im.ServerImages[from.Server.Name] = id
+	im.ServerImages[to.Server.Name] = id
+	if im.Connection == to {
+		im.ID = &id
+	}
+	return counter.n, nil
+}
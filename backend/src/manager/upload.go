@@ -0,0 +1,320 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrUploadBusy       = errors.New("upload is receiving another chunk")
+	ErrUploadOffset     = errors.New("upload offset mismatch")
+	ErrUploadOverflow   = errors.New("chunk exceeds the upload size")
+	ErrUploadIncomplete = errors.New("upload incomplete")
+	ErrUploadChecksum   = errors.New("upload checksum mismatch")
+)
+
+// Upload is a file being uploaded in chunks. Received bytes are kept outside
+// the workspace until the upload is completed.
+type Upload struct {
+	ID        string    `json:"id"`
+	Image     string    `json:"image"`
+	Path      string    `json:"path"`   // workspace file the upload completes into
+	Size      int64     `json:"size"`   // total size announced by the client
+	SHA256    string    `json:"sha256"` // expected digest, empty skips verification
+	Offset    int64     `json:"offset"` // bytes received so far
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UploadStore keeps resumable uploads under Dir, the metadata of each next to
+// the bytes received so far.
+type UploadStore struct {
+	Dir string
+
+	mu   sync.Mutex
+	busy map[string]bool // uploads a chunk is being appended to
+}
+
+func (s *UploadStore) metaPath(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+func (s *UploadStore) partPath(id string) string {
+	return filepath.Join(s.Dir, id+".part")
+}
+
+// Create starts an upload of size bytes into the workspace file path.
+func (s *UploadStore) Create(image, path string, size int64, digest string) (*Upload, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid upload size %d", size)
+	}
+	if digest != "" {
+		if raw, err := hex.DecodeString(digest); err != nil || len(raw) != sha256.Size {
+			return nil, fmt.Errorf("invalid sha256 digest %s", digest)
+		}
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	upload := &Upload{
+		ID:        NewRunID(),
+		Image:     image,
+		Path:      path,
+		Size:      size,
+		SHA256:    strings.ToLower(digest),
+		CreatedAt: time.Now(),
+	}
+	raw, err := json.Marshal(upload)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.partPath(upload.ID), nil, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.metaPath(upload.ID), raw, 0600); err != nil {
+		os.Remove(s.partPath(upload.ID))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Get returns an upload of the image with the number of bytes received so far.
+func (s *UploadStore) Get(image, id string) (*Upload, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, ErrUploadNotFound
+	}
+
+	raw, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	var upload Upload
+	if err := json.Unmarshal(raw, &upload); err != nil {
+		return nil, err
+	}
+	if upload.Image != image {
+		return nil, ErrUploadNotFound
+	}
+
+	info, err := os.Stat(s.partPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	upload.Offset = info.Size()
+	return &upload, nil
+}
+
+// List returns the uploads of the image in progress, without the number of
+// bytes received.
+func (s *UploadStore) List(image string) ([]*Upload, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var uploads []*Upload
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(s.Dir, entry.Name()))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		var upload Upload
+		if err := json.Unmarshal(raw, &upload); err != nil {
+			return nil, err
+		}
+		if upload.Image == image {
+			uploads = append(uploads, &upload)
+		}
+	}
+	return uploads, nil
+}
+
+// acquire marks an upload busy so chunks are never appended concurrently.
+func (s *UploadStore) acquire(id string) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.busy[id] {
+		return nil, ErrUploadBusy
+	}
+	if s.busy == nil {
+		s.busy = map[string]bool{}
+	}
+	s.busy[id] = true
+	return func() {
+		s.mu.Lock()
+		delete(s.busy, id)
+		s.mu.Unlock()
+	}, nil
+}
+
+// Append adds a chunk read from r at offset, which must be the number of bytes
+// received so far. Whatever arrives before r fails is kept, so a client that
+// lost its connection resumes from the returned upload's offset.
+func (s *UploadStore) Append(image, id string, offset int64, r io.Reader) (*Upload, error) {
+	release, err := s.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	upload, err := s.Get(image, id)
+	if err != nil {
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, ErrUploadOffset
+	}
+
+	part, err := os.OpenFile(s.partPath(id), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return upload, err
+	}
+	written, copyErr := io.Copy(part, io.LimitReader(r, upload.Size-upload.Offset))
+	upload.Offset += written
+	if err := part.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	if copyErr != nil {
+		return upload, copyErr
+	}
+
+	// bytes past the announced size are dropped, not stored
+	if n, _ := r.Read(make([]byte, 1)); n > 0 {
+		return upload, ErrUploadOverflow
+	}
+	return upload, nil
+}
+
+// Complete verifies a fully received upload and writes it to its file inside
+// root, the image's workspace. The upload is removed unless writing fails.
+func (s *UploadStore) Complete(image, id string, root *os.Root) (*Upload, error) {
+	release, err := s.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	upload, err := s.Get(image, id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Offset != upload.Size {
+		return upload, ErrUploadIncomplete
+	}
+
+	if upload.SHA256 != "" {
+		digest, err := hashFile(s.partPath(id))
+		if err != nil {
+			return upload, err
+		}
+		if digest != upload.SHA256 {
+			// the received bytes cannot be repaired by resuming
+			s.remove(id)
+			return upload, fmt.Errorf("%w: got %s", ErrUploadChecksum, digest)
+		}
+	}
+
+	part, err := os.Open(s.partPath(id))
+	if err != nil {
+		return upload, err
+	}
+	defer part.Close()
+
+	target, err := WorkspacePath(upload.Path)
+	if err != nil {
+		return upload, err
+	}
+	if err := WriteRootFile(root, target, part, 0644); err != nil {
+		return upload, err
+	}
+	s.remove(id)
+	return upload, nil
+}
+
+// Abort discards an upload and the bytes received for it.
+func (s *UploadStore) Abort(image, id string) error {
+	release, err := s.acquire(id)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if _, err := s.Get(image, id); err != nil {
+		return err
+	}
+	return s.remove(id)
+}
+
+func (s *UploadStore) remove(id string) error {
+	err := errors.Join(os.Remove(s.partPath(id)), os.Remove(s.metaPath(id)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Prune discards uploads that last received a chunk before the given time and
+// returns how many were removed.
+func (s *UploadStore) Prune(before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	pruned := 0
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		// the received bytes change with every chunk, the metadata never
+		info, err := os.Stat(s.partPath(id))
+		if err != nil {
+			info, err = entry.Info()
+		}
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+
+		release, err := s.acquire(id)
+		if err != nil {
+			continue
+		}
+		err = s.remove(id)
+		release()
+		if err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
@@ -0,0 +1,253 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// chunk is an Append of data at offset and what it is expected to return.
+type chunk struct {
+	offset     int64
+	data       string
+	wantOffset int64
+	wantErr    error
+}
+
+func TestUploadAppend(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int64
+		chunks []chunk
+		want   string // bytes received
+	}{
+		{
+			name: "in order",
+			size: 6,
+			chunks: []chunk{
+				{offset: 0, data: "abc", wantOffset: 3},
+				{offset: 3, data: "def", wantOffset: 6},
+			},
+			want: "abcdef",
+		},
+		{
+			name: "empty chunk",
+			size: 3,
+			chunks: []chunk{
+				{offset: 0, data: "", wantOffset: 0},
+				{offset: 0, data: "abc", wantOffset: 3},
+			},
+			want: "abc",
+		},
+		{
+			name: "offset ahead",
+			size: 6,
+			chunks: []chunk{
+				{offset: 0, data: "abc", wantOffset: 3},
+				{offset: 5, data: "f", wantOffset: 3, wantErr: ErrUploadOffset},
+				{offset: 3, data: "def", wantOffset: 6},
+			},
+			want: "abcdef",
+		},
+		{
+			name: "chunk sent twice",
+			size: 6,
+			chunks: []chunk{
+				{offset: 0, data: "abc", wantOffset: 3},
+				{offset: 0, data: "abc", wantOffset: 3, wantErr: ErrUploadOffset},
+				{offset: 3, data: "def", wantOffset: 6},
+			},
+			want: "abcdef",
+		},
+		{
+			name: "negative offset",
+			size: 3,
+			chunks: []chunk{
+				{offset: -1, data: "abc", wantOffset: 0, wantErr: ErrUploadOffset},
+			},
+			want: "",
+		},
+		{
+			name: "past the announced size",
+			size: 4,
+			chunks: []chunk{
+				{offset: 0, data: "abc", wantOffset: 3},
+				{offset: 3, data: "def", wantOffset: 4, wantErr: ErrUploadOverflow},
+				{offset: 4, data: "g", wantOffset: 4, wantErr: ErrUploadOverflow},
+			},
+			want: "abcd",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &UploadStore{Dir: t.TempDir()}
+			upload, err := store.Create("demo", "data.bin", tt.size, "")
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			for i, chunk := range tt.chunks {
+				got, err := store.Append("demo", upload.ID, chunk.offset, strings.NewReader(chunk.data))
+				if !errors.Is(err, chunk.wantErr) {
+					t.Fatalf("chunk %d: Append error = %v, want %v", i, err, chunk.wantErr)
+				}
+				if got == nil || got.Offset != chunk.wantOffset {
+					t.Fatalf("chunk %d: Append = %+v, want offset %d", i, got, chunk.wantOffset)
+				}
+			}
+
+			// the offset survives the request, a resuming client reads it back
+			got, err := store.Get("demo", upload.ID)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			last := tt.chunks[len(tt.chunks)-1]
+			if got.Offset != last.wantOffset {
+				t.Errorf("Get offset = %d, want %d", got.Offset, last.wantOffset)
+			}
+			if part, _ := os.ReadFile(store.partPath(upload.ID)); string(part) != tt.want {
+				t.Errorf("received %q, want %q", part, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadGet(t *testing.T) {
+	store := &UploadStore{Dir: t.TempDir()}
+	upload, err := store.Create("demo", "data.bin", 3, "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		image string
+		id    string
+	}{
+		{"other image", "other", upload.ID},
+		{"unknown", "demo", strings.Repeat("0", len(upload.ID))},
+		{"empty", "demo", ""},
+		{"traversal", "demo", "../" + upload.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Get(tt.image, tt.id); !errors.Is(err, ErrUploadNotFound) {
+				t.Errorf("Get(%q, %q) error = %v, want %v", tt.image, tt.id, err, ErrUploadNotFound)
+			}
+		})
+	}
+}
+
+func TestUploadComplete(t *testing.T) {
+	sum := sha256.Sum256([]byte("abcdef"))
+	digest := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name     string
+		digest   string
+		data     string
+		wantErr  error
+		wantKept bool // the upload can still be resumed
+	}{
+		{"no digest", "", "abcdef", nil, false},
+		{"matching digest", digest, "abcdef", nil, false},
+		{"uppercase digest", strings.ToUpper(digest), "abcdef", nil, false},
+		{"incomplete", digest, "abc", ErrUploadIncomplete, true},
+		{"checksum mismatch", digest, "abcxyz", ErrUploadChecksum, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &UploadStore{Dir: t.TempDir()}
+			workspace := t.TempDir()
+			root, err := os.OpenRoot(workspace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer root.Close()
+
+			upload, err := store.Create("demo", "out/data.bin", 6, tt.digest)
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if _, err := store.Append("demo", upload.ID, 0, strings.NewReader(tt.data)); err != nil {
+				t.Fatalf("Append: %v", err)
+			}
+
+			_, err = store.Complete("demo", upload.ID, root)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Complete error = %v, want %v", err, tt.wantErr)
+			}
+			if _, err := store.Get("demo", upload.ID); (err == nil) != tt.wantKept {
+				t.Errorf("upload kept = %v, want %v", err == nil, tt.wantKept)
+			}
+			content, readErr := os.ReadFile(filepath.Join(workspace, "out", "data.bin"))
+			if tt.wantErr == nil && string(content) != tt.data {
+				t.Errorf("completed file = %q, %v, want %q", content, readErr, tt.data)
+			}
+			if tt.wantErr != nil && readErr == nil {
+				t.Errorf("failed upload wrote %q", content)
+			}
+		})
+	}
+}
+
+func TestUploadCreate(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int64
+		digest  string
+		wantErr bool
+	}{
+		{"empty file", 0, "", false},
+		{"negative size", -1, "", true},
+		{"short digest", 3, "abc", true},
+		{"not hex", 3, strings.Repeat("z", 64), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &UploadStore{Dir: t.TempDir()}
+			_, err := store.Create("demo", "data.bin", tt.size, tt.digest)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Create error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUploadList(t *testing.T) {
+	store := &UploadStore{Dir: t.TempDir()}
+	if uploads, err := store.List("demo"); err != nil || len(uploads) != 0 {
+		t.Fatalf("List before any upload = %v, %v", uploads, err)
+	}
+
+	var ids []string
+	for _, size := range []int64{3, 5, 7} {
+		upload, err := store.Create("demo", "data.bin", size, "")
+		if err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		ids = append(ids, upload.ID)
+	}
+	if _, err := store.Create("other", "data.bin", 11, ""); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := store.Abort("demo", ids[1]); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+
+	uploads, err := store.List("demo")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	var size int64
+	for _, upload := range uploads {
+		size += upload.Size
+	}
+	if len(uploads) != 2 || size != 10 {
+		t.Errorf("List = %d uploads of %d bytes, want 2 of 10", len(uploads), size)
+	}
+}
@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containers/podman/v6/pkg/bindings/containers"
+)
+
+// ResourceUsage summarizes the CPU and memory samples taken during a run.
+type ResourceUsage struct {
+	Samples       int       `json:"samples"`
+	PeakCPU       float64   `json:"peak_cpu_percent"`
+	AvgCPU        float64   `json:"avg_cpu_percent"`
+	PeakMemory    uint64    `json:"peak_memory_bytes"`
+	AvgMemory     uint64    `json:"avg_memory_bytes"`
+	LastSampledAt time.Time `json:"last_sampled_at"`
+}
+
+// Add folds a sample into the running peak and average values.
+func (u *ResourceUsage) Add(cpu float64, memory uint64, at time.Time) {
+	u.Samples++
+	n := float64(u.Samples)
+
+	u.PeakCPU = max(u.PeakCPU, cpu)
+	u.AvgCPU += (cpu - u.AvgCPU) / n
+	u.PeakMemory = max(u.PeakMemory, memory)
+	u.AvgMemory = uint64(float64(u.AvgMemory) + (float64(memory)-float64(u.AvgMemory))/n)
+	u.LastSampledAt = at
+}
+
+// SampleUsage takes one stats sample of every running container, with a
+// single stats call per server, and records it on the run.
+func (sm *ServiceManager) SampleUsage() error {
+	type target struct {
+		image       *ImageManager
+		containerID string
+	}
+	byConnection := map[*ConnectionManager][]target{}
+
+	sm.Images.Range(func(_ string, im *ImageManager) bool {
+		im.Mu.RLock()
+		defer im.Mu.RUnlock()
+		if im.Container != nil && im.Container.Active() && im.Connection != nil {
+			byConnection[im.Connection] = append(byConnection[im.Connection], target{im, im.Container.ID})
+		}
+		return true
+	})
+
+	var errs []error
+	for cm, targets := range byConnection {
+		ids := make([]string, 0, len(targets))
+		for _, t := range targets {
+			ids = append(ids, t.containerID)
+		}
+
+		// only Podman reports usage
+		conn, err := cm.podmanConn()
+		if err != nil {
+			continue
+		}
+		reports, err := containers.Stats(conn, ids, &containers.StatsOptions{
+			Stream: func(a bool) *bool { return &a }(false),
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", cm.Server.Name, err))
+			continue
+		}
+
+		now := time.Now()
+		for report := range reports {
+			if report.Error != nil {
+				errs = append(errs, fmt.Errorf("server %s: %w", cm.Server.Name, report.Error))
+				continue
+			}
+			for _, stats := range report.Stats {
+				for _, t := range targets {
+					if t.containerID != stats.ContainerID {
+						continue
+					}
+					t.image.Mu.Lock()
+					// the run may have ended or been replaced while sampling; its
+					// usage is final once it exited
+					if t.image.Container != nil && t.image.Container.ID == stats.ContainerID && t.image.Container.Active() {
+						t.image.Container.Usage.Add(stats.CPU, stats.MemUsage, now)
+					}
+					t.image.Mu.Unlock()
+				}
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"time"
+)
+
+// FindByContainer returns the image whose current container has the given ID.
+func (sm *ServiceManager) FindByContainer(containerID string) (*ImageManager, bool) {
+	var found *ImageManager
+	sm.Images.Range(func(_ string, im *ImageManager) bool {
+		im.Mu.RLock()
+		defer im.Mu.RUnlock()
+		if im.Container != nil && im.Container.ID == containerID {
+			found = im
+			return false
+		}
+		return true
+	})
+	return found, found != nil
+}
+
+// MarkExited records the container as exited at the given time with its exit
+// code and closes its log files. A zero exit marks the run Exited, a non-zero
+// exit or an OOM kill marks it Failed, unless it already ended, e.g. was
+// stopped for a timeout. Containers already marked as exited are left
+// untouched; it reports whether the exit was recorded.
+func (cm *ContainerManager) MarkExited(at time.Time, exitCode int, oomKilled bool) bool {
+	if cm.FinishedAt != nil {
+		return false
+	}
+	cm.FinishedAt = &at
+	cm.ExitCode = &exitCode
+	cm.OOMKilled = cm.OOMKilled || oomKilled
+
+	switch {
+	case cm.Status.Terminal():
+	case exitCode == 0 && !cm.OOMKilled:
+		cm.Transition(Exited)
+	default:
+		cm.Transition(Failed)
+	}
+	cm.Activity.Finish(at)
+	cm.Stdout.Close()
+	cm.Stderr.Close()
+	return true
+}
+
+// HandleExit records the exit of the image's container, publishes its exited
+// event and finishes the run in the background. The event stream and the
+// reconciliation may both observe an exit; only the first is handled. The
+// caller holds the image lock.
+func (sm *ServiceManager) HandleExit(im *ImageManager, mc *ConnectionManager, cm *ContainerManager, at time.Time, exitCode int, oomKilled bool) {
+	if !cm.MarkExited(at, exitCode, oomKilled) {
+		return
+	}
+	sm.Events.Publish(ExitedEvent(im.Name, mc.Server.Name, cm))
+	go sm.FinishRun(im, mc, cm)
+}
+
+// MarkRestarted records that the container, Starting, was restarted at the
+// given time, clearing the outcome of its previous run. Its log files must be
+// open again.
+func (cm *ContainerManager) MarkRestarted(at time.Time) error {
+	if err := cm.Transition(Running); err != nil {
+		return err
+	}
+	cm.FinishedAt = nil
+	cm.ExitCode = nil
+	cm.OOMKilled = false
+	cm.Artifacts = ""
+	cm.Restarts++
+	cm.RestartedAt = &at
+	return nil
+}
+
+// WatchEvents streams container events from the server's engine and applies
+// them to the images tracked by sm. It blocks until the stream ends.
+func (cm *ConnectionManager) WatchEvents(sm *ServiceManager) error {
+	return cm.Runtime.ContainerEvents(func(event ContainerEvent) {
+		imageManager, exists := sm.FindByContainer(event.ID)
+		if !exists {
+			return
+		}
+
+		imageManager.Mu.Lock()
+		defer imageManager.Mu.Unlock()
+
+		// the container may have been replaced since the lookup
+		container := imageManager.Container
+		if container == nil || container.ID != event.ID {
+			return
+		}
+		// a restart stops the container before it starts again
+		if container.RestartedAt != nil && event.Time.Before(*container.RestartedAt) {
+			return
+		}
+
+		switch event.Action {
+		case "oom":
+			container.OOMKilled = true
+			sm.Events.Publish(Event{Type: EventError, Image: imageManager.Name, Server: cm.Server.Name, Container: container.Name, Message: "container ran out of memory"})
+		case "died":
+			sm.HandleExit(imageManager, cm, container, event.Time, event.ExitCode, false)
+		}
+	})
+}
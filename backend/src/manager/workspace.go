@@ -0,0 +1,119 @@
+package manager
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrInvalidPath is returned for workspace paths that are empty, absolute,
+// point outside the workspace or into a .git directory.
+var ErrInvalidPath = errors.New("invalid workspace path")
+
+// WorkspacePath validates a slash-separated path relative to a workspace and
+// returns it cleaned, in the OS form. Paths through a .git directory are
+// rejected: git, which maestro runs on the host, would read its config and
+// hooks from there.
+func WorkspacePath(name string) (string, error) {
+	path := filepath.Clean(filepath.FromSlash(name))
+	if name == "" || !filepath.IsLocal(path) {
+		return "", ErrInvalidPath
+	}
+	for _, part := range strings.Split(path, string(filepath.Separator)) {
+		if strings.EqualFold(part, ".git") {
+			return "", ErrInvalidPath
+		}
+	}
+	return path, nil
+}
+
+// OpenRoot opens the image's workspace directory. Accesses through the root
+// cannot escape the workspace, neither with `..` nor through symlinks.
+func (im *ImageManager) OpenRoot() (*os.Root, error) {
+	return os.OpenRoot(im.FilesDir)
+}
+
+// WriteRootFile writes r to the named file inside root, creating missing
+// parent directories.
+func WriteRootFile(root *os.Root, name string, r io.Reader, perm os.FileMode) error {
+	if dir := filepath.Dir(name); dir != "." {
+		if err := root.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	out, err := root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// WorkspaceEntry is a file or directory in a workspace listing.
+type WorkspaceEntry struct {
+	Path    string    `json:"path"` // slash-separated, relative to the workspace
+	Dir     bool      `json:"dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256,omitempty"` // files only, when checksums were asked for
+}
+
+// ListOptions controls what ListWorkspace returns.
+type ListOptions struct {
+	Recursive bool // descend into subdirectories
+	Checksums bool // hash every file, which reads all of them
+}
+
+// ListWorkspace lists the files and directories in dir ("." for the whole
+// workspace) inside root, parents before their contents.
+func ListWorkspace(root *os.Root, dir string, opts ListOptions) ([]WorkspaceEntry, error) {
+	entries := []WorkspaceEntry{}
+	err := fs.WalkDir(root.FS(), filepath.ToSlash(dir), func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == filepath.ToSlash(dir) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		listed := WorkspaceEntry{Path: path, Dir: entry.IsDir(), ModTime: info.ModTime()}
+		if !entry.IsDir() {
+			listed.Size = info.Size()
+		}
+		if opts.Checksums && entry.Type().IsRegular() {
+			if listed.SHA256, err = hashRootFile(root, path); err != nil {
+				return err
+			}
+		}
+		entries = append(entries, listed)
+
+		if entry.IsDir() && !opts.Recursive {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func hashRootFile(root *os.Root, name string) (string, error) {
+	file, err := root.Open(filepath.FromSlash(name))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return HashReader(file)
+}
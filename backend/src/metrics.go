@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EndpointStats aggregates the requests served by one route.
+type EndpointStats struct {
+	Count  int64         `json:"count"`
+	Errors int64         `json:"errors"` // responses with status >= 500
+	Total  time.Duration `json:"total_ns"`
+	Max    time.Duration `json:"max_ns"`
+}
+
+var (
+	endpointStats   = map[string]*EndpointStats{}
+	endpointStatsMu sync.Mutex
+)
+
+// requestMetrics records latency and error counts per route pattern.
+func requestMetrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	elapsed := time.Since(start)
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	key := c.Request.Method + " " + route
+
+	endpointStatsMu.Lock()
+	defer endpointStatsMu.Unlock()
+
+	stats, ok := endpointStats[key]
+	if !ok {
+		stats = &EndpointStats{}
+		endpointStats[key] = stats
+	}
+	stats.Count++
+	stats.Total += elapsed
+	stats.Max = max(stats.Max, elapsed)
+	if c.Writer.Status() >= 500 {
+		stats.Errors++
+	}
+}
+
+// handleGetMetrics returns per-endpoint request metrics, listing cache hits,
+// per-query database metrics, the database connection pool statistics and
+// the events dropped for slow event subscribers.
+func (s *server) handleGetMetrics(c *gin.Context) {
+	endpointStatsMu.Lock()
+	endpoints := make(map[string]EndpointStats, len(endpointStats))
+	for key, stats := range endpointStats {
+		endpoints[key] = *stats
+	}
+	endpointStatsMu.Unlock()
+
+	c.JSON(200, gin.H{
+		"endpoints": endpoints,
+		"cache":     listings.snapshot(),
+		"database": gin.H{
+			"queries": s.db.QueryMetrics(),
+			"pool":    s.db.PoolStats(),
+		},
+		"events": gin.H{
+			"dropped": serviceManager.Events.Dropped(),
+		},
+	})
+}
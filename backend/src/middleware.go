@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// apiPrefix is the path the current version of the API is served under.
+// Breaking changes go to a new version served next to it.
+const apiPrefix = "/api/v1"
+
+// currentRun names the current run of a workspace in run routes, for clients
+// that do not track run IDs.
+const currentRun = "current"
+
+// runActions are the actions on the container of a workspace's run.
+var runActions = []string{"stop", "restart", "kill", "wait", "pause", "unpause", "exec", "stdin"}
+
+// legacyPaths serves the paths of the API from before it was versioned, e.g.
+// /container/x, and the routes that moved since, as their successors and
+// marks the responses deprecated, pointing at the successor.
+func legacyPaths(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path := req.URL.EscapedPath()
+		if slices.Contains(probePaths, path) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		successor := path
+		if !strings.HasPrefix(successor, "/api/") {
+			successor = apiPrefix + successor
+		}
+		if route, moved := movedRoute(strings.TrimPrefix(successor, apiPrefix+"/")); moved {
+			successor = apiPrefix + "/" + route
+		}
+
+		if successor != path {
+			if unescaped, err := url.PathUnescape(successor); err == nil {
+				w.Header().Set("Deprecation", "true")
+				w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+				req.URL.Path = unescaped
+				req.URL.RawPath = successor
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// movedRoute returns where a route of the container naming, which conflated
+// workspaces and their runs, moved to, such as container/x/stop to
+// workspaces/x/runs/current/stop. Routes are relative to the API root.
+func movedRoute(route string) (string, bool) {
+	if route == "containers" {
+		return "workspaces", true
+	}
+	rest, found := strings.CutPrefix(route, "container/")
+	if !found {
+		return route, false
+	}
+
+	name, action, _ := strings.Cut(rest, "/")
+	workspace := "workspaces/" + name
+	switch {
+	case action == "":
+		return workspace, true
+	case action == "run":
+		return workspace + "/runs", true
+	case action == "snapshot":
+		return workspace + "/snapshots", true
+	case strings.HasPrefix(action, "restore/"):
+		return workspace + "/snapshots/" + strings.TrimPrefix(action, "restore/") + "/restore", true
+	case slices.Contains(runActions, action):
+		return workspace + "/runs/" + currentRun + "/" + action, true
+	}
+	return workspace + "/" + action, true
+}
+
+// requestLogger assigns every request an ID (reusing the client's one when
+// present), attaches a request-scoped logger to the context, and logs the
+// outcome once the request is handled.
+func requestLogger(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(requestIDHeader)
+		if requestID == "" {
+			buf := make([]byte, 8)
+			rand.Read(buf)
+			requestID = hex.EncodeToString(buf)
+		}
+		c.Header(requestIDHeader, requestID)
+
+		reqLog := logger.With("request_id", requestID)
+		c.Set("logger", reqLog)
+
+		start := time.Now()
+		c.Next()
+
+		level := slog.LevelInfo
+		if c.Writer.Status() >= 500 {
+			level = slog.LevelError
+		}
+		reqLog.Log(c, level, "Request handled",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", c.Writer.Status(),
+			"duration", time.Since(start),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
+
+// requestLog returns the request-scoped logger set by requestLogger, or the
+// http logger for requests it did not see.
+func requestLog(c *gin.Context) *slog.Logger {
+	if logger, ok := c.Get("logger"); ok {
+		return logger.(*slog.Logger)
+	}
+	return loggers.For("http")
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maestro/src/database/schema"
+	"maestro/src/manager"
+	"maestro/src/notify"
+	"maestro/src/outbound"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// notificationTimeout bounds one attempt to post a notification.
+	notificationTimeout = 10 * time.Second
+
+	// notificationAttempts is how many times a notification is posted before
+	// it is dropped, waiting notificationBackoff before each retry.
+	notificationAttempts = 3
+	notificationBackoff  = 10 * time.Second
+)
+
+// NotificationChannel is a Slack or Discord channel notified of runs. Its
+// webhook URL grants posting to the channel, so only its host is returned.
+type NotificationChannel struct {
+	ID        string    `json:"id"`
+	Provider  string    `json:"provider"`
+	URL       string    `json:"url"`
+	Workspace string    `json:"workspace,omitempty"` // set for the channels of a workspace
+	User      string    `json:"user,omitempty"`      // set for the channels of a user's workspaces
+	Events    []string  `json:"events"`              // every event if empty
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func notificationChannel(channel schema.NotificationChannel) NotificationChannel {
+	return NotificationChannel{
+		ID:        channel.ID,
+		Provider:  channel.Provider,
+		URL:       redactURL(channel.Url),
+		Workspace: channel.Image,
+		User:      channel.UserName,
+		Events:    webhookEventList(channel.Events),
+		CreatedBy: channel.CreatedBy,
+		CreatedAt: channel.CreatedAt,
+	}
+}
+
+// redactURL hides the path of a webhook URL, which carries its credentials.
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return parsed.Scheme + "://" + parsed.Host + "/…"
+}
+
+// notificationEvent returns the notification event a bus event is, if any:
+// the end of a run or a run waiting long in a queue.
+func notificationEvent(event manager.Event) (string, bool) {
+	name, ok := webhookEvent(event)
+	return name, ok && (name == "finished" || name == "failed" || name == "delayed")
+}
+
+// notificationMessage describes an event for a chat channel.
+func notificationMessage(name string, event manager.Event) notify.Message {
+	var msg notify.Message
+	var details []string
+	switch name {
+	case "finished":
+		msg.Title = fmt.Sprintf("Run of %s finished", event.Image)
+		msg.Level = notify.LevelSuccess
+	case "failed":
+		msg.Title = fmt.Sprintf("Run of %s failed", event.Image)
+		msg.Level = notify.LevelFailure
+		if event.ExitCode != nil {
+			details = append(details, fmt.Sprintf("Exit code `%d`", *event.ExitCode))
+		}
+	case "delayed":
+		msg.Title = fmt.Sprintf("Run of %s is waiting in the queue", event.Image)
+		msg.Level = notify.LevelWarning
+		details = append(details, fmt.Sprintf("Position %d", event.Position))
+		if len(event.Suggested) > 0 {
+			details = append(details, fmt.Sprintf("Servers with free capacity: `%s`", strings.Join(event.Suggested, "`, `")))
+		}
+	}
+	switch {
+	case event.Type == manager.EventExited:
+		details = append([]string{fmt.Sprintf("Status `%s`", event.Message)}, details...)
+	case event.Message != "":
+		details = append([]string{event.Message}, details...)
+	}
+	if event.Server != "" {
+		details = append(details, fmt.Sprintf("Server `%s`", event.Server))
+	}
+	if event.Container != "" {
+		details = append(details, fmt.Sprintf("Container `%s`", event.Container))
+	}
+	msg.Text = strings.Join(details, "\n")
+	return msg
+}
+
+// canAccessChannel reports whether the request may see a notification
+// channel: the channels of the workspaces the user can access and the user's
+// own; admins see all.
+func canAccessChannel(c *gin.Context, channel schema.NotificationChannel) bool {
+	if isAdmin(c) {
+		return true
+	}
+	if channel.Image == "" {
+		return channel.UserName == currentUser(c).Name
+	}
+	imageManager, exists := serviceManager.Images.Load(channel.Image)
+	return exists && canAccess(c, imageManager)
+}
+
+// loadNotificationChannel returns the channel of the request's id, responding
+// with an error if it cannot be seen.
+func (s *server) loadNotificationChannel(c *gin.Context) (schema.NotificationChannel, bool) {
+	id := c.Param("id")
+	channel, err := s.db.Query.GetNotificationChannel(c, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !canAccessChannel(c, channel)) {
+		respondError(c, CodeNotFound, fmt.Sprintf("Notification channel %s not found", id))
+		return channel, false
+	}
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to look up notification channel %s: %v", id, err))
+		return channel, false
+	}
+	return channel, true
+}
+
+// handleGetNotifications lists the notification channels the user can see.
+func (s *server) handleGetNotifications(c *gin.Context) {
+	channels, err := s.db.Query.ListNotificationChannels(c)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list notification channels: %v", err))
+		return
+	}
+
+	result := []NotificationChannel{}
+	for _, channel := range channels {
+		if canAccessChannel(c, channel) {
+			result = append(result, notificationChannel(channel))
+		}
+	}
+	c.JSON(200, result)
+}
+
+// NotificationRequest describes the channel handleCreateNotification adds.
+type NotificationRequest struct {
+	Provider  string   `json:"provider" binding:"required,oneof=slack discord"`
+	URL       string   `json:"url" binding:"required,http_url"` // incoming webhook URL of the channel
+	Workspace string   `json:"workspace"`                       // empty for the workspaces the user owns
+	Events    []string `json:"events" binding:"dive,oneof=finished failed delayed"`
+}
+
+// handleCreateNotification adds a Slack or Discord channel notified when runs
+// finish, fail or wait in a queue longer than the configured threshold. The
+// channel is notified of the runs of a workspace, or of the runs of every
+// workspace the user owns when none is given.
+func (s *server) handleCreateNotification(c *gin.Context) {
+	var body NotificationRequest
+	if !bindJSON(c, &body, "notification channel") {
+		return
+	}
+
+	user := currentUser(c).Name
+	if body.Workspace == "" {
+		if user == anonymousUser || user == "" {
+			respondError(c, CodeForbidden, "Anonymous requests may only add notification channels for a workspace")
+			return
+		}
+	} else {
+		imageManager, exists := serviceManager.Images.Load(body.Workspace)
+		if !exists || !canAccess(c, imageManager) {
+			respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", body.Workspace))
+			return
+		}
+		user = ""
+	}
+
+	channel := schema.NotificationChannel{
+		ID:        manager.NewRunID(),
+		Provider:  body.Provider,
+		Url:       body.URL,
+		Image:     body.Workspace,
+		UserName:  user,
+		Events:    strings.Join(body.Events, ","),
+		CreatedBy: currentUser(c).Name,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.db.Query.CreateNotificationChannel(c, schema.CreateNotificationChannelParams(channel)); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save notification channel: %v", err))
+		return
+	}
+
+	requestLog(c).Info("Added notification channel", "channel", channel.ID, "provider", channel.Provider, "image", channel.Image, "user", channel.UserName)
+	c.JSON(201, notificationChannel(channel))
+}
+
+// handleDeleteNotification removes a notification channel.
+func (s *server) handleDeleteNotification(c *gin.Context) {
+	channel, ok := s.loadNotificationChannel(c)
+	if !ok {
+		return
+	}
+
+	if err := s.db.Query.DeleteNotificationChannel(c, channel.ID); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to delete notification channel %s: %v", channel.ID, err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Notification channel %s deleted", channel.ID)})
+}
+
+// handleTestNotification posts a test message to a notification channel, so
+// its URL can be checked when it is added.
+func (s *server) handleTestNotification(c *gin.Context) {
+	channel, ok := s.loadNotificationChannel(c)
+	if !ok {
+		return
+	}
+
+	msg := notify.Message{
+		Title: "Test notification from maestro",
+		Text:  fmt.Sprintf("Sent by `%s`", cmp.Or(currentUser(c).DisplayName, currentUser(c).Name, anonymousUser)),
+		Level: notify.LevelSuccess,
+	}
+	if err := notify.Send(c, outbound.Client(notificationTimeout), channel.Provider, channel.Url, msg); err != nil {
+		respondError(c, CodeUpstream, fmt.Sprintf("Failed to notify channel %s: %v", channel.ID, err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Notified channel %s", channel.ID)})
+}
+
+// watchNotifications posts the end of runs and long queue waits to the
+// channels of their workspaces and of their workspaces' owners. Events wait
+// for it in a queue rather than being dropped while channels are slow.
+func (s *server) watchNotifications(bus *manager.EventBus) {
+	log := loggers.For("notifications")
+	for event := range bus.SubscribeQueued() {
+		name, ok := notificationEvent(event)
+		if !ok {
+			continue
+		}
+
+		owner := ""
+		if imageManager, exists := serviceManager.Images.Load(event.Image); exists {
+			imageManager.Mu.RLock()
+			owner = imageManager.Owner
+			imageManager.Mu.RUnlock()
+		}
+		channels, err := s.db.Query.ListRunNotificationChannels(context.Background(), schema.ListRunNotificationChannelsParams{
+			Image:    event.Image,
+			UserName: owner,
+		})
+		if err != nil {
+			log.Error("Failed to look up notification channels", "image", event.Image, "error", err)
+			continue
+		}
+
+		msg := notificationMessage(name, event)
+		for _, channel := range channels {
+			if channel.Events != "" && !slices.Contains(webhookEventList(channel.Events), name) {
+				continue
+			}
+			go postNotification(channel, name, msg)
+		}
+	}
+}
+
+// postNotification posts a message to a channel, retrying failed attempts.
+func postNotification(channel schema.NotificationChannel, event string, msg notify.Message) {
+	client := outbound.Client(notificationTimeout)
+	var err error
+	for attempt := 1; attempt <= notificationAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(notificationBackoff)
+		}
+		if err = notify.Send(context.Background(), client, channel.Provider, channel.Url, msg); err == nil {
+			return
+		}
+	}
+	loggers.For("notifications").Warn("Gave up notification", "channel", channel.ID, "provider", channel.Provider, "event", event, "error", err)
+}
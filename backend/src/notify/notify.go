@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+)
+
+// Level is how a notification is shown, such as the color of its bar.
+type Level string
+
+const (
+	LevelSuccess Level = "success"
+	LevelFailure Level = "failure"
+	LevelWarning Level = "warning"
+)
+
+// Message is a notification posted to a chat service.
+type Message struct {
+	Title string
+	Text  string // details below the title, `code` spans render on every provider
+	Level Level
+}
+
+// provider formats a message as the body of a chat service's incoming
+// webhook.
+type provider func(Message) any
+
+var providers = map[string]provider{
+	"slack":   slackPayload,
+	"discord": discordPayload,
+}
+
+// Providers lists the chat services notifications can be posted to.
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Send posts a message to the incoming webhook URL of a provider's channel.
+func Send(ctx context.Context, client *http.Client, providerName, url string, msg Message) error {
+	format, known := providers[providerName]
+	if !known {
+		return fmt.Errorf("unknown notification provider %s", providerName)
+	}
+	body, err := json.Marshal(format(msg))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	reply, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with %s: %s", providerName, resp.Status, bytes.TrimSpace(reply))
+	}
+	return nil
+}
+
+// colors of the levels, as RGB
+var colors = map[Level]int{
+	LevelSuccess: 0x2eb67d,
+	LevelFailure: 0xe01e5a,
+	LevelWarning: 0xecb22e,
+}
+
+// slackPayload formats a message for a Slack incoming webhook: the title as
+// text, so it shows in notifications, and the details in a colored
+// attachment.
+func slackPayload(msg Message) any {
+	return map[string]any{
+		"text": msg.Title,
+		"attachments": []map[string]any{{
+			"color":     fmt.Sprintf("#%06x", colors[msg.Level]),
+			"text":      msg.Text,
+			"mrkdwn_in": []string{"text"},
+		}},
+	}
+}
+
+// discordPayload formats a message for a Discord webhook as a colored embed.
+func discordPayload(msg Message) any {
+	return map[string]any{
+		"embeds": []map[string]any{{
+			"title":       msg.Title,
+			"description": msg.Text,
+			"color":       colors[msg.Level],
+		}},
+	}
+}
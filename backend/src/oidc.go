@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maestro/src/database/schema"
+	"maestro/src/outbound"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig enables single sign-on through an OpenID Connect provider such
+// as Keycloak or Google. Providers without OIDC, like GitHub, can be used
+// through a bridge such as Dex.
+type OIDCConfig struct {
+	Issuer          string          `yaml:"issuer"` // empty disables single sign-on
+	ClientID        string          `yaml:"clientID"`
+	ClientSecret    string          `yaml:"clientSecret"`
+	ClientSecretEnv string          `yaml:"clientSecretEnv"` // read the client secret from this variable instead
+	RedirectURL     string          `yaml:"redirectURL"`     // public URL of auth/oidc/callback
+	Scopes          []string        `yaml:"scopes"`          // defaults to openid, profile, email and groups
+	UsernameClaim   string          `yaml:"usernameClaim"`   // display name, defaults to preferred_username, then email
+	GroupsClaim     string          `yaml:"groupsClaim"`     // defaults to groups
+	GroupRoles      map[string]Role `yaml:"groupRoles"`      // the highest role of the user's groups applies
+	DefaultRole     Role            `yaml:"defaultRole"`     // users in no mapped group; empty rejects them
+	SessionHours    int             `yaml:"sessionHours"`    // defaults to 12
+	UIRedirect      string          `yaml:"uiRedirect"`      // send the session token here as #token=
+}
+
+const (
+	oidcProviderName   = "oidc"
+	oidcTimeout        = 10 * time.Second
+	oidcLoginTTL       = 10 * time.Minute
+	defaultSessionTime = 12 * time.Hour
+)
+
+// oidcLogin is a login started at the provider and not finished yet.
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+var (
+	oidcProvider   *oidc.Provider
+	oidcProviderMu sync.Mutex
+
+	oidcLogins   = map[string]oidcLogin{}
+	oidcLoginsMu sync.Mutex
+)
+
+// validateOIDC checks that single sign-on is fully configured and only maps
+// to known roles.
+func validateOIDC(cfg OIDCConfig) error {
+	if cfg.Issuer == "" {
+		return nil
+	}
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return fmt.Errorf("oidc: clientID and redirectURL are required")
+	}
+	if cfg.DefaultRole != "" && roleRanks[cfg.DefaultRole] == 0 {
+		return fmt.Errorf("oidc: unknown default role %q", cfg.DefaultRole)
+	}
+	for group, role := range cfg.GroupRoles {
+		if roleRanks[role] == 0 {
+			return fmt.Errorf("oidc: group %s: unknown role %q", group, role)
+		}
+	}
+	return nil
+}
+
+// oidcContext routes the provider requests through the outbound proxies.
+func oidcContext(ctx context.Context) context.Context {
+	return oidc.ClientContext(ctx, outbound.Client(oidcTimeout))
+}
+
+// loadOIDCProvider discovers the provider on first use so maestro starts even
+// while the provider is unreachable. The provider outlives the request, its
+// signing keys are refreshed in the background.
+func loadOIDCProvider() (*oidc.Provider, error) {
+	oidcProviderMu.Lock()
+	defer oidcProviderMu.Unlock()
+
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+	provider, err := oidc.NewProvider(oidcContext(context.Background()), config.Auth.OIDC.Issuer)
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = provider
+	return provider, nil
+}
+
+func oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	cfg := config.Auth.OIDC
+
+	secret := cfg.ClientSecret
+	if cfg.ClientSecretEnv != "" {
+		secret = os.Getenv(cfg.ClientSecretEnv)
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email", "groups"}
+	}
+
+	return &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: secret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+}
+
+// hashToken is what sessions are stored by, so a database leak does not leak
+// usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// oidcRole maps the user's groups to the highest configured role.
+func oidcRole(groups []string) Role {
+	cfg := config.Auth.OIDC
+
+	role := cfg.DefaultRole
+	for _, group := range groups {
+		if mapped, exists := cfg.GroupRoles[group]; exists && roleRanks[mapped] > roleRanks[role] {
+			role = mapped
+		}
+	}
+	return role
+}
+
+// oidcSubject is the name single sign-on users are known by: their subject,
+// which the issuer never reassigns, namespaced by the issuer. User names can
+// be changed and reused, so they are only displayed.
+func oidcSubject(idToken *oidc.IDToken) string {
+	return idToken.Issuer + "#" + idToken.Subject
+}
+
+// oidcIdentity extracts the display name and groups from the ID token
+// claims.
+func oidcIdentity(claims map[string]any) (string, []string) {
+	cfg := config.Auth.OIDC
+
+	usernameClaims := []string{"preferred_username", "email"}
+	if cfg.UsernameClaim != "" {
+		usernameClaims = []string{cfg.UsernameClaim}
+	}
+	var name string
+	for _, claim := range usernameClaims {
+		if value, ok := claims[claim].(string); ok && value != "" {
+			name = value
+			break
+		}
+	}
+
+	groupsClaim := cfg.GroupsClaim
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	var groups []string
+	values, _ := claims[groupsClaim].([]any)
+	for _, value := range values {
+		if group, ok := value.(string); ok {
+			groups = append(groups, group)
+		}
+	}
+	return name, groups
+}
+
+// handleOIDCLogin redirects the browser to the provider's login page.
+func handleOIDCLogin(c *gin.Context) {
+	if config.Auth.OIDC.Issuer == "" {
+		respondError(c, CodeNotFound, "Single sign-on is not configured")
+		return
+	}
+
+	provider, err := loadOIDCProvider()
+	if err != nil {
+		respondError(c, CodeUpstream, fmt.Sprintf("Failed to reach identity provider: %v", err))
+		return
+	}
+
+	state := rand.Text()
+	login := oidcLogin{
+		nonce:    rand.Text(),
+		verifier: oauth2.GenerateVerifier(),
+		expires:  time.Now().Add(oidcLoginTTL),
+	}
+
+	oidcLoginsMu.Lock()
+	for key, pending := range oidcLogins {
+		if time.Now().After(pending.expires) {
+			delete(oidcLogins, key)
+		}
+	}
+	oidcLogins[state] = login
+	oidcLoginsMu.Unlock()
+
+	url := oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(login.nonce), oauth2.S256ChallengeOption(login.verifier))
+	c.Redirect(302, url)
+}
+
+// handleOIDCCallback finishes a login at the provider, maps the user's groups
+// to a role and opens a session. The session token is used as bearer token
+// like the tokens of local users.
+func (s *server) handleOIDCCallback(c *gin.Context) {
+	if config.Auth.OIDC.Issuer == "" {
+		respondError(c, CodeNotFound, "Single sign-on is not configured")
+		return
+	}
+	if reason := c.Query("error"); reason != "" {
+		respondError(c, CodeUnauthenticated, fmt.Sprintf("Login failed: %s %s", reason, c.Query("error_description")))
+		return
+	}
+
+	state := c.Query("state")
+	oidcLoginsMu.Lock()
+	login, exists := oidcLogins[state]
+	delete(oidcLogins, state)
+	oidcLoginsMu.Unlock()
+	if !exists || time.Now().After(login.expires) {
+		respondError(c, CodeInvalidRequest, "Unknown or expired login, please log in again")
+		return
+	}
+
+	provider, err := loadOIDCProvider()
+	if err != nil {
+		respondError(c, CodeUpstream, fmt.Sprintf("Failed to reach identity provider: %v", err))
+		return
+	}
+
+	ctx := oidcContext(c)
+	token, err := oauth2Config(provider).Exchange(ctx, c.Query("code"), oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		respondError(c, CodeUnauthenticated, fmt.Sprintf("Failed to exchange authorization code: %v", err))
+		return
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		respondError(c, CodeUnauthenticated, "Identity provider returned no ID token")
+		return
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: config.Auth.OIDC.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		respondError(c, CodeUnauthenticated, fmt.Sprintf("Invalid ID token: %v", err))
+		return
+	}
+	if idToken.Nonce != login.nonce {
+		respondError(c, CodeUnauthenticated, "Invalid ID token: nonce mismatch")
+		return
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		respondError(c, CodeUnauthenticated, fmt.Sprintf("Invalid ID token claims: %v", err))
+		return
+	}
+	if idToken.Subject == "" {
+		respondError(c, CodeUnauthenticated, "ID token has no subject")
+		return
+	}
+	name := oidcSubject(idToken)
+	displayName, groups := oidcIdentity(claims)
+	if displayName == "" {
+		displayName = idToken.Subject
+	}
+	role := oidcRole(groups)
+	if role == "" {
+		respondError(c, CodeForbidden, fmt.Sprintf("User %s is in no group with access to maestro", displayName))
+		return
+	}
+
+	sessionTime := defaultSessionTime
+	if config.Auth.OIDC.SessionHours > 0 {
+		sessionTime = time.Duration(config.Auth.OIDC.SessionHours) * time.Hour
+	}
+	now := time.Now().UTC()
+	sessionToken := rand.Text() + rand.Text()
+	err = s.db.Query.CreateSession(c, schema.CreateSessionParams{
+		TokenHash:   hashToken(sessionToken),
+		UserName:    name,
+		DisplayName: displayName,
+		Role:        string(role),
+		Provider:    oidcProviderName,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(sessionTime),
+	})
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to create session: %v", err))
+		return
+	}
+	if _, err := s.db.Query.DeleteExpiredSessions(c, now); err != nil {
+		requestLog(c).Error("Failed to delete expired sessions", "error", err)
+	}
+	requestLog(c).Info("User logged in", "user", name, "display_name", displayName, "role", role, "groups", groups)
+
+	if config.Auth.OIDC.UIRedirect != "" {
+		c.Redirect(302, config.Auth.OIDC.UIRedirect+"#token="+sessionToken)
+		return
+	}
+	c.JSON(200, gin.H{
+		"token":      sessionToken,
+		"user":       User{Name: name, DisplayName: displayName, Role: role},
+		"expires_at": now.Add(sessionTime),
+	})
+}
+
+// sessionUser resolves a session token opened through single sign-on.
+func (s *server) sessionUser(c *gin.Context, token string) (User, bool) {
+	session, err := s.db.Query.GetSession(c, schema.GetSessionParams{
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().UTC(),
+	})
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			requestLog(c).Error("Failed to look up session", "error", err)
+		}
+		return User{}, false
+	}
+	return User{Name: session.UserName, DisplayName: session.DisplayName, Role: Role(session.Role)}, true
+}
+
+// handleLogout ends the session of the request's token. Tokens of local users
+// are configured and cannot be logged out.
+func (s *server) handleLogout(c *gin.Context) {
+	token, found := bearerToken(c)
+	if !found {
+		respondError(c, CodeInvalidRequest, "No session to log out of")
+		return
+	}
+	if err := s.db.Query.DeleteSession(c, hashToken(token)); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to end session: %v", err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": "Logged out"})
+}
+
+// handleGetMe returns the user the request is authenticated as.
+func handleGetMe(c *gin.Context) {
+	c.JSON(200, currentUser(c))
+}
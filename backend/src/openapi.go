@@ -0,0 +1,123 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// the hand-written part of the API document, completed by buildOpenAPI
+//
+//go:embed openapi.yaml
+var rawOpenAPI []byte
+
+//go:embed swagger.html
+var swaggerPage []byte
+
+// openapiSpec is the API document served as openapi.json, built once all
+// routes are registered.
+var openapiSpec []byte
+
+// buildOpenAPI completes the embedded API document from the registered
+// routes: paths, path parameters, operation IDs, security and default
+// responses. Routes without an entry in the document are listed with their
+// handler's name as summary, entries without a route are dropped.
+func buildOpenAPI(routes gin.RoutesInfo) ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(rawOpenAPI, &doc); err != nil {
+		return nil, err
+	}
+	documented, _ := doc["paths"].(map[string]any)
+
+	paths := map[string]any{}
+	for _, route := range routes {
+		path, params := openapiPath(strings.TrimPrefix(route.Path, apiPrefix))
+		method := strings.ToLower(route.Method)
+		id := operationID(route.Handler)
+
+		operations, _ := documented[path].(map[string]any)
+		operation, _ := operations[method].(map[string]any)
+		if operation == nil {
+			operation = map[string]any{"summary": id}
+		}
+		operation["operationId"] = id
+		if len(params) > 0 {
+			var parameters []any
+			for _, param := range params {
+				parameters = append(parameters, map[string]any{"name": param, "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+			}
+			if extra, ok := operation["parameters"].([]any); ok {
+				parameters = append(parameters, extra...)
+			}
+			operation["parameters"] = parameters
+		}
+		if _, ok := operation["x-role"]; ok {
+			operation["security"] = []any{map[string]any{"bearer": []any{}}}
+		}
+		if _, ok := operation["responses"]; !ok {
+			operation["responses"] = map[string]any{
+				"200": map[string]any{"description": "Success"},
+				"default": map[string]any{
+					"description": "Error",
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Error"}},
+					},
+				},
+			}
+		}
+
+		entry, _ := paths[path].(map[string]any)
+		if entry == nil {
+			entry = map[string]any{}
+			// routes outside the API prefix name their own server
+			if servers, ok := operations["servers"]; ok {
+				entry["servers"] = servers
+			}
+			paths[path] = entry
+		}
+		entry[method] = operation
+	}
+	doc["paths"] = paths
+	return json.Marshal(doc)
+}
+
+// openapiPath turns a gin route path into an OpenAPI one, e.g.
+// /workspaces/:name into /workspaces/{name}, and returns its parameters.
+func openapiPath(route string) (string, []string) {
+	var params []string
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if len(segment) > 1 && (segment[0] == ':' || segment[0] == '*') {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// operationID derives an operation ID from the route's handler name, e.g.
+// main.handleGetWorkspace becomes getWorkspace.
+func operationID(handler string) string {
+	name := handler[strings.LastIndex(handler, ".")+1:]
+	name = strings.TrimPrefix(name, "handle")
+	if name == "" {
+		return handler
+	}
+	runes := []rune(name)
+	runes[0] = unicode.ToLower(runes[0])
+	return string(runes)
+}
+
+// handleGetOpenAPI returns the API document.
+func handleGetOpenAPI(c *gin.Context) {
+	c.Data(200, "application/json", openapiSpec)
+}
+
+// handleGetDocs serves Swagger UI for the API document.
+func handleGetDocs(c *gin.Context) {
+	c.Data(200, "text/html; charset=utf-8", swaggerPage)
+}
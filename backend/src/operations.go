@@ -0,0 +1,409 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maestro/src/database/schema"
+	"maestro/src/manager"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImageOperations bounds the operations listed per image.
+const maxImageOperations = 50
+
+// maxOperations bounds the operations returned by one listing.
+const maxOperations = 500
+
+// newOperation starts tracking a background task of the given kind working on
+// the image and target, started by owner.
+func (s *server) newOperation(kind, image, target, owner string) *manager.Operation {
+	op := manager.NewOperation(manager.NewRunID(), kind, image, owner, nil, s.persistOperation)
+	op.Target = target
+	serviceManager.Operations.Store(op.ID, op)
+	return op
+}
+
+// keepInMemory reports whether the operation may still change: it is running
+// or it is a failed run that can be resumed or cleaned up.
+func keepInMemory(op *manager.Operation) bool {
+	return op.Status == manager.OperationRunning ||
+		(op.Status == manager.OperationFailed && op.Kind == manager.OperationRun)
+}
+
+// persistOperation saves the operation to the database. Operations that can
+// no longer change are dropped from memory. It is called with the operation's
+// lock held.
+func (s *server) persistOperation(op *manager.Operation) {
+	raw, err := json.Marshal(op)
+	if err == nil {
+		err = s.db.Query.UpsertOperation(context.Background(), schema.UpsertOperationParams{
+			ID:        op.ID,
+			Kind:      op.Kind,
+			Image:     op.Image,
+			Server:    op.Server,
+			Status:    string(op.Status),
+			Data:      string(raw),
+			CreatedAt: op.CreatedAt,
+			UpdatedAt: op.UpdatedAt,
+		})
+	}
+	if err != nil {
+		loggers.For("operations").Error("Failed to save operation", "operation", op.ID, "error", err)
+	}
+
+	if !keepInMemory(op) {
+		serviceManager.Operations.Delete(op.ID)
+	}
+}
+
+func (s *server) decodeOperation(row schema.Operation) (*manager.Operation, error) {
+	var op manager.Operation
+	if err := json.Unmarshal([]byte(row.Data), &op); err != nil {
+		return nil, fmt.Errorf("corrupt operation %s: %v", row.ID, err)
+	}
+	op.Restore(s.persistOperation)
+	return &op, nil
+}
+
+// loadOperation returns an operation from memory or, once finished or after a
+// restart, from the database.
+func (s *server) loadOperation(ctx context.Context, id string) (*manager.Operation, error) {
+	if op, exists := serviceManager.Operations.Load(id); exists {
+		return op, nil
+	}
+
+	row, err := s.db.Query.GetOperation(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	op, err := s.decodeOperation(row)
+	if err != nil {
+		return nil, err
+	}
+	if keepInMemory(op) {
+		serviceManager.Operations.Store(op.ID, op)
+	}
+	return op, nil
+}
+
+// failInterruptedOperations marks operations that were still running when
+// maestro stopped as failed, runs at the step they were in so they can be
+// resumed or cleaned up.
+func (s *server) failInterruptedOperations(ctx context.Context) error {
+	rows, err := s.db.Query.ListOperationsByStatus(ctx, string(manager.OperationRunning))
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		op, err := s.decodeOperation(row)
+		if err != nil {
+			return err
+		}
+
+		interruptOperation(op, errors.New("interrupted by a restart of maestro"))
+		if keepInMemory(op) {
+			serviceManager.Operations.Store(op.ID, op)
+		}
+	}
+	return nil
+}
+
+// interruptOperation fails the step a running operation was at, or the
+// operation itself if it has no steps.
+func interruptOperation(op *manager.Operation, err error) {
+	steps := op.Copy().Steps
+	if len(steps) == 0 {
+		op.Finish(err)
+		return
+	}
+
+	step := steps[0].Name
+	for _, s := range steps {
+		if s.Status == manager.StepRunning || s.Status == manager.StepPending {
+			step = s.Name
+			break
+		}
+	}
+	op.Fail(step, err)
+}
+
+// loadOwnedOperation loads the operation named by the `id` parameter and its
+// image, writing the error response when either is missing or hidden from the
+// user.
+func (s *server) loadOwnedOperation(c *gin.Context) (*manager.Operation, *manager.ImageManager, bool) {
+	id := c.Param("id")
+
+	op, err := s.loadOperation(c, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondError(c, CodeNotFound, fmt.Sprintf("Operation %s not found", id))
+		} else {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to load operation %s: %v", id, err))
+		}
+		return nil, nil, false
+	}
+
+	if !canAccessOperation(c, op.Copy()) {
+		respondError(c, CodeNotFound, fmt.Sprintf("Operation %s not found", id))
+		return nil, nil, false
+	}
+	imageManager, _ := serviceManager.Images.Load(op.Image)
+	return op, imageManager, true
+}
+
+// canAccessOperation reports whether the request's user may see and cancel
+// the operation: admins, the user who started it and those who can access its
+// workspace. Operations of no workspace or of a deleted one are for admins
+// only.
+func canAccessOperation(c *gin.Context, op *manager.Operation) bool {
+	if isAdmin(c) || (op.Owner != "" && op.Owner == currentUser(c).Name) {
+		return true
+	}
+	return canAccessImage(c, op.Image)
+}
+
+// handleGetOperation returns an operation with the status of each step.
+func (s *server) handleGetOperation(c *gin.Context) {
+	op, _, ok := s.loadOwnedOperation(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, op.Copy())
+}
+
+// handleGetImageOperations lists the most recent operations of an image.
+func (s *server) handleGetImageOperations(c *gin.Context) {
+	name := c.Param("name")
+
+	rows, err := s.db.Query.ListImageOperations(c, schema.ListImageOperationsParams{Image: name, Limit: maxImageOperations})
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list operations of image %s: %v", name, err))
+		return
+	}
+
+	operations, err := s.decodeOperations(c, rows)
+	if err != nil {
+		respondError(c, CodeInternal, err.Error())
+		return
+	}
+
+	c.JSON(200, operations)
+}
+
+// handleGetOperations lists the most recent operations of every kind, such as
+// runs, builds and archivals. They can be filtered by `kind`, `status` and
+// `image`; `limit` defaults to 100.
+func (s *server) handleGetOperations(c *gin.Context) {
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxOperations {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid limit: %s, expected 1 to %d", raw, maxOperations))
+			return
+		}
+		limit = parsed
+	}
+
+	rows, err := s.db.Query.ListOperations(c, schema.ListOperationsParams{
+		Kind:     c.Query("kind"),
+		Status:   c.Query("status"),
+		Image:    c.Query("image"),
+		RowLimit: int64(limit),
+	})
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list operations: %v", err))
+		return
+	}
+
+	operations, err := s.decodeOperations(c, rows)
+	if err != nil {
+		respondError(c, CodeInternal, err.Error())
+		return
+	}
+
+	c.JSON(200, operations)
+}
+
+// decodeOperations decodes the listed operations, preferring the live state
+// of operations still in memory, and hides those the user cannot access.
+func (s *server) decodeOperations(c *gin.Context, rows []schema.Operation) ([]*manager.Operation, error) {
+	operations := make([]*manager.Operation, 0, len(rows))
+	for _, row := range rows {
+		var op *manager.Operation
+		if live, exists := serviceManager.Operations.Load(row.ID); exists {
+			op = live.Copy()
+		} else {
+			decoded, err := s.decodeOperation(row)
+			if err != nil {
+				return nil, err
+			}
+			op = decoded
+		}
+
+		if canAccessOperation(c, op) {
+			operations = append(operations, op)
+		}
+	}
+	return operations, nil
+}
+
+// handleCancelOperation cancels a running operation that supports it, such as
+// a run still waiting in its server's queue or an archival.
+func (s *server) handleCancelOperation(c *gin.Context) {
+	op, _, ok := s.loadOwnedOperation(c)
+	if !ok {
+		return
+	}
+
+	if err := op.Cancel(); err != nil {
+		if errors.Is(err, manager.ErrNotCancelable) {
+			respondError(c, CodeNotCancelable, fmt.Sprintf("Operation %s cannot be canceled: %v", op.ID, err))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to cancel operation %s: %v", op.ID, err))
+		return
+	}
+
+	c.JSON(200, op.Copy())
+}
+
+// handleResumeOperation retries a failed run from the step that failed. Runs
+// that failed while capturing logs are reattached to their container; all
+// others are placed, built if needed and queued again.
+func (s *server) handleResumeOperation(c *gin.Context) {
+	op, imageManager, ok := s.loadOwnedOperation(c)
+	if !ok {
+		return
+	}
+	if imageManager == nil {
+		respondError(c, CodeGone, fmt.Sprintf("Image %s of operation %s no longer exists", op.Image, op.ID))
+		return
+	}
+	if op.Kind != manager.OperationRun {
+		respondError(c, CodeConflict, fmt.Sprintf("Operations of kind %s cannot be resumed", op.Kind))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	failed := op.FailedStep()
+	if op.Copy().Status != manager.OperationFailed || failed == "" {
+		respondError(c, CodeConflict, fmt.Sprintf("Operation %s has not failed", op.ID))
+		return
+	}
+
+	if failed == manager.StepAttach {
+		resumeAttach(c, imageManager, op)
+		return
+	}
+
+	if !checkRunnable(c, imageManager) {
+		return
+	}
+
+	// a container created before the failure would otherwise be left behind
+	if err := removeOperationContainer(imageManager, op); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to remove container of operation %s: %v", op.ID, err))
+		return
+	}
+
+	op.Retry(failed)
+	startRun(c, imageManager, op)
+}
+
+// resumeAttach reopens the log files of the operation's container and
+// captures its output again from the last output written to them. The caller must hold imageManager.Mu.
+func resumeAttach(c *gin.Context, imageManager *manager.ImageManager, op *manager.Operation) {
+	container := imageManager.Container
+	if container == nil || container.ID != op.ContainerID || container.FinishedAt != nil {
+		respondError(c, CodeNotRunning, fmt.Sprintf("The container of operation %s is no longer running", op.ID))
+		return
+	}
+	connectionManager := imageManager.Connection
+
+	var err error
+	for _, logFile := range []struct {
+		name string
+		file **os.File
+	}{{container.StdoutLog, &container.Stdout}, {container.StderrLog, &container.Stderr}} {
+		*logFile.file, err = os.OpenFile(filepath.Join(imageManager.FilesDir, logFile.name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to reopen log file %s: %v", logFile.name, err))
+			return
+		}
+	}
+
+	// the output captured before is not captured twice
+	if container.Status == manager.Error {
+		container.Transition(manager.Running)
+	}
+	cursor := container.Captured
+	if cursor == nil {
+		cursor = manager.NewLogCursor(imageManager.LastLogWrite(container))
+	}
+	op.Retry(manager.StepAttach)
+	go attachLogs(connectionManager, imageManager, container, cursor, op)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Reattached to the container of operation %s", op.ID), "operation": op.ID})
+}
+
+// removeOperationContainer force-removes the container the operation created,
+// if any, and moves it out of the image's current run. The caller must hold
+// imageManager.Mu.
+func removeOperationContainer(imageManager *manager.ImageManager, op *manager.Operation) error {
+	if op.ContainerID == "" {
+		return nil
+	}
+
+	connectionManager, exists := serviceManager.Connections.Load(op.Server)
+	if !exists {
+		return fmt.Errorf("server %s is not connected", op.Server)
+	}
+	if err := connectionManager.RemoveContainer(op.ContainerID); err != nil {
+		return err
+	}
+
+	if container := imageManager.Container; container != nil && container.ID == op.ContainerID {
+		container.MarkExited(time.Now(), -1, false)
+		imageManager.ClearContainer()
+	}
+	op.SetContainer("")
+	return nil
+}
+
+// handleCleanupOperation removes what a failed operation left behind, such as
+// a created but never started container, and closes the operation.
+func (s *server) handleCleanupOperation(c *gin.Context) {
+	op, imageManager, ok := s.loadOwnedOperation(c)
+	if !ok {
+		return
+	}
+	if op.Copy().Status != manager.OperationFailed {
+		respondError(c, CodeConflict, fmt.Sprintf("Operation %s has not failed", op.ID))
+		return
+	}
+
+	if imageManager != nil {
+		imageManager.Mu.Lock()
+		defer imageManager.Mu.Unlock()
+
+		if err := removeOperationContainer(imageManager, op); err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to remove container of operation %s: %v", op.ID, err))
+			return
+		}
+	}
+	op.MarkCleanedUp()
+
+	c.JSON(200, op.Copy())
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"maestro/src/manager"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOperationAccess(t *testing.T) {
+	srv := newTestServer(t)
+	serviceManager.Images.Store("alice-ws", &manager.ImageManager{Name: "alice-ws", Owner: "alice"})
+	serviceManager.Images.Store("bob-ws", &manager.ImageManager{Name: "bob-ws", Owner: "bob"})
+
+	start := func(image, owner string, finished bool) string {
+		op := manager.NewOperation(manager.NewRunID(), manager.OperationBuild, image, owner, nil, srv.persistOperation)
+		serviceManager.Operations.Store(op.ID, op)
+		if finished {
+			op.Finish(nil)
+		}
+		t.Cleanup(func() { serviceManager.Operations.Delete(op.ID) })
+		return op.ID
+	}
+	ops := map[string]string{
+		"own workspace":      start("alice-ws", "alice", false),
+		"other workspace":    start("bob-ws", "bob", true),
+		"started in other's": start("bob-ws", "alice", true),
+		"no workspace":       start("", "", false),
+		"deleted workspace":  start("gone-ws", "", true),
+		"own in deleted":     start("gone-ws", "alice", true),
+		"other's in deleted": start("gone-ws", "bob", false),
+	}
+	t.Cleanup(func() {
+		serviceManager.Images.Delete("alice-ws")
+		serviceManager.Images.Delete("bob-ws")
+	})
+
+	engine := func(user User) *gin.Engine {
+		engine := gin.New()
+		engine.Use(asUser(user))
+		engine.GET("/operations", srv.handleGetOperations)
+		engine.GET("/operations/:id", srv.handleGetOperation)
+		return engine
+	}
+	alice := engine(User{Name: "alice", Role: RoleOperator})
+	root := engine(User{Name: "root", Role: RoleAdmin})
+
+	visible := map[string]bool{
+		"own workspace":      true,
+		"started in other's": true,
+		"own in deleted":     true,
+	}
+	for name, id := range ops {
+		want := 404
+		if visible[name] {
+			want = 200
+		}
+		if rec := send(t, alice, "GET", "/operations/"+id, "", nil, nil); rec.Code != want {
+			t.Errorf("%s: alice got %d, want %d", name, rec.Code, want)
+		}
+		if rec := send(t, root, "GET", "/operations/"+id, "", nil, nil); rec.Code != 200 {
+			t.Errorf("%s: admin got %d, want 200", name, rec.Code)
+		}
+	}
+
+	rec := send(t, alice, "GET", "/operations", "", nil, nil)
+	var listed []*manager.Operation
+	if err := json.Unmarshal(rec.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode listing: %v: %s", err, rec.Body)
+	}
+	if len(listed) != len(visible) {
+		t.Fatalf("alice listed %d operations, want %d", len(listed), len(visible))
+	}
+	for _, op := range listed {
+		if op.Owner != "alice" {
+			t.Errorf("alice listed operation %s of %q", op.ID, op.Owner)
+		}
+	}
+}
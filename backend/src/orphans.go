@@ -0,0 +1,70 @@
+package main
+
+import (
+	"maestro/src/manager"
+)
+
+// reconcileOrphans handles the running containers of maestro's on the server
+// that no image tracks as configured by orphans: adopts them by default,
+// removes them or leaves them alone. Exited ones hold no resources and are
+// left to the engine.
+func (s *server) reconcileOrphans(connectionManager *manager.ConnectionManager) {
+	serverName := connectionManager.Server.Name
+	log := loggers.For("orphans")
+
+	orphans, err := serviceManager.Orphans(connectionManager)
+	if err != nil {
+		log.Error("Failed to list containers", "server", serverName, "error", err)
+		return
+	}
+	for _, orphan := range orphans {
+		if !orphan.Running {
+			continue
+		}
+		imageName := orphan.Labels[manager.LabelImage]
+
+		switch config.Orphans {
+		case manager.OrphansIgnore:
+			log.Warn("Untracked container left running", "server", serverName, "image", imageName, "container", orphan.Name)
+		case manager.OrphansRemove:
+			if err := connectionManager.Runtime.RemoveContainer(orphan.ID, true, true); err != nil {
+				log.Error("Failed to remove untracked container", "server", serverName, "image", imageName, "container", orphan.Name, "error", err)
+				continue
+			}
+			log.Info("Removed untracked container", "server", serverName, "image", imageName, "container", orphan.Name)
+		default:
+			s.adoptOrphan(connectionManager, orphan)
+		}
+	}
+}
+
+// adoptOrphan tracks the orphan as its image's current container again and
+// captures its output from where its logs stop.
+func (s *server) adoptOrphan(connectionManager *manager.ConnectionManager, orphan manager.ContainerSummary) {
+	serverName := connectionManager.Server.Name
+	imageName := orphan.Labels[manager.LabelImage]
+	log := loggers.For("orphans")
+
+	imageManager, exists := serviceManager.Images.Load(imageName)
+	if !exists {
+		log.Warn("Untracked container of an unknown image left running", "server", serverName, "image", imageName, "container", orphan.Name)
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+	container, since, err := imageManager.Adopt(connectionManager, orphan)
+	if err != nil {
+		log.Warn("Failed to adopt untracked container", "server", serverName, "image", imageName, "container", orphan.Name, "error", err)
+		return
+	}
+
+	op := manager.NewOperation(manager.NewRunID(), manager.OperationAdopt, imageName, "", manager.AdoptSteps, s.persistOperation)
+	op.Server = serverName
+	op.ContainerID = container.ID
+	serviceManager.Operations.Store(op.ID, op)
+
+	log.Info("Adopted untracked container", "server", serverName, "image", imageName, "container", container.Name)
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventAdopted, Image: imageName, Server: serverName, Container: container.Name})
+	go attachLogs(connectionManager, imageManager, container, manager.NewLogCursor(since), op)
+}
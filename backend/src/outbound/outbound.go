@@ -0,0 +1,113 @@
+package outbound
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Config selects the proxies used for HTTP calls maestro makes itself, such as
+// webhooks, registry checks and notifications. Empty fields fall back to the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+type Config struct {
+	HTTPProxy    string        `yaml:"httpProxy"`
+	HTTPSProxy   string        `yaml:"httpsProxy"`
+	NoProxy      string        `yaml:"noProxy"`
+	Destinations []Destination `yaml:"destinations"`
+}
+
+// Destination overrides the proxy for one host, or for all subdomains when
+// Host starts with a dot (".example.com").
+type Destination struct {
+	Host  string `yaml:"host"`
+	Proxy string `yaml:"proxy"` // proxy URL, or "direct" to bypass any proxy
+}
+
+type override struct {
+	host   string
+	direct bool
+	proxy  *url.URL
+}
+
+var (
+	mu        sync.RWMutex
+	overrides []override
+	fallback  = httpproxy.FromEnvironment().ProxyFunc()
+
+	transport = func() *http.Transport {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = proxyFor
+		return t
+	}()
+)
+
+// Setup applies the proxy configuration to every client returned by Client.
+func Setup(cfg Config) error {
+	env := httpproxy.FromEnvironment()
+	if cfg.HTTPProxy != "" {
+		env.HTTPProxy = cfg.HTTPProxy
+	}
+	if cfg.HTTPSProxy != "" {
+		env.HTTPSProxy = cfg.HTTPSProxy
+	}
+	if cfg.NoProxy != "" {
+		env.NoProxy = cfg.NoProxy
+	}
+
+	parsed := make([]override, 0, len(cfg.Destinations))
+	for _, destination := range cfg.Destinations {
+		o := override{host: strings.ToLower(destination.Host)}
+		if destination.Proxy == "direct" {
+			o.direct = true
+		} else {
+			proxyURL, err := url.Parse(destination.Proxy)
+			if err != nil || proxyURL.Host == "" {
+				return fmt.Errorf("destination %s: invalid proxy %q", destination.Host, destination.Proxy)
+			}
+			o.proxy = proxyURL
+		}
+		parsed = append(parsed, o)
+	}
+
+	mu.Lock()
+	overrides = parsed
+	fallback = env.ProxyFunc()
+	mu.Unlock()
+
+	// drop connections that were made through the previous proxies
+	transport.CloseIdleConnections()
+	return nil
+}
+
+// Client returns an HTTP client that routes requests through the configured
+// proxies.
+func Client(timeout time.Duration) *http.Client {
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+func proxyFor(req *http.Request) (*url.URL, error) {
+	return Proxy(req.URL)
+}
+
+// Proxy returns the proxy for requests to target, or nil to connect directly.
+// It is for tools that make their own connections, such as git.
+func Proxy(target *url.URL) (*url.URL, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	host := strings.ToLower(target.Hostname())
+	for _, o := range overrides {
+		if host == o.host || (strings.HasPrefix(o.host, ".") && strings.HasSuffix(host, o.host)) {
+			if o.direct {
+				return nil, nil
+			}
+			return o.proxy, nil
+		}
+	}
+	return fallback(target)
+}
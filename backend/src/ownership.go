@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maestro/src/database/schema"
+	"maestro/src/manager"
+
+	"github.com/gin-gonic/gin"
+)
+
+// canAccess reports whether the request's user may see and change the
+// workspace. Admins can access every workspace, other users only their own,
+// unowned ones created before ownership was tracked and the one a signed URL
+// grants.
+func canAccess(c *gin.Context, imageManager *manager.ImageManager) bool {
+	imageManager.Mu.RLock()
+	owner := imageManager.Owner
+	imageManager.Mu.RUnlock()
+
+	user := currentUser(c)
+	return isAdmin(c) || owner == "" || owner == user.Name || user.Grant == imageManager.Name
+}
+
+// canAccessImage reports whether the request's user may see what belongs to
+// the named workspace, such as its events and placements. What belongs to no
+// workspace, or to one that is no longer registered, is for admins only.
+func canAccessImage(c *gin.Context, name string) bool {
+	if imageManager, exists := serviceManager.Images.Load(name); exists {
+		return canAccess(c, imageManager)
+	}
+	return isAdmin(c)
+}
+
+// requireOwner hides workspaces of other users: requests for them get the same
+// 404 as for a workspace that does not exist.
+func requireOwner(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if exists && !canAccess(c, imageManager) {
+		abortWithError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	c.Next()
+}
+
+// loadOwners assigns the owners recorded in the database to the registered
+// images.
+func (s *server) loadOwners(ctx context.Context) error {
+	owners, err := s.db.Query.ListWorkspaceOwners(ctx)
+	if err != nil {
+		return err
+	}
+	for _, owner := range owners {
+		if imageManager, exists := serviceManager.Images.Load(owner.Image); exists {
+			imageManager.Mu.Lock()
+			imageManager.Owner = owner.Owner
+			imageManager.Mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// OwnerRequest names the user handleSetOwner transfers a workspace to.
+type OwnerRequest struct {
+	Owner string `json:"owner" binding:"required"`
+}
+
+// handleSetOwner transfers a workspace to another user.
+func (s *server) handleSetOwner(c *gin.Context) {
+	name := c.Param("name")
+
+	var body OwnerRequest
+	if !bindJSON(c, &body, "owner") {
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	err := s.db.Query.SetWorkspaceOwner(c, schema.SetWorkspaceOwnerParams{Image: name, Owner: body.Owner})
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save owner of image %s: %v", name, err))
+		return
+	}
+	imageManager.Owner = body.Owner
+	listings.invalidateImage(name)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Image %s is now owned by %s", name, body.Owner)})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// listQuery is the page, filters and order a list endpoint was asked for:
+// `page` (from 1), `limit`, `status`, `server` and `sort`, a field prefixed
+// with - for descending order.
+type listQuery struct {
+	Page   int
+	Limit  int
+	Status string
+	Server string
+	Sort   string
+	Desc   bool
+}
+
+// Page is one page of a listing.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	Total int `json:"total"` // items matching the filters, on all pages
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+}
+
+// parseListQuery reads the list query of the request, ordering by
+// defaultSort unless one of the sortable fields is asked for. It responds
+// with 400 and returns false for an invalid query.
+func parseListQuery(c *gin.Context, defaultSort string, sortable ...string) (listQuery, bool) {
+	q := listQuery{
+		Page:   1,
+		Limit:  defaultPageLimit,
+		Status: c.Query("status"),
+		Server: c.Query("server"),
+	}
+
+	if raw := c.Query("page"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid page: %s, expected a number from 1", raw))
+			return q, false
+		}
+		q.Page = parsed
+	}
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxPageLimit {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid limit: %s, expected 1 to %d", raw, maxPageLimit))
+			return q, false
+		}
+		q.Limit = parsed
+	}
+
+	sort := c.DefaultQuery("sort", defaultSort)
+	q.Sort, q.Desc = strings.CutPrefix(sort, "-")
+	if !slices.Contains(sortable, q.Sort) {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid sort: %s, expected one of %s", sort, strings.Join(sortable, ", ")))
+		return q, false
+	}
+	return q, true
+}
+
+// key returns the query in canonical form, to cache listings by.
+func (q listQuery) key() string {
+	sort := q.Sort
+	if q.Desc {
+		sort = "-" + sort
+	}
+	return url.Values{
+		"page":   {strconv.Itoa(q.Page)},
+		"limit":  {strconv.Itoa(q.Limit)},
+		"status": {q.Status},
+		"server": {q.Server},
+		"sort":   {sort},
+	}.Encode()
+}
+
+// paginate returns the page of the items that keep accepts, ordered by the
+// sort field using compare. Items comparing equal keep their order.
+func paginate[T any](items []T, q listQuery, keep func(T) bool, compare func(a, b T, field string) int) Page[T] {
+	kept := make([]T, 0, len(items))
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	slices.SortStableFunc(kept, func(a, b T) int {
+		if q.Desc {
+			return compare(b, a, q.Sort)
+		}
+		return compare(a, b, q.Sort)
+	})
+
+	page := Page[T]{Items: []T{}, Total: len(kept), Page: q.Page, Limit: q.Limit}
+	if start := (q.Page - 1) * q.Limit; start < len(kept) {
+		page.Items = kept[start:min(start+q.Limit, len(kept))]
+	}
+	return page
+}
+
+// acceptAll is the filter of listings that cannot be filtered.
+func acceptAll[T any](T) bool {
+	return true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"maestro/src/manager"
+
+	"github.com/gin-gonic/gin"
+)
+
+// checkBuildPolicy evaluates the base images of a build against the image
+// policy. It writes the error response and returns false when the build must
+// not proceed.
+func checkBuildPolicy(c *gin.Context, imageManager *manager.ImageManager, connectionManager *manager.ConnectionManager, buildOpts manager.BuildOptions) bool {
+	if apiErr := buildPolicyError(imageManager, connectionManager, buildOpts); apiErr != nil {
+		respondErrorDetails(c, apiErr.Code, apiErr.Message, apiErr.Details)
+		return false
+	}
+	return true
+}
+
+// buildPolicyError is the error checkBuildPolicy responds with, nil if the
+// build is allowed.
+func buildPolicyError(imageManager *manager.ImageManager, connectionManager *manager.ConnectionManager, buildOpts manager.BuildOptions) *APIError {
+	contextDir := buildOpts.ContextDir
+	if contextDir == "" {
+		contextDir = imageManager.FilesDir
+	}
+
+	decisions, err := imagePolicy.Load().CheckBuild(contextDir, buildOpts.Containerfile, manager.BuildArgs(connectionManager.Server.Defaults))
+	if err != nil {
+		return &APIError{Code: CodeInvalidRequest, Message: fmt.Sprintf("Failed to check base images of %s: %v", imageManager.Name, err)}
+	}
+
+	for _, decision := range decisions {
+		if !decision.Allowed {
+			return &APIError{Code: CodePolicyDenied, Message: fmt.Sprintf("Base image %s is not allowed: %s", decision.Image, decision.Reason), Details: gin.H{"decisions": decisions}}
+		}
+	}
+	return nil
+}
+
+// handleGetImagePolicy returns the image policy in effect.
+func handleGetImagePolicy(c *gin.Context) {
+	c.JSON(200, imagePolicy.Load())
+}
+
+// handlePutImagePolicy replaces the image policy. It applies to the next build
+// or run, running containers are unaffected.
+func handlePutImagePolicy(c *gin.Context) {
+	var policy manager.ImagePolicy
+	if !bindJSON(c, &policy, "image policy") {
+		return
+	}
+
+	if err := policy.Save(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save image policy: %v", err))
+		return
+	}
+	imagePolicy.Store(&policy)
+
+	c.JSON(200, &policy)
+}
+
+// PolicyTestRequest names the image references and workspace
+// handleTestImagePolicy checks.
+type PolicyTestRequest struct {
+	Images        []string `json:"images" binding:"dive,required"`
+	Container     string   `json:"container"`
+	Containerfile string   `json:"containerfile"` // relative to the workspace, defaults to its Containerfile
+}
+
+// handleTestImagePolicy reports how the image policy treats the given image
+// references and, when `container` is set, the base images of that
+// workspace's Containerfile.
+func handleTestImagePolicy(c *gin.Context) {
+	var body PolicyTestRequest
+	if !bindJSON(c, &body, "policy test") {
+		return
+	}
+
+	policy := imagePolicy.Load()
+	decisions := []manager.PolicyDecision{}
+	for _, image := range body.Images {
+		decisions = append(decisions, policy.Check(image))
+	}
+
+	if body.Container != "" {
+		imageManager, exists := serviceManager.Images.Load(body.Container)
+		if !exists || !canAccess(c, imageManager) {
+			respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", body.Container))
+			return
+		}
+
+		// server build args are not known here, so only ARG defaults apply
+		buildDecisions, err := policy.CheckBuild(imageManager.FilesDir, body.Containerfile, nil)
+		if err != nil {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Failed to check base images of %s: %v", body.Container, err))
+			return
+		}
+		decisions = append(decisions, buildDecisions...)
+	}
+
+	c.JSON(200, decisions)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maestro/src/manager"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// probePaths are the health probes of maestro itself. They are served outside
+// the API prefix, where load balancers and orchestrators expect them.
+var probePaths = []string{"/healthz", "/readyz"}
+
+// readyTimeout bounds the database check of a readiness probe.
+const readyTimeout = 2 * time.Second
+
+// handleHealthz reports that the process is up and serving requests.
+func handleHealthz(c *gin.Context) {
+	c.JSON(200, gin.H{"status": "ok"})
+}
+
+// handleReadyz reports whether maestro can serve the API: the database is
+// reachable and at least one server is online. It responds 503 otherwise, so
+// load balancers stop sending requests.
+func (s *server) handleReadyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, readyTimeout)
+	defer cancel()
+
+	database := "ok"
+	if err := s.db.Ping(ctx); err != nil {
+		database = err.Error()
+	}
+
+	online, total := 0, 0
+	serviceManager.Connections.Range(func(_ string, connectionManager *manager.ConnectionManager) bool {
+		if connectionManager.Status() == manager.ServerOnline {
+			online++
+		}
+		total++
+		return true
+	})
+
+	checks := gin.H{"database": database, "servers_online": online, "servers": total}
+	switch {
+	case database != "ok":
+		respondErrorDetails(c, CodeUnavailable, fmt.Sprintf("Database unreachable: %s", database), checks)
+	case online == 0:
+		respondErrorDetails(c, CodeUnavailable, "No server is online", checks)
+	default:
+		checks["status"] = "ready"
+		c.JSON(200, checks)
+	}
+}
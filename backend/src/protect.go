@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleProtectFile marks a workspace file as admin-only.
+func handleProtectFile(c *gin.Context) {
+	setFileProtection(c, true)
+}
+
+// handleUnprotectFile lets collaborators change a workspace file again.
+func handleUnprotectFile(c *gin.Context) {
+	setFileProtection(c, false)
+}
+
+func setFileProtection(c *gin.Context, protected bool) {
+	name := c.Param("name")
+	fileName := c.Query("f_name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	filePath, ok := workspaceFile(c, fileName)
+	if !ok {
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	imageManager.SetProtected(filepath.ToSlash(filePath), protected)
+	if err := imageManager.SaveProtected(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save file protection: %v", err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("File %s protection updated for image %s", fileName, name), "protected_files": imageManager.ProtectedFiles})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleQuarantineContainer pauses and/or isolates an image's container,
+// snapshots it for review, and blocks further runs of the image.
+func handleQuarantineContainer(c *gin.Context) {
+	name := c.Param("name")
+	reason := c.Query("reason")
+	mode := c.DefaultQuery("mode", "both")
+
+	if mode != "pause" && mode != "isolate" && mode != "both" {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid quarantine mode: %s", mode))
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	if imageManager.Quarantine != nil {
+		respondError(c, CodeConflict, fmt.Sprintf("Image %s is already quarantined", name))
+		return
+	}
+
+	forensicsDir := filepath.Join(config.StateDir, "quarantine", name, time.Now().Format("02-01-2006_15-04-05"))
+	info := imageManager.Isolate(reason, mode != "isolate", mode != "pause", forensicsDir)
+	requestLog(c).Warn("Image quarantined", "image", name, "reason", reason, "mode", mode, "errors", info.Errors)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Image %s quarantined", name), "quarantine": info})
+}
+
+// handleReleaseContainer lifts a quarantine so the image can run again. A
+// paused container is left paused for the admin to stop or resume.
+func handleReleaseContainer(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	if imageManager.Quarantine == nil {
+		respondError(c, CodeConflict, fmt.Sprintf("Image %s is not quarantined", name))
+		return
+	}
+
+	imageManager.Quarantine = nil
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Image %s released from quarantine", name)})
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// limiterIdleTimeout is how long an unused client limiter is kept.
+const limiterIdleTimeout = 10 * time.Minute
+
+// RateLimit is a token bucket refilled at PerSecond tokens per second holding
+// up to Burst tokens. A zero PerSecond disables the limit.
+type RateLimit struct {
+	PerSecond float64 `yaml:"perSecond"`
+	Burst     int     `yaml:"burst"`
+}
+
+// RateLimitConfig limits requests per token, or per IP for requests without
+// one. Expensive endpoints such as builds, runs and uploads are additionally
+// limited by Expensive, and requests with invalid credentials per IP by
+// FailedAuth, so tokens cannot be guessed at the default rate.
+type RateLimitConfig struct {
+	Default    RateLimit `yaml:"default"`
+	Expensive  RateLimit `yaml:"expensive"`
+	FailedAuth RateLimit `yaml:"failedAuth"`
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// rateLimiter keeps one token bucket per client.
+type rateLimiter struct {
+	limit RateLimit
+
+	mu      sync.Mutex
+	clients map[string]*clientLimiter
+}
+
+// newRateLimiter returns the middleware enforcing limit per client.
+func newRateLimiter(limit RateLimit) gin.HandlerFunc {
+	rl := newClientLimiters(limit)
+	if rl == nil {
+		return func(c *gin.Context) { c.Next() }
+	}
+	return rl.handle
+}
+
+// newClientLimiters returns the token buckets of limit, nil if it is
+// disabled.
+func newClientLimiters(limit RateLimit) *rateLimiter {
+	if limit.PerSecond <= 0 {
+		return nil
+	}
+
+	rl := &rateLimiter{limit: limit, clients: map[string]*clientLimiter{}}
+	go rl.evictIdle()
+	return rl
+}
+
+// clientKey identifies the client by user for token requests and by IP
+// otherwise.
+func clientKey(c *gin.Context) string {
+	if user := currentUser(c); user.Name != anonymousUser && user.Name != "" {
+		return "user:" + user.Name
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// client returns the limiter of the client, creating it on first use.
+func (rl *rateLimiter) client(key string) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	client, exists := rl.clients[key]
+	if !exists {
+		client = &clientLimiter{limiter: rate.NewLimiter(rate.Limit(rl.limit.PerSecond), max(rl.limit.Burst, 1))}
+		rl.clients[key] = client
+	}
+	client.lastSeen = time.Now()
+	return client.limiter
+}
+
+// wait returns how long the client has to wait for a token without taking
+// one, 0 if one is available.
+func (rl *rateLimiter) wait(key string) time.Duration {
+	limiter := rl.client(key)
+	tokens := limiter.Tokens()
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / float64(limiter.Limit()) * float64(time.Second))
+}
+
+// take takes a token of the client, if one is available.
+func (rl *rateLimiter) take(key string) {
+	rl.client(key).Allow()
+}
+
+// rejectRateLimited aborts the request with 429 and the delay after which it
+// may be retried.
+func rejectRateLimited(c *gin.Context, delay time.Duration, message string) {
+	c.Header("Retry-After", fmt.Sprint(int(math.Ceil(delay.Seconds()))))
+	abortWithError(c, CodeRateLimited, fmt.Sprintf("%s, retry in %s", message, delay.Round(time.Millisecond)))
+}
+
+func (rl *rateLimiter) handle(c *gin.Context) {
+	reservation := rl.client(clientKey(c)).Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		// give the token back, the request is rejected rather than delayed
+		reservation.Cancel()
+		rejectRateLimited(c, delay, "Rate limit exceeded")
+		return
+	}
+
+	c.Next()
+}
+
+func (rl *rateLimiter) evictIdle() {
+	for {
+		time.Sleep(limiterIdleTimeout)
+
+		rl.mu.Lock()
+		for key, client := range rl.clients {
+			if time.Since(client.lastSeen) > limiterIdleTimeout {
+				delete(rl.clients, key)
+			}
+		}
+		rl.mu.Unlock()
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// request is one request of a rate limit test and the code it should get.
+type request struct {
+	remoteAddr string
+	header     http.Header
+	want       int
+}
+
+func TestRateLimiter(t *testing.T) {
+	// a token every 100 seconds, none is refilled during a test
+	limit := RateLimit{PerSecond: 0.01, Burst: 2}
+
+	tests := []struct {
+		name     string
+		user     User
+		requests []request
+	}{
+		{
+			name: "burst then rejected",
+			user: User{Name: anonymousUser},
+			requests: []request{
+				{remoteAddr: "192.0.2.1:1000", want: 200},
+				{remoteAddr: "192.0.2.1:1001", want: 200},
+				{remoteAddr: "192.0.2.1:1002", want: 429},
+			},
+		},
+		{
+			name: "per IP",
+			user: User{Name: anonymousUser},
+			requests: []request{
+				{remoteAddr: "192.0.2.1:1000", want: 200},
+				{remoteAddr: "192.0.2.1:1000", want: 200},
+				{remoteAddr: "192.0.2.2:1000", want: 200},
+				{remoteAddr: "192.0.2.1:1000", want: 429},
+			},
+		},
+		{
+			name: "forwarded for headers of untrusted proxies are ignored",
+			user: User{Name: anonymousUser},
+			requests: []request{
+				{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: 200},
+				{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Forwarded-For": {"198.51.100.2"}}, want: 200},
+				{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Forwarded-For": {"198.51.100.3"}}, want: 429},
+				{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Real-Ip": {"198.51.100.4"}}, want: 429},
+			},
+		},
+		{
+			name: "per user across IPs",
+			user: User{Name: "alice", Role: RoleViewer},
+			requests: []request{
+				{remoteAddr: "192.0.2.1:1000", want: 200},
+				{remoteAddr: "192.0.2.2:1000", want: 200},
+				{remoteAddr: "192.0.2.3:1000", want: 429},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			engine.SetTrustedProxies(nil)
+			engine.GET("/", asUser(tt.user), newRateLimiter(limit), func(c *gin.Context) { c.Status(200) })
+
+			for i, req := range tt.requests {
+				rec := send(t, engine, "GET", "/", req.remoteAddr, nil, req.header)
+				if rec.Code != req.want {
+					t.Fatalf("request %d: code = %d, want %d", i, rec.Code, req.want)
+				}
+				if rec.Code == 429 && rec.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d: no Retry-After header", i)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterTrustedProxy(t *testing.T) {
+	engine := gin.New()
+	engine.SetTrustedProxies([]string{"192.0.2.1"})
+	engine.GET("/", asUser(User{Name: anonymousUser}), newRateLimiter(RateLimit{PerSecond: 0.01, Burst: 1}), func(c *gin.Context) { c.Status(200) })
+
+	// behind a trusted proxy, each forwarded client has its own bucket
+	requests := []request{
+		{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: 200},
+		{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Forwarded-For": {"198.51.100.2"}}, want: 200},
+		{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}}, want: 429},
+	}
+	for i, req := range requests {
+		if rec := send(t, engine, "GET", "/", req.remoteAddr, nil, req.header); rec.Code != req.want {
+			t.Fatalf("request %d: code = %d, want %d", i, rec.Code, req.want)
+		}
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	engine := gin.New()
+	engine.GET("/", newRateLimiter(RateLimit{}), func(c *gin.Context) { c.Status(200) })
+	for i := range 10 {
+		if rec := send(t, engine, "GET", "/", "192.0.2.1:1000", nil, nil); rec.Code != 200 {
+			t.Fatalf("request %d: code = %d, want 200", i, rec.Code)
+		}
+	}
+}
+
+// TestFailedAuthLimit checks that invalid credentials are counted per IP and
+// that an IP over the limit is rejected before its credentials are checked,
+// valid ones included.
+func TestFailedAuthLimit(t *testing.T) {
+	srv := newTestServer(t)
+	previousAuth, previousFailures := config.Auth, authFailures
+	config.Auth = AuthConfig{Users: []User{{Name: "alice", Token: "alice-token", Role: RoleViewer}}}
+	authFailures = newClientLimiters(RateLimit{PerSecond: 0.01, Burst: 2})
+	t.Cleanup(func() {
+		config.Auth, authFailures = previousAuth, previousFailures
+	})
+
+	engine := gin.New()
+	engine.SetTrustedProxies(nil)
+	engine.GET("/", srv.authenticate, func(c *gin.Context) { c.Status(200) })
+
+	requests := []request{
+		{remoteAddr: "192.0.2.1:1000", header: bearer("alice-token"), want: 200},
+		{remoteAddr: "192.0.2.1:1000", header: bearer("guess-1"), want: 401},
+		{remoteAddr: "192.0.2.1:1000", header: bearer("alice-token"), want: 200},
+		{remoteAddr: "192.0.2.1:1000", header: bearer("guess-2"), want: 401},
+		{remoteAddr: "192.0.2.1:1000", header: bearer("guess-3"), want: 429},
+		{remoteAddr: "192.0.2.1:1000", header: bearer("alice-token"), want: 429},
+		{remoteAddr: "192.0.2.1:1000", header: http.Header{"X-Forwarded-For": {"198.51.100.1"}, "Authorization": {"Bearer alice-token"}}, want: 429},
+		{remoteAddr: "192.0.2.2:1000", header: bearer("alice-token"), want: 200},
+		{remoteAddr: "192.0.2.1:1000", want: 200}, // requests without credentials are not limited
+	}
+	for i, req := range requests {
+		rec := send(t, engine, "GET", "/", req.remoteAddr, nil, req.header)
+		if rec.Code != req.want {
+			t.Fatalf("request %d: code = %d, want %d, body %s", i, rec.Code, req.want, rec.Body)
+		}
+	}
+}
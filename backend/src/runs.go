@@ -0,0 +1,362 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maestro/src/database/schema"
+	"maestro/src/manager"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// persistRun saves a run to the database, where retention finds it once it
+// left the run history of its image.
+func (s *server) persistRun(image string, run *manager.ContainerManager) {
+	raw, err := json.Marshal(run)
+	if err == nil {
+		err = s.db.Query.UpsertRun(context.Background(), schema.UpsertRunParams{
+			ID:          run.RunID,
+			Image:       image,
+			Status:      string(run.Status),
+			Data:        string(raw),
+			HotSince:    run.HotSince(),
+			ArchivedAt:  run.ArchivedAt,
+			ArchivePath: run.ArchivePath,
+			CreatedAt:   run.CreatedAt,
+			UpdatedAt:   time.Now(),
+		})
+	}
+	if err != nil {
+		loggers.For("runs").Error("Failed to save run", "image", image, "run", run.RunID, "error", err)
+	}
+}
+
+func decodeRun(row schema.Run) (*manager.ContainerManager, error) {
+	var run manager.ContainerManager
+	if err := json.Unmarshal([]byte(row.Data), &run); err != nil {
+		return nil, fmt.Errorf("corrupt run %s: %v", row.ID, err)
+	}
+	run.ArchivedAt = row.ArchivedAt
+	run.ArchivePath = row.ArchivePath
+	return &run, nil
+}
+
+// findRun returns a run of the image, from the run history or, for older
+// runs, the database. The caller must hold imageManager.Mu.
+func (s *server) findRun(ctx context.Context, imageManager *manager.ImageManager, runID string) (*manager.ContainerManager, bool, error) {
+	if run, exists := imageManager.FindRun(runID); exists {
+		return run, true, nil
+	}
+	row, err := s.db.Query.GetRun(ctx, schema.GetRunParams{Image: imageManager.Name, ID: runID})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	run, err := decodeRun(row)
+	if err != nil {
+		return nil, false, err
+	}
+	return run, true, nil
+}
+
+// dueRuns returns the persisted runs that were last recent before the given
+// time and are not archived yet.
+func (s *server) dueRuns(ctx context.Context, before time.Time) ([]manager.RunRecord, error) {
+	rows, err := s.db.Query.ListRunsToArchive(ctx, &before)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]manager.RunRecord, 0, len(rows))
+	for _, row := range rows {
+		run, err := decodeRun(row)
+		if err != nil {
+			loggers.For("runs").Error("Skipped run to archive", "image", row.Image, "error", err)
+			continue
+		}
+		records = append(records, manager.RunRecord{Image: row.Image, Run: run})
+	}
+	return records, nil
+}
+
+// runArchiveDir returns the directory archived run logs are kept in.
+func runArchiveDir() string {
+	if config.Retention.ArchiveDir != "" {
+		return config.Retention.ArchiveDir
+	}
+	return filepath.Join(config.StateDir, "archive")
+}
+
+// handleGetRuns returns a page of the current and past runs of an image, most
+// recent first. They can be filtered by `status` and the `server` they ran on
+// and sorted by created_at, finished_at or status.
+func handleGetRuns(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	q, ok := parseListQuery(c, "-created_at", "created_at", "finished_at", "status")
+	if !ok {
+		return
+	}
+
+	listings.serve(c, runsNamespace(name), q.key(), func() any {
+		imageManager.Mu.RLock()
+		defer imageManager.Mu.RUnlock()
+
+		return paginate(imageManager.AllRuns(), q, func(run *manager.ContainerManager) bool {
+			return (q.Status == "" || string(run.Status) == q.Status) && (q.Server == "" || run.Activity.Server() == q.Server)
+		}, compareRuns)
+	})
+}
+
+// handleGetRun returns a run of an image, currentRun for its current one.
+func (s *server) handleGetRun(c *gin.Context) {
+	name := c.Param("name")
+	runID := c.Param("run")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.RLock()
+	defer imageManager.Mu.RUnlock()
+
+	run, exists := imageManager.Container, imageManager.Container != nil
+	if runID != currentRun {
+		var err error
+		run, exists, err = s.findRun(c, imageManager, runID)
+		if err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to read run %s of image %s: %v", runID, name, err))
+			return
+		}
+	}
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Run %s not found for image %s", runID, name))
+		return
+	}
+
+	c.JSON(200, run)
+}
+
+// requireCurrentRun only lets requests on the container of a run through if
+// the run is the current one of its image, the container the handlers act
+// on, or currentRun. The containers of other runs are gone or not created yet.
+func requireCurrentRun(c *gin.Context) {
+	name := c.Param("name")
+	runID := c.Param("run")
+	if runID == currentRun {
+		c.Next()
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		abortWithError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.RLock()
+	current := imageManager.Container != nil && imageManager.Container.RunID == runID
+	_, known := imageManager.FindRun(runID)
+	imageManager.Mu.RUnlock()
+
+	switch {
+	case current:
+		c.Next()
+	case known:
+		abortWithError(c, CodeNotRunning, fmt.Sprintf("Run %s is not the current run of image %s", runID, name))
+	default:
+		abortWithError(c, CodeNotFound, fmt.Sprintf("Run %s not found for image %s", runID, name))
+	}
+}
+
+// compareRuns orders runs by a sortable field of theirs. Runs whose
+// container was not created yet, or has not finished, count as the most
+// recent.
+func compareRuns(a, b *manager.ContainerManager, field string) int {
+	var at, bt time.Time
+	switch field {
+	case "status":
+		return cmp.Compare(a.Status, b.Status)
+	case "finished_at":
+		if a.FinishedAt != nil {
+			at = *a.FinishedAt
+		}
+		if b.FinishedAt != nil {
+			bt = *b.FinishedAt
+		}
+	default:
+		at, bt = a.CreatedAt, b.CreatedAt
+	}
+	switch {
+	case at.IsZero() && bt.IsZero():
+		return 0
+	case at.IsZero():
+		return 1
+	case bt.IsZero():
+		return -1
+	}
+	return at.Compare(bt)
+}
+
+// archiveCompression picks the compression of a downloaded archive from the
+// `compression` query parameter or, failing that, the Accept-Encoding header.
+// It responds with 400 and returns false for an unknown compression.
+func archiveCompression(c *gin.Context) (manager.Compression, bool) {
+	if raw := c.Query("compression"); raw != "" {
+		compression, err := manager.ParseCompression(raw)
+		if err != nil {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid compression: %s, expected gzip or zstd", raw))
+			return "", false
+		}
+		return compression, true
+	}
+
+	for _, encoding := range strings.Split(c.GetHeader("Accept-Encoding"), ",") {
+		if name, _, _ := strings.Cut(strings.TrimSpace(encoding), ";"); name == "zstd" {
+			return manager.CompressionZstd, true
+		}
+	}
+	return manager.CompressionGzip, true
+}
+
+// handleGetRunLogs downloads the stdout, stderr and build logs of a run as a
+// single tar archive, compressed with gzip or zstd.
+func (s *server) handleGetRunLogs(c *gin.Context) {
+	name := c.Param("name")
+	runID := c.Param("run")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.RLock()
+	run, exists, err := s.findRun(c, imageManager, runID)
+	var logFiles []string
+	var archivePath string
+	if exists {
+		logFiles = run.LogFiles()
+		archivePath = run.ArchivePath
+	}
+	filesDir := imageManager.FilesDir
+	imageManager.Mu.RUnlock()
+
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read run %s of image %s: %v", runID, name, err))
+		return
+	}
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Run %s not found for image %s", runID, name))
+		return
+	}
+
+	compression, ok := archiveCompression(c)
+	if !ok {
+		return
+	}
+	fileName := fmt.Sprintf("%s-%s-logs%s", name, runID, compression.Ext())
+
+	// archived runs already are the archive the client asks for
+	if archivePath != "" && strings.HasSuffix(archivePath, compression.Ext()) {
+		c.FileAttachment(archivePath, fileName)
+		return
+	}
+
+	var archive *os.File
+	if archivePath != "" {
+		archive, err = os.Open(archivePath)
+		if err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to open archive of run %s: %v", runID, err))
+			return
+		}
+		defer archive.Close()
+	}
+
+	c.Header("Content-Type", compression.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+
+	if archive != nil {
+		err = manager.Recompress(c.Writer, archive, compression)
+	} else {
+		err = manager.WriteTar(c.Writer, filesDir, logFiles, compression)
+	}
+	if err != nil {
+		// headers are already sent, so the archive is simply cut short
+		requestLog(c).Error("Failed to write log archive", "image", name, "run", runID, "error", err)
+	}
+}
+
+// handleRehydrateRun moves the logs of an archived run back into the
+// workspace.
+func (s *server) handleRehydrateRun(c *gin.Context) {
+	name := c.Param("name")
+	runID := c.Param("run")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	run, exists, err := s.findRun(c, imageManager, runID)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to read run %s of image %s: %v", runID, name, err))
+		return
+	}
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Run %s not found for image %s", runID, name))
+		return
+	}
+
+	err = imageManager.Rehydrate(run)
+	if errors.Is(err, manager.ErrRunNotArchived) {
+		respondError(c, CodeConflict, fmt.Sprintf("Run %s of image %s is not archived", runID, name))
+		return
+	}
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to rehydrate run %s of image %s: %v", runID, name, err))
+		return
+	}
+	listings.invalidateImage(name)
+
+	c.JSON(200, run)
+}
+
+// handleGetPlacement explains how the scheduler placed a run: which servers
+// were considered, which were filtered out and why.
+func handleGetPlacement(c *gin.Context) {
+	runID := c.Param("id")
+
+	placement, exists := serviceManager.Placement(runID)
+	if exists {
+		// placements of other users' workspaces are hidden like the workspaces
+		exists = canAccessImage(c, placement.Image)
+	}
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("No placement recorded for run %s", runID))
+		return
+	}
+
+	c.JSON(200, placement)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maestro/src/manager"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ScaffoldRequest picks the template handleScaffold writes.
+type ScaffoldRequest struct {
+	Template   string `json:"template" binding:"required"`
+	Entrypoint bool   `json:"entrypoint"`
+	Overwrite  bool   `json:"overwrite"`
+}
+
+// handleScaffold writes a starter Containerfile for a template (python, r,
+// node or cuda) into the workspace, with the dependency list it installs from
+// and optionally an entrypoint script. An existing Containerfile or
+// entrypoint is only replaced with `overwrite`; existing dependency lists are
+// kept.
+func handleScaffold(c *gin.Context) {
+	name := c.Param("name")
+
+	var body ScaffoldRequest
+	if !bindJSON(c, &body, "scaffold request") {
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	files, err := manager.Scaffold(body.Template, body.Entrypoint)
+	if err != nil {
+		respondError(c, CodeInvalidRequest, err.Error())
+		return
+	}
+	base, _ := manager.ScaffoldBaseImage(body.Template)
+	if decision := imagePolicy.Load().Check(base); !decision.Allowed {
+		respondError(c, CodePolicyDenied, fmt.Sprintf("Base image %s of template %s is not allowed: %s", base, body.Template, decision.Reason))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	var written []string
+	for _, file := range files {
+		_, err := root.Stat(file.Name)
+		switch {
+		case err == nil && file.Keep:
+			continue
+		case err == nil && !body.Overwrite:
+			respondError(c, CodeAlreadyExists, fmt.Sprintf("File %s already exists in image %s, set overwrite to replace it", file.Name, name))
+			return
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to check file %s: %v", file.Name, err))
+			return
+		}
+		if imageManager.IsProtected(file.Name) && !isAdmin(c) {
+			respondError(c, CodeProtected, fmt.Sprintf("File %s is protected and can only be changed by an admin", file.Name))
+			return
+		}
+	}
+
+	for _, file := range files {
+		if _, err := root.Stat(file.Name); err == nil && file.Keep {
+			continue
+		}
+		if err := manager.WriteRootFile(root, file.Name, strings.NewReader(file.Content), file.Mode); err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to write file %s: %v", file.Name, err))
+			return
+		}
+		// the mode only applies to new files
+		if err := root.Chmod(file.Name, file.Mode); err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to write file %s: %v", file.Name, err))
+			return
+		}
+		written = append(written, file.Name)
+	}
+
+	c.JSON(201, gin.H{"message": fmt.Sprintf("Scaffolded image %s from the %s template", name, body.Template), "files": written})
+}
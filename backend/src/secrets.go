@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maestro/src/manager"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetSecrets lists the names and metadata of the stored secrets.
+// Secret values are never returned.
+func handleGetSecrets(c *gin.Context) {
+	c.JSON(200, secretStore.List())
+}
+
+// SecretRequest is the value handlePutSecret stores.
+type SecretRequest struct {
+	Value string `json:"value" binding:"required"`
+}
+
+// handlePutSecret creates a secret or replaces its value.
+func handlePutSecret(c *gin.Context) {
+	secretName := c.Param("secret")
+	if !manager.ValidSecretName(secretName) {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid secret name: %s", secretName))
+		return
+	}
+
+	var body SecretRequest
+	if !bindJSON(c, &body, "secret") {
+		return
+	}
+
+	info, err := secretStore.Set(secretName, []byte(body.Value))
+	if err != nil {
+		if errors.Is(err, manager.ErrSecretsDisabled) {
+			respondError(c, CodeSecretsDisabled, "Secrets are disabled, no secret key is configured")
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save secret %s: %v", secretName, err))
+		return
+	}
+
+	c.JSON(200, info)
+}
+
+// handleDeleteSecret removes a secret.
+func handleDeleteSecret(c *gin.Context) {
+	secretName := c.Param("secret")
+
+	if err := secretStore.Delete(secretName); err != nil {
+		if errors.Is(err, manager.ErrSecretNotFound) {
+			respondError(c, CodeNotFound, fmt.Sprintf("Secret %s not found", secretName))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to delete secret %s: %v", secretName, err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Secret %s deleted", secretName)})
+}
+
+// handleRotateSecrets re-encrypts every secret with the primary key.
+func handleRotateSecrets(c *gin.Context) {
+	rotated, err := secretStore.Rotate()
+	if err != nil {
+		if errors.Is(err, manager.ErrSecretsDisabled) {
+			respondError(c, CodeSecretsDisabled, "Secrets are disabled, no secret key is configured")
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to rotate secrets: %v", err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Rotated %d secrets", rotated), "rotated": rotated})
+}
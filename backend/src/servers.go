@@ -0,0 +1,651 @@
+package main
+
+import (
+	"fmt"
+	"maestro/src/manager"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// serverDrainInterval is how often a removed server is checked for runs that
+// are still queued or running.
+const serverDrainInterval = 5 * time.Second
+
+// healthCheckInterval is how often every server's Podman connection is
+// checked, and an offline server reconnected.
+const healthCheckInterval = 30 * time.Second
+
+// capacityCheckInterval is how often a run waiting for free resources checks
+// whether its server has room for it.
+const capacityCheckInterval = 2 * time.Second
+
+// handleGetServerTimeline returns the build and run intervals of a server that
+// overlap the requested range (RFC 3339 `from`/`to`, defaulting to the last
+// 24 hours).
+func handleGetServerTimeline(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+
+	to := time.Now()
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid to time: %s", raw))
+			return
+		}
+		to = parsed
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid from time: %s", raw))
+			return
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		respondError(c, CodeInvalidRequest, "from must be before to")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"server":     serverName,
+		"from":       from,
+		"to":         to,
+		"activities": connectionManager.Timeline(from, to),
+	})
+}
+
+// handleGetServerHealth runs a deep health check of a server. The response
+// status is 503 when the check fails.
+func handleGetServerHealth(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+
+	report := connectionManager.CheckHealth()
+	if report.Error != "" {
+		c.JSON(503, report)
+		return
+	}
+
+	c.JSON(200, report)
+}
+
+// handleGetServerInfo returns the engine version, storage driver, image count,
+// free disk and OS details of a server, to compare servers a run behaves
+// differently on.
+func handleGetServerInfo(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+
+	info, err := connectionManager.SystemInfo()
+	if err != nil {
+		respondError(c, CodeUpstream, fmt.Sprintf("Failed to read info of server %s: %v", serverName, err))
+		return
+	}
+
+	c.JSON(200, info)
+}
+
+// handleGetServerGroups lists the server groups runs can target.
+func handleGetServerGroups(c *gin.Context) {
+	c.JSON(200, serviceManager.GroupList())
+}
+
+// ServerGroupRequest lists the members handlePutServerGroup sets.
+type ServerGroupRequest struct {
+	Members []string `json:"members" binding:"required,dive,server_name"`
+}
+
+// handlePutServerGroup creates a server group or replaces its members.
+func handlePutServerGroup(c *gin.Context) {
+	groupName := c.Param("group")
+
+	var body ServerGroupRequest
+	if !bindJSON(c, &body, "server group") {
+		return
+	}
+
+	if err := serviceManager.SetGroup(groupName, body.Members); err != nil {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid server group %s: %v", groupName, err))
+		return
+	}
+	if err := serviceManager.SaveGroups(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save server groups: %v", err))
+		return
+	}
+
+	group, _ := serviceManager.Groups.Load(groupName)
+	c.JSON(200, group)
+}
+
+// handleDeleteServerGroup removes a server group. Its servers are unaffected.
+func handleDeleteServerGroup(c *gin.Context) {
+	groupName := c.Param("group")
+
+	if !serviceManager.Groups.Exists(groupName) {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server group %s not found", groupName))
+		return
+	}
+	serviceManager.Groups.Delete(groupName)
+
+	if err := serviceManager.SaveGroups(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save server groups: %v", err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Server group %s deleted", groupName)})
+}
+
+// handleGetServerQueue lists the runs waiting for a server, in order.
+func handleGetServerQueue(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+
+	runs := []manager.QueuedRun{}
+	for _, run := range connectionManager.RunQueue.List() {
+		// hide the runs of workspaces the user cannot access
+		if imageManager, exists := serviceManager.Images.Load(run.Image); exists && !canAccess(c, imageManager) {
+			run.Image = ""
+		}
+		runs = append(runs, run)
+	}
+
+	c.JSON(200, runs)
+}
+
+// checkPullPolicy rejects images the image policy does not allow, writing the
+// error response.
+func checkPullPolicy(c *gin.Context, refs []string) bool {
+	for _, ref := range refs {
+		if decision := imagePolicy.Load().Check(ref); !decision.Allowed {
+			respondError(c, CodePolicyDenied, fmt.Sprintf("Image %s is not allowed: %s", ref, decision.Reason))
+			return false
+		}
+	}
+	return true
+}
+
+// startPull pulls the images onto the server in the background, tracked as an
+// operation.
+func (s *server) startPull(connectionManager *manager.ConnectionManager, refs []string) *manager.Operation {
+	serverName := connectionManager.Server.Name
+	op := s.newOperation(manager.OperationPull, "", strings.Join(refs, ","), "")
+	op.SetServer(serverName)
+
+	go func() {
+		err := connectionManager.PullImages(refs, op)
+		op.Finish(err)
+		if err != nil {
+			loggers.For("servers").Error("Failed to pull images", "server", serverName, "error", err)
+		}
+	}()
+	return op
+}
+
+// prewarmServers pulls the images onto every server, skipping those the image
+// policy does not allow.
+func (s *server) prewarmServers(images []string) []*manager.Operation {
+	var refs []string
+	for _, ref := range images {
+		if decision := imagePolicy.Load().Check(ref); !decision.Allowed {
+			loggers.For("servers").Warn("Skipping prewarm image not allowed by the image policy", "image", ref, "reason", decision.Reason)
+			continue
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	var operations []*manager.Operation
+	serviceManager.Connections.Range(func(serverName string, connectionManager *manager.ConnectionManager) bool {
+		operations = append(operations, s.startPull(connectionManager, refs))
+		return true
+	})
+	return operations
+}
+
+// PullRequest lists the images handlePullImages pulls.
+type PullRequest struct {
+	Images []string `json:"images" binding:"required,min=1,dive,required"`
+}
+
+// handlePullImages pulls base images onto a server ahead of time. The pull
+// runs in the background; the response names its operation.
+func (s *server) handlePullImages(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+
+	var body PullRequest
+	if !bindJSON(c, &body, "pull request") {
+		return
+	}
+	if !checkPullPolicy(c, body.Images) {
+		return
+	}
+
+	op := s.startPull(connectionManager, body.Images)
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Pulling %d images on server %s", len(body.Images), serverName), "operation": op.ID})
+}
+
+// handleAddServer connects to a new server and starts its worker. The server
+// is saved in the state directory and connected again on restart.
+func (s *server) handleAddServer(c *gin.Context) {
+	var body manager.ServerRegistration
+	if !bindJSON(c, &body, "server") {
+		return
+	}
+	if err := body.Validate(); err != nil {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid server: %v", err))
+		return
+	}
+	if serviceManager.Connections.Exists(body.Name) {
+		respondError(c, CodeAlreadyExists, fmt.Sprintf("Server %s already exists", body.Name))
+		return
+	}
+
+	connectionManager, err := s.connectServer(body.Name, body.Info())
+	if err != nil {
+		respondError(c, CodeUpstream, fmt.Sprintf("Failed to connect to server %s: %v", body.Name, err))
+		return
+	}
+	serverRegistry.Add(body)
+	if err := serverRegistry.Save(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Server %s connected but not saved: %v", body.Name, err))
+		return
+	}
+	requestLog(c).Info("Server added", "server", body.Name, "host", body.Host)
+
+	c.JSON(201, connectionManager.Server)
+}
+
+// handleRemoveServer takes a server out of placement and its groups. Runs
+// already queued on it still run; its connection is closed once they and its
+// running containers finished.
+func handleRemoveServer(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+
+	serviceManager.RemoveServer(connectionManager)
+	serverRegistry.Remove(serverName)
+	if err := serverRegistry.Save(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Server %s removed but not saved: %v", serverName, err))
+		return
+	}
+	if err := serviceManager.SaveGroups(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save server groups: %v", err))
+		return
+	}
+
+	queued := connectionManager.RunQueue.Len()
+	running := serviceManager.RunningOn(connectionManager)
+	requestLog(c).Info("Server removed", "server", serverName, "queued", queued, "running", running)
+	go func() {
+		serviceManager.Drain(connectionManager, serverDrainInterval)
+		loggers.For("servers").Info("Server drained", "server", serverName)
+	}()
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Server %s removed, draining", serverName), "queued": queued, "running": running})
+}
+
+// handleDrainServer takes a server out of service for maintenance: it takes no
+// new runs and holds its queued ones, and is under maintenance once its running
+// containers exited. With `stop=true` they are stopped right away instead of
+// waited for.
+func handleDrainServer(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+	if state := connectionManager.Maintenance(); state != "" {
+		respondError(c, CodeConflict, fmt.Sprintf("Server %s is already %s", serverName, state))
+		return
+	}
+
+	connectionManager.SetMaintenance(manager.MaintenanceDraining)
+	serverRegistry.SetMaintenance(serverName, true)
+	if err := serverRegistry.Save(config.StateDir); err != nil {
+		requestLog(c).Error("Failed to save maintenance state", "server", serverName, "error", err)
+	}
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventServerDraining, Server: serverName})
+
+	running := serviceManager.RunningOn(connectionManager)
+	if c.Query("stop") == "true" {
+		for _, name := range running {
+			imageManager, exists := serviceManager.Images.Load(name)
+			if !exists {
+				continue
+			}
+			if err := stopRunning(imageManager); err != nil {
+				requestLog(c).Error("Stop failed", "image", name, "server", serverName, "error", err)
+			}
+		}
+	}
+	requestLog(c).Info("Server draining", "server", serverName, "queued", connectionManager.RunQueue.Len(), "running", running)
+
+	go func() {
+		if serviceManager.WaitMaintenance(connectionManager, serverDrainInterval) {
+			loggers.For("servers").Info("Server under maintenance", "server", serverName)
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventServerMaintenance, Server: serverName})
+		}
+	}()
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Server %s draining", serverName), "queued": connectionManager.RunQueue.Len(), "running": running})
+}
+
+// handleResumeServer puts a drained server back in service. Its held runs
+// start again.
+func handleResumeServer(c *gin.Context) {
+	serverName := c.Param("name")
+
+	connectionManager, exists := serviceManager.Connections.Load(serverName)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Server %s not found", serverName))
+		return
+	}
+	if connectionManager.Maintenance() == "" {
+		respondError(c, CodeConflict, fmt.Sprintf("Server %s is not drained", serverName))
+		return
+	}
+
+	connectionManager.SetMaintenance("")
+	serverRegistry.SetMaintenance(serverName, false)
+	if err := serverRegistry.Save(config.StateDir); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Server %s resumed but not saved: %v", serverName, err))
+		return
+	}
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventServerResumed, Server: serverName})
+	requestLog(c).Info("Server resumed", "server", serverName)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Server %s resumed", serverName), "queued": connectionManager.RunQueue.Len()})
+}
+
+// handlePrewarmServers pulls the configured prewarm images onto every server
+// again, such as after adding a server or to pick up newer base images.
+func (s *server) handlePrewarmServers(c *gin.Context) {
+	if len(config.Prewarm) == 0 {
+		respondError(c, CodeConflict, "No prewarm images configured")
+		return
+	}
+
+	ids := []string{}
+	for _, op := range s.prewarmServers(config.Prewarm) {
+		ids = append(ids, op.ID)
+	}
+
+	c.JSON(202, gin.H{"message": fmt.Sprintf("Pulling %d images on every server", len(config.Prewarm)), "operations": ids})
+}
+
+// connectServer opens the Podman and SSH connections of a server, registers
+// it and starts its worker.
+func (s *server) connectServer(serverName string, serverInfo manager.ServerInfo) (*manager.ConnectionManager, error) {
+	loggers.For("servers").Info("Connecting to server", "server", serverName, "uri", serverInfo.URI, "user", serverInfo.Username, "host", serverInfo.Host, "port", serverInfo.Port, "socket", serverInfo.PodmanSocket)
+	serverInfo.Name = serverName
+	connectionManager := manager.NewConnectionManager(serverInfo)
+	connectionManager.Secrets = secretStore
+	if err := connectionManager.Reconnect(); err != nil {
+		return nil, err
+	}
+	if err := connectionManager.ReadInfo(); err != nil {
+		if connectionManager.SshConn != nil {
+			connectionManager.SshConn.Close()
+		}
+		return nil, err
+	}
+
+	connectionManager.Server.Status = manager.ServerOnline
+	s.registerServer(connectionManager)
+	return connectionManager, nil
+}
+
+// registerOfflineServer registers a server that could not be connected to as
+// offline. Its health monitor keeps trying to connect.
+func (s *server) registerOfflineServer(serverName string, serverInfo manager.ServerInfo) {
+	serverInfo.Name = serverName
+	serverInfo.ConsecutiveFailures = 1
+	connectionManager := manager.NewConnectionManager(serverInfo)
+	connectionManager.Secrets = secretStore
+	s.registerServer(connectionManager)
+}
+
+// registerServer makes a server available for placement and starts its
+// event watcher, health monitor and worker.
+func (s *server) registerServer(connectionManager *manager.ConnectionManager) {
+	if serverRegistry.UnderMaintenance(connectionManager.Server.Name) {
+		connectionManager.SetMaintenance(manager.MaintenanceActive)
+	}
+	serviceManager.Connections.Store(connectionManager.Server.Name, connectionManager)
+	go watchServer(connectionManager)
+	go s.monitorServer(connectionManager)
+	go runWorker(connectionManager)
+}
+
+// watchServer follows the Podman event stream of a server to track container
+// exits, resubscribing whenever the stream drops, until the server is removed.
+func watchServer(connectionManager *manager.ConnectionManager) {
+	serverName := connectionManager.Server.Name
+
+	for !connectionManager.RunQueue.Closed() {
+		if connectionManager.Status() == manager.ServerOffline {
+			time.Sleep(reconcileInterval / 6)
+			continue
+		}
+		err := connectionManager.WatchEvents(&serviceManager)
+		if err != nil && !connectionManager.RunQueue.Closed() {
+			loggers.For("monitor").Error("Event stream failed", "server", serverName, "error", err)
+		}
+		time.Sleep(reconcileInterval / 6)
+	}
+}
+
+// monitorServer checks the health of a server every healthCheckInterval until
+// the server is removed. Once the server is offline, its connections are
+// opened again on every check instead, so a rebooted server comes back by
+// itself.
+func (s *server) monitorServer(connectionManager *manager.ConnectionManager) {
+	serverName := connectionManager.Server.Name
+	log := loggers.For("monitor")
+
+	for !connectionManager.RunQueue.Closed() {
+		time.Sleep(healthCheckInterval)
+
+		if connectionManager.Status() == manager.ServerOffline {
+			if err := connectionManager.Reconnect(); err != nil {
+				log.Debug("Failed to reconnect to server", "server", serverName, "error", err)
+				continue
+			}
+			if err := connectionManager.ReadInfo(); err != nil {
+				log.Debug("Failed to reconnect to server", "server", serverName, "error", err)
+				continue
+			}
+			if report := connectionManager.CheckHealth(); report.Status == manager.ServerOnline {
+				log.Info("Server reconnected", "server", serverName)
+				serviceManager.Events.Publish(manager.Event{Type: manager.EventServerOnline, Server: serverName})
+				s.reconcileOrphans(connectionManager)
+			}
+			continue
+		}
+
+		if report := connectionManager.CheckHealth(); report.Status == manager.ServerOffline {
+			log.Error("Server offline", "server", serverName, "failures", report.ConsecutiveFailures, "error", report.Error)
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventServerOffline, Server: serverName, Message: report.Error})
+		}
+	}
+}
+
+// runWorker consumes the image jobs queued for a server and creates and starts
+// their containers, until the server is removed and its queue runs empty.
+func runWorker(connectionManager *manager.ConnectionManager) {
+	serverName := connectionManager.Server.Name
+	workerLog := loggers.For("worker")
+	for {
+		// queued runs are held while the server is out of service
+		for connectionManager.Maintenance() != "" && !connectionManager.RunQueue.Closed() {
+			time.Sleep(capacityCheckInterval)
+		}
+		job := connectionManager.RunQueue.Pop()
+		if job == nil {
+			return
+		}
+		job.Operation.SetCancel(nil)
+		imageManager := job.Image
+
+		// a run that does not fit waits at the head of the queue until running
+		// containers exit and free their resources
+		capacity := connectionManager.Server.Capacity
+		if !capacity.Fits(serviceManager.Reserved(connectionManager), job.Options.Resources) {
+			workerLog.Info("Run waits for free resources", "server", serverName, "image", imageManager.Name, "run", job.ID)
+			for !capacity.Fits(serviceManager.Reserved(connectionManager), job.Options.Resources) {
+				time.Sleep(capacityCheckInterval)
+			}
+		}
+		func() {
+			imageManager.Mu.Lock()
+			defer imageManager.Mu.Unlock()
+
+			dateTime := time.Now().Format("02-01-2006_15-04-05")
+			containerName := fmt.Sprintf("container-%s", dateTime)
+
+			op := job.Operation
+			run := job.Run
+
+			// Create container using the built image reference.
+			op.Begin(manager.StepCreate)
+			mounts := job.Options.Mounts
+			if workspace := job.Options.Workspace; workspace != nil {
+				source, err := connectionManager.SyncWorkspace(imageManager, workspace.Subdir)
+				if err != nil {
+					workerLog.Error("Failed to sync workspace", "server", serverName, "image", imageManager.Name, "error", err)
+					imageManager.AbortRun(run, manager.Error)
+					serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: imageManager.Name, Server: serverName, Message: err.Error()})
+					op.Fail(manager.StepCreate, err)
+					return
+				}
+				mounts = append(slices.Clone(mounts), manager.Mount{Source: source, Target: workspace.Target, ReadOnly: workspace.ReadOnly})
+			}
+			stdoutFileName := fmt.Sprintf("stdout-%s.log", dateTime)
+			stderrFileName := fmt.Sprintf("stderr-%s.log", dateTime)
+			containerID, err := connectionManager.Runtime.CreateContainer(manager.ContainerSpec{
+				Name:        containerName,
+				Image:       imageManager.RunImage(),
+				Env:         job.Options.Env,
+				Mounts:      mounts,
+				Resources:   job.Options.Resources,
+				Interactive: job.Options.Interactive,
+				Labels:      manager.RunLabels(imageManager.Name, job.ID, stdoutFileName, stderrFileName, job.Options),
+			})
+			if err != nil {
+				// Creation failed
+				workerLog.Error("Failed to create container", "server", serverName, "image", imageManager.Name, "container", containerName, "error", err)
+				imageManager.AbortRun(run, manager.Error)
+				serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: imageManager.Name, Server: serverName, Container: containerName, Message: err.Error()})
+				op.Fail(manager.StepCreate, err)
+				return
+			}
+			op.SetContainer(containerID)
+			op.Succeed(manager.StepCreate)
+
+			// Prepare stdout/stderr files in the image's directory.
+			stdoutPath := filepath.Join(imageManager.FilesDir, stdoutFileName)
+			stderrPath := filepath.Join(imageManager.FilesDir, stderrFileName)
+
+			stdoutFD, err := os.OpenFile(stdoutPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				workerLog.Error("Failed to open stdout file", "image", imageManager.Name, "path", stdoutPath, "error", err)
+			}
+
+			stderrFD, err := os.OpenFile(stderrPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+			if err != nil {
+				workerLog.Error("Failed to open stderr file", "image", imageManager.Name, "path", stderrPath, "error", err)
+			}
+
+			// Track container metadata on the run, now the image's current
+			// container.
+			container := run
+			container.ID = containerID
+			container.Name = containerName
+			container.CreatedAt = time.Now()
+			container.StdoutLog = stdoutFileName
+			container.StderrLog = stderrFileName
+			container.Commit = imageManager.Commit
+			container.Options = job.Options
+			container.Stdout = stdoutFD
+			container.Stderr = stderrFD
+			if buildLog := imageManager.LastBuildLog(); buildLog != nil {
+				container.BuildLog = buildLog.Name
+			}
+			if err := imageManager.StartRun(container); err != nil {
+				workerLog.Error("Failed to start container", "server", serverName, "image", imageManager.Name, "container", containerName, "error", err)
+				connectionManager.RemoveContainer(containerID)
+				container.CloseLogs()
+				op.Fail(manager.StepStart, err)
+				return
+			}
+
+			// Start the container and update status on failure.
+			op.Begin(manager.StepStart)
+			err = connectionManager.Runtime.StartContainer(container.ID)
+			if err == nil {
+				err = container.Transition(manager.Running)
+			}
+			if err != nil {
+				workerLog.Error("Failed to start container", "server", serverName, "image", imageManager.Name, "container", containerName, "error", err)
+				container.Transition(manager.Error)
+				serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: imageManager.Name, Server: serverName, Container: containerName, Message: err.Error()})
+				op.Fail(manager.StepStart, err)
+				return
+			}
+			op.Succeed(manager.StepStart)
+
+			container.Activity = connectionManager.BeginActivity(manager.RunActivity, imageManager.Name)
+			workerLog.Info("Container started", "server", serverName, "image", imageManager.Name, "container", containerName)
+			serviceManager.Events.Publish(manager.Event{Type: manager.EventStarted, Image: imageManager.Name, Server: serverName, Container: containerName})
+
+			// Attach to container streams to capture logs in a separate thread.
+			go attachLogs(connectionManager, imageManager, container, manager.NewLogCursor(time.Time{}), op)
+		}()
+	}
+
+}
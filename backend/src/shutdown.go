@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maestro/src/manager"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout is how long requests in flight may take to complete once
+// maestro is asked to stop.
+const shutdownTimeout = 30 * time.Second
+
+// shuttingDown is set once maestro stops, so the log captures that end with it
+// are not taken for failed runs.
+var shuttingDown atomic.Bool
+
+// errShutdown fails the operations maestro stops in the middle of.
+var errShutdown = errors.New("interrupted by a shutdown of maestro")
+
+// serve runs the HTTP server until SIGINT or SIGTERM. It then stops accepting
+// requests, gives those in flight shutdownTimeout to complete and shuts down.
+func serve(handler http.Handler, addr string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// event and build log streams only end with their request's context,
+	// which is canceled as soon as the shutdown starts
+	base, cancelBase := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     handler,
+		BaseContext: func(net.Listener) context.Context { return base },
+	}
+	srv.RegisterOnShutdown(cancelBase)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-served:
+		cancelBase()
+		return err
+	case <-ctx.Done():
+	}
+	// a second signal stops maestro right away
+	stop()
+
+	log := loggers.For("main")
+	log.Info("Shutting down", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Warn("Requests still in flight after the timeout", "error", err)
+	}
+
+	shutdown()
+	return nil
+}
+
+// shutdown stops the workers, cancels the queued runs, fails the operations
+// still running, records the containers that keep running for the next start
+// and closes their log files and the connections to the servers. The
+// containers themselves are left running.
+func shutdown() {
+	log := loggers.For("main")
+	shuttingDown.Store(true)
+
+	// the workers stop after their current job
+	serviceManager.Connections.Range(func(serverName string, connectionManager *manager.ConnectionManager) bool {
+		jobs := connectionManager.RunQueue.Drain()
+		for _, job := range jobs {
+			cancelQueuedRun(job, serverName)
+		}
+		if len(jobs) > 0 {
+			log.Info("Cancelled queued runs", "server", serverName, "count", len(jobs))
+		}
+		return true
+	})
+
+	for _, op := range serviceManager.Operations.Values() {
+		if op.Copy().Status == manager.OperationRunning {
+			interruptOperation(op, errShutdown)
+		}
+	}
+
+	if err := serviceManager.SaveTracking(config.StateDir); err != nil {
+		log.Error("Failed to save tracked containers", "error", err)
+	}
+
+	serviceManager.Images.Range(func(_ string, imageManager *manager.ImageManager) bool {
+		imageManager.Mu.Lock()
+		defer imageManager.Mu.Unlock()
+		if imageManager.Container != nil && imageManager.Container.FinishedAt == nil {
+			imageManager.Container.CloseLogs()
+		}
+		return true
+	})
+
+	// closing the SSH connections ends the attaches, not the containers
+	serviceManager.Connections.Range(func(_ string, connectionManager *manager.ConnectionManager) bool {
+		if connectionManager.SshConn != nil {
+			connectionManager.SshConn.Close()
+		}
+		return true
+	})
+
+	// events already published are flushed to the broker
+	if eventBroker != nil {
+		eventBroker.Close()
+	}
+
+	log.Info("Shut down")
+}
+
+// cancelQueuedRun ends a run taken out of its queue by the shutdown: the run
+// is recorded as Cancelled, its operation fails with errShutdown and an error
+// event tells subscribers why.
+func cancelQueuedRun(job *manager.RunJob, serverName string) {
+	imageManager := job.Image
+	imageManager.Mu.Lock()
+	imageManager.AbortRun(job.Run, manager.Cancelled)
+	imageManager.Mu.Unlock()
+
+	interruptOperation(job.Operation, errShutdown)
+	serviceManager.Events.Publish(manager.Event{Type: manager.EventError, Image: imageManager.Name, Server: serverName, Message: fmt.Sprintf("queued run %s cancelled: %v", job.ID, errShutdown)})
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSignedURLTTL = 15 * time.Minute
+	maxSignedURLTTL     = 24 * time.Hour
+)
+
+// signableRoutes are the downloads a signed URL can grant. The first group is
+// the workspace the download belongs to.
+var signableRoutes = regexp.MustCompile(`^workspaces/([^/]+)/(file|build/log|runs/[^/]+/logs)$`)
+
+// urlSigningKey authenticates signed URLs. Without a configured key a random
+// one is used, so links stop working when maestro restarts.
+var urlSigningKey []byte
+
+func setupURLSigning(cfg AuthConfig, log *slog.Logger) {
+	if cfg.SigningKey != "" {
+		urlSigningKey = []byte(cfg.SigningKey)
+		return
+	}
+	urlSigningKey = []byte(rand.Text())
+	log.Warn("No URL signing key configured, signed URLs are invalidated on restart")
+}
+
+// urlSignature signs the path and the query, including its expiry and the
+// signing user, of a GET request.
+func urlSignature(path string, query url.Values) string {
+	mac := hmac.New(sha256.New, urlSigningKey)
+	fmt.Fprintf(mac, "GET\n%s\n%s", path, query.Encode())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signedURLUser checks the signature of a signed URL request and returns the
+// user who signed it, limited to the viewer role and granted the workspace of
+// the download: the signer could access it when signing, admins included. It
+// reports false if the request carries no signature.
+func signedURLUser(c *gin.Context) (User, bool, error) {
+	query := c.Request.URL.Query()
+	signature := query.Get("signature")
+	if signature == "" {
+		return User{}, false, nil
+	}
+	query.Del("signature")
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return User{}, true, fmt.Errorf("invalid expiry")
+	}
+	if time.Now().Unix() > expires {
+		return User{}, true, fmt.Errorf("signed URL expired")
+	}
+
+	path := strings.TrimPrefix(c.Request.URL.Path, apiPrefix+"/")
+	expected := urlSignature(path, query)
+	match := signableRoutes.FindStringSubmatch(path)
+	if c.Request.Method != "GET" || match == nil || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return User{}, true, fmt.Errorf("invalid signature")
+	}
+
+	return User{Name: query.Get("user"), Role: RoleViewer, Grant: match[1]}, true, nil
+}
+
+// SignURLRequest names the download handleSignURL signs.
+type SignURLRequest struct {
+	Path string `json:"path" binding:"required"`
+	TTL  string `json:"ttl"`
+}
+
+// handleSignURL returns a URL for a file or log download that works without
+// an Authorization header until it expires. The body names the download as
+// path relative to the API root, such as `workspaces/x/file?f_name=data.csv`,
+// and an optional Go duration `ttl` (default 15m, at most 24h).
+func handleSignURL(c *gin.Context) {
+	var body SignURLRequest
+	if !bindJSON(c, &body, "signed URL request") {
+		return
+	}
+
+	ttl := defaultSignedURLTTL
+	if body.TTL != "" {
+		parsed, err := time.ParseDuration(body.TTL)
+		if err != nil || parsed <= 0 || parsed > maxSignedURLTTL {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid ttl: %s, expected a duration up to %s", body.TTL, maxSignedURLTTL))
+			return
+		}
+		ttl = parsed
+	}
+
+	target, err := url.Parse(strings.TrimPrefix(body.Path, "/"))
+	if err != nil || target.IsAbs() || target.Host != "" {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid path: %s", body.Path))
+		return
+	}
+	// links to the container naming are signed as their successors
+	target.Path, _ = movedRoute(target.Path)
+	match := signableRoutes.FindStringSubmatch(target.Path)
+	if match == nil {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Only file and log downloads can be signed, not %s", target.Path))
+		return
+	}
+
+	// the link must not grant more than the signer can see now
+	imageManager, exists := serviceManager.Images.Load(match[1])
+	if !exists || !canAccess(c, imageManager) {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", match[1]))
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	query := target.Query()
+	query.Del("signature")
+	query.Set("expires", strconv.FormatInt(expiresAt.Unix(), 10))
+	query.Set("user", currentUser(c).Name)
+	query.Set("signature", urlSignature(target.Path, query))
+
+	c.JSON(200, gin.H{
+		"url":        target.Path + "?" + query.Encode(),
+		"expires_at": expiresAt,
+	})
+}
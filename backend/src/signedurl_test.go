@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"maestro/src/manager"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// signedURLEngine serves signing and the routes signed URLs are used on for
+// the workspaces of alice and bob, signed by them or by root, an admin.
+func signedURLEngine(t *testing.T) *gin.Engine {
+	t.Helper()
+	srv := newTestServer(t)
+
+	previousKey, previousAuth := urlSigningKey, config.Auth
+	urlSigningKey = []byte("test signing key")
+	config.Auth = AuthConfig{Users: []User{
+		{Name: "alice", Token: "alice-token", Role: RoleOperator},
+		{Name: "bob", Token: "bob-token", Role: RoleViewer},
+		{Name: "root", Token: "root-token", Role: RoleAdmin},
+	}}
+	serviceManager.Images.Store("alice-ws", &manager.ImageManager{Name: "alice-ws", Owner: "alice"})
+	serviceManager.Images.Store("bob-ws", &manager.ImageManager{Name: "bob-ws", Owner: "bob"})
+	t.Cleanup(func() {
+		urlSigningKey, config.Auth = previousKey, previousAuth
+		serviceManager.Images.Delete("alice-ws")
+		serviceManager.Images.Delete("bob-ws")
+	})
+
+	ok := func(c *gin.Context) { c.String(200, currentUser(c).Name) }
+	engine := gin.New()
+	api := engine.Group(apiPrefix, srv.authenticate)
+	api.POST("signed-urls", requireViewer, handleSignURL)
+	api.GET("workspaces/:name", requireViewer, requireOwner, ok)
+	api.GET("workspaces/:name/file", requireViewer, requireOwner, ok)
+	api.PUT("workspaces/:name/file", requireOperator, requireOwner, ok)
+	api.GET("workspaces/:name/build/log", requireViewer, requireOwner, ok)
+	return engine
+}
+
+// signURL signs the path as the user of the token and returns the response
+// code and the signed URL, relative to the API root.
+func signURL(t *testing.T, engine *gin.Engine, token, path string) (int, string) {
+	t.Helper()
+	body, _ := json.Marshal(SignURLRequest{Path: path})
+	rec := send(t, engine, "POST", apiPrefix+"/signed-urls", "", strings.NewReader(string(body)), bearer(token))
+	var signed struct {
+		URL string `json:"url"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &signed)
+	return rec.Code, signed.URL
+}
+
+func TestSignedURLAccess(t *testing.T) {
+	engine := signedURLEngine(t)
+
+	tests := []struct {
+		name     string
+		token    string
+		path     string
+		wantSign int
+		wantURL  string // prefix of the signed URL
+	}{
+		{"owner signs a file", "alice-token", "workspaces/alice-ws/file?f_name=data.csv", 200, "workspaces/alice-ws/file?"},
+		{"owner signs a build log", "alice-token", "/workspaces/alice-ws/build/log", 200, "workspaces/alice-ws/build/log?"},
+		{"admin signs another user's file", "root-token", "workspaces/alice-ws/file?f_name=data.csv", 200, "workspaces/alice-ws/file?"},
+		{"old route signed as its successor", "alice-token", "container/alice-ws/file?f_name=data.csv", 200, "workspaces/alice-ws/file?"},
+		{"viewer signs another user's file", "bob-token", "workspaces/alice-ws/file?f_name=data.csv", 404, ""},
+		{"unknown workspace", "root-token", "workspaces/nobody-ws/file?f_name=data.csv", 404, ""},
+		{"route that cannot be signed", "alice-token", "workspaces/alice-ws", 400, ""},
+		{"absolute URL", "alice-token", "https://example.com/api/v1/workspaces/alice-ws/file", 400, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, signed := signURL(t, engine, tt.token, tt.path)
+			if code != tt.wantSign {
+				t.Fatalf("sign %s: code = %d, want %d", tt.path, code, tt.wantSign)
+			}
+			if code != 200 {
+				return
+			}
+			if !strings.HasPrefix(signed, tt.wantURL) {
+				t.Fatalf("signed URL = %s, want prefix %s", signed, tt.wantURL)
+			}
+
+			// the link works without a token, as its signer
+			rec := send(t, engine, "GET", apiPrefix+"/"+signed, "", nil, nil)
+			if rec.Code != 200 {
+				t.Fatalf("GET signed URL: code = %d, body %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestSignedURLTampering(t *testing.T) {
+	engine := signedURLEngine(t)
+	code, signed := signURL(t, engine, "root-token", "workspaces/alice-ws/file?f_name=data.csv")
+	if code != 200 {
+		t.Fatalf("sign: code = %d", code)
+	}
+	path, rawQuery, _ := strings.Cut(signed, "?")
+	query, _ := url.ParseQuery(rawQuery)
+
+	// with returns the signed URL with a query parameter changed
+	with := func(key, value string) string {
+		changed, _ := url.ParseQuery(rawQuery)
+		changed.Set(key, value)
+		return path + "?" + changed.Encode()
+	}
+	// expired returns a correctly signed URL that expired a minute ago
+	expired := func() string {
+		old, _ := url.ParseQuery(rawQuery)
+		old.Del("signature")
+		old.Set("expires", strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10))
+		old.Set("signature", urlSignature(path, old))
+		return path + "?" + old.Encode()
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		want   int
+	}{
+		{"unchanged", "GET", signed, 200},
+		{"other workspace", "GET", strings.Replace(signed, "alice-ws", "bob-ws", 1), 401},
+		{"other route of the workspace", "GET", "workspaces/alice-ws?" + rawQuery, 401},
+		{"other file", "GET", with("f_name", "secret.txt"), 401},
+		{"other signer", "GET", with("user", "alice"), 401},
+		{"extended expiry", "GET", with("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)), 401},
+		{"invalid expiry", "GET", with("expires", "soon"), 401},
+		{"expired", "GET", expired(), 401},
+		{"forged signature", "GET", with("signature", strings.Repeat("0", len(query.Get("signature")))), 401},
+		{"write with a read link", "PUT", signed, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := send(t, engine, tt.method, apiPrefix+"/"+tt.target, "", nil, nil)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s: code = %d, want %d, body %s", tt.method, tt.target, rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+// TestSignedURLUser checks what a signed URL grants: the viewer role and the
+// one workspace it was signed for, whatever the signer's role.
+func TestSignedURLUser(t *testing.T) {
+	engine := signedURLEngine(t)
+
+	tests := []struct {
+		token string
+		want  User
+	}{
+		{"root-token", User{Name: "root", Role: RoleViewer, Grant: "alice-ws"}},
+		{"alice-token", User{Name: "alice", Role: RoleViewer, Grant: "alice-ws"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want.Name, func(t *testing.T) {
+			_, signed := signURL(t, engine, tt.token, "workspaces/alice-ws/file?f_name=data.csv")
+			c, _ := gin.CreateTestContext(nil)
+			c.Request, _ = http.NewRequest("GET", apiPrefix+"/"+signed, nil)
+
+			user, isSigned, err := signedURLUser(c)
+			if !isSigned || err != nil {
+				t.Fatalf("signedURLUser: signed %v, error %v", isSigned, err)
+			}
+			if user != tt.want {
+				t.Errorf("signedURLUser = %+v, want %+v", user, tt.want)
+			}
+		})
+	}
+}
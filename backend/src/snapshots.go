@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maestro/src/manager"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validSnapshotName rejects names that cannot be used as a manifest file name.
+func validSnapshotName(name string) bool {
+	return manager.ValidSnapshotName(name)
+}
+
+// buildOptionsFromRequest reads the optional `snapshot` and `containerfile`
+// query parameters, or `git` and its companions to build from a repository. A
+// snapshot or repository is copied into a temporary build context. The cache
+// flags `noCache`, `pullPolicy` and `forceRm`, the comma separated target
+// `platforms`, the `target` stage and `label=key=value` image labels apply to
+// either. The returned cleanup func removes the context and must always be
+// called.
+func buildOptionsFromRequest(c *gin.Context, imageManager *manager.ImageManager) (manager.BuildOptions, func(), error) {
+	pullPolicy := c.Query("pullPolicy")
+	if _, err := manager.ParsePullPolicy(pullPolicy); err != nil {
+		return manager.BuildOptions{}, func() {}, err
+	}
+	target := c.Query("target")
+	labels := map[string]string{}
+	for _, label := range c.QueryArray("label") {
+		key, value, _ := strings.Cut(label, "=")
+		labels[key] = value
+	}
+	if err := manager.ValidateStageAndLabels(target, labels); err != nil {
+		return manager.BuildOptions{}, func() {}, err
+	}
+	var platforms []string
+	if raw := c.Query("platforms"); raw != "" {
+		platforms = strings.Split(raw, ",")
+		if _, err := manager.ParsePlatforms(platforms); err != nil {
+			return manager.BuildOptions{}, func() {}, err
+		}
+	}
+
+	var buildOpts manager.BuildOptions
+	var cleanup func()
+	var err error
+	switch {
+	case c.Query("git") != "" && c.Query("snapshot") != "":
+		return manager.BuildOptions{}, func() {}, errors.New("build from either a snapshot or a git repository, not both")
+	case c.Query("git") != "":
+		buildOpts, cleanup, err = gitBuildOptions(c)
+	default:
+		buildOpts, cleanup, err = buildOptionsFor(imageManager, c.Query("snapshot"), c.Query("containerfile"))
+	}
+	if err != nil {
+		return buildOpts, cleanup, err
+	}
+
+	buildOpts.NoCache = c.Query("noCache") == "true"
+	buildOpts.PullPolicy = pullPolicy
+	buildOpts.ForceRm = c.Query("forceRm") == "true"
+	buildOpts.Platforms = platforms
+	buildOpts.Target = target
+	buildOpts.Labels = labels
+	return buildOpts, cleanup, nil
+}
+
+// tempBuildContext creates an empty directory for a build context under the
+// state directory.
+func tempBuildContext(prefix string) (string, error) {
+	tmpRoot := filepath.Join(config.StateDir, "tmp")
+	if err := os.MkdirAll(tmpRoot, 0700); err != nil {
+		return "", err
+	}
+	return os.MkdirTemp(tmpRoot, prefix)
+}
+
+// buildOptionsFor is buildOptionsFromRequest for a known snapshot name and
+// Containerfile, building the workspace when the snapshot is empty.
+func buildOptionsFor(imageManager *manager.ImageManager, snapshotName, containerfile string) (manager.BuildOptions, func(), error) {
+	noop := func() {}
+
+	if containerfile != "" {
+		if _, err := manager.WorkspacePath(containerfile); err != nil {
+			return manager.BuildOptions{}, noop, fmt.Errorf("invalid Containerfile path %s", containerfile)
+		}
+	}
+
+	if snapshotName == "" {
+		commit := manager.WorkspaceCommit(context.Background(), imageManager.GitDir, imageManager.FilesDir)
+		return manager.BuildOptions{Containerfile: containerfile, Commit: commit}, noop, nil
+	}
+
+	if !validSnapshotName(snapshotName) {
+		return manager.BuildOptions{}, noop, fmt.Errorf("invalid snapshot name: %s", snapshotName)
+	}
+	snapshot, err := snapshotStore.Get(imageManager.Name, snapshotName)
+	if err != nil {
+		return manager.BuildOptions{}, noop, fmt.Errorf("snapshot %s: %v", snapshotName, err)
+	}
+
+	contextDir, err := tempBuildContext("snapshot-")
+	if err != nil {
+		return manager.BuildOptions{}, noop, err
+	}
+	cleanup := func() { os.RemoveAll(contextDir) }
+
+	if err := snapshotStore.Materialize(snapshot, contextDir); err != nil {
+		cleanup()
+		return manager.BuildOptions{}, noop, err
+	}
+
+	return manager.BuildOptions{ContextDir: contextDir, Snapshot: snapshotName, Containerfile: containerfile}, cleanup, nil
+}
+
+// handleCreateSnapshot records the image's current project files as a named,
+// immutable snapshot. With `image=true` the image the workspace runs is kept
+// with it and comes back when the snapshot is restored.
+func handleCreateSnapshot(c *gin.Context) {
+	name := c.Param("name")
+	snapshotName := c.DefaultQuery("name", time.Now().Format("02-01-2006_15-04-05"))
+
+	if !validSnapshotName(snapshotName) {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid snapshot name: %s", snapshotName))
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	var builtImage *manager.SnapshotImage
+	if c.Query("image") == "true" {
+		var err error
+		builtImage, err = imageManager.KeepImage(snapshotName)
+		if errors.Is(err, manager.ErrNoSnapshotImage) {
+			respondError(c, CodeConflict, fmt.Sprintf("Image %s has not been built yet", name))
+			return
+		}
+		if err != nil {
+			respondError(c, CodeInternal, err.Error())
+			return
+		}
+	}
+
+	snapshot, err := snapshotStore.Create(imageManager, snapshotName, builtImage)
+	if err != nil {
+		if errors.Is(err, manager.ErrSnapshotExists) {
+			respondError(c, CodeAlreadyExists, fmt.Sprintf("Snapshot %s already exists for image %s", snapshotName, name))
+			return
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to create snapshot: %v", err))
+		return
+	}
+
+	c.JSON(201, snapshot)
+}
+
+// handleGetSnapshots lists an image's snapshots.
+func handleGetSnapshots(c *gin.Context) {
+	name := c.Param("name")
+
+	if !serviceManager.Images.Exists(name) {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	snapshots, err := snapshotStore.List(name)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list snapshots: %v", err))
+		return
+	}
+
+	c.JSON(200, snapshots)
+}
+
+// handleGetSnapshot returns a snapshot's manifest.
+func handleGetSnapshot(c *gin.Context) {
+	name := c.Param("name")
+	snapshotName := c.Param("snapshot")
+
+	snapshot, ok := loadSnapshot(c, name, snapshotName)
+	if !ok {
+		return
+	}
+
+	c.JSON(200, snapshot)
+}
+
+// handleDiffSnapshot compares a snapshot with another snapshot (`against`) or,
+// by default, with the current workspace.
+func handleDiffSnapshot(c *gin.Context) {
+	name := c.Param("name")
+	snapshotName := c.Param("snapshot")
+	against := c.Query("against")
+
+	snapshot, ok := loadSnapshot(c, name, snapshotName)
+	if !ok {
+		return
+	}
+
+	var target []manager.SnapshotFile
+	if against != "" {
+		other, ok := loadSnapshot(c, name, against)
+		if !ok {
+			return
+		}
+		target = other.Files
+	} else {
+		imageManager, _ := serviceManager.Images.Load(name)
+
+		imageManager.Mu.RLock()
+		files, err := manager.ScanWorkspace(imageManager.FilesDir, nil)
+		imageManager.Mu.RUnlock()
+		if err != nil {
+			respondError(c, CodeInternal, fmt.Sprintf("Failed to scan workspace: %v", err))
+			return
+		}
+		target = files
+	}
+
+	c.JSON(200, manager.DiffFiles(snapshot.Files, target))
+}
+
+// handleRestoreSnapshot replaces the image's project files with a snapshot and,
+// if the snapshot kept one, makes its image the one the workspace runs.
+func (s *server) handleRestoreSnapshot(c *gin.Context) {
+	name := c.Param("name")
+	snapshotName := c.Param("snapshot")
+
+	snapshot, ok := loadSnapshot(c, name, snapshotName)
+	if !ok {
+		return
+	}
+
+	imageManager, _ := serviceManager.Images.Load(name)
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	// a restore rewrites every project file, protected ones included
+	if len(imageManager.ProtectedFiles) > 0 && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("Image %s has protected files; only an admin can restore snapshots", name))
+		return
+	}
+
+	op := s.newOperation(manager.OperationSnapshotRestore, name, snapshotName, currentUser(c).Name)
+
+	err := snapshotStore.Restore(imageManager, snapshot)
+	if err == nil && snapshot.BuiltImage != nil {
+		connectionManager, exists := serviceManager.Connections.Load(snapshot.BuiltImage.Server)
+		if !exists {
+			err = fmt.Errorf("server %s of the snapshot's image is gone", snapshot.BuiltImage.Server)
+		} else if imageManager.Container != nil && imageManager.Container.FinishedAt == nil {
+			err = errors.New("files restored, but the image cannot change while a container runs")
+		} else {
+			err = imageManager.UseSnapshotImage(connectionManager, snapshot.BuiltImage)
+		}
+	}
+	op.Finish(err)
+	if err != nil {
+		respondErrorDetails(c, CodeInternal, fmt.Sprintf("Failed to restore snapshot: %v", err), gin.H{"operation": op.ID})
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Snapshot %s restored for image %s", snapshotName, name), "operation": op.ID})
+}
+
+// loadSnapshot resolves a snapshot of an existing image, writing the error
+// response and returning false when it cannot.
+func loadSnapshot(c *gin.Context, name, snapshotName string) (*manager.Snapshot, bool) {
+	if !serviceManager.Images.Exists(name) {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return nil, false
+	}
+
+	if !validSnapshotName(snapshotName) {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid snapshot name: %s", snapshotName))
+		return nil, false
+	}
+
+	snapshot, err := snapshotStore.Get(name, snapshotName)
+	if err != nil {
+		if errors.Is(err, manager.ErrSnapshotNotFound) {
+			respondError(c, CodeNotFound, fmt.Sprintf("Snapshot %s not found for image %s", snapshotName, name))
+			return nil, false
+		}
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to load snapshot: %v", err))
+		return nil, false
+	}
+
+	return snapshot, true
+}
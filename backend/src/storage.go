@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maestro/src/manager"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetStorage reports the space used by an image's source files, run
+// logs and artifacts.
+func handleGetStorage(c *gin.Context) {
+	name := c.Param("name")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.RLock()
+	defer imageManager.Mu.RUnlock()
+
+	report, err := imageManager.Storage()
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to compute storage for image %s: %v", name, err))
+		return
+	}
+
+	c.JSON(200, report)
+}
+
+// handleCleanStorage deletes the files of one storage category. The optional
+// olderThan query (a Go duration such as 72h) limits the cleanup to files not
+// modified within that time.
+func (s *server) handleCleanStorage(c *gin.Context) {
+	name := c.Param("name")
+	category := manager.StorageCategory(c.Param("category"))
+	if !slices.Contains(manager.StorageCategories, category) {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Unknown storage category %s, expected files, logs or artifacts", category))
+		return
+	}
+
+	var olderThan time.Duration
+	if raw := c.Query("olderThan"); raw != "" {
+		var err error
+		olderThan, err = time.ParseDuration(raw)
+		if err != nil || olderThan < 0 {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid olderThan duration: %s", raw))
+			return
+		}
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", name))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	op := s.newOperation(manager.OperationStorageCleanup, name, string(category), currentUser(c).Name)
+
+	result, err := imageManager.CleanStorage(category, time.Now().Add(-olderThan))
+	if result != nil {
+		op.Logf("removed %d files (%d bytes), skipped %d", len(result.Removed), result.RemovedBytes, len(result.Skipped))
+	}
+	op.Finish(err)
+	if err != nil {
+		respondErrorDetails(c, CodeInternal, fmt.Sprintf("Failed to clean %s of image %s: %v", category, name, err), gin.H{"operation": op.ID})
+		return
+	}
+
+	c.JSON(200, result)
+}
+
+// checkQuota admits adding bytes to the image's workspace, besides those of
+// its uploads in progress but the one named by completing. It responds with
+// 507 and returns false when they do not fit in the quota.
+func checkQuota(c *gin.Context, imageManager *manager.ImageManager, adding int64, completing string) bool {
+	staged, err := stagedUploads(imageManager.Name, completing)
+	if err == nil {
+		err = imageManager.CheckQuota(adding, staged)
+	}
+	if errors.Is(err, manager.ErrQuotaExceeded) {
+		respondError(c, CodeQuotaExceeded, err.Error())
+		return false
+	}
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to check quota of image %s: %v", imageManager.Name, err))
+		return false
+	}
+	return true
+}
+
+// quotaHeadroom measures how many bytes the image's workspace can still take,
+// besides those of its uploads in progress.
+func quotaHeadroom(imageManager *manager.ImageManager) (int64, error) {
+	used, err := imageManager.MeasureUsage()
+	if err != nil || imageManager.Disk.QuotaBytes <= 0 {
+		return math.MaxInt64, err
+	}
+	staged, err := stagedUploads(imageManager.Name, "")
+	if err != nil {
+		return 0, err
+	}
+	return max(imageManager.Disk.QuotaBytes-used-staged, 0), nil
+}
+
+// stagedUploads sums the announced sizes of the image's uploads in progress
+// but the one named by except. Their bytes are kept outside the workspace, but
+// were admitted against its quota when the uploads started.
+func stagedUploads(image, except string) (int64, error) {
+	uploads, err := uploadStore.List(image)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list uploads: %v", err)
+	}
+	var staged int64
+	for _, upload := range uploads {
+		if upload.ID != except {
+			staged += upload.Size
+		}
+	}
+	return staged, nil
+}
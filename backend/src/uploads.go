@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"maestro/src/manager"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadRequest describes the file handleCreateUpload receives.
+type UploadRequest struct {
+	Path   string `json:"path" binding:"required"`
+	Size   int64  `json:"size" binding:"gte=0"`
+	SHA256 string `json:"sha256" binding:"omitempty,len=64,hexadecimal"`
+}
+
+// handleCreateUpload starts a resumable upload of a large file. The body
+// names the workspace `path`, the total `size` in bytes and optionally the
+// `sha256` the file is verified against on completion.
+func handleCreateUpload(c *gin.Context) {
+	name := c.Param("name")
+
+	var body UploadRequest
+	if !bindJSON(c, &body, "upload request") {
+		return
+	}
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	filePath, ok := workspaceFile(c, body.Path)
+	if !ok {
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	if imageManager.IsProtected(filepath.ToSlash(filePath)) && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("File %s is protected and can only be changed by an admin", body.Path))
+		return
+	}
+	uploads, err := uploadStore.List(name)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list uploads of image %s: %v", name, err))
+		return
+	}
+	if len(uploads) >= maxOpenUploads {
+		respondError(c, CodeRateLimited, fmt.Sprintf("Image %s already has %d uploads in progress, complete or abort one first", name, len(uploads)))
+		return
+	}
+	// rejected before any byte is sent, and checked again on completion
+	headroom, err := quotaHeadroom(imageManager)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to check quota of image %s: %v", name, err))
+		return
+	}
+	if body.Size > headroom {
+		respondError(c, CodeQuotaExceeded, fmt.Sprintf("%v: %d bytes left, %d requested", manager.ErrQuotaExceeded, headroom, body.Size))
+		return
+	}
+
+	upload, err := uploadStore.Create(name, filepath.ToSlash(filePath), body.Size, body.SHA256)
+	if err != nil {
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Failed to start upload: %v", err))
+		return
+	}
+
+	c.JSON(201, upload)
+}
+
+// handleGetUpload reports how much of an upload was received, the offset an
+// interrupted client resumes from.
+func handleGetUpload(c *gin.Context) {
+	name := c.Param("name")
+	id := c.Param("id")
+
+	upload, err := uploadStore.Get(name, id)
+	if err != nil {
+		respondError(c, errorCode(err, CodeInternal), fmt.Sprintf("Upload %s: %v", id, err))
+		return
+	}
+
+	c.JSON(200, upload)
+}
+
+// handleAppendUpload appends the request body to an upload. The
+// `Upload-Offset` header must match the bytes received so far; on a mismatch
+// the response carries the offset to resume from.
+func handleAppendUpload(c *gin.Context) {
+	name := c.Param("name")
+	id := c.Param("id")
+
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil {
+		respondError(c, CodeInvalidRequest, "Upload-Offset header is required")
+		return
+	}
+
+	upload, err := uploadStore.Append(name, id, offset, c.Request.Body)
+	if upload != nil {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	}
+	if err != nil {
+		var details gin.H
+		if upload != nil {
+			details = gin.H{"offset": upload.Offset}
+		}
+		respondErrorDetails(c, errorCode(err, CodeInternal), fmt.Sprintf("Upload %s: %v", id, err), details)
+		return
+	}
+
+	c.JSON(200, upload)
+}
+
+// handleCompleteUpload verifies a fully received upload and moves it into the
+// workspace.
+func handleCompleteUpload(c *gin.Context) {
+	name := c.Param("name")
+	id := c.Param("id")
+
+	imageManager, exists := serviceManager.Images.Load(name)
+	if !exists {
+		respondError(c, CodeNotFound, fmt.Sprintf("Container %s not found", name))
+		return
+	}
+
+	upload, err := uploadStore.Get(name, id)
+	if err != nil {
+		respondError(c, errorCode(err, CodeInternal), fmt.Sprintf("Upload %s: %v", id, err))
+		return
+	}
+
+	imageManager.Mu.Lock()
+	defer imageManager.Mu.Unlock()
+
+	// the file may have been protected while the upload was running
+	if imageManager.IsProtected(upload.Path) && !isAdmin(c) {
+		respondError(c, CodeProtected, fmt.Sprintf("File %s is protected and can only be changed by an admin", upload.Path))
+		return
+	}
+
+	if !checkQuota(c, imageManager, upload.Size, upload.ID) {
+		return
+	}
+
+	root := openWorkspace(c, imageManager)
+	if root == nil {
+		return
+	}
+	defer root.Close()
+
+	upload, err = uploadStore.Complete(name, id, root)
+	if err != nil {
+		respondError(c, errorCode(err, CodeInternal), fmt.Sprintf("Upload %s: %v", id, err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("File %s uploaded for image %s", upload.Path, name)})
+}
+
+// handleAbortUpload discards an upload.
+func handleAbortUpload(c *gin.Context) {
+	name := c.Param("name")
+	id := c.Param("id")
+
+	if err := uploadStore.Abort(name, id); err != nil {
+		respondError(c, errorCode(err, CodeInternal), fmt.Sprintf("Upload %s: %v", id, err))
+		return
+	}
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Upload %s aborted", id)})
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// maxWorkspaceNameLength bounds workspace names, which become directory,
+// image and container names.
+const maxWorkspaceNameLength = 128
+
+// namePattern matches the names workspaces and servers may be created with: a
+// letter or digit followed by letters, digits, dots, dashes and underscores.
+// Other characters break paths, image references or placement constraints.
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// validWorkspaceName reports whether a workspace may be created with the
+// name.
+func validWorkspaceName(name string) bool {
+	return len(name) <= maxWorkspaceNameLength && namePattern.MatchString(name)
+}
+
+// fieldMessages explain what the validation tags of request DTOs require.
+// Tags with a parameter get it appended, length tags are worded by
+// fieldMessage.
+var fieldMessages = map[string]string{
+	"required":       "is required",
+	"workspace_name": fmt.Sprintf("must start with a letter or digit, contain only letters, digits, '.', '-' and '_' and be at most %d characters", maxWorkspaceNameLength),
+	"server_name":    "must start with a letter or digit and contain only letters, digits, '.', '-' and '_'",
+	"http_url":       "must be an http or https URL",
+	"oneof":          "must be one of",
+	"min":            "at least",
+	"max":            "at most",
+	"gte":            "must be at least",
+	"lte":            "must be at most",
+	"hexadecimal":    "must be hexadecimal",
+	"len":            "exactly",
+}
+
+// registerValidators adds the validation tags of request DTOs to gin's
+// validator and makes it name fields by their JSON names.
+func registerValidators() {
+	engine, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+	engine.RegisterValidation("workspace_name", func(field validator.FieldLevel) bool {
+		return validWorkspaceName(field.Field().String())
+	})
+	engine.RegisterValidation("server_name", func(field validator.FieldLevel) bool {
+		return namePattern.MatchString(field.Field().String())
+	})
+}
+
+// bindJSON decodes the JSON body into a request DTO and validates it against
+// its binding tags. Malformed JSON is answered with invalid_request, values
+// the DTO rejects with validation_failed and the error of every field, keyed
+// by its JSON path, in the details.
+func bindJSON(c *gin.Context, dto any, what string) bool {
+	err := c.ShouldBindJSON(dto)
+	if err == nil {
+		return true
+	}
+
+	fields := map[string]string{}
+	var invalid validator.ValidationErrors
+	var mistyped *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &invalid):
+		for _, fieldErr := range invalid {
+			fields[fieldPath(fieldErr.Namespace())] = fieldMessage(fieldErr)
+		}
+	case errors.As(err, &mistyped) && mistyped.Field != "":
+		fields[mistyped.Field] = fmt.Sprintf("must be %s, not %s", jsonKind(mistyped.Type), mistyped.Value)
+	default:
+		respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid %s: %v", what, err))
+		return false
+	}
+	respondFieldErrors(c, what, fields)
+	return false
+}
+
+// respondFieldErrors responds with validation_failed and the error of each
+// field.
+func respondFieldErrors(c *gin.Context, what string, fields map[string]string) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	problems := make([]string, len(names))
+	for i, name := range names {
+		problems[i] = name + " " + fields[name]
+	}
+	respondErrorDetails(c, CodeValidationFailed, fmt.Sprintf("Invalid %s: %s", what, strings.Join(problems, "; ")), gin.H{"fields": fields})
+}
+
+// respondFieldError responds like respondFieldErrors for a single field.
+func respondFieldError(c *gin.Context, what, field, message string) {
+	respondFieldErrors(c, what, map[string]string{field: message})
+}
+
+// fieldPath turns a validator namespace such as body.capacity.cpus into the
+// JSON path of the field, capacity.cpus.
+func fieldPath(namespace string) string {
+	_, path, found := strings.Cut(namespace, ".")
+	if !found {
+		return namespace
+	}
+	return path
+}
+
+// fieldMessage explains a failed validation tag.
+func fieldMessage(fieldErr validator.FieldError) string {
+	message, known := fieldMessages[fieldErr.Tag()]
+	if !known {
+		return "is invalid"
+	}
+	param := fieldErr.Param()
+	if param == "" {
+		return message
+	}
+	switch fieldErr.Tag() {
+	case "oneof":
+		return message + " " + strings.Join(strings.Fields(param), ", ")
+	case "min", "max", "len":
+		// the length of a string or the items of a list or map
+		switch fieldErr.Kind() {
+		case reflect.String:
+			return fmt.Sprintf("must be %s %s characters", message, param)
+		case reflect.Slice, reflect.Array, reflect.Map:
+			return fmt.Sprintf("must have %s %s items", message, param)
+		}
+		return fmt.Sprintf("must be %s %s", message, param)
+	}
+	return message + " " + param
+}
+
+// jsonKind names the JSON type a Go type is decoded from.
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
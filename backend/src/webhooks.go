@@ -0,0 +1,511 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maestro/src/database/schema"
+	"maestro/src/manager"
+	"maestro/src/outbound"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/http/httpguts"
+)
+
+const (
+	webhookEventHeader     = "X-Maestro-Event"
+	webhookDeliveryHeader  = "X-Maestro-Delivery"
+	webhookTimestampHeader = "X-Maestro-Timestamp"
+	webhookSignatureHeader = "X-Maestro-Signature"
+)
+
+const (
+	// webhookTimeout bounds one delivery attempt.
+	webhookTimeout = 10 * time.Second
+
+	// webhookAttempts is how many times a delivery is tried before it is given
+	// up, waiting webhookBackoff before the first retry and twice as long
+	// before each further one.
+	webhookAttempts = 5
+	webhookBackoff  = 5 * time.Second
+
+	// webhookHistory is how long delivery attempts are kept.
+	webhookHistory = 7 * 24 * time.Hour
+
+	// maxWebhookDeliveries bounds the attempts returned by one query.
+	maxWebhookDeliveries = 1000
+)
+
+// reservedWebhookHeaders are set by maestro or the HTTP client on every
+// delivery, so webhooks cannot override them. The X-Maestro- prefix is
+// reserved too.
+var reservedWebhookHeaders = []string{"Connection", "Content-Length", "Content-Type", "Host", "Transfer-Encoding"}
+
+// WebhookResponse is a registered webhook. The secret is only returned when
+// the webhook is created.
+type WebhookResponse struct {
+	ID        string    `json:"id"`
+	Workspace string    `json:"workspace,omitempty"` // empty for webhooks of every workspace
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`  // every event if empty
+	Headers   []string  `json:"headers"` // names of the custom headers, whose values are not returned
+	Secret    string    `json:"secret,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func webhookResponse(hook schema.Webhook) WebhookResponse {
+	return WebhookResponse{
+		ID:        hook.ID,
+		Workspace: hook.Image,
+		URL:       hook.Url,
+		Events:    webhookEventList(hook.Events),
+		Headers:   webhookHeaderNames(hook),
+		CreatedBy: hook.CreatedBy,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+// webhookEventList splits the stored comma separated events.
+func webhookEventList(events string) []string {
+	if events == "" {
+		return []string{}
+	}
+	return strings.Split(events, ",")
+}
+
+// webhookHeadersSecret names the secret the custom headers of a webhook are
+// kept in. They often carry credentials of the receiver, so the webhook only
+// records their names.
+func webhookHeadersSecret(id string) string {
+	return "webhook." + id + ".headers"
+}
+
+// webhookHeaderNames decodes the names of a webhook's custom headers.
+func webhookHeaderNames(hook schema.Webhook) []string {
+	names := []string{}
+	if hook.Headers != "" {
+		if err := json.Unmarshal([]byte(hook.Headers), &names); err != nil {
+			loggers.For("webhooks").Error("Invalid webhook headers", "webhook", hook.ID, "error", err)
+		}
+	}
+	return names
+}
+
+// webhookHeaders reveals the custom headers of a webhook.
+func webhookHeaders(hook schema.Webhook) (map[string]string, error) {
+	headers := map[string]string{}
+	if hook.Headers == "" {
+		return headers, nil
+	}
+	raw, err := secretStore.Reveal(webhookHeadersSecret(hook.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to reveal headers: %v", err)
+	}
+	if err := json.Unmarshal(raw, &headers); err != nil {
+		return nil, fmt.Errorf("invalid headers: %v", err)
+	}
+	return headers, nil
+}
+
+// webhookHeaderProblem explains why a custom header cannot be sent, empty if
+// it can.
+func webhookHeaderProblem(name, value string) string {
+	switch {
+	case !httpguts.ValidHeaderFieldName(name):
+		return "is not a valid header name"
+	case strings.HasPrefix(http.CanonicalHeaderKey(name), "X-Maestro-") || slices.Contains(reservedWebhookHeaders, http.CanonicalHeaderKey(name)):
+		return "is set by maestro"
+	case !httpguts.ValidHeaderFieldValue(value):
+		return "must not contain control characters"
+	}
+	return ""
+}
+
+// WebhookPayload is the JSON body posted to webhooks.
+type WebhookPayload struct {
+	Delivery  string    `json:"delivery"`
+	Event     string    `json:"event"`
+	Workspace string    `json:"workspace"`
+	Server    string    `json:"server,omitempty"`
+	Run       string    `json:"run,omitempty"`
+	ExitCode  *int      `json:"exit_code,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Position  int       `json:"position,omitempty"`
+	Suggested []string  `json:"suggested,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// webhookEvent returns the webhook event a bus event is, if any. A run that
+// failed before its container started has an error event without one; a run
+// waiting in a queue longer than the configured threshold is delayed.
+func webhookEvent(event manager.Event) (string, bool) {
+	switch event.Type {
+	case manager.EventQueued:
+		return "queued", true
+	case manager.EventStarted:
+		return "started", true
+	case manager.EventExited:
+		if event.ExitCode != nil && *event.ExitCode == 0 {
+			return "finished", true
+		}
+		return "failed", true
+	case manager.EventError:
+		return "failed", event.Container == ""
+	case manager.EventDelayed:
+		return "delayed", true
+	}
+	return "", false
+}
+
+// canAccessWebhook reports whether the request may see a webhook. Global
+// webhooks receive the events of every workspace, so only admins see them,
+// and so do those of workspaces that no longer exist.
+func canAccessWebhook(c *gin.Context, hook schema.Webhook) bool {
+	if hook.Image == "" {
+		return isAdmin(c)
+	}
+	imageManager, exists := serviceManager.Images.Load(hook.Image)
+	if !exists {
+		return isAdmin(c)
+	}
+	return canAccess(c, imageManager)
+}
+
+// loadWebhook returns the webhook of the request's id, responding with an
+// error if it cannot be seen.
+func (s *server) loadWebhook(c *gin.Context) (schema.Webhook, bool) {
+	id := c.Param("id")
+	hook, err := s.db.Query.GetWebhook(c, id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !canAccessWebhook(c, hook)) {
+		respondError(c, CodeNotFound, fmt.Sprintf("Webhook %s not found", id))
+		return hook, false
+	}
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to look up webhook %s: %v", id, err))
+		return hook, false
+	}
+	return hook, true
+}
+
+// handleGetWebhooks lists the webhooks of the workspaces the user can access,
+// and the global ones to admins.
+func (s *server) handleGetWebhooks(c *gin.Context) {
+	hooks, err := s.db.Query.ListWebhooks(c)
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list webhooks: %v", err))
+		return
+	}
+
+	result := []WebhookResponse{}
+	for _, hook := range hooks {
+		if canAccessWebhook(c, hook) {
+			result = append(result, webhookResponse(hook))
+		}
+	}
+	c.JSON(200, result)
+}
+
+// WebhookRequest describes the webhook handleCreateWebhook registers.
+type WebhookRequest struct {
+	URL       string            `json:"url" binding:"required,http_url"`
+	Workspace string            `json:"workspace"` // empty for every workspace
+	Events    []string          `json:"events" binding:"dive,oneof=queued started finished failed delayed"`
+	Headers   map[string]string `json:"headers" binding:"max=20"` // sent with every delivery, such as credentials of the receiver
+}
+
+// handleCreateWebhook registers a webhook for a workspace's runs, or for the
+// runs of every workspace when none is given, which only admins may. The
+// response carries the secret the payloads are signed with.
+func (s *server) handleCreateWebhook(c *gin.Context) {
+	var body WebhookRequest
+	if !bindJSON(c, &body, "webhook") {
+		return
+	}
+	problems := map[string]string{}
+	canonical := map[string]string{}
+	for name, value := range body.Headers {
+		if problem := webhookHeaderProblem(name, value); problem != "" {
+			problems["headers."+name] = problem
+		}
+		canonical[http.CanonicalHeaderKey(name)] = value
+	}
+	if len(problems) > 0 {
+		respondFieldErrors(c, "webhook", problems)
+		return
+	}
+
+	if body.Workspace == "" {
+		if !isAdmin(c) {
+			respondError(c, CodeForbidden, "Only admins may register webhooks for every workspace")
+			return
+		}
+	} else {
+		imageManager, exists := serviceManager.Images.Load(body.Workspace)
+		if !exists || !canAccess(c, imageManager) {
+			respondError(c, CodeNotFound, fmt.Sprintf("Image %s not found", body.Workspace))
+			return
+		}
+	}
+
+	hook := schema.Webhook{
+		ID:        manager.NewRunID(),
+		Image:     body.Workspace,
+		Url:       body.URL,
+		Secret:    rand.Text(),
+		Events:    strings.Join(body.Events, ","),
+		CreatedBy: currentUser(c).Name,
+		CreatedAt: time.Now().UTC(),
+	}
+	if len(canonical) > 0 {
+		names, _ := json.Marshal(slices.Sorted(maps.Keys(canonical)))
+		values, _ := json.Marshal(canonical)
+		if _, err := secretStore.Set(webhookHeadersSecret(hook.ID), values); err != nil {
+			respondError(c, errorCode(err, CodeInternal), fmt.Sprintf("Failed to store webhook headers: %v", err))
+			return
+		}
+		hook.Headers = string(names)
+	}
+	if err := s.db.Query.CreateWebhook(c, schema.CreateWebhookParams(hook)); err != nil {
+		deleteWebhookHeaders(hook)
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to save webhook: %v", err))
+		return
+	}
+
+	requestLog(c).Info("Registered webhook", "webhook", hook.ID, "image", hook.Image, "url", hook.Url)
+	response := webhookResponse(hook)
+	response.Secret = hook.Secret
+	c.JSON(201, response)
+}
+
+// handleDeleteWebhook removes a webhook with its delivery history.
+func (s *server) handleDeleteWebhook(c *gin.Context) {
+	hook, ok := s.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := s.db.Query.DeleteWebhook(c, hook.ID); err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to delete webhook %s: %v", hook.ID, err))
+		return
+	}
+	if err := s.db.Query.DeleteWebhookDeliveries(c, hook.ID); err != nil {
+		requestLog(c).Error("Failed to delete webhook deliveries", "webhook", hook.ID, "error", err)
+	}
+	deleteWebhookHeaders(hook)
+
+	c.JSON(200, gin.H{"message": fmt.Sprintf("Webhook %s deleted", hook.ID)})
+}
+
+// deleteImageWebhooks removes the webhooks of a deleted workspace with their
+// delivery history.
+func (s *server) deleteImageWebhooks(ctx context.Context, image string) error {
+	hooks, err := s.db.Query.ListImageWebhooks(ctx, image)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Query.DeleteImageWebhookDeliveries(ctx, image); err != nil {
+		return err
+	}
+	if err := s.db.Query.DeleteImageWebhooks(ctx, image); err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		// the webhooks of every workspace are listed too, and kept
+		if hook.Image == image {
+			deleteWebhookHeaders(hook)
+		}
+	}
+	return nil
+}
+
+// deleteWebhookHeaders removes the secret holding the custom headers of a
+// webhook, if it has any.
+func deleteWebhookHeaders(hook schema.Webhook) {
+	if hook.Headers == "" {
+		return
+	}
+	err := secretStore.Delete(webhookHeadersSecret(hook.ID))
+	if err != nil && !errors.Is(err, manager.ErrSecretNotFound) {
+		loggers.For("webhooks").Error("Failed to delete webhook headers", "webhook", hook.ID, "error", err)
+	}
+}
+
+// handleGetWebhookDeliveries lists the delivery attempts of a webhook, most
+// recent first; `limit` defaults to 100.
+func (s *server) handleGetWebhookDeliveries(c *gin.Context) {
+	hook, ok := s.loadWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit := 100
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxWebhookDeliveries {
+			respondError(c, CodeInvalidRequest, fmt.Sprintf("Invalid limit: %s, expected 1 to %d", raw, maxWebhookDeliveries))
+			return
+		}
+		limit = parsed
+	}
+
+	deliveries, err := s.db.Query.ListWebhookDeliveries(c, schema.ListWebhookDeliveriesParams{
+		WebhookID: hook.ID,
+		Limit:     int64(limit),
+	})
+	if err != nil {
+		respondError(c, CodeInternal, fmt.Sprintf("Failed to list deliveries of webhook %s: %v", hook.ID, err))
+		return
+	}
+
+	c.JSON(200, deliveries)
+}
+
+// watchWebhooks posts the run lifecycle events on the bus to the webhooks
+// registered for them. Events wait for it in a queue rather than being
+// dropped while deliveries are slow.
+func (s *server) watchWebhooks(bus *manager.EventBus) {
+	for event := range bus.SubscribeQueued() {
+		name, ok := webhookEvent(event)
+		if !ok {
+			continue
+		}
+
+		hooks, err := s.db.Query.ListImageWebhooks(context.Background(), event.Image)
+		if err != nil {
+			loggers.For("webhooks").Error("Failed to look up webhooks", "image", event.Image, "error", err)
+			continue
+		}
+
+		payload := WebhookPayload{
+			Event:     name,
+			Workspace: event.Image,
+			Server:    event.Server,
+			Run:       event.Container,
+			ExitCode:  event.ExitCode,
+			Message:   event.Message,
+			Position:  event.Position,
+			Suggested: event.Suggested,
+			Time:      event.Time,
+		}
+		for _, hook := range hooks {
+			if hook.Events != "" && !slices.Contains(webhookEventList(hook.Events), name) {
+				continue
+			}
+			payload.Delivery = manager.NewRunID()
+			body, err := json.Marshal(payload)
+			if err != nil {
+				loggers.For("webhooks").Error("Failed to encode webhook payload", "webhook", hook.ID, "error", err)
+				continue
+			}
+			go s.deliverWebhook(hook, name, payload.Delivery, body)
+		}
+	}
+}
+
+// deliverWebhook posts a payload to a webhook until it accepts it or
+// webhookAttempts were made, recording every attempt.
+func (s *server) deliverWebhook(hook schema.Webhook, event, delivery string, body []byte) {
+	client := outbound.Client(webhookTimeout)
+	backoff := webhookBackoff
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+		status, err := sendWebhook(client, hook, event, delivery, body)
+
+		record := schema.InsertWebhookDeliveryParams{
+			WebhookID:  hook.ID,
+			DeliveryID: delivery,
+			Event:      event,
+			Attempt:    int64(attempt),
+			StatusCode: int64(status),
+			DurationMs: time.Since(start).Milliseconds(),
+			CreatedAt:  start.UTC(),
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		if err := s.db.Query.InsertWebhookDelivery(context.Background(), record); err != nil {
+			loggers.For("webhooks").Error("Failed to record webhook delivery", "webhook", hook.ID, "delivery", delivery, "error", err)
+		}
+
+		if err == nil {
+			return
+		}
+		if attempt == webhookAttempts {
+			loggers.For("webhooks").Warn("Gave up webhook delivery", "webhook", hook.ID, "delivery", delivery, "event", event, "error", err)
+			return
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// sendWebhook makes one delivery attempt and returns the response status, an
+// error unless it is a success.
+func sendWebhook(client *http.Client, hook schema.Webhook, event, delivery string, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	headers, err := webhookHeaders(hook)
+	if err != nil {
+		return 0, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "maestro-webhook")
+	req.Header.Set(webhookEventHeader, event)
+	req.Header.Set(webhookDeliveryHeader, delivery)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(hook.Secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of the timestamp and body, joined
+// by a dot, keyed with the webhook's secret. Receivers recompute it to verify
+// a payload and reject old timestamps to stop replays.
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pruneWebhookDeliveries deletes the delivery attempts older than
+// webhookHistory.
+func (s *server) pruneWebhookDeliveries() {
+	pruned, err := s.db.Query.DeleteOldWebhookDeliveries(context.Background(), time.Now().UTC().Add(-webhookHistory))
+	if err != nil {
+		loggers.For("webhooks").Error("Failed to prune webhook deliveries", "error", err)
+	}
+	if pruned > 0 {
+		loggers.For("webhooks").Info("Pruned webhook deliveries", "count", pruned)
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maestro/src/manager"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{"payload", "whsec", "1700000000", `{"event":"exited"}`, "e56035b62688520742838dcae40e8bce47adaf0217a881b9c35d90807e4fcd35"},
+		{"empty", "", "1700000000", "", "c1da1b6c6b8e9da7f4bbb90f7cab0820f271ad19ccbf80c88479c4e14f37d1c6"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signWebhook(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Errorf("signWebhook = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSignWebhookCoversTimestamp checks that neither the secret, the
+// timestamp nor the body can be changed without the signature changing.
+func TestSignWebhookCoversTimestamp(t *testing.T) {
+	signed := signWebhook("whsec", "1700000000", []byte(`{"event":"exited"}`))
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+	}{
+		{"other secret", "other", "1700000000", `{"event":"exited"}`},
+		{"replayed later", "whsec", "1700000300", `{"event":"exited"}`},
+		{"other body", "whsec", "1700000000", `{"event":"failed"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if signWebhook(tt.secret, tt.timestamp, []byte(tt.body)) == signed {
+				t.Errorf("signature unchanged")
+			}
+		})
+	}
+}
+
+func TestValidGitHubSignature(t *testing.T) {
+	body := []byte(`{"ref":"refs/heads/main"}`)
+	valid := "sha256=145c1affb5be2d0608d62da0cb5b74e246bb612db5621c79b8c07cee99f38433"
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		want   bool
+	}{
+		{"valid", "gitsecret", valid, true},
+		{"other secret", "other", valid, false},
+		{"empty secret", "", valid, false},
+		{"missing", "gitsecret", "", false},
+		{"no prefix", "gitsecret", valid[len("sha256="):], false},
+		{"sha1", "gitsecret", "sha1=" + valid[len("sha256="):], false},
+		{"not hex", "gitsecret", "sha256=zz", false},
+		{"truncated", "gitsecret", valid[:len(valid)-2], false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validGitHubSignature([]byte(tt.secret), tt.header, body); got != tt.want {
+				t.Errorf("validGitHubSignature = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestGitHookVerification checks that a repository webhook is rejected unless
+// signed with the trigger secret of a workspace following the repository, and
+// that rejections are limited per IP like invalid credentials.
+func TestGitHookVerification(t *testing.T) {
+	srv := newTestServer(t)
+	store, err := manager.OpenSecretStore(t.TempDir(), manager.SecretsConfig{Keys: []manager.SecretKey{
+		{ID: "test", Key: base64.StdEncoding.EncodeToString(make([]byte, 32))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Set("hook-secret", []byte("gitsecret")); err != nil {
+		t.Fatal(err)
+	}
+	previousStore, previousFailures := secretStore, authFailures
+	secretStore = store
+	authFailures = newClientLimiters(RateLimit{PerSecond: 0.01, Burst: 2})
+	serviceManager.Images.Store("app", &manager.ImageManager{Name: "app"})
+	t.Cleanup(func() {
+		secretStore, authFailures = previousStore, previousFailures
+		serviceManager.Images.Delete("app")
+	})
+	repo := &manager.WorkspaceRepo{URL: "git@github.com:acme/app.git", Ref: "main", Trigger: []string{"push"}, TriggerSecret: "hook-secret"}
+	if err := srv.indexWorkspaceTrigger(context.Background(), "app", repo); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := gin.New()
+	engine.SetTrustedProxies(nil)
+	engine.POST("/hooks/git", srv.handleGitHook)
+
+	push := func(repository string) string {
+		return fmt.Sprintf(`{"ref":"refs/heads/main","after":"abc","repository":{"clone_url":%q,"default_branch":"main"}}`, repository)
+	}
+	signed := func(event, secret, body string) http.Header {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return http.Header{"X-Github-Event": {event}, "X-Hub-Signature-256": {"sha256=" + hex.EncodeToString(mac.Sum(nil))}}
+	}
+	followed, other := push("https://github.com/acme/app.git"), push("https://github.com/acme/other.git")
+
+	requests := []struct {
+		remoteAddr string
+		body       string
+		header     http.Header
+		want       int
+	}{
+		{"192.0.2.1:1000", followed, signed("ping", "gitsecret", followed), 200}, // ignored events are not verified
+		{"192.0.2.1:1000", followed, signed("push", "guess", followed), 401},
+		{"192.0.2.1:1000", other, signed("push", "gitsecret", other), 401},
+		{"192.0.2.1:1000", followed, signed("push", "gitsecret", followed), 429},
+		{"192.0.2.2:1000", followed, http.Header{"X-Github-Event": {"push"}}, 401},
+	}
+	for i, req := range requests {
+		rec := send(t, engine, "POST", "/hooks/git", req.remoteAddr, strings.NewReader(req.body), req.header)
+		if rec.Code != req.want {
+			t.Fatalf("request %d: code = %d, want %d, body %s", i, rec.Code, req.want, rec.Body)
+		}
+	}
+}
+
+func TestWebhookHeadersEncrypted(t *testing.T) {
+	srv := newTestServer(t)
+	store, err := manager.OpenSecretStore(t.TempDir(), manager.SecretsConfig{Keys: []manager.SecretKey{
+		{ID: "test", Key: base64.StdEncoding.EncodeToString(make([]byte, 32))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	previousStore := secretStore
+	secretStore = store
+	t.Cleanup(func() { secretStore = previousStore })
+
+	engine := gin.New()
+	engine.Use(asUser(User{Name: "root", Role: RoleAdmin}))
+	engine.POST("/webhooks", srv.handleCreateWebhook)
+	engine.DELETE("/webhooks/:id", srv.handleDeleteWebhook)
+
+	body := `{"url":"https://example.com/hook","headers":{"authorization":"Bearer receiver-token"}}`
+	rec := send(t, engine, "POST", "/webhooks", "", strings.NewReader(body), nil)
+	if rec.Code != 201 {
+		t.Fatalf("create webhook: %d %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "receiver-token") {
+		t.Errorf("response reveals the header value: %s", rec.Body)
+	}
+	var created WebhookResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if len(created.Headers) != 1 || created.Headers[0] != "Authorization" {
+		t.Errorf("headers = %v, want [Authorization]", created.Headers)
+	}
+
+	hook, err := srv.db.Query.GetWebhook(context.Background(), created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(hook.Headers, "receiver-token") {
+		t.Errorf("database row holds the header value: %s", hook.Headers)
+	}
+
+	var got string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+	}))
+	defer receiver.Close()
+	hook.Url = receiver.URL
+	if _, err := sendWebhook(receiver.Client(), hook, "finished", "delivery", []byte("{}")); err != nil {
+		t.Fatalf("sendWebhook: %v", err)
+	}
+	if got != "Bearer receiver-token" {
+		t.Errorf("delivery Authorization = %q, want the stored value", got)
+	}
+
+	if rec := send(t, engine, "DELETE", "/webhooks/"+created.ID, "", nil, nil); rec.Code != 200 {
+		t.Fatalf("delete webhook: %d %s", rec.Code, rec.Body)
+	}
+	if _, err := store.Reveal(webhookHeadersSecret(created.ID)); !errors.Is(err, manager.ErrSecretNotFound) {
+		t.Errorf("headers of the deleted webhook: %v, want %v", err, manager.ErrSecretNotFound)
+	}
+}